@@ -2,7 +2,10 @@ package config
 
 import (
 	"flag"
+	"fmt"
 	"github.com/jgrecu/redis-clone/app/resp"
+	"math"
+	"strconv"
 	"strings"
 	"sync"
 )
@@ -17,6 +20,9 @@ type Config struct {
 	MasterReplId     string
 	MasterReplOffset string
 	Offset           int
+	Databases        int
+	MaxMemory        string
+	MaxMemoryPolicy  string
 }
 
 var (
@@ -31,6 +37,8 @@ var (
 		"master_port":        &configs.MasterPort,
 		"master_replid":      &configs.MasterReplId,
 		"master_repl_offset": &configs.MasterReplOffset,
+		"maxmemory":          &configs.MaxMemory,
+		"maxmemory-policy":   &configs.MaxMemoryPolicy,
 	}
 )
 
@@ -40,11 +48,17 @@ func Get() *Config {
 		dbFileName := flag.String("dbfilename", "dump.rdb", "Filename to save the DB to")
 		port := flag.String("port", "6379", "Port to listen on")
 		replicaof := flag.String("replicaof", "", "Replicate to another Redis server")
+		databases := flag.Int("databases", 16, "Number of logical databases")
+		maxMemory := flag.String("maxmemory", "0", "Memory limit, such as 100mb; 0 means none")
+		maxMemoryPolicy := flag.String("maxmemory-policy", "noeviction", "Eviction policy applied at the memory limit")
 		flag.Parse()
 
 		configs.Dir = *dir
 		configs.DbFileName = *dbFileName
 		configs.Port = *port
+		configs.Databases = *databases
+		configs.MaxMemory = *maxMemory
+		configs.MaxMemoryPolicy = *maxMemoryPolicy
 		configs.Role = "master"
 
 		if *replicaof != "" {
@@ -78,6 +92,33 @@ func GetConfigHandler(params []resp.RESP) []byte {
 	return resp.Error("ERR wrong number of arguments for 'config' command").Marshal()
 }
 
+// ParseMemory parses a memory size in bytes, optionally followed by one of
+// the units k, kb, m, mb, g or gb. As in redis.conf, k, m and g are powers
+// of 1000 and kb, mb and gb powers of 1024.
+func ParseMemory(value string) (int64, error) {
+	units := []struct {
+		suffix string
+		scale  int64
+	}{
+		{"kb", 1 << 10}, {"mb", 1 << 20}, {"gb", 1 << 30},
+		{"k", 1000}, {"m", 1000 * 1000}, {"g", 1000 * 1000 * 1000},
+	}
+
+	number, scale := strings.ToLower(value), int64(1)
+	for _, unit := range units {
+		if strings.HasSuffix(number, unit.suffix) {
+			number, scale = strings.TrimSuffix(number, unit.suffix), unit.scale
+			break
+		}
+	}
+
+	n, err := strconv.ParseInt(number, 10, 64)
+	if err != nil || n < 0 || n > math.MaxInt64/scale {
+		return 0, fmt.Errorf("invalid memory size '%s'", value)
+	}
+	return n * scale, nil
+}
+
 func IncreaseOffset(num int) {
 	mu.Lock()
 	configs.Offset += num
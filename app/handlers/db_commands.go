@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"github.com/jgrecu/redis-clone/app/resp"
+	"strconv"
+	"strings"
+)
+
+// selectDB switches the router to another database. Routers belong to a
+// single connection, so this only affects the client that sent it.
+func (r *CommandRouter) selectDB(params []resp.RESP) []byte {
+	if len(params) != 1 {
+		return wrongArgs("select")
+	}
+
+	index, err := strconv.Atoi(params[0].Bulk)
+	if err != nil {
+		return resp.Error(errNotInteger).Marshal()
+	}
+	db, err := r.Store.Select(index)
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+	r.Store = db
+	return resp.String("OK").Marshal()
+}
+
+func (r *CommandRouter) swapdb(params []resp.RESP) []byte {
+	if len(params) != 2 {
+		return wrongArgs("swapdb")
+	}
+
+	a, err := strconv.Atoi(params[0].Bulk)
+	if err != nil {
+		return resp.Error("ERR invalid first DB index").Marshal()
+	}
+	b, err := strconv.Atoi(params[1].Bulk)
+	if err != nil {
+		return resp.Error("ERR invalid second DB index").Marshal()
+	}
+
+	if err := r.Store.SwapDB(a, b); err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+	return resp.String("OK").Marshal()
+}
+
+// flushdb empties the selected database. ASYNC and SYNC are accepted for
+// compatibility: the old keyspace is left to the garbage collector either
+// way, so a flush never blocks on its size.
+func (r *CommandRouter) flushdb(params []resp.RESP) []byte {
+	if !validFlushMode(params) {
+		return resp.Error("ERR syntax error").Marshal()
+	}
+	r.Store.FlushDB()
+	return resp.String("OK").Marshal()
+}
+
+// flushall empties every database; see flushdb for the ASYNC and SYNC
+// modes.
+func (r *CommandRouter) flushall(params []resp.RESP) []byte {
+	if !validFlushMode(params) {
+		return resp.Error("ERR syntax error").Marshal()
+	}
+	r.Store.FlushAll()
+	return resp.String("OK").Marshal()
+}
+
+// validFlushMode reports whether params hold at most one ASYNC or SYNC
+// flag.
+func validFlushMode(params []resp.RESP) bool {
+	switch len(params) {
+	case 0:
+		return true
+	case 1:
+		mode := strings.ToUpper(params[0].Bulk)
+		return mode == "ASYNC" || mode == "SYNC"
+	}
+	return false
+}
@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jgrecu/redis-clone/app/resp"
+	"github.com/jgrecu/redis-clone/app/structures"
+)
+
+func TestDBCommands(t *testing.T) {
+	ok := resp.String("OK").Marshal()
+	oneKey := func(s *structures.Store) { s.Set("a", "1", time.Time{}) }
+
+	tests := []commandTest{
+		{
+			name:     "SELECT",
+			setup:    oneKey,
+			command:  bulks("SELECT", "15"),
+			expected: ok,
+		},
+		{
+			name:     "SELECT out of range",
+			setup:    oneKey,
+			command:  bulks("SELECT", "16"),
+			expected: resp.Error("ERR DB index is out of range").Marshal(),
+		},
+		{
+			name:     "SELECT not an integer",
+			setup:    oneKey,
+			command:  bulks("SELECT", "x"),
+			expected: resp.Error("ERR value is not an integer or out of range").Marshal(),
+		},
+		{
+			name:     "SWAPDB",
+			setup:    oneKey,
+			command:  bulks("SWAPDB", "0", "1"),
+			expected: ok,
+		},
+		{
+			name:     "SWAPDB invalid first index",
+			setup:    oneKey,
+			command:  bulks("SWAPDB", "x", "1"),
+			expected: resp.Error("ERR invalid first DB index").Marshal(),
+		},
+		{
+			name:     "SWAPDB invalid second index",
+			setup:    oneKey,
+			command:  bulks("SWAPDB", "0", "x"),
+			expected: resp.Error("ERR invalid second DB index").Marshal(),
+		},
+		{
+			name:     "SWAPDB out of range",
+			setup:    oneKey,
+			command:  bulks("SWAPDB", "0", "99"),
+			expected: resp.Error("ERR DB index is out of range").Marshal(),
+		},
+		{
+			name:     "FLUSHDB",
+			setup:    oneKey,
+			command:  bulks("FLUSHDB"),
+			expected: ok,
+		},
+		{
+			name:     "FLUSHDB ASYNC",
+			setup:    oneKey,
+			command:  bulks("FLUSHDB", "async"),
+			expected: ok,
+		},
+		{
+			name:     "FLUSHALL SYNC",
+			setup:    oneKey,
+			command:  bulks("FLUSHALL", "SYNC"),
+			expected: ok,
+		},
+		{
+			name:     "FLUSHALL unknown mode",
+			setup:    oneKey,
+			command:  bulks("FLUSHALL", "LATER"),
+			expected: resp.Error("ERR syntax error").Marshal(),
+		},
+	}
+
+	runCommandTests(t, tests)
+}
+
+func TestSelect_OnlyAffectsItsConnection(t *testing.T) {
+	base := NewRouter(structures.NewStore())
+	first, second := base.ForConnection(nil), base.ForConnection(nil)
+
+	first.selectDB(bulks("1"))
+	first.set(bulks("k", "v"))
+
+	if got := second.get(bulks("k")); !reflect.DeepEqual(got, resp.Nil().Marshal()) {
+		t.Errorf("GET on db0 = %q, want nil", got)
+	}
+	second.selectDB(bulks("1"))
+	if got := second.get(bulks("k")); !reflect.DeepEqual(got, resp.Bulk("v").Marshal()) {
+		t.Errorf("GET on db1 = %q, want v", got)
+	}
+	if base.Store.DB() != 0 {
+		t.Errorf("base router DB = %d, want 0", base.Store.DB())
+	}
+}
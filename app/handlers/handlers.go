@@ -1,54 +1,321 @@
 package handlers
 
 import (
+	"fmt"
 	"github.com/jgrecu/redis-clone/app/config"
 	"github.com/jgrecu/redis-clone/app/resp"
 	"github.com/jgrecu/redis-clone/app/structures"
+	"math"
+	"strconv"
 	"strings"
 	"time"
 )
 
+const (
+	errNotInteger = "ERR value is not an integer or out of range"
+	errNotFloat   = "ERR value is not a valid float"
+)
+
 // CommandHandler is a function that processes a Redis command and returns
 // the RESP-encoded response.
 type CommandHandler func([]resp.RESP) []byte
 
 // CommandRouter routes Redis commands to their handler functions.
 // It holds a reference to the Store, keeping command logic decoupled
-// from storage internals.
+// from storage internals. Store selects the database the commands act on.
 type CommandRouter struct {
 	Store    *structures.Store
 	commands map[string]CommandHandler
+	// propagation holds the commands the running command asked to send to
+	// replicas in its place, when rewritten is set; see rewrite.
+	propagation [][]resp.RESP
+	rewritten   bool
 }
 
-// NewRouter creates a CommandRouter with all commands registered.
+// NewRouter creates a CommandRouter with all commands registered, running
+// them through its own view of store so that their effects can be told
+// apart from other clients'; see Replication.
 func NewRouter(store *structures.Store) *CommandRouter {
-	r := &CommandRouter{Store: store}
+	r := &CommandRouter{Store: store.WithEffects()}
 	r.commands = map[string]CommandHandler{
-		"PING":     r.ping,
-		"ECHO":     r.echo,
-		"GET":      r.get,
-		"SET":      r.set,
-		"KEYS":     r.keys,
-		"TYPE":     r.typ,
-		"INCR":     r.incr,
-		"INFO":     r.info,
-		"REPLCONF": r.replconf,
-		"PSYNC":    r.psync,
-		"XADD":     r.xadd,
-		"XRANGE":   r.xrange,
-		"XREAD":    r.xread,
-		"CONFIG":   config.GetConfigHandler,
+		"PING":             r.ping,
+		"ECHO":             r.echo,
+		"GET":              r.get,
+		"SET":              r.set,
+		"KEYS":             r.keys,
+		"TYPE":             r.typ,
+		"DEL":              r.del,
+		"UNLINK":           r.unlink,
+		"EXISTS":           r.exists,
+		"TOUCH":            r.touch,
+		"RENAME":           r.rename,
+		"RENAMENX":         r.renamenx,
+		"COPY":             r.copyCmd,
+		"MOVE":             r.move,
+		"RANDOMKEY":        r.randomkey,
+		"DBSIZE":           r.dbsize,
+		"MEMORY":           r.memory,
+		"OBJECT":           r.object,
+		"SELECT":           r.selectDB,
+		"SWAPDB":           r.swapdb,
+		"FLUSHDB":          r.flushdb,
+		"FLUSHALL":         r.flushall,
+		"SCAN":             r.scan,
+		"EXPIRE":           r.expire,
+		"PEXPIRE":          r.pexpire,
+		"EXPIREAT":         r.expireat,
+		"PEXPIREAT":        r.pexpireat,
+		"TTL":              r.ttl,
+		"PTTL":             r.pttl,
+		"EXPIRETIME":       r.expiretime,
+		"PEXPIRETIME":      r.pexpiretime,
+		"PERSIST":          r.persist,
+		"INCR":             r.incr,
+		"INCRBY":           r.incrby,
+		"DECR":             r.decr,
+		"DECRBY":           r.decrby,
+		"INCRBYFLOAT":      r.incrbyfloat,
+		"APPEND":           r.appendCmd,
+		"STRLEN":           r.strlen,
+		"GETRANGE":         r.getrange,
+		"SETRANGE":         r.setrange,
+		"GETDEL":           r.getdel,
+		"GETEX":            r.getex,
+		"GETSET":           r.getset,
+		"SETNX":            r.setnx,
+		"SETEX":            r.setex,
+		"PSETEX":           r.psetex,
+		"MGET":             r.mget,
+		"MSET":             r.mset,
+		"MSETNX":           r.msetnx,
+		"INFO":             r.info,
+		"REPLCONF":         r.replconf,
+		"PSYNC":            r.psync,
+		"XADD":             r.xadd,
+		"XLEN":             r.xlen,
+		"XDEL":             r.xdel,
+		"XTRIM":            r.xtrim,
+		"XRANGE":           r.xrange,
+		"XREAD":            r.xread,
+		"XREVRANGE":        r.xrevrange,
+		"XGROUP":           r.xgroup,
+		"XREADGROUP":       r.xreadgroup,
+		"XACK":             r.xack,
+		"XPENDING":         r.xpending,
+		"XCLAIM":           r.xclaim,
+		"XAUTOCLAIM":       r.xautoclaim,
+		"CONFIG":           config.GetConfigHandler,
+		"LPUSH":            r.lpush,
+		"RPUSH":            r.rpush,
+		"LPUSHX":           r.lpushx,
+		"RPUSHX":           r.rpushx,
+		"LPOP":             r.lpop,
+		"RPOP":             r.rpop,
+		"LRANGE":           r.lrange,
+		"LLEN":             r.llen,
+		"LINDEX":           r.lindex,
+		"LSET":             r.lset,
+		"LINSERT":          r.linsert,
+		"LREM":             r.lrem,
+		"LTRIM":            r.ltrim,
+		"LMOVE":            r.lmove,
+		"LMPOP":            r.lmpop,
+		"BLPOP":            r.blpop,
+		"BRPOP":            r.brpop,
+		"BLMOVE":           r.blmove,
+		"BLMPOP":           r.blmpop,
+		"HSET":             r.hset,
+		"HMSET":            r.hmset,
+		"HSETNX":           r.hsetnx,
+		"HGET":             r.hget,
+		"HMGET":            r.hmget,
+		"HDEL":             r.hdel,
+		"HGETALL":          r.hgetall,
+		"HKEYS":            r.hkeys,
+		"HVALS":            r.hvals,
+		"HEXISTS":          r.hexists,
+		"HLEN":             r.hlen,
+		"HSTRLEN":          r.hstrlen,
+		"HINCRBY":          r.hincrby,
+		"HINCRBYFLOAT":     r.hincrbyfloat,
+		"HEXPIRE":          r.hexpire,
+		"HPEXPIRE":         r.hpexpire,
+		"HEXPIREAT":        r.hexpireat,
+		"HPEXPIREAT":       r.hpexpireat,
+		"HTTL":             r.httl,
+		"HPTTL":            r.hpttl,
+		"HEXPIRETIME":      r.hexpiretime,
+		"HPEXPIRETIME":     r.hpexpiretime,
+		"HPERSIST":         r.hpersist,
+		"HSCAN":            r.hscan,
+		"SADD":             r.sadd,
+		"SREM":             r.srem,
+		"SMEMBERS":         r.smembers,
+		"SISMEMBER":        r.sismember,
+		"SMISMEMBER":       r.smismember,
+		"SCARD":            r.scard,
+		"SPOP":             r.spop,
+		"SRANDMEMBER":      r.srandmember,
+		"SMOVE":            r.smove,
+		"SINTER":           r.sinter,
+		"SUNION":           r.sunion,
+		"SDIFF":            r.sdiff,
+		"SINTERSTORE":      r.sinterstore,
+		"SUNIONSTORE":      r.sunionstore,
+		"SDIFFSTORE":       r.sdiffstore,
+		"SINTERCARD":       r.sintercard,
+		"SSCAN":            r.sscan,
+		"ZADD":             r.zadd,
+		"ZINCRBY":          r.zincrby,
+		"ZSCORE":           r.zscore,
+		"ZRANK":            r.zrank,
+		"ZREVRANK":         r.zrevrank,
+		"ZCARD":            r.zcard,
+		"ZREM":             r.zrem,
+		"ZRANGE":           r.zrange,
+		"ZREVRANGE":        r.zrevrange,
+		"ZRANGEBYSCORE":    r.zrangebyscore,
+		"ZREVRANGEBYSCORE": r.zrevrangebyscore,
+		"ZRANGEBYLEX":      r.zrangebylex,
+		"ZREVRANGEBYLEX":   r.zrevrangebylex,
+		"ZRANGESTORE":      r.zrangestore,
+		"ZCOUNT":           r.zcount,
+		"ZLEXCOUNT":        r.zlexcount,
+		"ZREMRANGEBYRANK":  r.zremrangebyrank,
+		"ZREMRANGEBYSCORE": r.zremrangebyscore,
+		"ZREMRANGEBYLEX":   r.zremrangebylex,
+		"ZPOPMIN":          r.zpopmin,
+		"ZPOPMAX":          r.zpopmax,
+		"BZPOPMIN":         r.bzpopmin,
+		"BZPOPMAX":         r.bzpopmax,
+		"ZMPOP":            r.zmpop,
+		"BZMPOP":           r.bzmpop,
+		"ZRANDMEMBER":      r.zrandmember,
+		"ZUNIONSTORE":      r.zunionstore,
+		"ZINTERSTORE":      r.zinterstore,
+		"ZDIFFSTORE":       r.zdiffstore,
+		"ZSCAN":            r.zscan,
 	}
 	return r
 }
 
+// ForConnection returns a router of its own for a client connection, on
+// the same database as r. Commands such as SELECT change the state of the
+// router they run on, so each connection needs a separate one. The
+// connection closes gone when it goes away, which cancels the command it
+// may be blocked in.
+func (r *CommandRouter) ForConnection(gone <-chan struct{}) *CommandRouter {
+	return NewRouter(r.Store.ForClient(gone))
+}
+
+// WithoutBlocking runs fn with the blocking commands of the router giving up
+// straight away when they cannot be served, as if their timeout had already
+// passed. EXEC runs the commands queued by MULTI this way, like Redis. The
+// database fn leaves selected stays selected.
+func (r *CommandRouter) WithoutBlocking(fn func()) {
+	r.Store = r.Store.WithBlocking(false)
+	defer func() { r.Store = r.Store.WithBlocking(true) }()
+	fn()
+}
+
+// denyOOM holds the commands that may grow the dataset. They are refused
+// while memory use is over maxmemory and nothing more can be evicted.
+var denyOOM = map[string]bool{
+	"SET": true, "SETNX": true, "SETEX": true, "PSETEX": true, "GETSET": true,
+	"APPEND": true, "SETRANGE": true, "MSET": true, "MSETNX": true,
+	"INCR": true, "INCRBY": true, "DECR": true, "DECRBY": true, "INCRBYFLOAT": true,
+	"LPUSH": true, "RPUSH": true, "LPUSHX": true, "RPUSHX": true, "LINSERT": true,
+	"LSET": true, "LMOVE": true, "BLMOVE": true,
+	"HSET": true, "HMSET": true, "HSETNX": true, "HINCRBY": true, "HINCRBYFLOAT": true,
+	"SADD": true, "SINTERSTORE": true, "SUNIONSTORE": true, "SDIFFSTORE": true,
+	"ZADD": true, "ZINCRBY": true, "ZRANGESTORE": true, "ZUNIONSTORE": true,
+	"ZINTERSTORE": true, "ZDIFFSTORE": true,
+	"XADD": true, "XGROUP": true, "COPY": true,
+}
+
 // GetHandler returns the handler for the given command, or notFound if unknown.
+// Every command first evicts keys as needed to honour maxmemory; those in
+// denyOOM fail with an OOM error if that is not enough. Effects of earlier
+// commands not taken by Replication are dropped.
 func (r *CommandRouter) GetHandler(command string) CommandHandler {
 	handler, ok := r.commands[command]
 	if !ok {
 		return notFound
 	}
-	return handler
+	return func(params []resp.RESP) []byte {
+		r.propagation, r.rewritten = nil, false
+		r.Store.TakeEffects()
+		if err := r.Store.FreeMemory(); err != nil && denyOOM[command] {
+			r.rewrite()
+			return resp.Error(err.Error()).Marshal()
+		}
+		return handler(params)
+	}
+}
+
+// rewrite makes the running command propagate to replicas as commands
+// instead of itself, for commands whose effect depends on the clock or on
+// what they found, such as an ID generated by XADD. It may be called more
+// than once; without commands, nothing is propagated.
+func (r *CommandRouter) rewrite(commands ...resp.RESP) {
+	r.rewritten = true
+	for _, command := range commands {
+		r.propagation = append(r.propagation, command.Array)
+	}
+}
+
+// rewriteExpiry makes a command that set the expiry of key to at propagate
+// as PEXPIREAT with the absolute deadline, so that replicas count it from
+// the same instant as the master, or as DEL if the deadline had passed and
+// the key is gone.
+func (r *CommandRouter) rewriteExpiry(key string, at time.Time) {
+	if !at.After(time.Now()) {
+		r.rewrite(resp.Command("DEL", key))
+		return
+	}
+	r.rewrite(resp.Command("PEXPIREAT", key, formatUnixMillis(at)))
+}
+
+// Propagation returns the commands to send to replicas for args, the last
+// command the router ran: args itself unless its handler rewrote it.
+func (r *CommandRouter) Propagation(args []resp.RESP) [][]resp.RESP {
+	if !r.rewritten {
+		return [][]resp.RESP{args}
+	}
+	return r.propagation
+}
+
+// Replicated is a command to send to replicas, with the index of the
+// database it applies to.
+type Replicated struct {
+	DB      int
+	Command []resp.RESP
+}
+
+// Replication returns everything to send to replicas after running args,
+// in order: the effects the store had ahead of the command's writes, such
+// as deleting the expired keys it met, then its Propagation if it is a
+// write, then the effects its writes caused. Any command may have effects.
+func (r *CommandRouter) Replication(args []resp.RESP, write bool) []Replicated {
+	before, after := r.Store.TakeEffects()
+	var replicated []Replicated
+	for _, effect := range before {
+		replicated = append(replicated, replicatedEffect(effect))
+	}
+	if write {
+		for _, command := range r.Propagation(args) {
+			replicated = append(replicated, Replicated{r.Store.DB(), command})
+		}
+	}
+	for _, effect := range after {
+		replicated = append(replicated, replicatedEffect(effect))
+	}
+	return replicated
+}
+
+// replicatedEffect returns the command replicas must apply for effect.
+func replicatedEffect(effect structures.Effect) Replicated {
+	return Replicated{effect.DB, resp.Command(effect.Args[0], effect.Args[1:]...).Array}
 }
 
 func (r *CommandRouter) ping(params []resp.RESP) []byte {
@@ -63,12 +330,51 @@ func notFound(params []resp.RESP) []byte {
 	return resp.Error("Command not found").Marshal()
 }
 
+// wrongArgs returns the arity error for the given lowercase command name.
+func wrongArgs(command string) []byte {
+	return resp.Error(fmt.Sprintf("ERR wrong number of arguments for '%s' command", command)).Marshal()
+}
+
+// parseTimeout parses a blocking command timeout given in (possibly
+// fractional) seconds. Zero means block forever.
+func parseTimeout(value string) (time.Duration, error) {
+	seconds, err := strconv.ParseFloat(value, 64)
+	if err != nil || math.IsNaN(seconds) || math.IsInf(seconds, 0) {
+		return 0, fmt.Errorf("ERR timeout is not a float or out of range")
+	}
+	if seconds < 0 {
+		return 0, fmt.Errorf("ERR timeout is negative")
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+// bulkArray converts a slice of strings into a RESP array of bulk strings.
+func bulkArray(values []string) resp.RESP {
+	result := make([]resp.RESP, len(values))
+	for i, v := range values {
+		result[i] = resp.Bulk(v)
+	}
+	return resp.Array(result...)
+}
+
+// bulkParams returns the Bulk value of each param.
+func bulkParams(params []resp.RESP) []string {
+	values := make([]string, len(params))
+	for i, p := range params {
+		values[i] = p.Bulk
+	}
+	return values
+}
+
 func (r *CommandRouter) get(params []resp.RESP) []byte {
 	if len(params) != 1 {
 		return resp.Error("ERR wrong number of arguments for 'get' command").Marshal()
 	}
 
-	value, ok := r.Store.Get(params[0].Bulk)
+	value, ok, err := r.Store.Get(params[0].Bulk)
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
 	if !ok {
 		return resp.Nil().Marshal()
 	}
@@ -81,28 +387,125 @@ func (r *CommandRouter) set(params []resp.RESP) []byte {
 		return resp.Error("ERR wrong number of arguments for 'set' command").Marshal()
 	}
 
-	expiry := time.Time{}
-	if len(params) >= 4 && strings.ToUpper(params[2].Bulk) == "PX" {
-		d, err := time.ParseDuration(params[3].Bulk + "ms")
-		if err != nil {
-			return resp.Error("ERR invalid expire time in set command").Marshal()
-		}
-		expiry = time.Now().Add(d)
+	opts, err := parseSetOptions(params[2:])
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+
+	old, hadOld, stored, err := r.Store.SetWithOptions(params[0].Bulk, params[1].Bulk, opts)
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+	r.rewrite()
+	if stored {
+		r.rewrite(setPropagation(params, opts))
 	}
 
-	r.Store.Set(params[0].Bulk, params[1].Bulk, expiry)
+	switch {
+	case opts.Get && hadOld:
+		return resp.Bulk(old).Marshal()
+	case opts.Get || !stored:
+		return resp.Nil().Marshal()
+	}
 	return resp.String("OK").Marshal()
 }
 
+// parseSetOptions parses the options of SET, which may come in any order.
+func parseSetOptions(params []resp.RESP) (structures.SetOptions, error) {
+	var opts structures.SetOptions
+	hasExpiry := false
+
+	for i := 0; i < len(params); i++ {
+		opt := strings.ToUpper(params[i].Bulk)
+		switch {
+		case opt == "NX" && !opts.XX:
+			opts.NX = true
+		case opt == "XX" && !opts.NX:
+			opts.XX = true
+		case opt == "GET":
+			opts.Get = true
+		case opt == "KEEPTTL" && !hasExpiry:
+			opts.KeepTTL = true
+		case (opt == "EX" || opt == "PX" || opt == "EXAT" || opt == "PXAT") &&
+			!hasExpiry && !opts.KeepTTL && i+1 < len(params):
+			amount, err := strconv.ParseInt(params[i+1].Bulk, 10, 64)
+			if err != nil {
+				return opts, fmt.Errorf(errNotInteger)
+			}
+			unit := time.Second
+			if opt == "PX" || opt == "PXAT" {
+				unit = time.Millisecond
+			}
+			at, ok := expireAt(amount, unit, strings.HasSuffix(opt, "AT"))
+			if amount <= 0 || !ok {
+				return opts, fmt.Errorf("ERR invalid expire time in 'set' command")
+			}
+			opts.Expiry = at
+			hasExpiry = true
+			i++
+		default:
+			return opts, fmt.Errorf("ERR syntax error")
+		}
+	}
+	return opts, nil
+}
+
+// setPropagation returns the SET that replicas apply for a SET with params
+// and their parsed opts: the expiry becomes PXAT with the master's deadline,
+// and GET, whose reply replicas drop, goes. Other options are kept.
+func setPropagation(params []resp.RESP, opts structures.SetOptions) resp.RESP {
+	args := bulkParams(params[:2])
+	for i := 2; i < len(params); i++ {
+		switch strings.ToUpper(params[i].Bulk) {
+		case "GET":
+		case "EX", "PX", "EXAT", "PXAT":
+			i++
+		default:
+			args = append(args, params[i].Bulk)
+		}
+	}
+	if !opts.Expiry.IsZero() {
+		args = append(args, "PXAT", formatUnixMillis(opts.Expiry))
+	}
+	return resp.Command("SET", args...)
+}
+
+// expireAt converts an expire time in the given unit into a deadline. The
+// amount is relative to now unless absolute is set, in which case it is a
+// unix time. It reports false if the deadline overflows.
+func expireAt(amount int64, unit time.Duration, absolute bool) (time.Time, bool) {
+	perMs := int64(unit / time.Millisecond)
+	if amount > math.MaxInt64/perMs || amount < math.MinInt64/perMs {
+		return time.Time{}, false
+	}
+
+	ms := amount * perMs
+	if !absolute {
+		now := time.Now().UnixMilli()
+		if ms > math.MaxInt64-now {
+			return time.Time{}, false
+		}
+		ms += now
+	}
+	return time.UnixMilli(ms), true
+}
+
+// formatUnixMillis formats a deadline as the unix time in milliseconds that PXAT
+// and PEXPIREAT take.
+func formatUnixMillis(at time.Time) string {
+	return strconv.FormatInt(at.UnixMilli(), 10)
+}
+
 func (r *CommandRouter) keys(params []resp.RESP) []byte {
 	if len(params) != 1 {
 		return resp.Error("ERR wrong number of arguments for 'keys' command").Marshal()
 	}
 
-	keys := r.Store.Keys()
-	result := make([]resp.RESP, len(keys))
-	for i, k := range keys {
-		result[i] = resp.Bulk(k)
+	result := []resp.RESP{}
+	for _, k := range r.Store.Keys() {
+		if structures.MatchGlob(params[0].Bulk, k) {
+			result = append(result, resp.Bulk(k))
+		}
 	}
 	return resp.Array(result...).Marshal()
 }
@@ -123,10 +526,5 @@ func (r *CommandRouter) incr(params []resp.RESP) []byte {
 	if len(params) != 1 {
 		return resp.Error("ERR wrong number of arguments for 'incr' command").Marshal()
 	}
-
-	value, err := r.Store.Incr(params[0].Bulk)
-	if err != nil {
-		return resp.Error("ERR value is not an integer or out of range").Marshal()
-	}
-	return resp.Integer(value).Marshal()
+	return r.incrBy(params[0].Bulk, 1)
 }
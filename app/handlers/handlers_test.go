@@ -13,6 +13,89 @@ func newTestRouter() *CommandRouter {
 	return NewRouter(structures.NewStore())
 }
 
+// replicate runs the command args on master, then on replica whatever master
+// replicates for it, and returns the reply of master. Both must be on the
+// database the replicated commands apply to.
+func replicate(master, replica *CommandRouter, args ...string) []byte {
+	command := bulks(args...)
+	reply := master.GetHandler(strings.ToUpper(args[0]))(command[1:])
+	for _, replicated := range master.Replication(command, true) {
+		replica.GetHandler(strings.ToUpper(replicated.Command[0].Bulk))(replicated.Command[1:])
+	}
+	return reply
+}
+
+// wrongType is the reply to a command run against a key of another type.
+var wrongType = resp.Error(structures.ErrWrongType.Error()).Marshal()
+
+// commandTest is a row of a table of command tests: command, run on a fresh
+// store prepared by setup, must reply expected.
+type commandTest struct {
+	name     string
+	setup    func(s *structures.Store)
+	command  []resp.RESP
+	expected []byte
+}
+
+// runCommandTests runs each of tests as a subtest.
+func runCommandTests(t *testing.T, tests []commandTest) {
+	t.Helper()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := structures.NewStore()
+			tt.setup(store)
+			router := NewRouter(store)
+
+			result := router.GetHandler(tt.command[0].Bulk)(tt.command[1:])
+			if !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("got %q, want %q", string(result), string(tt.expected))
+			}
+		})
+	}
+}
+
+// propagated runs the command args on r and returns what it propagates.
+func propagated(r *CommandRouter, args ...string) [][]resp.RESP {
+	command := bulks(args...)
+	r.GetHandler(strings.ToUpper(args[0]))(command[1:])
+	return r.Propagation(command)
+}
+
+// servedReplication runs the blocking command blockArgs on a connection of
+// r until the command writeArgs, run on another, serves it, and returns what
+// the writer replicates. The served command must replicate nothing itself:
+// its effect goes with the write, so replicas apply it after the write
+// whatever the order the two connections get to propagate in.
+func servedReplication(t *testing.T, r *CommandRouter, key string, blockArgs []string, writeArgs ...string) [][]resp.RESP {
+	t.Helper()
+	waiter, writer := r.ForConnection(nil), r.ForConnection(nil)
+	waited := make(chan []Replicated)
+	go func() {
+		command := bulks(blockArgs...)
+		waiter.GetHandler(strings.ToUpper(blockArgs[0]))(command[1:])
+		waited <- waiter.Replication(command, true)
+	}()
+
+	deadline := time.Now().Add(time.Second)
+	for r.Store.BlockedCount(key) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("%v never blocked on %s", blockArgs, key)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	command := bulks(writeArgs...)
+	writer.GetHandler(strings.ToUpper(writeArgs[0]))(command[1:])
+	var commands [][]resp.RESP
+	for _, replicated := range writer.Replication(command, true) {
+		commands = append(commands, replicated.Command)
+	}
+	if served := <-waited; len(served) != 0 {
+		t.Errorf("%v replicated %v itself, want nothing", blockArgs, served)
+	}
+	return commands
+}
+
 func TestGetHandler(t *testing.T) {
 	router := newTestRouter()
 
@@ -173,6 +256,12 @@ func TestGet(t *testing.T) {
 			params:   []resp.RESP{{Type: "bulk", Bulk: "nonExistingKey"}},
 			expected: resp.Nil().Marshal(),
 		},
+		{
+			name:     "Get against a hash",
+			setup:    func(s *structures.Store) { s.HSet("h", map[string]string{"f": "v"}) },
+			params:   bulks("h"),
+			expected: resp.Error(structures.ErrWrongType.Error()).Marshal(),
+		},
 		{
 			name:     "Get with wrong number of arguments",
 			setup:    func(s *structures.Store) {},
@@ -235,7 +324,7 @@ func TestSet(t *testing.T) {
 			},
 			expected: resp.String("OK").Marshal(),
 			check: func(s *structures.Store) bool {
-				v, ok := s.Get("key")
+				v, ok, _ := s.Get("key")
 				return ok && v == "val"
 			},
 		},
@@ -249,7 +338,7 @@ func TestSet(t *testing.T) {
 			},
 			expected: resp.String("OK").Marshal(),
 			check: func(s *structures.Store) bool {
-				v, ok := s.Get("expiryKey")
+				v, ok, _ := s.Get("expiryKey")
 				return ok && v == "expiryValue"
 			},
 		},
@@ -269,7 +358,7 @@ func TestSet(t *testing.T) {
 				{Type: "bulk", Bulk: "PX"},
 				{Type: "bulk", Bulk: "notanumber"},
 			},
-			expected: resp.Error("ERR invalid expire time in set command").Marshal(),
+			expected: resp.Error(errNotInteger).Marshal(),
 			check:    func(s *structures.Store) bool { return true },
 		},
 		{
@@ -282,12 +371,12 @@ func TestSet(t *testing.T) {
 			},
 			expected: resp.String("OK").Marshal(),
 			check: func(s *structures.Store) bool {
-				v, ok := s.Get("k")
+				v, ok, _ := s.Get("k")
 				return ok && v == "v"
 			},
 		},
 		{
-			name: "Set with non-PX flag is ignored",
+			name: "Set with EX expiry",
 			params: []resp.RESP{
 				{Type: "bulk", Bulk: "k"},
 				{Type: "bulk", Bulk: "v"},
@@ -296,7 +385,7 @@ func TestSet(t *testing.T) {
 			},
 			expected: resp.String("OK").Marshal(),
 			check: func(s *structures.Store) bool {
-				_, ok := s.Get("k")
+				_, ok, _ := s.Get("k")
 				return ok
 			},
 		},
@@ -318,6 +407,134 @@ func TestSet(t *testing.T) {
 	}
 }
 
+func TestSetOptions(t *testing.T) {
+	tests := []struct {
+		name     string
+		setup    func(s *structures.Store)
+		params   []resp.RESP
+		expected []byte
+	}{
+		{
+			name:     "NX on missing key",
+			setup:    func(s *structures.Store) {},
+			params:   bulks("k", "v", "NX"),
+			expected: resp.String("OK").Marshal(),
+		},
+		{
+			name:     "NX on existing key",
+			setup:    func(s *structures.Store) { s.Set("k", "old", time.Time{}) },
+			params:   bulks("k", "v", "NX"),
+			expected: resp.Nil().Marshal(),
+		},
+		{
+			name:     "XX on missing key",
+			setup:    func(s *structures.Store) {},
+			params:   bulks("k", "v", "XX"),
+			expected: resp.Nil().Marshal(),
+		},
+		{
+			name:     "GET returns old value",
+			setup:    func(s *structures.Store) { s.Set("k", "old", time.Time{}) },
+			params:   bulks("k", "v", "EX", "10", "GET"),
+			expected: resp.Bulk("old").Marshal(),
+		},
+		{
+			name:     "GET on missing key",
+			setup:    func(s *structures.Store) {},
+			params:   bulks("k", "v", "GET"),
+			expected: resp.Nil().Marshal(),
+		},
+		{
+			name:     "GET against list",
+			setup:    func(s *structures.Store) { s.RPush("k", false, "a") },
+			params:   bulks("k", "v", "GET"),
+			expected: resp.Error(structures.ErrWrongType.Error()).Marshal(),
+		},
+		{
+			name:     "options in any order",
+			setup:    func(s *structures.Store) {},
+			params:   bulks("k", "v", "pxat", "99999999999999", "nx"),
+			expected: resp.String("OK").Marshal(),
+		},
+		{
+			name:     "NX and XX",
+			setup:    func(s *structures.Store) {},
+			params:   bulks("k", "v", "NX", "XX"),
+			expected: resp.Error("ERR syntax error").Marshal(),
+		},
+		{
+			name:     "EX and PX",
+			setup:    func(s *structures.Store) {},
+			params:   bulks("k", "v", "EX", "1", "PX", "1"),
+			expected: resp.Error("ERR syntax error").Marshal(),
+		},
+		{
+			name:     "KEEPTTL and EX",
+			setup:    func(s *structures.Store) {},
+			params:   bulks("k", "v", "KEEPTTL", "EX", "1"),
+			expected: resp.Error("ERR syntax error").Marshal(),
+		},
+		{
+			name:     "EX without value",
+			setup:    func(s *structures.Store) {},
+			params:   bulks("k", "v", "EX"),
+			expected: resp.Error("ERR syntax error").Marshal(),
+		},
+		{
+			name:     "zero EX",
+			setup:    func(s *structures.Store) {},
+			params:   bulks("k", "v", "EX", "0"),
+			expected: resp.Error("ERR invalid expire time in 'set' command").Marshal(),
+		},
+		{
+			name:     "overflowing EX",
+			setup:    func(s *structures.Store) {},
+			params:   bulks("k", "v", "EX", "9223372036854775807"),
+			expected: resp.Error("ERR invalid expire time in 'set' command").Marshal(),
+		},
+		{
+			name:     "unknown option",
+			setup:    func(s *structures.Store) {},
+			params:   bulks("k", "v", "FOREVER"),
+			expected: resp.Error("ERR syntax error").Marshal(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := structures.NewStore()
+			tt.setup(store)
+			router := NewRouter(store)
+
+			result := router.set(tt.params)
+			if !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("set() = %q, want %q", string(result), string(tt.expected))
+			}
+		})
+	}
+}
+
+func TestSet_Propagation(t *testing.T) {
+	router := newTestRouter()
+
+	got := propagated(router, "SET", "k", "v", "EX", "100", "GET", "XX")
+	if len(got) != 0 {
+		t.Errorf("Propagation of a SET that stored nothing = %v, want none", got)
+	}
+
+	// A relative TTL goes to replicas as the deadline the master computed,
+	// and GET, whose reply they drop, goes.
+	got = propagated(router, "SET", "k", "v", "nx", "EX", "100", "GET")
+	at, _ := router.Store.ExpiryTime("k")
+	if want := [][]resp.RESP{bulks("SET", "k", "v", "nx", "PXAT", formatUnixMillis(at))}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Propagation of SET EX = %v, want %v", got, want)
+	}
+	got = propagated(router, "SET", "k", "w", "KEEPTTL")
+	if want := [][]resp.RESP{bulks("SET", "k", "w", "KEEPTTL")}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Propagation of SET KEEPTTL = %v, want %v", got, want)
+	}
+}
+
 func TestKeys(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -355,6 +572,17 @@ func TestKeys(t *testing.T) {
 					strings.Contains(r, "k2")
 			},
 		},
+		{
+			name: "Pattern",
+			setup: func(s *structures.Store) {
+				s.Set("user:1", "v1", time.Time{})
+				s.Set("session:1", "v2", time.Time{})
+			},
+			params: []resp.RESP{{Type: "bulk", Bulk: "user:*"}},
+			checkFn: func(result []byte) bool {
+				return string(result) == string(resp.Array(resp.Bulk("user:1")).Marshal())
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -431,6 +659,20 @@ func TestTyp(t *testing.T) {
 	}
 }
 
+func TestInfoStats(t *testing.T) {
+	store := structures.NewStore()
+	store.Set("gone", "v", time.Now().Add(-time.Second))
+	store.Get("gone")
+	router := NewRouter(store)
+
+	result := string(router.info([]resp.RESP{{Type: "bulk", Bulk: "stats"}}))
+	for _, field := range []string{"expired_keys:1", "expired_stale_perc:0.00", "expired_time_cap_reached_count:0", "expire_cycle_cpu_milliseconds:0"} {
+		if !strings.Contains(result, field) {
+			t.Errorf("info(stats) = %q, missing %q", result, field)
+		}
+	}
+}
+
 func TestIncr(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -516,6 +758,13 @@ func TestXadd(t *testing.T) {
 				return reflect.DeepEqual(result, resp.Bulk("1-1").Marshal())
 			},
 		},
+		{
+			name:   "Bare millisecond ID",
+			params: bulks("s", "5", "f", "v"),
+			checkFn: func(result []byte) bool {
+				return reflect.DeepEqual(result, resp.Bulk("5-0").Marshal())
+			},
+		},
 		{
 			name: "Invalid ID 0-0",
 			params: []resp.RESP{
@@ -568,7 +817,7 @@ func TestXRange(t *testing.T) {
 				{Type: "bulk", Bulk: "+"},
 			},
 			checkFn: func(result []byte) bool {
-				return reflect.DeepEqual(result, resp.Nil().Marshal())
+				return reflect.DeepEqual(result, resp.Array().Marshal())
 			},
 		},
 		{
@@ -582,7 +831,7 @@ func TestXRange(t *testing.T) {
 				{Type: "bulk", Bulk: "+"},
 			},
 			checkFn: func(result []byte) bool {
-				return reflect.DeepEqual(result, resp.Nil().Marshal())
+				return reflect.DeepEqual(result, resp.Error(structures.ErrWrongType.Error()).Marshal())
 			},
 		},
 	}
@@ -0,0 +1,436 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/jgrecu/redis-clone/app/resp"
+	"github.com/jgrecu/redis-clone/app/structures"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func (r *CommandRouter) hset(params []resp.RESP) []byte {
+	if len(params) < 3 || len(params)%2 != 1 {
+		return wrongArgs("hset")
+	}
+
+	added, err := r.Store.HSet(params[0].Bulk, fieldPairs(params[1:]))
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+	return resp.Integer(added).Marshal()
+}
+
+func (r *CommandRouter) hmset(params []resp.RESP) []byte {
+	if len(params) < 3 || len(params)%2 != 1 {
+		return wrongArgs("hmset")
+	}
+
+	if _, err := r.Store.HSet(params[0].Bulk, fieldPairs(params[1:])); err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+	return resp.String("OK").Marshal()
+}
+
+// fieldPairs converts alternating field/value params into a map.
+func fieldPairs(params []resp.RESP) map[string]string {
+	pairs := make(map[string]string, len(params)/2)
+	for i := 0; i+1 < len(params); i += 2 {
+		pairs[params[i].Bulk] = params[i+1].Bulk
+	}
+	return pairs
+}
+
+func (r *CommandRouter) hsetnx(params []resp.RESP) []byte {
+	if len(params) != 3 {
+		return wrongArgs("hsetnx")
+	}
+
+	set, err := r.Store.HSetNX(params[0].Bulk, params[1].Bulk, params[2].Bulk)
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+	return resp.Integer(boolToInt(set)).Marshal()
+}
+
+func (r *CommandRouter) hget(params []resp.RESP) []byte {
+	if len(params) != 2 {
+		return wrongArgs("hget")
+	}
+
+	value, ok, err := r.Store.HGet(params[0].Bulk, params[1].Bulk)
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+	if !ok {
+		return resp.Nil().Marshal()
+	}
+	return resp.Bulk(value).Marshal()
+}
+
+func (r *CommandRouter) hmget(params []resp.RESP) []byte {
+	if len(params) < 2 {
+		return wrongArgs("hmget")
+	}
+
+	fields := make([]string, 0, len(params)-1)
+	for _, p := range params[1:] {
+		fields = append(fields, p.Bulk)
+	}
+
+	values, found, err := r.Store.HMGet(params[0].Bulk, fields...)
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+
+	result := make([]resp.RESP, len(values))
+	for i, v := range values {
+		if found[i] {
+			result[i] = resp.Bulk(v)
+		} else {
+			result[i] = resp.Nil()
+		}
+	}
+	return resp.Array(result...).Marshal()
+}
+
+func (r *CommandRouter) hdel(params []resp.RESP) []byte {
+	if len(params) < 2 {
+		return wrongArgs("hdel")
+	}
+
+	fields := make([]string, 0, len(params)-1)
+	for _, p := range params[1:] {
+		fields = append(fields, p.Bulk)
+	}
+
+	removed, err := r.Store.HDel(params[0].Bulk, fields...)
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+	return resp.Integer(removed).Marshal()
+}
+
+func (r *CommandRouter) hgetall(params []resp.RESP) []byte {
+	if len(params) != 1 {
+		return wrongArgs("hgetall")
+	}
+
+	all, err := r.Store.HGetAll(params[0].Bulk)
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+
+	result := make([]resp.RESP, 0, len(all)*2)
+	for field, value := range all {
+		result = append(result, resp.Bulk(field), resp.Bulk(value))
+	}
+	return resp.Array(result...).Marshal()
+}
+
+func (r *CommandRouter) hkeys(params []resp.RESP) []byte {
+	if len(params) != 1 {
+		return wrongArgs("hkeys")
+	}
+
+	all, err := r.Store.HGetAll(params[0].Bulk)
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+
+	result := make([]resp.RESP, 0, len(all))
+	for field := range all {
+		result = append(result, resp.Bulk(field))
+	}
+	return resp.Array(result...).Marshal()
+}
+
+func (r *CommandRouter) hvals(params []resp.RESP) []byte {
+	if len(params) != 1 {
+		return wrongArgs("hvals")
+	}
+
+	all, err := r.Store.HGetAll(params[0].Bulk)
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+
+	result := make([]resp.RESP, 0, len(all))
+	for _, value := range all {
+		result = append(result, resp.Bulk(value))
+	}
+	return resp.Array(result...).Marshal()
+}
+
+func (r *CommandRouter) hexists(params []resp.RESP) []byte {
+	if len(params) != 2 {
+		return wrongArgs("hexists")
+	}
+
+	_, ok, err := r.Store.HGet(params[0].Bulk, params[1].Bulk)
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+	return resp.Integer(boolToInt(ok)).Marshal()
+}
+
+func (r *CommandRouter) hlen(params []resp.RESP) []byte {
+	if len(params) != 1 {
+		return wrongArgs("hlen")
+	}
+
+	length, err := r.Store.HLen(params[0].Bulk)
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+	return resp.Integer(length).Marshal()
+}
+
+func (r *CommandRouter) hstrlen(params []resp.RESP) []byte {
+	if len(params) != 2 {
+		return wrongArgs("hstrlen")
+	}
+
+	value, _, err := r.Store.HGet(params[0].Bulk, params[1].Bulk)
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+	return resp.Integer(len(value)).Marshal()
+}
+
+func (r *CommandRouter) hincrby(params []resp.RESP) []byte {
+	if len(params) != 3 {
+		return wrongArgs("hincrby")
+	}
+
+	delta, err := strconv.ParseInt(params[2].Bulk, 10, 64)
+	if err != nil {
+		return resp.Error(errNotInteger).Marshal()
+	}
+
+	value, err := r.Store.HIncrBy(params[0].Bulk, params[1].Bulk, delta)
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+	return resp.Integer(int(value)).Marshal()
+}
+
+func (r *CommandRouter) hincrbyfloat(params []resp.RESP) []byte {
+	if len(params) != 3 {
+		return wrongArgs("hincrbyfloat")
+	}
+
+	delta, err := strconv.ParseFloat(params[2].Bulk, 64)
+	if err != nil || math.IsNaN(delta) || math.IsInf(delta, 0) {
+		return resp.Error(errNotFloat).Marshal()
+	}
+
+	value, err := r.Store.HIncrByFloat(params[0].Bulk, params[1].Bulk, delta)
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+	return resp.Bulk(value).Marshal()
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// parseFields parses the trailing "FIELDS numfields field [field ...]"
+// arguments of the hash field expiry commands.
+func parseFields(params []resp.RESP) ([]string, error) {
+	if len(params) < 2 || strings.ToUpper(params[0].Bulk) != "FIELDS" {
+		return nil, fmt.Errorf("ERR Mandatory argument FIELDS is missing or not at the right position")
+	}
+
+	numFields, err := strconv.Atoi(params[1].Bulk)
+	if err != nil || numFields <= 0 {
+		return nil, fmt.Errorf("ERR Parameter `numFields` should be greater than 0")
+	}
+	if numFields != len(params)-2 {
+		return nil, fmt.Errorf("ERR The `numfields` parameter must match the number of arguments")
+	}
+
+	fields := make([]string, 0, numFields)
+	for _, p := range params[2:] {
+		fields = append(fields, p.Bulk)
+	}
+	return fields, nil
+}
+
+func (r *CommandRouter) hexpire(params []resp.RESP) []byte {
+	return r.hexpireGeneric("hexpire", params, time.Second, false)
+}
+
+func (r *CommandRouter) hpexpire(params []resp.RESP) []byte {
+	return r.hexpireGeneric("hpexpire", params, time.Millisecond, false)
+}
+
+func (r *CommandRouter) hexpireat(params []resp.RESP) []byte {
+	return r.hexpireGeneric("hexpireat", params, time.Second, true)
+}
+
+func (r *CommandRouter) hpexpireat(params []resp.RESP) []byte {
+	return r.hexpireGeneric("hpexpireat", params, time.Millisecond, true)
+}
+
+func (r *CommandRouter) hexpireGeneric(name string, params []resp.RESP, unit time.Duration, absolute bool) []byte {
+	if len(params) < 5 {
+		return wrongArgs(name)
+	}
+
+	amount, err := strconv.ParseInt(params[1].Bulk, 10, 64)
+	if err != nil {
+		return resp.Error(errNotInteger).Marshal()
+	}
+	if amount < 0 {
+		return resp.Error("ERR invalid expire time, must be >= 0").Marshal()
+	}
+	at, ok := expireAt(amount, unit, absolute)
+	if !ok {
+		return resp.Error(fmt.Sprintf("ERR invalid expire time in '%s' command", name)).Marshal()
+	}
+
+	rest := params[2:]
+	cond := ""
+	switch strings.ToUpper(rest[0].Bulk) {
+	case "NX", "XX", "GT", "LT":
+		cond = strings.ToUpper(rest[0].Bulk)
+		rest = rest[1:]
+	}
+
+	fields, err := parseFields(rest)
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+
+	key := params[0].Bulk
+	codes, err := r.Store.HExpire(key, at, cond, fields)
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+	r.rewriteHExpire(key, at, fields, codes)
+	return integerArray(codes).Marshal()
+}
+
+// rewriteHExpire makes a hash field expiry command propagate as HPEXPIREAT
+// with the master's deadline for the fields it updated, and as HDEL for
+// those it deleted because the deadline had passed.
+func (r *CommandRouter) rewriteHExpire(key string, at time.Time, fields []string, codes []int) {
+	var updated, deleted []string
+	for i, code := range codes {
+		switch code {
+		case structures.FieldUpdated:
+			updated = append(updated, fields[i])
+		case structures.FieldDeletedByTTL:
+			deleted = append(deleted, fields[i])
+		}
+	}
+
+	r.rewrite()
+	if len(updated) > 0 {
+		args := append([]string{key, formatUnixMillis(at), "FIELDS", strconv.Itoa(len(updated))}, updated...)
+		r.rewrite(resp.Command("HPEXPIREAT", args...))
+	}
+	if len(deleted) > 0 {
+		r.rewrite(resp.Command("HDEL", append([]string{key}, deleted...)...))
+	}
+}
+
+func (r *CommandRouter) httl(params []resp.RESP) []byte {
+	return r.hexpiryGeneric("httl", params, ttlSeconds)
+}
+
+func (r *CommandRouter) hpttl(params []resp.RESP) []byte {
+	return r.hexpiryGeneric("hpttl", params, ttlMillis)
+}
+
+func (r *CommandRouter) hexpiretime(params []resp.RESP) []byte {
+	return r.hexpiryGeneric("hexpiretime", params, unixSeconds)
+}
+
+func (r *CommandRouter) hpexpiretime(params []resp.RESP) []byte {
+	return r.hexpiryGeneric("hpexpiretime", params, unixMillis)
+}
+
+// hexpiryGeneric replies with convert(expiry) for each requested field, or
+// -2 for missing fields and -1 for fields without an expiry.
+func (r *CommandRouter) hexpiryGeneric(name string, params []resp.RESP, convert func(time.Time) int) []byte {
+	if len(params) < 3 {
+		return wrongArgs(name)
+	}
+
+	fields, err := parseFields(params[1:])
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+
+	times, found, err := r.Store.HExpiryTimes(params[0].Bulk, fields)
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+
+	codes := make([]int, len(times))
+	for i, at := range times {
+		switch {
+		case !found[i]:
+			codes[i] = structures.FieldMissing
+		case at.IsZero():
+			codes[i] = structures.FieldNoExpiry
+		default:
+			codes[i] = convert(at)
+		}
+	}
+	return integerArray(codes).Marshal()
+}
+
+func (r *CommandRouter) hpersist(params []resp.RESP) []byte {
+	if len(params) < 3 {
+		return wrongArgs("hpersist")
+	}
+
+	fields, err := parseFields(params[1:])
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+
+	codes, err := r.Store.HPersist(params[0].Bulk, fields)
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+	return integerArray(codes).Marshal()
+}
+
+func (r *CommandRouter) hscan(params []resp.RESP) []byte {
+	if len(params) < 2 {
+		return wrongArgs("hscan")
+	}
+
+	cursor, err := parseCursor(params[1].Bulk)
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+	opts, err := parseScanOptions(params[2:], "hscan")
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+
+	next, items, err := r.Store.HScan(params[0].Bulk, cursor, opts.count, opts.match, opts.noValues)
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+	return scanReply(next, bulkArray(items)).Marshal()
+}
+
+// integerArray converts a slice of ints into a RESP array of integers.
+func integerArray(values []int) resp.RESP {
+	result := make([]resp.RESP, len(values))
+	for i, v := range values {
+		result[i] = resp.Integer(v)
+	}
+	return resp.Array(result...)
+}
@@ -0,0 +1,269 @@
+package handlers
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jgrecu/redis-clone/app/resp"
+	"github.com/jgrecu/redis-clone/app/structures"
+)
+
+func TestHashCommands(t *testing.T) {
+	tests := []commandTest{
+		{
+			name:     "HSET adds fields",
+			setup:    func(s *structures.Store) {},
+			command:  bulks("HSET", "h", "a", "1", "b", "2"),
+			expected: resp.Integer(2).Marshal(),
+		},
+		{
+			name:     "HSET odd field/value count",
+			setup:    func(s *structures.Store) {},
+			command:  bulks("HSET", "h", "a", "1", "b"),
+			expected: resp.Error("ERR wrong number of arguments for 'hset' command").Marshal(),
+		},
+		{
+			name:     "HSET against string",
+			setup:    func(s *structures.Store) { s.Set("str", "v", time.Time{}) },
+			command:  bulks("HSET", "str", "a", "1"),
+			expected: wrongType,
+		},
+		{
+			name:     "HMSET",
+			setup:    func(s *structures.Store) {},
+			command:  bulks("HMSET", "h", "a", "1"),
+			expected: resp.String("OK").Marshal(),
+		},
+		{
+			name:     "HSETNX existing",
+			setup:    func(s *structures.Store) { s.HSet("h", map[string]string{"a": "1"}) },
+			command:  bulks("HSETNX", "h", "a", "2"),
+			expected: resp.Integer(0).Marshal(),
+		},
+		{
+			name:     "HGET",
+			setup:    func(s *structures.Store) { s.HSet("h", map[string]string{"a": "1"}) },
+			command:  bulks("HGET", "h", "a"),
+			expected: resp.Bulk("1").Marshal(),
+		},
+		{
+			name:     "HGET missing",
+			setup:    func(s *structures.Store) {},
+			command:  bulks("HGET", "h", "a"),
+			expected: resp.Nil().Marshal(),
+		},
+		{
+			name:     "HGET against list",
+			setup:    func(s *structures.Store) { s.RPush("l", false, "a") },
+			command:  bulks("HGET", "l", "a"),
+			expected: wrongType,
+		},
+		{
+			name:     "HMGET",
+			setup:    func(s *structures.Store) { s.HSet("h", map[string]string{"a": "1"}) },
+			command:  bulks("HMGET", "h", "a", "b"),
+			expected: resp.Array(resp.Bulk("1"), resp.Nil()).Marshal(),
+		},
+		{
+			name:     "HDEL",
+			setup:    func(s *structures.Store) { s.HSet("h", map[string]string{"a": "1", "b": "2"}) },
+			command:  bulks("HDEL", "h", "a", "c"),
+			expected: resp.Integer(1).Marshal(),
+		},
+		{
+			name:     "HGETALL",
+			setup:    func(s *structures.Store) { s.HSet("h", map[string]string{"a": "1"}) },
+			command:  bulks("HGETALL", "h"),
+			expected: resp.Array(resp.Bulk("a"), resp.Bulk("1")).Marshal(),
+		},
+		{
+			name:     "HKEYS missing",
+			setup:    func(s *structures.Store) {},
+			command:  bulks("HKEYS", "h"),
+			expected: resp.Array().Marshal(),
+		},
+		{
+			name:     "HVALS",
+			setup:    func(s *structures.Store) { s.HSet("h", map[string]string{"a": "1"}) },
+			command:  bulks("HVALS", "h"),
+			expected: resp.Array(resp.Bulk("1")).Marshal(),
+		},
+		{
+			name:     "HEXISTS",
+			setup:    func(s *structures.Store) { s.HSet("h", map[string]string{"a": "1"}) },
+			command:  bulks("HEXISTS", "h", "a"),
+			expected: resp.Integer(1).Marshal(),
+		},
+		{
+			name:     "HLEN",
+			setup:    func(s *structures.Store) { s.HSet("h", map[string]string{"a": "1", "b": "2"}) },
+			command:  bulks("HLEN", "h"),
+			expected: resp.Integer(2).Marshal(),
+		},
+		{
+			name:     "HSTRLEN",
+			setup:    func(s *structures.Store) { s.HSet("h", map[string]string{"a": "hello"}) },
+			command:  bulks("HSTRLEN", "h", "a"),
+			expected: resp.Integer(5).Marshal(),
+		},
+		{
+			name:     "HINCRBY",
+			setup:    func(s *structures.Store) { s.HSet("h", map[string]string{"n": "5"}) },
+			command:  bulks("HINCRBY", "h", "n", "-10"),
+			expected: resp.Integer(-5).Marshal(),
+		},
+		{
+			name:     "HINCRBY non-integer increment",
+			setup:    func(s *structures.Store) {},
+			command:  bulks("HINCRBY", "h", "n", "1.5"),
+			expected: resp.Error(errNotInteger).Marshal(),
+		},
+		{
+			name:     "HINCRBY non-integer value",
+			setup:    func(s *structures.Store) { s.HSet("h", map[string]string{"n": "x"}) },
+			command:  bulks("HINCRBY", "h", "n", "1"),
+			expected: resp.Error("ERR hash value is not an integer").Marshal(),
+		},
+		{
+			name:     "HINCRBYFLOAT",
+			setup:    func(s *structures.Store) { s.HSet("h", map[string]string{"f": "5.0e3"}) },
+			command:  bulks("HINCRBYFLOAT", "h", "f", "2.0e2"),
+			expected: resp.Bulk("5200").Marshal(),
+		},
+		{
+			name:     "HINCRBYFLOAT invalid increment",
+			setup:    func(s *structures.Store) {},
+			command:  bulks("HINCRBYFLOAT", "h", "f", "abc"),
+			expected: resp.Error("ERR value is not a valid float").Marshal(),
+		},
+		{
+			name:     "HSCAN",
+			setup:    func(s *structures.Store) { s.HSet("h", map[string]string{"a": "1"}) },
+			command:  bulks("HSCAN", "h", "0"),
+			expected: resp.Array(resp.Bulk("0"), resp.Array(resp.Bulk("a"), resp.Bulk("1"))).Marshal(),
+		},
+		{
+			name:     "HSCAN MATCH NOVALUES",
+			setup:    func(s *structures.Store) { s.HSet("h", map[string]string{"a": "1", "b": "2"}) },
+			command:  bulks("HSCAN", "h", "0", "NOVALUES", "MATCH", "b"),
+			expected: resp.Array(resp.Bulk("0"), resp.Array(resp.Bulk("b"))).Marshal(),
+		},
+		{
+			name:     "HSCAN missing key",
+			setup:    func(s *structures.Store) {},
+			command:  bulks("HSCAN", "h", "0"),
+			expected: resp.Array(resp.Bulk("0"), resp.Array()).Marshal(),
+		},
+		{
+			name:     "HSCAN rejects TYPE",
+			setup:    func(s *structures.Store) {},
+			command:  bulks("HSCAN", "h", "0", "TYPE", "string"),
+			expected: resp.Error("ERR syntax error").Marshal(),
+		},
+		{
+			name:     "HSCAN against string",
+			setup:    func(s *structures.Store) { s.Set("str", "v", time.Time{}) },
+			command:  bulks("HSCAN", "str", "0"),
+			expected: wrongType,
+		},
+	}
+
+	runCommandTests(t, tests)
+}
+
+func TestHashFieldExpiryCommands(t *testing.T) {
+	withField := func(s *structures.Store) { s.HSet("h", map[string]string{"a": "1"}) }
+	withTTL := func(s *structures.Store) {
+		s.HSet("h", map[string]string{"a": "1", "b": "2"})
+		s.HExpire("h", time.Now().Add(100*time.Second), "", []string{"a"})
+	}
+
+	tests := []commandTest{
+		{
+			name:     "HEXPIRE",
+			setup:    withField,
+			command:  bulks("HEXPIRE", "h", "100", "FIELDS", "2", "a", "b"),
+			expected: integerArray([]int{1, -2}).Marshal(),
+		},
+		{
+			name:     "HEXPIRE with XX",
+			setup:    withField,
+			command:  bulks("HEXPIRE", "h", "100", "XX", "FIELDS", "1", "a"),
+			expected: integerArray([]int{0}).Marshal(),
+		},
+		{
+			name:     "HPEXPIRE zero deletes",
+			setup:    withField,
+			command:  bulks("HPEXPIRE", "h", "0", "FIELDS", "1", "a"),
+			expected: integerArray([]int{2}).Marshal(),
+		},
+		{
+			name:     "HEXPIRE missing FIELDS",
+			setup:    withField,
+			command:  bulks("HEXPIRE", "h", "100", "NX", "1", "a"),
+			expected: resp.Error("ERR Mandatory argument FIELDS is missing or not at the right position").Marshal(),
+		},
+		{
+			name:     "HEXPIRE numfields mismatch",
+			setup:    withField,
+			command:  bulks("HEXPIRE", "h", "100", "FIELDS", "2", "a"),
+			expected: resp.Error("ERR The `numfields` parameter must match the number of arguments").Marshal(),
+		},
+		{
+			name:     "HEXPIRE negative",
+			setup:    withField,
+			command:  bulks("HEXPIRE", "h", "-1", "FIELDS", "1", "a"),
+			expected: resp.Error("ERR invalid expire time, must be >= 0").Marshal(),
+		},
+		{
+			name:     "HTTL",
+			setup:    withTTL,
+			command:  bulks("HTTL", "h", "FIELDS", "3", "a", "b", "c"),
+			expected: integerArray([]int{100, -1, -2}).Marshal(),
+		},
+		{
+			name:     "HPERSIST",
+			setup:    withTTL,
+			command:  bulks("HPERSIST", "h", "FIELDS", "2", "a", "b"),
+			expected: integerArray([]int{1, -1}).Marshal(),
+		},
+		{
+			name: "HEXPIRETIME",
+			setup: func(s *structures.Store) {
+				s.HSet("h", map[string]string{"a": "1"})
+				s.HExpire("h", time.Unix(4000000000, 0), "", []string{"a"})
+			},
+			command:  bulks("HEXPIRETIME", "h", "FIELDS", "1", "a"),
+			expected: integerArray([]int{4000000000}).Marshal(),
+		},
+		{
+			name:     "HPEXPIREAT",
+			setup:    withField,
+			command:  bulks("HPEXPIREAT", "h", "4000000000000", "FIELDS", "1", "a"),
+			expected: integerArray([]int{1}).Marshal(),
+		},
+	}
+
+	runCommandTests(t, tests)
+}
+
+func TestHExpire_Propagation(t *testing.T) {
+	router := newTestRouter()
+	router.Store.HSet("h", map[string]string{"a": "1", "b": "2", "c": "3"})
+	router.Store.HExpire("h", time.Now().Add(time.Hour), "", []string{"b"})
+
+	// Only the fields whose expiry was set go to replicas, with the
+	// deadline the master computed.
+	got := propagated(router, "HEXPIRE", "h", "100", "NX", "FIELDS", "3", "a", "b", "missing")
+	times, _, _ := router.Store.HExpiryTimes("h", []string{"a"})
+	if want := [][]resp.RESP{bulks("HPEXPIREAT", "h", formatUnixMillis(times[0]), "FIELDS", "1", "a")}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Propagation of HEXPIRE = %v, want %v", got, want)
+	}
+	if got := propagated(router, "HPEXPIRE", "h", "100000", "NX", "FIELDS", "1", "a"); len(got) != 0 {
+		t.Errorf("Propagation of an HPEXPIRE that changed nothing = %v, want none", got)
+	}
+	if got, want := propagated(router, "HPEXPIREAT", "h", "1", "FIELDS", "2", "b", "c"), [][]resp.RESP{bulks("HDEL", "h", "b", "c")}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Propagation of an HPEXPIREAT in the past = %v, want %v", got, want)
+	}
+}
@@ -12,7 +12,8 @@ func (r *CommandRouter) info(params []resp.RESP) []byte {
 		return resp.Error("ERR wrong number of arguments for 'info' command").Marshal()
 	}
 
-	if strings.ToUpper(params[0].Bulk) == "REPLICATION" {
+	switch strings.ToUpper(params[0].Bulk) {
+	case "REPLICATION":
 		replInfo := fmt.Sprintf(
 			"role:%s\nmaster_replid:%s\nmaster_repl_offset:%s",
 			config.Get().Role,
@@ -20,6 +21,26 @@ func (r *CommandRouter) info(params []resp.RESP) []byte {
 			config.Get().MasterReplOffset,
 		)
 		return resp.Bulk(replInfo).Marshal()
+	case "STATS":
+		stats := r.Store.ExpiryStats()
+		statsInfo := fmt.Sprintf(
+			"expired_keys:%d\nexpired_stale_perc:%.2f\nexpired_time_cap_reached_count:%d\nexpire_cycle_cpu_milliseconds:%d\nevicted_keys:%d",
+			stats.ExpiredKeys,
+			stats.ExpiredStalePerc,
+			stats.TimeCapReachedCount,
+			stats.CycleTime.Milliseconds(),
+			r.Store.MemoryStats().EvictedKeys,
+		)
+		return resp.Bulk(statsInfo).Marshal()
+	case "MEMORY":
+		stats := r.Store.MemoryStats()
+		memoryInfo := fmt.Sprintf(
+			"used_memory:%d\nmaxmemory:%d\nmaxmemory_policy:%s",
+			stats.Used,
+			stats.MaxMemory,
+			stats.Policy,
+		)
+		return resp.Bulk(memoryInfo).Marshal()
 	}
 
 	return resp.Nil().Marshal()
@@ -0,0 +1,335 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"github.com/jgrecu/redis-clone/app/resp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func (r *CommandRouter) del(params []resp.RESP) []byte {
+	if len(params) < 1 {
+		return wrongArgs("del")
+	}
+	return resp.Integer(r.Store.Del(bulkParams(params)...)).Marshal()
+}
+
+// unlink is DEL without blocking on freeing large values. Memory is
+// reclaimed by the garbage collector either way, so the two are the same.
+func (r *CommandRouter) unlink(params []resp.RESP) []byte {
+	if len(params) < 1 {
+		return wrongArgs("unlink")
+	}
+	return resp.Integer(r.Store.Del(bulkParams(params)...)).Marshal()
+}
+
+func (r *CommandRouter) exists(params []resp.RESP) []byte {
+	if len(params) < 1 {
+		return wrongArgs("exists")
+	}
+	return resp.Integer(r.Store.Exists(bulkParams(params)...)).Marshal()
+}
+
+func (r *CommandRouter) touch(params []resp.RESP) []byte {
+	if len(params) < 1 {
+		return wrongArgs("touch")
+	}
+	return resp.Integer(r.Store.Exists(bulkParams(params)...)).Marshal()
+}
+
+func (r *CommandRouter) rename(params []resp.RESP) []byte {
+	if len(params) != 2 {
+		return wrongArgs("rename")
+	}
+
+	if _, err := r.Store.Rename(params[0].Bulk, params[1].Bulk, false); err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+	return resp.String("OK").Marshal()
+}
+
+func (r *CommandRouter) renamenx(params []resp.RESP) []byte {
+	if len(params) != 2 {
+		return wrongArgs("renamenx")
+	}
+
+	renamed, err := r.Store.Rename(params[0].Bulk, params[1].Bulk, true)
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+	return resp.Integer(boolToInt(renamed)).Marshal()
+}
+
+func (r *CommandRouter) copyCmd(params []resp.RESP) []byte {
+	if len(params) < 2 {
+		return wrongArgs("copy")
+	}
+
+	replace, db := false, r.Store.DB()
+	for i := 2; i < len(params); i++ {
+		switch strings.ToUpper(params[i].Bulk) {
+		case "REPLACE":
+			replace = true
+		case "DB":
+			if i+1 >= len(params) {
+				return resp.Error("ERR syntax error").Marshal()
+			}
+			i++
+			var err error
+			db, err = strconv.Atoi(params[i].Bulk)
+			if err != nil {
+				return resp.Error(errNotInteger).Marshal()
+			}
+		default:
+			return resp.Error("ERR syntax error").Marshal()
+		}
+	}
+
+	copied, err := r.Store.Copy(params[0].Bulk, params[1].Bulk, db, replace)
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+	return resp.Integer(boolToInt(copied)).Marshal()
+}
+
+func (r *CommandRouter) move(params []resp.RESP) []byte {
+	if len(params) != 2 {
+		return wrongArgs("move")
+	}
+
+	db, err := strconv.Atoi(params[1].Bulk)
+	if err != nil {
+		return resp.Error(errNotInteger).Marshal()
+	}
+	moved, err := r.Store.Move(params[0].Bulk, db)
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+	return resp.Integer(boolToInt(moved)).Marshal()
+}
+
+func (r *CommandRouter) randomkey(params []resp.RESP) []byte {
+	if len(params) != 0 {
+		return wrongArgs("randomkey")
+	}
+
+	key, ok := r.Store.RandomKey()
+	if !ok {
+		return resp.Nil().Marshal()
+	}
+	return resp.Bulk(key).Marshal()
+}
+
+func (r *CommandRouter) dbsize(params []resp.RESP) []byte {
+	if len(params) != 0 {
+		return wrongArgs("dbsize")
+	}
+	return resp.Integer(r.Store.DBSize()).Marshal()
+}
+
+func (r *CommandRouter) expire(params []resp.RESP) []byte {
+	return r.expireGeneric("expire", params, time.Second, false)
+}
+
+func (r *CommandRouter) pexpire(params []resp.RESP) []byte {
+	return r.expireGeneric("pexpire", params, time.Millisecond, false)
+}
+
+func (r *CommandRouter) expireat(params []resp.RESP) []byte {
+	return r.expireGeneric("expireat", params, time.Second, true)
+}
+
+func (r *CommandRouter) pexpireat(params []resp.RESP) []byte {
+	return r.expireGeneric("pexpireat", params, time.Millisecond, true)
+}
+
+func (r *CommandRouter) expireGeneric(name string, params []resp.RESP, unit time.Duration, absolute bool) []byte {
+	if len(params) < 2 {
+		return wrongArgs(name)
+	}
+
+	amount, err := strconv.ParseInt(params[1].Bulk, 10, 64)
+	if err != nil {
+		return resp.Error(errNotInteger).Marshal()
+	}
+
+	var conds []string
+	nx, xx, gt, lt := false, false, false, false
+	for _, p := range params[2:] {
+		cond := strings.ToUpper(p.Bulk)
+		switch cond {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "GT":
+			gt = true
+		case "LT":
+			lt = true
+		default:
+			return resp.Error("ERR Unsupported option " + p.Bulk).Marshal()
+		}
+		conds = append(conds, cond)
+	}
+	if nx && (xx || gt || lt) {
+		return resp.Error("ERR NX and XX, GT or LT options at the same time are not compatible").Marshal()
+	}
+	if gt && lt {
+		return resp.Error("ERR GT and LT options at the same time are not compatible").Marshal()
+	}
+
+	at, ok := expireAt(amount, unit, absolute)
+	if !ok {
+		return resp.Error(fmt.Sprintf("ERR invalid expire time in '%s' command", name)).Marshal()
+	}
+
+	key := params[0].Bulk
+	set := r.Store.Expire(key, at, conds...)
+	r.rewrite()
+	if set {
+		r.rewriteExpiry(key, at)
+	}
+	return resp.Integer(boolToInt(set)).Marshal()
+}
+
+func (r *CommandRouter) ttl(params []resp.RESP) []byte {
+	return r.ttlGeneric("ttl", params, ttlSeconds)
+}
+
+func (r *CommandRouter) pttl(params []resp.RESP) []byte {
+	return r.ttlGeneric("pttl", params, ttlMillis)
+}
+
+func (r *CommandRouter) expiretime(params []resp.RESP) []byte {
+	return r.ttlGeneric("expiretime", params, unixSeconds)
+}
+
+func (r *CommandRouter) pexpiretime(params []resp.RESP) []byte {
+	return r.ttlGeneric("pexpiretime", params, unixMillis)
+}
+
+// ttlGeneric replies with convert(expiry) for key, or -2 if the key is
+// missing and -1 if it has no expiry.
+func (r *CommandRouter) ttlGeneric(name string, params []resp.RESP, convert func(time.Time) int) []byte {
+	if len(params) != 1 {
+		return wrongArgs(name)
+	}
+
+	at, ok := r.Store.ExpiryTime(params[0].Bulk)
+	switch {
+	case !ok:
+		return resp.Integer(-2).Marshal()
+	case at.IsZero():
+		return resp.Integer(-1).Marshal()
+	}
+	return resp.Integer(convert(at)).Marshal()
+}
+
+// Conversions of an expiry into the replies of the TTL command families.
+
+func ttlSeconds(at time.Time) int {
+	return int((time.Until(at).Milliseconds() + 500) / 1000)
+}
+
+func ttlMillis(at time.Time) int {
+	return int(time.Until(at).Milliseconds())
+}
+
+func unixSeconds(at time.Time) int {
+	return int(at.Unix())
+}
+
+func unixMillis(at time.Time) int {
+	return int(at.UnixMilli())
+}
+
+func (r *CommandRouter) persist(params []resp.RESP) []byte {
+	if len(params) != 1 {
+		return wrongArgs("persist")
+	}
+	return resp.Integer(boolToInt(r.Store.Persist(params[0].Bulk))).Marshal()
+}
+
+func (r *CommandRouter) scan(params []resp.RESP) []byte {
+	if len(params) < 1 {
+		return wrongArgs("scan")
+	}
+
+	cursor, err := parseCursor(params[0].Bulk)
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+	opts, err := parseScanOptions(params[1:], "scan")
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+
+	next, keys := r.Store.Scan(cursor, opts.count, opts.match, opts.typ)
+	return scanReply(next, bulkArray(keys)).Marshal()
+}
+
+// scanOptions holds the MATCH, COUNT, TYPE and NOVALUES options of the SCAN
+// family.
+type scanOptions struct {
+	match    string
+	count    int
+	typ      string
+	noValues bool
+}
+
+// parseCursor parses a SCAN cursor, which Redis treats as unsigned.
+func parseCursor(s string) (uint64, error) {
+	cursor, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return 0, errors.New("ERR invalid cursor")
+	}
+	return cursor, nil
+}
+
+// parseScanOptions parses the options following the cursor of command. TYPE
+// is only accepted by SCAN and NOVALUES only by HSCAN.
+func parseScanOptions(params []resp.RESP, command string) (scanOptions, error) {
+	opts := scanOptions{count: 10}
+	for i := 0; i < len(params); i++ {
+		opt := strings.ToUpper(params[i].Bulk)
+		if opt == "NOVALUES" && command == "hscan" {
+			opts.noValues = true
+			continue
+		}
+		if i+1 >= len(params) {
+			return opts, errors.New("ERR syntax error")
+		}
+		i++
+
+		switch {
+		case opt == "MATCH":
+			opts.match = params[i].Bulk
+		case opt == "COUNT":
+			count, err := strconv.Atoi(params[i].Bulk)
+			if err != nil {
+				return opts, errors.New(errNotInteger)
+			}
+			if count < 1 {
+				return opts, errors.New("ERR syntax error")
+			}
+			opts.count = count
+		case opt == "TYPE" && command == "scan":
+			opts.typ = strings.ToLower(params[i].Bulk)
+			switch opts.typ {
+			case "string", "list", "hash", "set", "zset", "stream":
+			default:
+				return opts, fmt.Errorf("ERR unknown type name '%s'", params[i].Bulk)
+			}
+		default:
+			return opts, errors.New("ERR syntax error")
+		}
+	}
+	return opts, nil
+}
+
+// scanReply builds the two-element reply of the SCAN family.
+func scanReply(cursor uint64, items resp.RESP) resp.RESP {
+	return resp.Array(resp.Bulk(strconv.FormatUint(cursor, 10)), items)
+}
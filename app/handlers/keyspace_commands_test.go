@@ -0,0 +1,329 @@
+package handlers
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jgrecu/redis-clone/app/resp"
+	"github.com/jgrecu/redis-clone/app/structures"
+)
+
+func TestKeyspaceCommands(t *testing.T) {
+	twoKeys := func(s *structures.Store) {
+		s.Set("a", "1", time.Time{})
+		s.Set("b", "2", time.Time{})
+	}
+
+	tests := []commandTest{
+		{
+			name:     "DEL",
+			setup:    twoKeys,
+			command:  bulks("DEL", "a", "b", "missing"),
+			expected: resp.Integer(2).Marshal(),
+		},
+		{
+			name:     "DEL no keys",
+			setup:    func(s *structures.Store) {},
+			command:  bulks("DEL"),
+			expected: resp.Error("ERR wrong number of arguments for 'del' command").Marshal(),
+		},
+		{
+			name:     "UNLINK",
+			setup:    twoKeys,
+			command:  bulks("UNLINK", "a"),
+			expected: resp.Integer(1).Marshal(),
+		},
+		{
+			name:     "EXISTS counts duplicates",
+			setup:    twoKeys,
+			command:  bulks("EXISTS", "a", "a", "missing"),
+			expected: resp.Integer(2).Marshal(),
+		},
+		{
+			name:     "TOUCH",
+			setup:    twoKeys,
+			command:  bulks("TOUCH", "a", "b", "missing"),
+			expected: resp.Integer(2).Marshal(),
+		},
+		{
+			name:     "RENAME",
+			setup:    twoKeys,
+			command:  bulks("RENAME", "a", "b"),
+			expected: resp.String("OK").Marshal(),
+		},
+		{
+			name:     "RENAME missing key",
+			setup:    func(s *structures.Store) {},
+			command:  bulks("RENAME", "a", "b"),
+			expected: resp.Error("ERR no such key").Marshal(),
+		},
+		{
+			name:     "RENAMENX existing destination",
+			setup:    twoKeys,
+			command:  bulks("RENAMENX", "a", "b"),
+			expected: resp.Integer(0).Marshal(),
+		},
+		{
+			name:     "COPY existing destination",
+			setup:    twoKeys,
+			command:  bulks("COPY", "a", "b"),
+			expected: resp.Integer(0).Marshal(),
+		},
+		{
+			name:     "COPY REPLACE",
+			setup:    twoKeys,
+			command:  bulks("COPY", "a", "b", "replace"),
+			expected: resp.Integer(1).Marshal(),
+		},
+		{
+			name:     "COPY DB 0",
+			setup:    twoKeys,
+			command:  bulks("COPY", "a", "c", "DB", "0"),
+			expected: resp.Integer(1).Marshal(),
+		},
+		{
+			name:     "COPY DB out of range",
+			setup:    twoKeys,
+			command:  bulks("COPY", "a", "c", "DB", "16"),
+			expected: resp.Error("ERR DB index is out of range").Marshal(),
+		},
+		{
+			name:     "COPY to another DB under the same name",
+			setup:    twoKeys,
+			command:  bulks("COPY", "a", "a", "DB", "5"),
+			expected: resp.Integer(1).Marshal(),
+		},
+		{
+			name:     "MOVE",
+			setup:    twoKeys,
+			command:  bulks("MOVE", "a", "3"),
+			expected: resp.Integer(1).Marshal(),
+		},
+		{
+			name:     "MOVE to the selected DB",
+			setup:    twoKeys,
+			command:  bulks("MOVE", "a", "0"),
+			expected: resp.Error("ERR source and destination objects are the same").Marshal(),
+		},
+		{
+			name:     "MOVE invalid DB",
+			setup:    twoKeys,
+			command:  bulks("MOVE", "a", "x"),
+			expected: resp.Error("ERR value is not an integer or out of range").Marshal(),
+		},
+		{
+			name:     "COPY onto itself",
+			setup:    twoKeys,
+			command:  bulks("COPY", "a", "a"),
+			expected: resp.Error("ERR source and destination objects are the same").Marshal(),
+		},
+		{
+			name:     "COPY unknown option",
+			setup:    twoKeys,
+			command:  bulks("COPY", "a", "c", "NOW"),
+			expected: resp.Error("ERR syntax error").Marshal(),
+		},
+		{
+			name:     "RANDOMKEY empty",
+			setup:    func(s *structures.Store) {},
+			command:  bulks("RANDOMKEY"),
+			expected: resp.Nil().Marshal(),
+		},
+		{
+			name:     "RANDOMKEY",
+			setup:    func(s *structures.Store) { s.Set("only", "1", time.Time{}) },
+			command:  bulks("RANDOMKEY"),
+			expected: resp.Bulk("only").Marshal(),
+		},
+		{
+			name:     "DBSIZE",
+			setup:    twoKeys,
+			command:  bulks("DBSIZE"),
+			expected: resp.Integer(2).Marshal(),
+		},
+		{
+			name:     "EXPIRE",
+			setup:    twoKeys,
+			command:  bulks("EXPIRE", "a", "100"),
+			expected: resp.Integer(1).Marshal(),
+		},
+		{
+			name:     "EXPIRE missing key",
+			setup:    func(s *structures.Store) {},
+			command:  bulks("EXPIRE", "a", "100"),
+			expected: resp.Integer(0).Marshal(),
+		},
+		{
+			name:     "EXPIRE XX without expiry",
+			setup:    twoKeys,
+			command:  bulks("EXPIRE", "a", "100", "xx"),
+			expected: resp.Integer(0).Marshal(),
+		},
+		{
+			name:     "EXPIRE NX and GT",
+			setup:    twoKeys,
+			command:  bulks("EXPIRE", "a", "100", "NX", "GT"),
+			expected: resp.Error("ERR NX and XX, GT or LT options at the same time are not compatible").Marshal(),
+		},
+		{
+			name:     "EXPIRE GT and LT",
+			setup:    twoKeys,
+			command:  bulks("EXPIRE", "a", "100", "GT", "LT"),
+			expected: resp.Error("ERR GT and LT options at the same time are not compatible").Marshal(),
+		},
+		{
+			name:     "EXPIRE unknown option",
+			setup:    twoKeys,
+			command:  bulks("EXPIRE", "a", "100", "foo"),
+			expected: resp.Error("ERR Unsupported option foo").Marshal(),
+		},
+		{
+			name:     "EXPIRE overflow",
+			setup:    twoKeys,
+			command:  bulks("EXPIRE", "a", "9223372036854775807"),
+			expected: resp.Error("ERR invalid expire time in 'expire' command").Marshal(),
+		},
+		{
+			name:     "PEXPIREAT in the past deletes",
+			setup:    twoKeys,
+			command:  bulks("PEXPIREAT", "a", "1000"),
+			expected: resp.Integer(1).Marshal(),
+		},
+		{
+			name:     "TTL missing key",
+			setup:    func(s *structures.Store) {},
+			command:  bulks("TTL", "a"),
+			expected: resp.Integer(-2).Marshal(),
+		},
+		{
+			name:     "TTL without expiry",
+			setup:    twoKeys,
+			command:  bulks("TTL", "a"),
+			expected: resp.Integer(-1).Marshal(),
+		},
+		{
+			name:     "TTL",
+			setup:    func(s *structures.Store) { s.Set("a", "1", time.Now().Add(100*time.Second)) },
+			command:  bulks("TTL", "a"),
+			expected: resp.Integer(100).Marshal(),
+		},
+		{
+			name:     "PEXPIRETIME",
+			setup:    func(s *structures.Store) { s.Set("a", "1", time.UnixMilli(33177117420000)) },
+			command:  bulks("PEXPIRETIME", "a"),
+			expected: resp.Integer(33177117420000).Marshal(),
+		},
+		{
+			name:     "EXPIRETIME",
+			setup:    func(s *structures.Store) { s.Set("a", "1", time.UnixMilli(33177117420000)) },
+			command:  bulks("EXPIRETIME", "a"),
+			expected: resp.Integer(33177117420).Marshal(),
+		},
+		{
+			name:     "PERSIST",
+			setup:    func(s *structures.Store) { s.Set("a", "1", time.Now().Add(time.Hour)) },
+			command:  bulks("PERSIST", "a"),
+			expected: resp.Integer(1).Marshal(),
+		},
+		{
+			name:     "PERSIST without expiry",
+			setup:    twoKeys,
+			command:  bulks("PERSIST", "a"),
+			expected: resp.Integer(0).Marshal(),
+		},
+		{
+			name:     "SCAN",
+			setup:    func(s *structures.Store) { s.Set("only", "1", time.Time{}) },
+			command:  bulks("SCAN", "0"),
+			expected: resp.Array(resp.Bulk("0"), resp.Array(resp.Bulk("only"))).Marshal(),
+		},
+		{
+			name:     "SCAN MATCH and TYPE filter",
+			setup:    twoKeys,
+			command:  bulks("SCAN", "0", "MATCH", "a", "COUNT", "100", "TYPE", "string"),
+			expected: resp.Array(resp.Bulk("0"), resp.Array(resp.Bulk("a"))).Marshal(),
+		},
+		{
+			name:     "SCAN invalid cursor",
+			setup:    func(s *structures.Store) {},
+			command:  bulks("SCAN", "-1"),
+			expected: resp.Error("ERR invalid cursor").Marshal(),
+		},
+		{
+			name:     "SCAN zero COUNT",
+			setup:    func(s *structures.Store) {},
+			command:  bulks("SCAN", "0", "COUNT", "0"),
+			expected: resp.Error("ERR syntax error").Marshal(),
+		},
+		{
+			name:     "SCAN missing option value",
+			setup:    func(s *structures.Store) {},
+			command:  bulks("SCAN", "0", "MATCH"),
+			expected: resp.Error("ERR syntax error").Marshal(),
+		},
+		{
+			name:     "SCAN unknown type",
+			setup:    func(s *structures.Store) {},
+			command:  bulks("SCAN", "0", "TYPE", "widget"),
+			expected: resp.Error("ERR unknown type name 'widget'").Marshal(),
+		},
+	}
+
+	runCommandTests(t, tests)
+}
+
+func TestExpire_Propagation(t *testing.T) {
+	router := newTestRouter()
+	router.Store.Set("k", "v", time.Time{})
+
+	// Relative and absolute TTLs go to replicas as the deadline the master
+	// computed, so they expire the key at the same time.
+	for _, args := range [][]string{
+		{"EXPIRE", "k", "100"},
+		{"PEXPIRE", "k", "200000", "GT"},
+		{"EXPIREAT", "k", "4102444800"},
+	} {
+		got := propagated(router, args...)
+		at, _ := router.Store.ExpiryTime("k")
+		want := [][]resp.RESP{bulks("PEXPIREAT", "k", formatUnixMillis(at))}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Propagation of %v = %v, want %v", args, got, want)
+		}
+	}
+
+	if got := propagated(router, "EXPIRE", "k", "100", "NX"); len(got) != 0 {
+		t.Errorf("Propagation of an EXPIRE that changed nothing = %v, want none", got)
+	}
+	if got := propagated(router, "EXPIRE", "missing", "100"); len(got) != 0 {
+		t.Errorf("Propagation of an EXPIRE on a missing key = %v, want none", got)
+	}
+	if got, want := propagated(router, "PEXPIRE", "k", "-1"), [][]resp.RESP{bulks("DEL", "k")}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Propagation of an EXPIRE in the past = %v, want %v", got, want)
+	}
+}
+
+func TestExpiredKeys_Replication(t *testing.T) {
+	router := newTestRouter()
+	router.Store.Set("k", "v", time.Now().Add(-time.Second))
+
+	// A read deleting an expired key replicates the deletion alone, and a
+	// write replicates it ahead of itself.
+	args := bulks("GET", "k")
+	router.GetHandler("GET")(args[1:])
+	want := []Replicated{{0, bulks("DEL", "k")}}
+	if got := router.Replication(args, false); !reflect.DeepEqual(got, want) {
+		t.Errorf("Replication of GET = %v, want %v", got, want)
+	}
+
+	router.Store.Set("k", "v", time.Now().Add(-time.Second))
+	args = bulks("SET", "k", "w")
+	router.GetHandler("SET")(args[1:])
+	want = []Replicated{{0, bulks("DEL", "k")}, {0, args}}
+	if got := router.Replication(args, true); !reflect.DeepEqual(got, want) {
+		t.Errorf("Replication of SET = %v, want %v", got, want)
+	}
+	if got := router.Replication(args, true); !reflect.DeepEqual(got, want[1:]) {
+		t.Errorf("Replication taken twice = %v, want %v", got, want[1:])
+	}
+}
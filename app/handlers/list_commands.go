@@ -0,0 +1,384 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/jgrecu/redis-clone/app/resp"
+	"strconv"
+	"strings"
+)
+
+func (r *CommandRouter) lpush(params []resp.RESP) []byte {
+	return r.push("lpush", params, r.Store.LPush, false)
+}
+
+func (r *CommandRouter) rpush(params []resp.RESP) []byte {
+	return r.push("rpush", params, r.Store.RPush, false)
+}
+
+func (r *CommandRouter) lpushx(params []resp.RESP) []byte {
+	return r.push("lpushx", params, r.Store.LPush, true)
+}
+
+func (r *CommandRouter) rpushx(params []resp.RESP) []byte {
+	return r.push("rpushx", params, r.Store.RPush, true)
+}
+
+func (r *CommandRouter) push(
+	name string,
+	params []resp.RESP,
+	pushFn func(string, bool, ...string) (int, error),
+	onlyIfExists bool,
+) []byte {
+	if len(params) < 2 {
+		return wrongArgs(name)
+	}
+
+	values := make([]string, 0, len(params)-1)
+	for _, p := range params[1:] {
+		values = append(values, p.Bulk)
+	}
+
+	length, err := pushFn(params[0].Bulk, onlyIfExists, values...)
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+	return resp.Integer(length).Marshal()
+}
+
+func (r *CommandRouter) lpop(params []resp.RESP) []byte {
+	return r.pop("lpop", params, r.Store.LPop)
+}
+
+func (r *CommandRouter) rpop(params []resp.RESP) []byte {
+	return r.pop("rpop", params, r.Store.RPop)
+}
+
+func (r *CommandRouter) pop(name string, params []resp.RESP, popFn func(string, int) ([]string, error)) []byte {
+	if len(params) < 1 || len(params) > 2 {
+		return wrongArgs(name)
+	}
+
+	count := 1
+	if len(params) == 2 {
+		n, err := strconv.Atoi(params[1].Bulk)
+		if err != nil || n < 0 {
+			return resp.Error("ERR value is out of range, must be positive").Marshal()
+		}
+		count = n
+	}
+
+	values, err := popFn(params[0].Bulk, count)
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+	if values == nil {
+		return resp.Nil().Marshal()
+	}
+
+	// Without a count the reply is a single bulk string.
+	if len(params) == 1 {
+		if len(values) == 0 {
+			return resp.Nil().Marshal()
+		}
+		return resp.Bulk(values[0]).Marshal()
+	}
+	return bulkArray(values).Marshal()
+}
+
+func (r *CommandRouter) lrange(params []resp.RESP) []byte {
+	if len(params) != 3 {
+		return wrongArgs("lrange")
+	}
+
+	start, err1 := strconv.Atoi(params[1].Bulk)
+	stop, err2 := strconv.Atoi(params[2].Bulk)
+	if err1 != nil || err2 != nil {
+		return resp.Error(errNotInteger).Marshal()
+	}
+
+	values, err := r.Store.LRange(params[0].Bulk, start, stop)
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+	return bulkArray(values).Marshal()
+}
+
+func (r *CommandRouter) llen(params []resp.RESP) []byte {
+	if len(params) != 1 {
+		return wrongArgs("llen")
+	}
+
+	length, err := r.Store.LLen(params[0].Bulk)
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+	return resp.Integer(length).Marshal()
+}
+
+func (r *CommandRouter) lindex(params []resp.RESP) []byte {
+	if len(params) != 2 {
+		return wrongArgs("lindex")
+	}
+
+	index, err := strconv.Atoi(params[1].Bulk)
+	if err != nil {
+		return resp.Error(errNotInteger).Marshal()
+	}
+
+	value, ok, err := r.Store.LIndex(params[0].Bulk, index)
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+	if !ok {
+		return resp.Nil().Marshal()
+	}
+	return resp.Bulk(value).Marshal()
+}
+
+func (r *CommandRouter) lset(params []resp.RESP) []byte {
+	if len(params) != 3 {
+		return wrongArgs("lset")
+	}
+
+	index, err := strconv.Atoi(params[1].Bulk)
+	if err != nil {
+		return resp.Error(errNotInteger).Marshal()
+	}
+
+	if err := r.Store.LSet(params[0].Bulk, index, params[2].Bulk); err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+	return resp.String("OK").Marshal()
+}
+
+func (r *CommandRouter) linsert(params []resp.RESP) []byte {
+	if len(params) != 4 {
+		return wrongArgs("linsert")
+	}
+
+	var before bool
+	switch strings.ToUpper(params[1].Bulk) {
+	case "BEFORE":
+		before = true
+	case "AFTER":
+		before = false
+	default:
+		return resp.Error("ERR syntax error").Marshal()
+	}
+
+	length, err := r.Store.LInsert(params[0].Bulk, before, params[2].Bulk, params[3].Bulk)
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+	return resp.Integer(length).Marshal()
+}
+
+func (r *CommandRouter) lrem(params []resp.RESP) []byte {
+	if len(params) != 3 {
+		return wrongArgs("lrem")
+	}
+
+	count, err := strconv.Atoi(params[1].Bulk)
+	if err != nil {
+		return resp.Error(errNotInteger).Marshal()
+	}
+
+	removed, err := r.Store.LRem(params[0].Bulk, count, params[2].Bulk)
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+	return resp.Integer(removed).Marshal()
+}
+
+func (r *CommandRouter) ltrim(params []resp.RESP) []byte {
+	if len(params) != 3 {
+		return wrongArgs("ltrim")
+	}
+
+	start, err1 := strconv.Atoi(params[1].Bulk)
+	stop, err2 := strconv.Atoi(params[2].Bulk)
+	if err1 != nil || err2 != nil {
+		return resp.Error(errNotInteger).Marshal()
+	}
+
+	if err := r.Store.LTrim(params[0].Bulk, start, stop); err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+	return resp.String("OK").Marshal()
+}
+
+// parseDirection parses a LEFT|RIGHT argument, returning true for LEFT.
+func parseDirection(value string) (bool, bool) {
+	switch strings.ToUpper(value) {
+	case "LEFT":
+		return true, true
+	case "RIGHT":
+		return false, true
+	}
+	return false, false
+}
+
+func (r *CommandRouter) lmove(params []resp.RESP) []byte {
+	if len(params) != 4 {
+		return wrongArgs("lmove")
+	}
+
+	fromFront, ok1 := parseDirection(params[2].Bulk)
+	toFront, ok2 := parseDirection(params[3].Bulk)
+	if !ok1 || !ok2 {
+		return resp.Error("ERR syntax error").Marshal()
+	}
+
+	value, ok, err := r.Store.LMove(params[0].Bulk, params[1].Bulk, fromFront, toFront)
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+	if !ok {
+		return resp.Nil().Marshal()
+	}
+	return resp.Bulk(value).Marshal()
+}
+
+func (r *CommandRouter) blmove(params []resp.RESP) []byte {
+	if len(params) != 5 {
+		return wrongArgs("blmove")
+	}
+
+	fromFront, ok1 := parseDirection(params[2].Bulk)
+	toFront, ok2 := parseDirection(params[3].Bulk)
+	if !ok1 || !ok2 {
+		return resp.Error("ERR syntax error").Marshal()
+	}
+
+	timeout, err := parseTimeout(params[4].Bulk)
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+
+	// The store records the move, if any, for replicas.
+	value, ok, err := r.Store.BLMove(params[0].Bulk, params[1].Bulk, fromFront, toFront, timeout)
+	r.rewrite()
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+	if !ok {
+		return resp.Nil().Marshal()
+	}
+	return resp.Bulk(value).Marshal()
+}
+
+func (r *CommandRouter) blpop(params []resp.RESP) []byte {
+	return r.bpop("blpop", params, true)
+}
+
+func (r *CommandRouter) brpop(params []resp.RESP) []byte {
+	return r.bpop("brpop", params, false)
+}
+
+func (r *CommandRouter) bpop(name string, params []resp.RESP, front bool) []byte {
+	if len(params) < 2 {
+		return wrongArgs(name)
+	}
+
+	timeout, err := parseTimeout(params[len(params)-1].Bulk)
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+
+	keys := make([]string, 0, len(params)-1)
+	for _, p := range params[:len(params)-1] {
+		keys = append(keys, p.Bulk)
+	}
+
+	// The store records the pop, if any, for replicas.
+	key, values, ok, err := r.Store.BLMPop(keys, front, 1, timeout)
+	r.rewrite()
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+	if !ok {
+		return resp.Nil().Marshal()
+	}
+	return resp.Array(resp.Bulk(key), resp.Bulk(values[0])).Marshal()
+}
+
+// parseMPop parses the "numkeys key [key ...] where [COUNT count]" tail
+// shared by LMPOP, BLMPOP, ZMPOP and BZMPOP, using parseWhere to read the
+// LEFT|RIGHT or MIN|MAX argument.
+func parseMPop(params []resp.RESP, parseWhere func(string) (bool, bool)) ([]string, bool, int, error) {
+	numKeys, err := strconv.Atoi(params[0].Bulk)
+	if err != nil || numKeys <= 0 {
+		return nil, false, 0, fmt.Errorf("ERR numkeys should be greater than 0")
+	}
+	if numKeys > len(params)-2 {
+		return nil, false, 0, fmt.Errorf("ERR syntax error")
+	}
+
+	keys := bulkParams(params[1 : numKeys+1])
+
+	where, ok := parseWhere(params[numKeys+1].Bulk)
+	if !ok {
+		return nil, false, 0, fmt.Errorf("ERR syntax error")
+	}
+
+	count := 1
+	rest := params[numKeys+2:]
+	if len(rest) > 0 {
+		if len(rest) != 2 || strings.ToUpper(rest[0].Bulk) != "COUNT" {
+			return nil, false, 0, fmt.Errorf("ERR syntax error")
+		}
+		count, err = strconv.Atoi(rest[1].Bulk)
+		if err != nil || count <= 0 {
+			return nil, false, 0, fmt.Errorf("ERR count should be greater than 0")
+		}
+	}
+
+	return keys, where, count, nil
+}
+
+func (r *CommandRouter) lmpop(params []resp.RESP) []byte {
+	if len(params) < 3 {
+		return wrongArgs("lmpop")
+	}
+
+	keys, front, count, err := parseMPop(params, parseDirection)
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+
+	key, values, ok, err := r.Store.LMPop(keys, front, count)
+	return formatMPop(key, values, ok, err)
+}
+
+func (r *CommandRouter) blmpop(params []resp.RESP) []byte {
+	if len(params) < 4 {
+		return wrongArgs("blmpop")
+	}
+
+	timeout, err := parseTimeout(params[0].Bulk)
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+
+	keys, front, count, err := parseMPop(params[1:], parseDirection)
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+
+	// The store records the pop, if any, for replicas.
+	key, values, ok, err := r.Store.BLMPop(keys, front, count, timeout)
+	r.rewrite()
+	return formatMPop(key, values, ok, err)
+}
+
+// formatMPop builds the [key, [values...]] reply of LMPOP and BLMPOP, nil
+// if nothing was popped.
+func formatMPop(key string, values []string, ok bool, err error) []byte {
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+	if !ok {
+		return resp.Nil().Marshal()
+	}
+	return resp.Array(resp.Bulk(key), bulkArray(values)).Marshal()
+}
@@ -0,0 +1,310 @@
+package handlers
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jgrecu/redis-clone/app/resp"
+	"github.com/jgrecu/redis-clone/app/structures"
+)
+
+// bulks builds a params slice of bulk strings.
+func bulks(args ...string) []resp.RESP {
+	params := make([]resp.RESP, len(args))
+	for i, a := range args {
+		params[i] = resp.Bulk(a)
+	}
+	return params
+}
+
+func TestListCommands(t *testing.T) {
+	tests := []commandTest{
+		{
+			name:     "RPUSH creates list",
+			setup:    func(s *structures.Store) {},
+			command:  bulks("RPUSH", "l", "a", "b"),
+			expected: resp.Integer(2).Marshal(),
+		},
+		{
+			name:     "LPUSH wrong number of arguments",
+			setup:    func(s *structures.Store) {},
+			command:  bulks("LPUSH", "l"),
+			expected: resp.Error("ERR wrong number of arguments for 'lpush' command").Marshal(),
+		},
+		{
+			name:     "LPUSH against string",
+			setup:    func(s *structures.Store) { s.Set("str", "v", time.Time{}) },
+			command:  bulks("LPUSH", "str", "a"),
+			expected: wrongType,
+		},
+		{
+			name: "LPUSHX against stream",
+			setup: func(s *structures.Store) {
+				s.XAdd("stream", "1-1", map[string]string{"a": "b"})
+			},
+			command:  bulks("LPUSHX", "stream", "a"),
+			expected: wrongType,
+		},
+		{
+			name:     "RPUSHX missing key",
+			setup:    func(s *structures.Store) {},
+			command:  bulks("RPUSHX", "l", "a"),
+			expected: resp.Integer(0).Marshal(),
+		},
+		{
+			name:     "LPOP single",
+			setup:    func(s *structures.Store) { s.RPush("l", false, "a", "b") },
+			command:  bulks("LPOP", "l"),
+			expected: resp.Bulk("a").Marshal(),
+		},
+		{
+			name:     "RPOP with count",
+			setup:    func(s *structures.Store) { s.RPush("l", false, "a", "b", "c") },
+			command:  bulks("RPOP", "l", "2"),
+			expected: resp.Array(resp.Bulk("c"), resp.Bulk("b")).Marshal(),
+		},
+		{
+			name:     "LPOP missing key",
+			setup:    func(s *structures.Store) {},
+			command:  bulks("LPOP", "l"),
+			expected: resp.Nil().Marshal(),
+		},
+		{
+			name:     "LPOP negative count",
+			setup:    func(s *structures.Store) { s.RPush("l", false, "a") },
+			command:  bulks("LPOP", "l", "-1"),
+			expected: resp.Error("ERR value is out of range, must be positive").Marshal(),
+		},
+		{
+			name:     "LPOP against string",
+			setup:    func(s *structures.Store) { s.Set("str", "v", time.Time{}) },
+			command:  bulks("LPOP", "str"),
+			expected: wrongType,
+		},
+		{
+			name:     "LRANGE negative indexes",
+			setup:    func(s *structures.Store) { s.RPush("l", false, "a", "b", "c") },
+			command:  bulks("LRANGE", "l", "-2", "-1"),
+			expected: resp.Array(resp.Bulk("b"), resp.Bulk("c")).Marshal(),
+		},
+		{
+			name:     "LRANGE missing key",
+			setup:    func(s *structures.Store) {},
+			command:  bulks("LRANGE", "l", "0", "-1"),
+			expected: resp.Array().Marshal(),
+		},
+		{
+			name:     "LRANGE non-integer",
+			setup:    func(s *structures.Store) {},
+			command:  bulks("LRANGE", "l", "a", "-1"),
+			expected: resp.Error(errNotInteger).Marshal(),
+		},
+		{
+			name:     "LLEN",
+			setup:    func(s *structures.Store) { s.RPush("l", false, "a", "b") },
+			command:  bulks("LLEN", "l"),
+			expected: resp.Integer(2).Marshal(),
+		},
+		{
+			name:     "LINDEX out of range",
+			setup:    func(s *structures.Store) { s.RPush("l", false, "a") },
+			command:  bulks("LINDEX", "l", "3"),
+			expected: resp.Nil().Marshal(),
+		},
+		{
+			name:     "LSET missing key",
+			setup:    func(s *structures.Store) {},
+			command:  bulks("LSET", "l", "0", "x"),
+			expected: resp.Error("ERR no such key").Marshal(),
+		},
+		{
+			name:     "LINSERT bad position",
+			setup:    func(s *structures.Store) { s.RPush("l", false, "a") },
+			command:  bulks("LINSERT", "l", "MIDDLE", "a", "b"),
+			expected: resp.Error("ERR syntax error").Marshal(),
+		},
+		{
+			name:     "LREM",
+			setup:    func(s *structures.Store) { s.RPush("l", false, "a", "b", "a") },
+			command:  bulks("LREM", "l", "0", "a"),
+			expected: resp.Integer(2).Marshal(),
+		},
+		{
+			name:     "LTRIM",
+			setup:    func(s *structures.Store) { s.RPush("l", false, "a", "b", "c") },
+			command:  bulks("LTRIM", "l", "0", "1"),
+			expected: resp.String("OK").Marshal(),
+		},
+	}
+
+	runCommandTests(t, tests)
+}
+
+func TestBlockingListCommands(t *testing.T) {
+	tests := []commandTest{
+		{
+			name:     "BLPOP available",
+			setup:    func(s *structures.Store) { s.RPush("b", false, "x", "y") },
+			command:  bulks("BLPOP", "a", "b", "0"),
+			expected: resp.Array(resp.Bulk("b"), resp.Bulk("x")).Marshal(),
+		},
+		{
+			name:     "BLPOP empty key name",
+			setup:    func(s *structures.Store) { s.RPush("", false, "x") },
+			command:  bulks("BLPOP", "", "0.01"),
+			expected: resp.Array(resp.Bulk(""), resp.Bulk("x")).Marshal(),
+		},
+		{
+			name:     "LMPOP empty key name",
+			setup:    func(s *structures.Store) { s.RPush("", false, "x") },
+			command:  bulks("LMPOP", "1", "", "LEFT"),
+			expected: resp.Array(resp.Bulk(""), resp.Array(resp.Bulk("x"))).Marshal(),
+		},
+		{
+			name:     "BRPOP times out",
+			setup:    func(s *structures.Store) {},
+			command:  bulks("BRPOP", "a", "0.01"),
+			expected: resp.Nil().Marshal(),
+		},
+		{
+			name:     "BLPOP negative timeout",
+			setup:    func(s *structures.Store) {},
+			command:  bulks("BLPOP", "a", "-1"),
+			expected: resp.Error("ERR timeout is negative").Marshal(),
+		},
+		{
+			name:     "BLPOP invalid timeout",
+			setup:    func(s *structures.Store) {},
+			command:  bulks("BLPOP", "a", "soon"),
+			expected: resp.Error("ERR timeout is not a float or out of range").Marshal(),
+		},
+		{
+			name:     "LMOVE",
+			setup:    func(s *structures.Store) { s.RPush("a", false, "x", "y") },
+			command:  bulks("LMOVE", "a", "b", "RIGHT", "LEFT"),
+			expected: resp.Bulk("y").Marshal(),
+		},
+		{
+			name:     "LMOVE bad direction",
+			setup:    func(s *structures.Store) {},
+			command:  bulks("LMOVE", "a", "b", "UP", "LEFT"),
+			expected: resp.Error("ERR syntax error").Marshal(),
+		},
+		{
+			name:     "BLMOVE times out",
+			setup:    func(s *structures.Store) {},
+			command:  bulks("BLMOVE", "a", "b", "LEFT", "LEFT", "0.01"),
+			expected: resp.Nil().Marshal(),
+		},
+		{
+			name:     "LMPOP with count",
+			setup:    func(s *structures.Store) { s.RPush("b", false, "x", "y", "z") },
+			command:  bulks("LMPOP", "2", "a", "b", "RIGHT", "COUNT", "2"),
+			expected: resp.Array(resp.Bulk("b"), resp.Array(resp.Bulk("z"), resp.Bulk("y"))).Marshal(),
+		},
+		{
+			name:     "LMPOP all empty",
+			setup:    func(s *structures.Store) {},
+			command:  bulks("LMPOP", "1", "a", "LEFT"),
+			expected: resp.Nil().Marshal(),
+		},
+		{
+			name:     "LMPOP zero numkeys",
+			setup:    func(s *structures.Store) {},
+			command:  bulks("LMPOP", "0", "a", "LEFT"),
+			expected: resp.Error("ERR numkeys should be greater than 0").Marshal(),
+		},
+		{
+			name:     "LMPOP numkeys out of range",
+			setup:    func(s *structures.Store) {},
+			command:  bulks("LMPOP", "9223372036854775807", "a", "LEFT"),
+			expected: resp.Error("ERR syntax error").Marshal(),
+		},
+		{
+			name:     "BLMPOP zero count",
+			setup:    func(s *structures.Store) {},
+			command:  bulks("BLMPOP", "0", "1", "a", "LEFT", "COUNT", "0"),
+			expected: resp.Error("ERR count should be greater than 0").Marshal(),
+		},
+		{
+			name:     "BLMPOP available",
+			setup:    func(s *structures.Store) { s.RPush("a", false, "x") },
+			command:  bulks("BLMPOP", "0", "1", "a", "LEFT"),
+			expected: resp.Array(resp.Bulk("a"), resp.Array(resp.Bulk("x"))).Marshal(),
+		},
+	}
+
+	runCommandTests(t, tests)
+}
+
+func TestBlockingListCommands_Propagation(t *testing.T) {
+	master, replica := newTestRouter(), newTestRouter()
+	replicate(master, replica, "RPUSH", "k", "a", "b", "c", "d")
+
+	replicate(master, replica, "BLPOP", "k", "0")
+	replicate(master, replica, "BRPOP", "k", "0")
+	replicate(master, replica, "BLMOVE", "k", "dst", "LEFT", "RIGHT", "0")
+	replicate(master, replica, "BLMPOP", "0", "2", "k", "dst", "RIGHT", "COUNT", "5")
+
+	for _, key := range []string{"k", "dst"} {
+		got, _ := replica.Store.LRange(key, 0, -1)
+		want, _ := master.Store.LRange(key, 0, -1)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("replica %s = %v, want %v", key, got, want)
+		}
+	}
+
+	args := bulks("BLMPOP", "0.01", "1", "k", "LEFT")
+	master.GetHandler("BLMPOP")(args[1:])
+	if got := master.Propagation(args); len(got) != 0 {
+		t.Errorf("Propagation of a BLMPOP that timed out = %v, want none", got)
+	}
+
+	args = bulks("BLPOP", "k", "dst", "0")
+	master.Store.RPush("dst", false, "x")
+	master.GetHandler("BLPOP")(args[1:])
+	want := [][]resp.RESP{bulks("LPOP", "dst", "1")}
+	if got := master.Replication(args, true); len(got) != 1 || !reflect.DeepEqual(got[0].Command, want[0]) {
+		t.Errorf("Replication of BLPOP = %v, want %v", got, want)
+	}
+}
+
+func TestBlockingListCommands_ServedPropagation(t *testing.T) {
+	tests := []struct {
+		name  string
+		block []string
+		write []string
+		want  [][]resp.RESP
+	}{
+		{
+			"BLPOP",
+			[]string{"BLPOP", "q", "0"},
+			[]string{"RPUSH", "q", "a", "b"},
+			[][]resp.RESP{bulks("RPUSH", "q", "a", "b"), bulks("LPOP", "q", "1")},
+		},
+		{
+			"BLMPOP",
+			[]string{"BLMPOP", "0", "1", "q", "RIGHT", "COUNT", "5"},
+			[]string{"LPUSH", "q", "a", "b"},
+			[][]resp.RESP{bulks("LPUSH", "q", "a", "b"), bulks("RPOP", "q", "2")},
+		},
+		{
+			"BLMOVE",
+			[]string{"BLMOVE", "q", "dst", "RIGHT", "LEFT", "0"},
+			[]string{"RPUSH", "q", "a"},
+			[][]resp.RESP{bulks("RPUSH", "q", "a"), bulks("LMOVE", "q", "dst", "RIGHT", "LEFT")},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The pop must reach replicas after the push that served it,
+			// or they would pop from a list that is still empty.
+			got := servedReplication(t, newTestRouter(), "q", tt.block, tt.write...)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("replicated %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/jgrecu/redis-clone/app/resp"
+	"github.com/jgrecu/redis-clone/app/structures"
+	"strconv"
+	"strings"
+)
+
+// memory implements MEMORY USAGE key [SAMPLES count]. Collections keep a
+// running count of their size, so SAMPLES is accepted but never needed.
+func (r *CommandRouter) memory(params []resp.RESP) []byte {
+	if len(params) < 1 {
+		return wrongArgs("memory")
+	}
+
+	subcommand := strings.ToUpper(params[0].Bulk)
+	if subcommand != "USAGE" {
+		return resp.Error(fmt.Sprintf("ERR unknown subcommand '%s'. Try MEMORY HELP.", params[0].Bulk)).Marshal()
+	}
+	if len(params) != 2 && len(params) != 4 {
+		return wrongArgs("memory|usage")
+	}
+	if len(params) == 4 {
+		if !strings.EqualFold(params[2].Bulk, "SAMPLES") {
+			return resp.Error("ERR syntax error").Marshal()
+		}
+		if _, err := strconv.Atoi(params[3].Bulk); err != nil {
+			return resp.Error(errNotInteger).Marshal()
+		}
+	}
+
+	usage, ok := r.Store.MemoryUsage(params[1].Bulk)
+	if !ok {
+		return resp.Nil().Marshal()
+	}
+	return resp.Integer(int(usage)).Marshal()
+}
+
+// object implements OBJECT IDLETIME and OBJECT FREQ, which expose the
+// access metadata kept for the LRU and LFU eviction policies. As in Redis,
+// each is only available when its metadata drives eviction.
+func (r *CommandRouter) object(params []resp.RESP) []byte {
+	if len(params) < 1 {
+		return wrongArgs("object")
+	}
+
+	subcommand := strings.ToUpper(params[0].Bulk)
+	if subcommand != "IDLETIME" && subcommand != "FREQ" {
+		return resp.Error(fmt.Sprintf("ERR unknown subcommand '%s'. Try OBJECT HELP.", params[0].Bulk)).Marshal()
+	}
+	if len(params) != 2 {
+		return wrongArgs("object|" + strings.ToLower(subcommand))
+	}
+
+	policy := r.Store.MemoryStats().Policy
+	lfu := policy == structures.AllKeysLFU || policy == structures.VolatileLFU
+	switch {
+	case subcommand == "IDLETIME" && lfu:
+		return resp.Error("ERR An LFU maxmemory policy is selected, idle time not tracked.").Marshal()
+	case subcommand == "FREQ" && !lfu:
+		return resp.Error("ERR An LFU maxmemory policy is not selected, access frequency not tracked.").Marshal()
+	}
+
+	idle, freq, ok := r.Store.AccessInfo(params[1].Bulk)
+	if !ok {
+		return resp.Nil().Marshal()
+	}
+	if subcommand == "FREQ" {
+		return resp.Integer(freq).Marshal()
+	}
+	return resp.Integer(int(idle.Seconds())).Marshal()
+}
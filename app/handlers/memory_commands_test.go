@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jgrecu/redis-clone/app/resp"
+	"github.com/jgrecu/redis-clone/app/structures"
+)
+
+func TestMemoryCommands(t *testing.T) {
+	oneKey := func(s *structures.Store) { s.Set("a", "1", time.Time{}) }
+	lfu := func(s *structures.Store) {
+		oneKey(s)
+		s.SetMaxMemory(0, structures.AllKeysLFU)
+	}
+
+	tests := []commandTest{
+		{
+			name:     "MEMORY USAGE missing key",
+			setup:    oneKey,
+			command:  bulks("MEMORY", "USAGE", "missing"),
+			expected: resp.Nil().Marshal(),
+		},
+		{
+			name:     "MEMORY USAGE bad SAMPLES",
+			setup:    oneKey,
+			command:  bulks("MEMORY", "USAGE", "a", "SAMPLES", "x"),
+			expected: resp.Error("ERR value is not an integer or out of range").Marshal(),
+		},
+		{
+			name:     "MEMORY USAGE unknown option",
+			setup:    oneKey,
+			command:  bulks("MEMORY", "USAGE", "a", "EXACT", "5"),
+			expected: resp.Error("ERR syntax error").Marshal(),
+		},
+		{
+			name:     "MEMORY unknown subcommand",
+			setup:    oneKey,
+			command:  bulks("MEMORY", "DOCTOR"),
+			expected: resp.Error("ERR unknown subcommand 'DOCTOR'. Try MEMORY HELP.").Marshal(),
+		},
+		{
+			name:     "OBJECT IDLETIME",
+			setup:    oneKey,
+			command:  bulks("OBJECT", "IDLETIME", "a"),
+			expected: resp.Integer(0).Marshal(),
+		},
+		{
+			name:     "OBJECT IDLETIME missing key",
+			setup:    oneKey,
+			command:  bulks("OBJECT", "idletime", "missing"),
+			expected: resp.Nil().Marshal(),
+		},
+		{
+			name:     "OBJECT IDLETIME under LFU",
+			setup:    lfu,
+			command:  bulks("OBJECT", "IDLETIME", "a"),
+			expected: resp.Error("ERR An LFU maxmemory policy is selected, idle time not tracked.").Marshal(),
+		},
+		{
+			name:     "OBJECT FREQ without LFU",
+			setup:    oneKey,
+			command:  bulks("OBJECT", "FREQ", "a"),
+			expected: resp.Error("ERR An LFU maxmemory policy is not selected, access frequency not tracked.").Marshal(),
+		},
+		{
+			name:     "OBJECT wrong number of arguments",
+			setup:    oneKey,
+			command:  bulks("OBJECT", "FREQ"),
+			expected: resp.Error("ERR wrong number of arguments for 'object|freq' command").Marshal(),
+		},
+	}
+
+	runCommandTests(t, tests)
+}
+
+func TestMemoryUsage(t *testing.T) {
+	store := structures.NewStore()
+	router := NewRouter(store)
+	router.rpush(bulks("list", "a", "b", "c"))
+
+	usage, _ := store.MemoryUsage("list")
+	if got := router.memory(bulks("USAGE", "list")); !reflect.DeepEqual(got, resp.Integer(int(usage)).Marshal()) {
+		t.Errorf("MEMORY USAGE = %q, want %d", got, usage)
+	}
+	store.SetMaxMemory(0, structures.VolatileLFU)
+	if got := router.object(bulks("FREQ", "list")); got[0] != ':' {
+		t.Errorf("OBJECT FREQ under LFU = %q, want an integer", got)
+	}
+}
+
+func TestGetHandler_OutOfMemory(t *testing.T) {
+	store := structures.NewStore()
+	router := NewRouter(store)
+	router.GetHandler("SET")(bulks("k", "v"))
+	store.SetMaxMemory(1, structures.NoEviction)
+
+	oom := resp.Error("OOM command not allowed when used memory > 'maxmemory'.").Marshal()
+	if got := router.GetHandler("SET")(bulks("k2", "v")); !reflect.DeepEqual(got, oom) {
+		t.Errorf("SET over maxmemory = %q, want %q", got, oom)
+	}
+	if got := router.Propagation(bulks("SET", "k2", "v")); len(got) != 0 {
+		t.Errorf("Propagation of a refused SET = %v, want none", got)
+	}
+	if got := router.GetHandler("XGROUP")(bulks("CREATE", "s", "g", "$", "MKSTREAM")); !reflect.DeepEqual(got, oom) {
+		t.Errorf("XGROUP CREATE over maxmemory = %q, want %q", got, oom)
+	}
+	if got := router.GetHandler("GET")(bulks("k")); !reflect.DeepEqual(got, resp.Bulk("v").Marshal()) {
+		t.Errorf("GET over maxmemory = %q, want reads to keep working", got)
+	}
+	if got := router.GetHandler("DEL")(bulks("k")); !reflect.DeepEqual(got, resp.Integer(1).Marshal()) {
+		t.Errorf("DEL over maxmemory = %q, want deletions to keep working", got)
+	}
+
+	// With an eviction policy, writes make room instead of failing.
+	router.GetHandler("SET")(bulks("k", "v"))
+	store.SetMaxMemory(1, structures.AllKeysRandom)
+	if got := router.GetHandler("SET")(bulks("k2", "v")); !reflect.DeepEqual(got, resp.String("OK").Marshal()) {
+		t.Errorf("SET with allkeys-random = %q, want OK", got)
+	}
+	if store.Exists("k") != 0 {
+		t.Error("allkeys-random should have evicted k to make room")
+	}
+}
+
+func TestInfoMemory(t *testing.T) {
+	store := structures.NewStore()
+	store.SetMaxMemory(1<<20, structures.AllKeysLRU)
+	router := NewRouter(store)
+
+	result := string(router.info(bulks("memory")))
+	for _, field := range []string{"used_memory:0", "maxmemory:1048576", "maxmemory_policy:allkeys-lru"} {
+		if !strings.Contains(result, field) {
+			t.Errorf("info(memory) = %q, missing %q", result, field)
+		}
+	}
+	if stats := string(router.info(bulks("stats"))); !strings.Contains(stats, "evicted_keys:0") {
+		t.Errorf("info(stats) = %q, missing evicted_keys", stats)
+	}
+}
@@ -0,0 +1,283 @@
+package handlers
+
+import (
+	"github.com/jgrecu/redis-clone/app/resp"
+	"math"
+	"strconv"
+	"strings"
+)
+
+func (r *CommandRouter) sadd(params []resp.RESP) []byte {
+	if len(params) < 2 {
+		return wrongArgs("sadd")
+	}
+
+	added, err := r.Store.SAdd(params[0].Bulk, bulkParams(params[1:])...)
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+	return resp.Integer(added).Marshal()
+}
+
+func (r *CommandRouter) srem(params []resp.RESP) []byte {
+	if len(params) < 2 {
+		return wrongArgs("srem")
+	}
+
+	removed, err := r.Store.SRem(params[0].Bulk, bulkParams(params[1:])...)
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+	return resp.Integer(removed).Marshal()
+}
+
+func (r *CommandRouter) smembers(params []resp.RESP) []byte {
+	if len(params) != 1 {
+		return wrongArgs("smembers")
+	}
+
+	members, err := r.Store.SMembers(params[0].Bulk)
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+	return bulkArray(members).Marshal()
+}
+
+func (r *CommandRouter) sismember(params []resp.RESP) []byte {
+	if len(params) != 2 {
+		return wrongArgs("sismember")
+	}
+
+	found, err := r.Store.SIsMember(params[0].Bulk, params[1].Bulk)
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+	return resp.Integer(boolToInt(found[0])).Marshal()
+}
+
+func (r *CommandRouter) smismember(params []resp.RESP) []byte {
+	if len(params) < 2 {
+		return wrongArgs("smismember")
+	}
+
+	found, err := r.Store.SIsMember(params[0].Bulk, bulkParams(params[1:])...)
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+
+	codes := make([]int, len(found))
+	for i, f := range found {
+		codes[i] = boolToInt(f)
+	}
+	return integerArray(codes).Marshal()
+}
+
+func (r *CommandRouter) scard(params []resp.RESP) []byte {
+	if len(params) != 1 {
+		return wrongArgs("scard")
+	}
+
+	card, err := r.Store.SCard(params[0].Bulk)
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+	return resp.Integer(card).Marshal()
+}
+
+func (r *CommandRouter) spop(params []resp.RESP) []byte {
+	if len(params) < 1 || len(params) > 2 {
+		return wrongArgs("spop")
+	}
+
+	if len(params) == 1 {
+		members, err := r.Store.SPop(params[0].Bulk, 1)
+		r.rewriteSPop(params[0].Bulk, members)
+		if err != nil {
+			return resp.Error(err.Error()).Marshal()
+		}
+		if len(members) == 0 {
+			return resp.Nil().Marshal()
+		}
+		return resp.Bulk(members[0]).Marshal()
+	}
+
+	count, err := strconv.Atoi(params[1].Bulk)
+	if err != nil {
+		return resp.Error(errNotInteger).Marshal()
+	}
+	if count < 0 {
+		return resp.Error("ERR value is out of range, must be positive").Marshal()
+	}
+
+	members, err := r.Store.SPop(params[0].Bulk, count)
+	r.rewriteSPop(params[0].Bulk, members)
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+	return bulkArray(members).Marshal()
+}
+
+// rewriteSPop propagates SPOP as the SREM of the members it popped, since
+// replicas would pick others at random.
+func (r *CommandRouter) rewriteSPop(key string, members []string) {
+	r.rewrite()
+	if len(members) > 0 {
+		r.rewrite(resp.Command("SREM", append([]string{key}, members...)...))
+	}
+}
+
+func (r *CommandRouter) srandmember(params []resp.RESP) []byte {
+	if len(params) < 1 || len(params) > 2 {
+		return wrongArgs("srandmember")
+	}
+
+	if len(params) == 1 {
+		members, err := r.Store.SRandMember(params[0].Bulk, 1)
+		if err != nil {
+			return resp.Error(err.Error()).Marshal()
+		}
+		if len(members) == 0 {
+			return resp.Nil().Marshal()
+		}
+		return resp.Bulk(members[0]).Marshal()
+	}
+
+	count, err := strconv.Atoi(params[1].Bulk)
+	if err != nil {
+		return resp.Error(errNotInteger).Marshal()
+	}
+	// -count must fit, as Redis only accepts -LONG_MAX to LONG_MAX.
+	if count == math.MinInt {
+		return resp.Error("ERR value is out of range").Marshal()
+	}
+
+	members, err := r.Store.SRandMember(params[0].Bulk, count)
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+	return bulkArray(members).Marshal()
+}
+
+func (r *CommandRouter) smove(params []resp.RESP) []byte {
+	if len(params) != 3 {
+		return wrongArgs("smove")
+	}
+
+	moved, err := r.Store.SMove(params[0].Bulk, params[1].Bulk, params[2].Bulk)
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+	return resp.Integer(boolToInt(moved)).Marshal()
+}
+
+func (r *CommandRouter) sinter(params []resp.RESP) []byte {
+	return r.setAlgebra("sinter", params, r.Store.SInter)
+}
+
+func (r *CommandRouter) sunion(params []resp.RESP) []byte {
+	return r.setAlgebra("sunion", params, r.Store.SUnion)
+}
+
+func (r *CommandRouter) sdiff(params []resp.RESP) []byte {
+	return r.setAlgebra("sdiff", params, r.Store.SDiff)
+}
+
+// setAlgebra replies with the members computed by op over the given keys.
+func (r *CommandRouter) setAlgebra(name string, params []resp.RESP, op func(...string) ([]string, error)) []byte {
+	if len(params) < 1 {
+		return wrongArgs(name)
+	}
+
+	members, err := op(bulkParams(params)...)
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+	return bulkArray(members).Marshal()
+}
+
+func (r *CommandRouter) sinterstore(params []resp.RESP) []byte {
+	return r.setAlgebraStore("sinterstore", params, r.Store.SInterStore)
+}
+
+func (r *CommandRouter) sunionstore(params []resp.RESP) []byte {
+	return r.setAlgebraStore("sunionstore", params, r.Store.SUnionStore)
+}
+
+func (r *CommandRouter) sdiffstore(params []resp.RESP) []byte {
+	return r.setAlgebraStore("sdiffstore", params, r.Store.SDiffStore)
+}
+
+// setAlgebraStore stores the result of op in the destination key and
+// replies with its size.
+func (r *CommandRouter) setAlgebraStore(name string, params []resp.RESP, op func(string, ...string) (int, error)) []byte {
+	if len(params) < 2 {
+		return wrongArgs(name)
+	}
+
+	size, err := op(params[0].Bulk, bulkParams(params[1:])...)
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+	return resp.Integer(size).Marshal()
+}
+
+func (r *CommandRouter) sintercard(params []resp.RESP) []byte {
+	if len(params) < 2 {
+		return wrongArgs("sintercard")
+	}
+
+	numKeys, err := strconv.Atoi(params[0].Bulk)
+	if err != nil {
+		return resp.Error(errNotInteger).Marshal()
+	}
+	if numKeys <= 0 {
+		return resp.Error("ERR numkeys should be greater than 0").Marshal()
+	}
+	if numKeys > len(params)-1 {
+		return resp.Error("ERR Number of keys can't be greater than number of args").Marshal()
+	}
+
+	keys := bulkParams(params[1 : numKeys+1])
+	rest := params[numKeys+1:]
+
+	limit := 0
+	if len(rest) > 0 {
+		if len(rest) != 2 || strings.ToUpper(rest[0].Bulk) != "LIMIT" {
+			return resp.Error("ERR syntax error").Marshal()
+		}
+		limit, err = strconv.Atoi(rest[1].Bulk)
+		if err != nil {
+			return resp.Error(errNotInteger).Marshal()
+		}
+		if limit < 0 {
+			return resp.Error("ERR LIMIT can't be negative").Marshal()
+		}
+	}
+
+	card, err := r.Store.SInterCard(limit, keys...)
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+	return resp.Integer(card).Marshal()
+}
+
+func (r *CommandRouter) sscan(params []resp.RESP) []byte {
+	if len(params) < 2 {
+		return wrongArgs("sscan")
+	}
+
+	cursor, err := parseCursor(params[1].Bulk)
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+	opts, err := parseScanOptions(params[2:], "sscan")
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+
+	next, members, err := r.Store.SScan(params[0].Bulk, cursor, opts.count, opts.match)
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+	return scanReply(next, bulkArray(members)).Marshal()
+}
@@ -0,0 +1,209 @@
+package handlers
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jgrecu/redis-clone/app/resp"
+	"github.com/jgrecu/redis-clone/app/structures"
+)
+
+func TestSetCommands(t *testing.T) {
+	tests := []commandTest{
+		{
+			name:     "SADD creates set",
+			setup:    func(s *structures.Store) {},
+			command:  bulks("SADD", "s", "a", "b", "a"),
+			expected: resp.Integer(2).Marshal(),
+		},
+		{
+			name:     "SADD wrong number of arguments",
+			setup:    func(s *structures.Store) {},
+			command:  bulks("SADD", "s"),
+			expected: resp.Error("ERR wrong number of arguments for 'sadd' command").Marshal(),
+		},
+		{
+			name:     "SADD against string",
+			setup:    func(s *structures.Store) { s.Set("str", "v", time.Time{}) },
+			command:  bulks("SADD", "str", "a"),
+			expected: wrongType,
+		},
+		{
+			name:     "SREM",
+			setup:    func(s *structures.Store) { s.SAdd("s", "a", "b") },
+			command:  bulks("SREM", "s", "a", "c"),
+			expected: resp.Integer(1).Marshal(),
+		},
+		{
+			name:     "SMEMBERS missing key",
+			setup:    func(s *structures.Store) {},
+			command:  bulks("SMEMBERS", "s"),
+			expected: resp.Array().Marshal(),
+		},
+		{
+			name:     "SISMEMBER",
+			setup:    func(s *structures.Store) { s.SAdd("s", "a") },
+			command:  bulks("SISMEMBER", "s", "a"),
+			expected: resp.Integer(1).Marshal(),
+		},
+		{
+			name:     "SMISMEMBER",
+			setup:    func(s *structures.Store) { s.SAdd("s", "a") },
+			command:  bulks("SMISMEMBER", "s", "b", "a"),
+			expected: resp.Array(resp.Integer(0), resp.Integer(1)).Marshal(),
+		},
+		{
+			name:     "SCARD",
+			setup:    func(s *structures.Store) { s.SAdd("s", "a", "b") },
+			command:  bulks("SCARD", "s"),
+			expected: resp.Integer(2).Marshal(),
+		},
+		{
+			name:     "SPOP single",
+			setup:    func(s *structures.Store) { s.SAdd("s", "a") },
+			command:  bulks("SPOP", "s"),
+			expected: resp.Bulk("a").Marshal(),
+		},
+		{
+			name:     "SPOP missing key",
+			setup:    func(s *structures.Store) {},
+			command:  bulks("SPOP", "s"),
+			expected: resp.Nil().Marshal(),
+		},
+		{
+			name:     "SPOP count on missing key",
+			setup:    func(s *structures.Store) {},
+			command:  bulks("SPOP", "s", "2"),
+			expected: resp.Array().Marshal(),
+		},
+		{
+			name:     "SPOP negative count",
+			setup:    func(s *structures.Store) { s.SAdd("s", "a") },
+			command:  bulks("SPOP", "s", "-1"),
+			expected: resp.Error("ERR value is out of range, must be positive").Marshal(),
+		},
+		{
+			name:     "SRANDMEMBER negative count repeats",
+			setup:    func(s *structures.Store) { s.SAdd("s", "a") },
+			command:  bulks("SRANDMEMBER", "s", "-3"),
+			expected: resp.Array(resp.Bulk("a"), resp.Bulk("a"), resp.Bulk("a")).Marshal(),
+		},
+		{
+			name:     "SRANDMEMBER non-integer count",
+			setup:    func(s *structures.Store) {},
+			command:  bulks("SRANDMEMBER", "s", "x"),
+			expected: resp.Error(errNotInteger).Marshal(),
+		},
+		{
+			name:     "SRANDMEMBER count out of range",
+			setup:    func(s *structures.Store) { s.SAdd("s", "a") },
+			command:  bulks("SRANDMEMBER", "s", "-9223372036854775808"),
+			expected: resp.Error("ERR value is out of range").Marshal(),
+		},
+		{
+			name:     "SMOVE",
+			setup:    func(s *structures.Store) { s.SAdd("a", "x") },
+			command:  bulks("SMOVE", "a", "b", "x"),
+			expected: resp.Integer(1).Marshal(),
+		},
+		{
+			name:     "SMOVE against string destination",
+			setup:    func(s *structures.Store) { s.SAdd("a", "x"); s.Set("str", "v", time.Time{}) },
+			command:  bulks("SMOVE", "a", "str", "x"),
+			expected: wrongType,
+		},
+		{
+			name:     "SINTER",
+			setup:    func(s *structures.Store) { s.SAdd("a", "x", "y"); s.SAdd("b", "y") },
+			command:  bulks("SINTER", "a", "b"),
+			expected: resp.Array(resp.Bulk("y")).Marshal(),
+		},
+		{
+			name:     "SDIFF missing first key",
+			setup:    func(s *structures.Store) { s.SAdd("b", "y") },
+			command:  bulks("SDIFF", "a", "b"),
+			expected: resp.Array().Marshal(),
+		},
+		{
+			name:     "SUNION against string",
+			setup:    func(s *structures.Store) { s.Set("str", "v", time.Time{}) },
+			command:  bulks("SUNION", "a", "str"),
+			expected: wrongType,
+		},
+		{
+			name:     "SUNIONSTORE",
+			setup:    func(s *structures.Store) { s.SAdd("a", "x"); s.SAdd("b", "y") },
+			command:  bulks("SUNIONSTORE", "dst", "a", "b"),
+			expected: resp.Integer(2).Marshal(),
+		},
+		{
+			name:     "SINTERSTORE wrong number of arguments",
+			setup:    func(s *structures.Store) {},
+			command:  bulks("SINTERSTORE", "dst"),
+			expected: resp.Error("ERR wrong number of arguments for 'sinterstore' command").Marshal(),
+		},
+		{
+			name:     "SINTERCARD with LIMIT",
+			setup:    func(s *structures.Store) { s.SAdd("a", "x", "y", "z"); s.SAdd("b", "x", "y", "z") },
+			command:  bulks("SINTERCARD", "2", "a", "b", "LIMIT", "1"),
+			expected: resp.Integer(1).Marshal(),
+		},
+		{
+			name:     "SINTERCARD too many numkeys",
+			setup:    func(s *structures.Store) {},
+			command:  bulks("SINTERCARD", "3", "a", "b"),
+			expected: resp.Error("ERR Number of keys can't be greater than number of args").Marshal(),
+		},
+		{
+			name:     "SINTERCARD negative LIMIT",
+			setup:    func(s *structures.Store) {},
+			command:  bulks("SINTERCARD", "1", "a", "LIMIT", "-1"),
+			expected: resp.Error("ERR LIMIT can't be negative").Marshal(),
+		},
+		{
+			name:     "SSCAN MATCH",
+			setup:    func(s *structures.Store) { s.SAdd("s", "apple", "banana") },
+			command:  bulks("SSCAN", "s", "0", "MATCH", "a*", "COUNT", "5"),
+			expected: resp.Array(resp.Bulk("0"), resp.Array(resp.Bulk("apple"))).Marshal(),
+		},
+		{
+			name:     "SSCAN rejects NOVALUES",
+			setup:    func(s *structures.Store) {},
+			command:  bulks("SSCAN", "s", "0", "NOVALUES"),
+			expected: resp.Error("ERR syntax error").Marshal(),
+		},
+		{
+			name:     "SSCAN against string",
+			setup:    func(s *structures.Store) { s.Set("str", "v", time.Time{}) },
+			command:  bulks("SSCAN", "str", "0"),
+			expected: wrongType,
+		},
+	}
+
+	runCommandTests(t, tests)
+}
+
+func TestSPop_Propagation(t *testing.T) {
+	master, replica := newTestRouter(), newTestRouter()
+	replicate(master, replica, "SADD", "s", "a", "b", "c", "d")
+
+	replicate(master, replica, "SPOP", "s")
+	replicate(master, replica, "SPOP", "s", "2")
+	got, _ := replica.Store.SMembers("s")
+	want, _ := master.Store.SMembers("s")
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("replica members = %v, want %v", got, want)
+	}
+
+	replicate(master, replica, "SPOP", "s", "5")
+	if replica.Store.Exists("s") != 0 {
+		t.Error("replica kept the set SPOP emptied")
+	}
+
+	args := bulks("SPOP", "s")
+	master.GetHandler("SPOP")(args[1:])
+	if got := master.Propagation(args); len(got) != 0 {
+		t.Errorf("Propagation of an SPOP popping nothing = %v, want none", got)
+	}
+}
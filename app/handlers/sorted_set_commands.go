@@ -0,0 +1,684 @@
+package handlers
+
+import (
+	"errors"
+	"github.com/jgrecu/redis-clone/app/resp"
+	"github.com/jgrecu/redis-clone/app/structures"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// parseScore parses a sorted set score, accepting "inf", "+inf" and "-inf"
+// but rejecting NaN.
+func parseScore(s string) (float64, error) {
+	score, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(score) {
+		return 0, strconv.ErrSyntax
+	}
+	return score, nil
+}
+
+// formatScore renders a score the way Redis does: the shortest decimal that
+// round-trips, switching to exponent notation only for very large or small
+// magnitudes, and "inf"/"-inf" for infinities.
+func formatScore(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	case f == 0:
+		return "0"
+	}
+
+	// Shortest digits and decimal exponent, e.g. "-1.25e+03".
+	e := strconv.FormatFloat(f, 'e', -1, 64)
+	mantissa, expPart, _ := strings.Cut(e, "e")
+	exp, _ := strconv.Atoi(expPart)
+	sign := ""
+	if strings.HasPrefix(mantissa, "-") {
+		sign, mantissa = "-", mantissa[1:]
+	}
+	digits := strings.Replace(mantissa, ".", "", 1)
+
+	// Same thresholds as the fpconv_dtoa routine Redis uses.
+	k := exp - len(digits) + 1
+	absExp := exp
+	if absExp < 0 {
+		absExp = -absExp
+	}
+	if (k >= 0 && absExp < len(digits)+7) || (k < 0 && (k > -7 || absExp < 4)) {
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+
+	out := sign + digits[:1]
+	if len(digits) > 1 {
+		out += "." + digits[1:]
+	}
+	if exp < 0 {
+		return out + "e-" + strconv.Itoa(-exp)
+	}
+	return out + "e+" + strconv.Itoa(exp)
+}
+
+func (r *CommandRouter) zadd(params []resp.RESP) []byte {
+	if len(params) < 3 {
+		return wrongArgs("zadd")
+	}
+
+	var opts structures.ZAddOptions
+	ch, incr := false, false
+	i := 1
+flags:
+	for ; i < len(params); i++ {
+		switch strings.ToUpper(params[i].Bulk) {
+		case "NX":
+			opts.NX = true
+		case "XX":
+			opts.XX = true
+		case "GT":
+			opts.GT = true
+		case "LT":
+			opts.LT = true
+		case "CH":
+			ch = true
+		case "INCR":
+			incr = true
+		default:
+			break flags
+		}
+	}
+
+	rest := params[i:]
+	if len(rest) == 0 || len(rest)%2 != 0 {
+		return resp.Error("ERR syntax error").Marshal()
+	}
+	if incr && len(rest) != 2 {
+		return resp.Error("ERR INCR option supports a single increment-element pair").Marshal()
+	}
+	if opts.NX && opts.XX {
+		return resp.Error("ERR XX and NX options at the same time are not compatible").Marshal()
+	}
+	if (opts.GT && opts.NX) || (opts.LT && opts.NX) || (opts.GT && opts.LT) {
+		return resp.Error("ERR GT, LT, and/or NX options at the same time are not compatible").Marshal()
+	}
+
+	members := make([]structures.ScoredMember, 0, len(rest)/2)
+	for j := 0; j < len(rest); j += 2 {
+		score, err := parseScore(rest[j].Bulk)
+		if err != nil {
+			return resp.Error(errNotFloat).Marshal()
+		}
+		members = append(members, structures.ScoredMember{Member: rest[j+1].Bulk, Score: score})
+	}
+
+	if incr {
+		score, ok, err := r.Store.ZIncrBy(params[0].Bulk, members[0].Member, members[0].Score, opts)
+		if err != nil {
+			return resp.Error(err.Error()).Marshal()
+		}
+		if !ok {
+			return resp.Nil().Marshal()
+		}
+		return resp.Bulk(formatScore(score)).Marshal()
+	}
+
+	added, updated, err := r.Store.ZAdd(params[0].Bulk, opts, members)
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+	if ch {
+		return resp.Integer(added + updated).Marshal()
+	}
+	return resp.Integer(added).Marshal()
+}
+
+func (r *CommandRouter) zincrby(params []resp.RESP) []byte {
+	if len(params) != 3 {
+		return wrongArgs("zincrby")
+	}
+
+	delta, err := parseScore(params[1].Bulk)
+	if err != nil {
+		return resp.Error(errNotFloat).Marshal()
+	}
+
+	score, _, err := r.Store.ZIncrBy(params[0].Bulk, params[2].Bulk, delta, structures.ZAddOptions{})
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+	return resp.Bulk(formatScore(score)).Marshal()
+}
+
+func (r *CommandRouter) zscore(params []resp.RESP) []byte {
+	if len(params) != 2 {
+		return wrongArgs("zscore")
+	}
+
+	score, ok, err := r.Store.ZScore(params[0].Bulk, params[1].Bulk)
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+	if !ok {
+		return resp.Nil().Marshal()
+	}
+	return resp.Bulk(formatScore(score)).Marshal()
+}
+
+func (r *CommandRouter) zrank(params []resp.RESP) []byte {
+	return r.zrankGeneric("zrank", params, false)
+}
+
+func (r *CommandRouter) zrevrank(params []resp.RESP) []byte {
+	return r.zrankGeneric("zrevrank", params, true)
+}
+
+func (r *CommandRouter) zrankGeneric(name string, params []resp.RESP, reverse bool) []byte {
+	if len(params) < 2 || len(params) > 3 {
+		return wrongArgs(name)
+	}
+	withScore := len(params) == 3
+	if withScore && strings.ToUpper(params[2].Bulk) != "WITHSCORE" {
+		return resp.Error("ERR syntax error").Marshal()
+	}
+
+	rank, score, ok, err := r.Store.ZRank(params[0].Bulk, params[1].Bulk, reverse)
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+	if !ok {
+		return resp.Nil().Marshal()
+	}
+	if withScore {
+		return resp.Array(resp.Integer(rank), resp.Bulk(formatScore(score))).Marshal()
+	}
+	return resp.Integer(rank).Marshal()
+}
+
+func (r *CommandRouter) zcard(params []resp.RESP) []byte {
+	if len(params) != 1 {
+		return wrongArgs("zcard")
+	}
+
+	card, err := r.Store.ZCard(params[0].Bulk)
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+	return resp.Integer(card).Marshal()
+}
+
+func (r *CommandRouter) zrem(params []resp.RESP) []byte {
+	if len(params) < 2 {
+		return wrongArgs("zrem")
+	}
+
+	removed, err := r.Store.ZRem(params[0].Bulk, bulkParams(params[1:])...)
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+	return resp.Integer(removed).Marshal()
+}
+
+// zrangeArgs holds the parsed arguments of ZRANGE and its variants.
+type zrangeArgs struct {
+	spec       structures.RangeSpec
+	withScores bool
+}
+
+// parseZRange parses "start stop [options]" for ZRANGE-style commands. The
+// legacy commands fix by and rev and pass flexible=false so BYSCORE, BYLEX
+// and REV are rejected; allowScores controls whether WITHSCORES is accepted.
+func parseZRange(params []resp.RESP, by structures.RangeBy, rev, flexible, allowScores bool) (zrangeArgs, error) {
+	args := zrangeArgs{spec: structures.RangeSpec{By: by, Rev: rev, Count: -1}}
+	limit := false
+
+	for i := 2; i < len(params); i++ {
+		switch opt := strings.ToUpper(params[i].Bulk); {
+		case opt == "WITHSCORES" && allowScores:
+			args.withScores = true
+		case opt == "LIMIT" && i+2 < len(params):
+			offset, err1 := strconv.Atoi(params[i+1].Bulk)
+			count, err2 := strconv.Atoi(params[i+2].Bulk)
+			if err1 != nil || err2 != nil {
+				return args, errors.New(errNotInteger)
+			}
+			args.spec.Offset, args.spec.Count = offset, count
+			limit = true
+			i += 2
+		case opt == "BYSCORE" && flexible:
+			args.spec.By = structures.RangeByScore
+		case opt == "BYLEX" && flexible:
+			args.spec.By = structures.RangeByLex
+		case opt == "REV" && flexible:
+			args.spec.Rev = true
+		default:
+			return args, errors.New("ERR syntax error")
+		}
+	}
+
+	if limit && args.spec.By == structures.RangeByRank {
+		return args, errors.New("ERR syntax error, LIMIT is only supported in combination with either BYSCORE or BYLEX")
+	}
+	if args.withScores && args.spec.By == structures.RangeByLex {
+		return args, errors.New("ERR syntax error, WITHSCORES not supported in combination with BYLEX")
+	}
+
+	var err error
+	args.spec, err = parseRangeBounds(args.spec, params[0].Bulk, params[1].Bulk)
+	return args, err
+}
+
+// parseRangeBounds fills in the bounds of spec. For reversed score and lex
+// ranges the first bound is the maximum, as in ZREVRANGEBYSCORE.
+func parseRangeBounds(spec structures.RangeSpec, start, stop string) (structures.RangeSpec, error) {
+	if spec.Rev && spec.By != structures.RangeByRank {
+		start, stop = stop, start
+	}
+
+	var err error
+	switch spec.By {
+	case structures.RangeByScore:
+		spec.Score, err = structures.ParseScoreRange(start, stop)
+	case structures.RangeByLex:
+		spec.Lex, err = structures.ParseLexRange(start, stop)
+	default:
+		var err1, err2 error
+		spec.Start, err1 = strconv.Atoi(start)
+		spec.Stop, err2 = strconv.Atoi(stop)
+		if err1 != nil || err2 != nil {
+			err = errors.New(errNotInteger)
+		}
+	}
+	return spec, err
+}
+
+// scoredArray replies with members, interleaving their scores if
+// withScores is set.
+func scoredArray(members []structures.ScoredMember, withScores bool) resp.RESP {
+	result := make([]resp.RESP, 0, len(members)*2)
+	for _, m := range members {
+		result = append(result, resp.Bulk(m.Member))
+		if withScores {
+			result = append(result, resp.Bulk(formatScore(m.Score)))
+		}
+	}
+	return resp.Array(result...)
+}
+
+func (r *CommandRouter) zrange(params []resp.RESP) []byte {
+	return r.zrangeGeneric("zrange", params, structures.RangeByRank, false, true, true)
+}
+
+func (r *CommandRouter) zrevrange(params []resp.RESP) []byte {
+	return r.zrangeGeneric("zrevrange", params, structures.RangeByRank, true, false, true)
+}
+
+func (r *CommandRouter) zrangebyscore(params []resp.RESP) []byte {
+	return r.zrangeGeneric("zrangebyscore", params, structures.RangeByScore, false, false, true)
+}
+
+func (r *CommandRouter) zrevrangebyscore(params []resp.RESP) []byte {
+	return r.zrangeGeneric("zrevrangebyscore", params, structures.RangeByScore, true, false, true)
+}
+
+func (r *CommandRouter) zrangebylex(params []resp.RESP) []byte {
+	return r.zrangeGeneric("zrangebylex", params, structures.RangeByLex, false, false, false)
+}
+
+func (r *CommandRouter) zrevrangebylex(params []resp.RESP) []byte {
+	return r.zrangeGeneric("zrevrangebylex", params, structures.RangeByLex, true, false, false)
+}
+
+func (r *CommandRouter) zrangeGeneric(name string, params []resp.RESP, by structures.RangeBy, rev, flexible, allowScores bool) []byte {
+	if len(params) < 3 {
+		return wrongArgs(name)
+	}
+
+	args, err := parseZRange(params[1:], by, rev, flexible, allowScores)
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+
+	members, err := r.Store.ZRange(params[0].Bulk, args.spec)
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+	return scoredArray(members, args.withScores).Marshal()
+}
+
+func (r *CommandRouter) zrangestore(params []resp.RESP) []byte {
+	if len(params) < 4 {
+		return wrongArgs("zrangestore")
+	}
+
+	args, err := parseZRange(params[2:], structures.RangeByRank, false, true, false)
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+
+	stored, err := r.Store.ZRangeStore(params[0].Bulk, params[1].Bulk, args.spec)
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+	return resp.Integer(stored).Marshal()
+}
+
+func (r *CommandRouter) zcount(params []resp.RESP) []byte {
+	if len(params) != 3 {
+		return wrongArgs("zcount")
+	}
+
+	rng, err := structures.ParseScoreRange(params[1].Bulk, params[2].Bulk)
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+
+	count, err := r.Store.ZCount(params[0].Bulk, rng)
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+	return resp.Integer(count).Marshal()
+}
+
+func (r *CommandRouter) zlexcount(params []resp.RESP) []byte {
+	if len(params) != 3 {
+		return wrongArgs("zlexcount")
+	}
+
+	rng, err := structures.ParseLexRange(params[1].Bulk, params[2].Bulk)
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+
+	count, err := r.Store.ZLexCount(params[0].Bulk, rng)
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+	return resp.Integer(count).Marshal()
+}
+
+func (r *CommandRouter) zremrangebyrank(params []resp.RESP) []byte {
+	return r.zremrangeGeneric("zremrangebyrank", params, structures.RangeByRank)
+}
+
+func (r *CommandRouter) zremrangebyscore(params []resp.RESP) []byte {
+	return r.zremrangeGeneric("zremrangebyscore", params, structures.RangeByScore)
+}
+
+func (r *CommandRouter) zremrangebylex(params []resp.RESP) []byte {
+	return r.zremrangeGeneric("zremrangebylex", params, structures.RangeByLex)
+}
+
+func (r *CommandRouter) zremrangeGeneric(name string, params []resp.RESP, by structures.RangeBy) []byte {
+	if len(params) != 3 {
+		return wrongArgs(name)
+	}
+
+	spec, err := parseRangeBounds(structures.RangeSpec{By: by, Count: -1}, params[1].Bulk, params[2].Bulk)
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+
+	removed, err := r.Store.ZRemRange(params[0].Bulk, spec)
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+	return resp.Integer(removed).Marshal()
+}
+
+// parseMinMax parses a MIN|MAX argument, returning true for MAX.
+func parseMinMax(value string) (bool, bool) {
+	switch strings.ToUpper(value) {
+	case "MIN":
+		return false, true
+	case "MAX":
+		return true, true
+	}
+	return false, false
+}
+
+func (r *CommandRouter) zpopmin(params []resp.RESP) []byte {
+	return r.zpopGeneric("zpopmin", params, false)
+}
+
+func (r *CommandRouter) zpopmax(params []resp.RESP) []byte {
+	return r.zpopGeneric("zpopmax", params, true)
+}
+
+func (r *CommandRouter) zpopGeneric(name string, params []resp.RESP, max bool) []byte {
+	if len(params) < 1 || len(params) > 2 {
+		return wrongArgs(name)
+	}
+
+	count := 1
+	if len(params) == 2 {
+		var err error
+		count, err = strconv.Atoi(params[1].Bulk)
+		if err != nil {
+			return resp.Error(errNotInteger).Marshal()
+		}
+		if count < 0 {
+			return resp.Error("ERR value is out of range, must be positive").Marshal()
+		}
+	}
+
+	members, err := r.Store.ZPop(params[0].Bulk, max, count)
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+	return scoredArray(members, true).Marshal()
+}
+
+func (r *CommandRouter) bzpopmin(params []resp.RESP) []byte {
+	return r.bzpopGeneric("bzpopmin", params, false)
+}
+
+func (r *CommandRouter) bzpopmax(params []resp.RESP) []byte {
+	return r.bzpopGeneric("bzpopmax", params, true)
+}
+
+func (r *CommandRouter) bzpopGeneric(name string, params []resp.RESP, max bool) []byte {
+	if len(params) < 2 {
+		return wrongArgs(name)
+	}
+
+	timeout, err := parseTimeout(params[len(params)-1].Bulk)
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+
+	// The store records the pop, if any, for replicas.
+	key, members, ok, err := r.Store.BZMPop(bulkParams(params[:len(params)-1]), max, 1, timeout)
+	r.rewrite()
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+	if !ok {
+		return resp.Nil().Marshal()
+	}
+	return resp.Array(resp.Bulk(key), resp.Bulk(members[0].Member), resp.Bulk(formatScore(members[0].Score))).Marshal()
+}
+
+func (r *CommandRouter) zmpop(params []resp.RESP) []byte {
+	if len(params) < 3 {
+		return wrongArgs("zmpop")
+	}
+
+	keys, max, count, err := parseMPop(params, parseMinMax)
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+
+	key, members, ok, err := r.Store.ZMPop(keys, max, count)
+	return formatZMPop(key, members, ok, err)
+}
+
+func (r *CommandRouter) bzmpop(params []resp.RESP) []byte {
+	if len(params) < 4 {
+		return wrongArgs("bzmpop")
+	}
+
+	timeout, err := parseTimeout(params[0].Bulk)
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+
+	keys, max, count, err := parseMPop(params[1:], parseMinMax)
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+
+	// The store records the pop, if any, for replicas.
+	key, members, ok, err := r.Store.BZMPop(keys, max, count, timeout)
+	r.rewrite()
+	return formatZMPop(key, members, ok, err)
+}
+
+// formatZMPop builds the [key, [[member, score], ...]] reply of ZMPOP and
+// BZMPOP, nil if nothing was popped.
+func formatZMPop(key string, members []structures.ScoredMember, ok bool, err error) []byte {
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+	if !ok {
+		return resp.Nil().Marshal()
+	}
+
+	pairs := make([]resp.RESP, len(members))
+	for i, m := range members {
+		pairs[i] = resp.Array(resp.Bulk(m.Member), resp.Bulk(formatScore(m.Score)))
+	}
+	return resp.Array(resp.Bulk(key), resp.Array(pairs...)).Marshal()
+}
+
+func (r *CommandRouter) zrandmember(params []resp.RESP) []byte {
+	if len(params) < 1 || len(params) > 3 {
+		return wrongArgs("zrandmember")
+	}
+
+	if len(params) == 1 {
+		members, err := r.Store.ZRandMember(params[0].Bulk, 1)
+		if err != nil {
+			return resp.Error(err.Error()).Marshal()
+		}
+		if len(members) == 0 {
+			return resp.Nil().Marshal()
+		}
+		return resp.Bulk(members[0].Member).Marshal()
+	}
+
+	count, err := strconv.Atoi(params[1].Bulk)
+	if err != nil {
+		return resp.Error(errNotInteger).Marshal()
+	}
+	withScores := len(params) == 3
+	if withScores && strings.ToUpper(params[2].Bulk) != "WITHSCORES" {
+		return resp.Error("ERR syntax error").Marshal()
+	}
+	// Like Redis, -count must fit, and so must the reply length when each
+	// member comes with its score.
+	if count == math.MinInt || withScores && (count < -math.MaxInt/2 || count > math.MaxInt/2) {
+		return resp.Error("ERR value is out of range").Marshal()
+	}
+
+	members, err := r.Store.ZRandMember(params[0].Bulk, count)
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+	return scoredArray(members, withScores).Marshal()
+}
+
+func (r *CommandRouter) zunionstore(params []resp.RESP) []byte {
+	return r.zsetAlgebraStore("zunionstore", params, r.Store.ZUnionStore)
+}
+
+func (r *CommandRouter) zinterstore(params []resp.RESP) []byte {
+	return r.zsetAlgebraStore("zinterstore", params, r.Store.ZInterStore)
+}
+
+func (r *CommandRouter) zdiffstore(params []resp.RESP) []byte {
+	return r.zsetAlgebraStore("zdiffstore", params, func(dst string, keys []string, _ []float64, _ structures.Aggregate) (int, error) {
+		return r.Store.ZDiffStore(dst, keys)
+	})
+}
+
+// zsetAlgebraStore parses "destination numkeys key [key ...] [WEIGHTS ...]
+// [AGGREGATE SUM|MIN|MAX]" and replies with the size of the stored result.
+// ZDIFFSTORE accepts neither option.
+func (r *CommandRouter) zsetAlgebraStore(name string, params []resp.RESP, op func(string, []string, []float64, structures.Aggregate) (int, error)) []byte {
+	if len(params) < 3 {
+		return wrongArgs(name)
+	}
+
+	numKeys, err := strconv.Atoi(params[1].Bulk)
+	if err != nil {
+		return resp.Error(errNotInteger).Marshal()
+	}
+	if numKeys < 1 {
+		return resp.Error("ERR at least 1 input key is needed for '" + name + "' command").Marshal()
+	}
+	if numKeys > len(params)-2 {
+		return resp.Error("ERR syntax error").Marshal()
+	}
+
+	keys := bulkParams(params[2 : numKeys+2])
+	var weights []float64
+	agg := structures.AggregateSum
+
+	rest := params[numKeys+2:]
+	for i := 0; i < len(rest); i++ {
+		switch opt := strings.ToUpper(rest[i].Bulk); {
+		case opt == "WEIGHTS" && name != "zdiffstore" && i+numKeys < len(rest):
+			weights = make([]float64, numKeys)
+			for j := range weights {
+				weights[j], err = parseScore(rest[i+1+j].Bulk)
+				if err != nil {
+					return resp.Error("ERR weight value is not a float").Marshal()
+				}
+			}
+			i += numKeys
+		case opt == "AGGREGATE" && name != "zdiffstore" && i+1 < len(rest):
+			switch strings.ToUpper(rest[i+1].Bulk) {
+			case "SUM":
+				agg = structures.AggregateSum
+			case "MIN":
+				agg = structures.AggregateMin
+			case "MAX":
+				agg = structures.AggregateMax
+			default:
+				return resp.Error("ERR syntax error").Marshal()
+			}
+			i++
+		default:
+			return resp.Error("ERR syntax error").Marshal()
+		}
+	}
+
+	size, err := op(params[0].Bulk, keys, weights, agg)
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+	return resp.Integer(size).Marshal()
+}
+
+func (r *CommandRouter) zscan(params []resp.RESP) []byte {
+	if len(params) < 2 {
+		return wrongArgs("zscan")
+	}
+
+	cursor, err := parseCursor(params[1].Bulk)
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+	opts, err := parseScanOptions(params[2:], "zscan")
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+
+	next, members, err := r.Store.ZScan(params[0].Bulk, cursor, opts.count, opts.match)
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+	return scanReply(next, scoredArray(members, true)).Marshal()
+}
@@ -0,0 +1,403 @@
+package handlers
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jgrecu/redis-clone/app/resp"
+	"github.com/jgrecu/redis-clone/app/structures"
+)
+
+func TestFormatScore(t *testing.T) {
+	tests := []struct {
+		in   float64
+		want string
+	}{
+		{0, "0"},
+		{1, "1"},
+		{-2.5, "-2.5"},
+		{0.1, "0.1"},
+		{1000000, "1000000"},
+		{1e20, "1e+20"},
+		{1.5e10, "1.5e+10"},
+		{123456789, "123456789"},
+		{1.5e25, "1.5e+25"},
+		{0.000001, "0.000001"},
+		{1e-7, "1e-7"},
+		{1.23e-8, "1.23e-8"},
+		{math.Inf(1), "inf"},
+		{math.Inf(-1), "-inf"},
+	}
+	for _, tt := range tests {
+		if got := formatScore(tt.in); got != tt.want {
+			t.Errorf("formatScore(%v) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestSortedSetCommands(t *testing.T) {
+	seed := func(s *structures.Store) {
+		s.ZAdd("z", structures.ZAddOptions{}, []structures.ScoredMember{{Member: "a", Score: 1}, {Member: "b", Score: 2}})
+	}
+
+	tests := []commandTest{
+		{
+			name:     "ZADD creates sorted set",
+			setup:    func(s *structures.Store) {},
+			command:  bulks("ZADD", "z", "1", "a", "2", "b"),
+			expected: resp.Integer(2).Marshal(),
+		},
+		{
+			name:     "ZADD CH counts updates",
+			setup:    seed,
+			command:  bulks("ZADD", "z", "CH", "5", "a", "2", "b", "3", "c"),
+			expected: resp.Integer(2).Marshal(),
+		},
+		{
+			name:     "ZADD INCR",
+			setup:    seed,
+			command:  bulks("ZADD", "z", "INCR", "0.5", "a"),
+			expected: resp.Bulk("1.5").Marshal(),
+		},
+		{
+			name:     "ZADD INCR aborted by NX",
+			setup:    seed,
+			command:  bulks("ZADD", "z", "NX", "INCR", "1", "a"),
+			expected: resp.Nil().Marshal(),
+		},
+		{
+			name:     "ZADD INCR multiple pairs",
+			setup:    func(s *structures.Store) {},
+			command:  bulks("ZADD", "z", "INCR", "1", "a", "2", "b"),
+			expected: resp.Error("ERR INCR option supports a single increment-element pair").Marshal(),
+		},
+		{
+			name:     "ZADD NX and XX",
+			setup:    func(s *structures.Store) {},
+			command:  bulks("ZADD", "z", "NX", "XX", "1", "a"),
+			expected: resp.Error("ERR XX and NX options at the same time are not compatible").Marshal(),
+		},
+		{
+			name:     "ZADD GT and LT",
+			setup:    func(s *structures.Store) {},
+			command:  bulks("ZADD", "z", "GT", "LT", "1", "a"),
+			expected: resp.Error("ERR GT, LT, and/or NX options at the same time are not compatible").Marshal(),
+		},
+		{
+			name:     "ZADD odd score/member count",
+			setup:    func(s *structures.Store) {},
+			command:  bulks("ZADD", "z", "1", "a", "2"),
+			expected: resp.Error("ERR syntax error").Marshal(),
+		},
+		{
+			name:     "ZADD invalid score",
+			setup:    func(s *structures.Store) {},
+			command:  bulks("ZADD", "z", "nan", "a"),
+			expected: resp.Error(errNotFloat).Marshal(),
+		},
+		{
+			name:     "ZADD against string",
+			setup:    func(s *structures.Store) { s.Set("str", "v", time.Time{}) },
+			command:  bulks("ZADD", "str", "1", "a"),
+			expected: wrongType,
+		},
+		{
+			name:     "ZINCRBY",
+			setup:    seed,
+			command:  bulks("ZINCRBY", "z", "-inf", "b"),
+			expected: resp.Bulk("-inf").Marshal(),
+		},
+		{
+			name:     "ZSCORE missing member",
+			setup:    seed,
+			command:  bulks("ZSCORE", "z", "x"),
+			expected: resp.Nil().Marshal(),
+		},
+		{
+			name:     "ZRANK",
+			setup:    seed,
+			command:  bulks("ZRANK", "z", "b"),
+			expected: resp.Integer(1).Marshal(),
+		},
+		{
+			name:     "ZREVRANK WITHSCORE",
+			setup:    seed,
+			command:  bulks("ZREVRANK", "z", "b", "WITHSCORE"),
+			expected: resp.Array(resp.Integer(0), resp.Bulk("2")).Marshal(),
+		},
+		{
+			name:     "ZCARD",
+			setup:    seed,
+			command:  bulks("ZCARD", "z"),
+			expected: resp.Integer(2).Marshal(),
+		},
+		{
+			name:     "ZREM",
+			setup:    seed,
+			command:  bulks("ZREM", "z", "a", "x"),
+			expected: resp.Integer(1).Marshal(),
+		},
+		{
+			name:     "ZRANGE by rank WITHSCORES",
+			setup:    seed,
+			command:  bulks("ZRANGE", "z", "0", "-1", "WITHSCORES"),
+			expected: resp.Array(resp.Bulk("a"), resp.Bulk("1"), resp.Bulk("b"), resp.Bulk("2")).Marshal(),
+		},
+		{
+			name:     "ZRANGE BYSCORE REV LIMIT",
+			setup:    seed,
+			command:  bulks("ZRANGE", "z", "+inf", "(0", "BYSCORE", "REV", "LIMIT", "0", "1"),
+			expected: resp.Array(resp.Bulk("b")).Marshal(),
+		},
+		{
+			name:     "ZRANGE BYLEX",
+			setup:    seed,
+			command:  bulks("ZRANGE", "z", "(a", "+", "BYLEX"),
+			expected: resp.Array(resp.Bulk("b")).Marshal(),
+		},
+		{
+			name:     "ZRANGE LIMIT by rank",
+			setup:    seed,
+			command:  bulks("ZRANGE", "z", "0", "-1", "LIMIT", "0", "1"),
+			expected: resp.Error("ERR syntax error, LIMIT is only supported in combination with either BYSCORE or BYLEX").Marshal(),
+		},
+		{
+			name:     "ZRANGE BYLEX WITHSCORES",
+			setup:    seed,
+			command:  bulks("ZRANGE", "z", "-", "+", "BYLEX", "WITHSCORES"),
+			expected: resp.Error("ERR syntax error, WITHSCORES not supported in combination with BYLEX").Marshal(),
+		},
+		{
+			name:     "ZRANGE invalid score bound",
+			setup:    seed,
+			command:  bulks("ZRANGE", "z", "x", "1", "BYSCORE"),
+			expected: resp.Error("ERR min or max is not a float").Marshal(),
+		},
+		{
+			name:     "ZREVRANGEBYSCORE",
+			setup:    seed,
+			command:  bulks("ZREVRANGEBYSCORE", "z", "2", "1", "WITHSCORES"),
+			expected: resp.Array(resp.Bulk("b"), resp.Bulk("2"), resp.Bulk("a"), resp.Bulk("1")).Marshal(),
+		},
+		{
+			name:     "ZRANGEBYLEX rejects REV",
+			setup:    seed,
+			command:  bulks("ZRANGEBYLEX", "z", "-", "+", "REV"),
+			expected: resp.Error("ERR syntax error").Marshal(),
+		},
+		{
+			name:     "ZRANGESTORE",
+			setup:    seed,
+			command:  bulks("ZRANGESTORE", "dst", "z", "1", "inf", "BYSCORE"),
+			expected: resp.Integer(2).Marshal(),
+		},
+		{
+			name:     "ZCOUNT exclusive",
+			setup:    seed,
+			command:  bulks("ZCOUNT", "z", "(1", "2"),
+			expected: resp.Integer(1).Marshal(),
+		},
+		{
+			name:     "ZLEXCOUNT invalid bound",
+			setup:    seed,
+			command:  bulks("ZLEXCOUNT", "z", "a", "+"),
+			expected: resp.Error("ERR min or max not valid string range item").Marshal(),
+		},
+		{
+			name:     "ZREMRANGEBYRANK",
+			setup:    seed,
+			command:  bulks("ZREMRANGEBYRANK", "z", "0", "0"),
+			expected: resp.Integer(1).Marshal(),
+		},
+		{
+			name:     "ZREMRANGEBYSCORE",
+			setup:    seed,
+			command:  bulks("ZREMRANGEBYSCORE", "z", "-inf", "+inf"),
+			expected: resp.Integer(2).Marshal(),
+		},
+		{
+			name:     "ZREMRANGEBYLEX",
+			setup:    seed,
+			command:  bulks("ZREMRANGEBYLEX", "z", "[b", "[b"),
+			expected: resp.Integer(1).Marshal(),
+		},
+		{
+			name:     "ZPOPMIN with count",
+			setup:    seed,
+			command:  bulks("ZPOPMIN", "z", "5"),
+			expected: resp.Array(resp.Bulk("a"), resp.Bulk("1"), resp.Bulk("b"), resp.Bulk("2")).Marshal(),
+		},
+		{
+			name:     "ZPOPMAX missing key",
+			setup:    func(s *structures.Store) {},
+			command:  bulks("ZPOPMAX", "z"),
+			expected: resp.Array().Marshal(),
+		},
+		{
+			name:     "BZPOPMAX available",
+			setup:    seed,
+			command:  bulks("BZPOPMAX", "other", "z", "0"),
+			expected: resp.Array(resp.Bulk("z"), resp.Bulk("b"), resp.Bulk("2")).Marshal(),
+		},
+		{
+			name:     "BZPOPMIN times out",
+			setup:    func(s *structures.Store) {},
+			command:  bulks("BZPOPMIN", "z", "0.01"),
+			expected: resp.Nil().Marshal(),
+		},
+		{
+			name:     "ZMPOP",
+			setup:    seed,
+			command:  bulks("ZMPOP", "1", "z", "MAX", "COUNT", "1"),
+			expected: resp.Array(resp.Bulk("z"), resp.Array(resp.Array(resp.Bulk("b"), resp.Bulk("2")))).Marshal(),
+		},
+		{
+			name:     "ZMPOP bad direction",
+			setup:    seed,
+			command:  bulks("ZMPOP", "1", "z", "LEFT"),
+			expected: resp.Error("ERR syntax error").Marshal(),
+		},
+		{
+			name: "BZPOPMIN empty key name",
+			setup: func(s *structures.Store) {
+				s.ZAdd("", structures.ZAddOptions{}, []structures.ScoredMember{{Member: "a", Score: 1}})
+			},
+			command:  bulks("BZPOPMIN", "", "0.01"),
+			expected: resp.Array(resp.Bulk(""), resp.Bulk("a"), resp.Bulk("1")).Marshal(),
+		},
+		{
+			name:     "BZMPOP numkeys out of range",
+			setup:    seed,
+			command:  bulks("BZMPOP", "0", "9223372036854775807", "z", "MIN"),
+			expected: resp.Error("ERR syntax error").Marshal(),
+		},
+		{
+			name: "ZRANDMEMBER negative count WITHSCORES",
+			setup: func(s *structures.Store) {
+				s.ZAdd("z", structures.ZAddOptions{}, []structures.ScoredMember{{Member: "a", Score: 1}})
+			},
+			command:  bulks("ZRANDMEMBER", "z", "-2", "WITHSCORES"),
+			expected: resp.Array(resp.Bulk("a"), resp.Bulk("1"), resp.Bulk("a"), resp.Bulk("1")).Marshal(),
+		},
+		{
+			name:     "ZRANDMEMBER count out of range",
+			setup:    seed,
+			command:  bulks("ZRANDMEMBER", "z", "-9223372036854775808"),
+			expected: resp.Error("ERR value is out of range").Marshal(),
+		},
+		{
+			name:     "ZRANDMEMBER WITHSCORES count out of range",
+			setup:    seed,
+			command:  bulks("ZRANDMEMBER", "z", "-4611686018427387904", "WITHSCORES"),
+			expected: resp.Error("ERR value is out of range").Marshal(),
+		},
+		{
+			name:     "ZRANDMEMBER missing key",
+			setup:    func(s *structures.Store) {},
+			command:  bulks("ZRANDMEMBER", "z"),
+			expected: resp.Nil().Marshal(),
+		},
+		{
+			name:     "ZUNIONSTORE WEIGHTS AGGREGATE",
+			setup:    seed,
+			command:  bulks("ZUNIONSTORE", "dst", "2", "z", "z", "WEIGHTS", "1", "2", "AGGREGATE", "MAX"),
+			expected: resp.Integer(2).Marshal(),
+		},
+		{
+			name:     "ZINTERSTORE zero numkeys",
+			setup:    func(s *structures.Store) {},
+			command:  bulks("ZINTERSTORE", "dst", "0", "z"),
+			expected: resp.Error("ERR at least 1 input key is needed for 'zinterstore' command").Marshal(),
+		},
+		{
+			name:     "ZINTERSTORE invalid weight",
+			setup:    func(s *structures.Store) {},
+			command:  bulks("ZINTERSTORE", "dst", "1", "z", "WEIGHTS", "x"),
+			expected: resp.Error("ERR weight value is not a float").Marshal(),
+		},
+		{
+			name:     "ZDIFFSTORE rejects AGGREGATE",
+			setup:    func(s *structures.Store) {},
+			command:  bulks("ZDIFFSTORE", "dst", "1", "z", "AGGREGATE", "SUM"),
+			expected: resp.Error("ERR syntax error").Marshal(),
+		},
+		{
+			name:     "ZSCAN MATCH",
+			setup:    seed,
+			command:  bulks("ZSCAN", "z", "0", "MATCH", "b"),
+			expected: resp.Array(resp.Bulk("0"), resp.Array(resp.Bulk("b"), resp.Bulk("2"))).Marshal(),
+		},
+		{
+			name:     "ZSCAN invalid cursor",
+			setup:    seed,
+			command:  bulks("ZSCAN", "z", "x"),
+			expected: resp.Error("ERR invalid cursor").Marshal(),
+		},
+		{
+			name:     "ZSCAN against string",
+			setup:    func(s *structures.Store) { s.Set("str", "v", time.Time{}) },
+			command:  bulks("ZSCAN", "str", "0"),
+			expected: wrongType,
+		},
+	}
+
+	runCommandTests(t, tests)
+}
+
+func TestBlockingSortedSetCommands_Propagation(t *testing.T) {
+	master, replica := newTestRouter(), newTestRouter()
+	replicate(master, replica, "ZADD", "z", "1", "a", "2", "b", "3", "c", "4", "d")
+
+	replicate(master, replica, "BZPOPMIN", "z", "0")
+	replicate(master, replica, "BZPOPMAX", "z", "0")
+	args := bulks("BZMPOP", "0", "1", "z", "MIN", "COUNT", "5")
+	master.GetHandler("BZMPOP")(args[1:])
+	got := master.Replication(args, true)
+	want := bulks("ZPOPMIN", "z", "2")
+	if len(got) != 1 || !reflect.DeepEqual(got[0].Command, want) {
+		t.Fatalf("Replication of BZMPOP = %v, want %v", got, want)
+	}
+	replica.GetHandler("ZPOPMIN")(want[1:])
+	if replica.Store.Exists("z") != 0 {
+		t.Error("replica kept members the pops took")
+	}
+
+	args = bulks("BZPOPMAX", "z", "0.01")
+	master.GetHandler("BZPOPMAX")(args[1:])
+	if got := master.Replication(args, true); len(got) != 0 {
+		t.Errorf("Replication of a BZPOPMAX that timed out = %v, want none", got)
+	}
+}
+
+func TestBlockingSortedSetCommands_ServedPropagation(t *testing.T) {
+	tests := []struct {
+		name  string
+		block []string
+		write []string
+		want  [][]resp.RESP
+	}{
+		{
+			"BZPOPMIN",
+			[]string{"BZPOPMIN", "z", "0"},
+			[]string{"ZADD", "z", "1", "a", "2", "b"},
+			[][]resp.RESP{bulks("ZADD", "z", "1", "a", "2", "b"), bulks("ZPOPMIN", "z", "1")},
+		},
+		{
+			"BZMPOP",
+			[]string{"BZMPOP", "0", "1", "z", "MAX", "COUNT", "5"},
+			[]string{"ZADD", "z", "1", "a", "2", "b"},
+			[][]resp.RESP{bulks("ZADD", "z", "1", "a", "2", "b"), bulks("ZPOPMAX", "z", "2")},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := servedReplication(t, newTestRouter(), "z", tt.block, tt.write...)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("replicated %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
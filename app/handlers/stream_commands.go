@@ -4,139 +4,288 @@ import (
 	"fmt"
 	"github.com/jgrecu/redis-clone/app/resp"
 	"github.com/jgrecu/redis-clone/app/structures"
-	"math"
 	"strconv"
 	"strings"
 	"time"
 )
 
+// xadd implements XADD key [NOMKSTREAM] [MAXLEN|MINID [=|~] threshold
+// [LIMIT count]] *|id field value [field value ...].
 func (r *CommandRouter) xadd(params []resp.RESP) []byte {
 	if len(params) < 2 {
-		return resp.Error("ERR wrong number of arguments for 'xadd' command").Marshal()
+		return wrongArgs("xadd")
 	}
 
-	entryKey := params[1].Bulk
+	opts, i, err := parseStreamAddArgs(params[1:], true)
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+	i++
+	if i >= len(params) {
+		return wrongArgs("xadd")
+	}
+
+	fields := bulkParams(params[i+1:])
+	if len(fields) == 0 || len(fields)%2 != 0 {
+		return wrongArgs("xadd")
+	}
 	pairs := make(map[string]string)
-	for i := 2; i < len(params); i += 2 {
-		if i+1 < len(params) {
-			pairs[params[i].Bulk] = params[i+1].Bulk
-		}
+	for j := 0; j < len(fields); j += 2 {
+		pairs[fields[j]] = fields[j+1]
 	}
 
-	key, err := r.Store.XAdd(params[0].Bulk, entryKey, pairs)
+	key, trim, added, err := r.Store.XAddWithOptions(params[0].Bulk, params[i].Bulk, pairs, opts)
 	if err != nil {
 		return resp.Error(err.Error()).Marshal()
 	}
+	if !added {
+		r.rewrite()
+		return resp.Nil().Marshal()
+	}
 
+	// Replicas must add the entry under the ID generated here, and trim
+	// exactly as much as was trimmed here.
+	args := append([]string{params[0].Bulk}, trimArgs(trim)...)
+	args = append(append(args, key), fields...)
+	r.rewrite(resp.Command("XADD", args...))
 	return resp.Bulk(key).Marshal()
 }
 
-func (r *CommandRouter) xrange(params []resp.RESP) []byte {
+// trimArgs returns the options of XADD and XTRIM asking for trim, which
+// must be exact.
+func trimArgs(trim structures.TrimOptions) []string {
+	switch trim.By {
+	case structures.TrimByMaxLen:
+		return []string{"MAXLEN", "=", strconv.Itoa(trim.MaxLen)}
+	case structures.TrimByMinID:
+		return []string{"MINID", "=", trim.MinID}
+	}
+	return nil
+}
+
+// parseStreamAddArgs parses the trimming options shared by XADD and XTRIM,
+// MAXLEN or MINID [=|~] threshold and LIMIT count, and for XADD NOMKSTREAM.
+// XADD options end at the entry ID, whose index it returns.
+func parseStreamAddArgs(params []resp.RESP, xadd bool) (structures.XAddOptions, int, error) {
+	var opts structures.XAddOptions
+	trim := &opts.Trim
+	i := 0
+	for ; i < len(params); i++ {
+		opt := strings.ToUpper(params[i].Bulk)
+		more := len(params) - 1 - i
+		switch {
+		case (opt == "MAXLEN" || opt == "MINID") && more > 0:
+			if trim.By != structures.TrimNone {
+				return opts, 0, fmt.Errorf("ERR syntax error, MAXLEN and MINID options at the same time are not compatible")
+			}
+			if more > 1 && (params[i+1].Bulk == "~" || params[i+1].Bulk == "=") {
+				trim.Approx = params[i+1].Bulk == "~"
+				i++
+			}
+			i++
+			if opt == "MINID" {
+				trim.By, trim.MinID = structures.TrimByMinID, params[i].Bulk
+				continue
+			}
+			maxLen, err := strconv.Atoi(params[i].Bulk)
+			if err != nil {
+				return opts, 0, fmt.Errorf(errNotInteger)
+			}
+			if maxLen < 0 {
+				return opts, 0, fmt.Errorf("ERR The MAXLEN argument must be >= 0.")
+			}
+			trim.By, trim.MaxLen = structures.TrimByMaxLen, maxLen
+		case opt == "LIMIT" && more > 0:
+			limit, err := strconv.Atoi(params[i+1].Bulk)
+			if err != nil {
+				return opts, 0, fmt.Errorf(errNotInteger)
+			}
+			if limit < 0 {
+				return opts, 0, fmt.Errorf("ERR The LIMIT argument must be >= 0.")
+			}
+			trim.Limit, trim.HasLimit = limit, true
+			i++
+		case opt == "NOMKSTREAM" && xadd:
+			opts.NoMkStream = true
+		case xadd:
+			return opts, i, checkTrimArgs(*trim, xadd)
+		default:
+			return opts, 0, fmt.Errorf("ERR syntax error")
+		}
+	}
+	return opts, i, checkTrimArgs(*trim, xadd)
+}
+
+// checkTrimArgs rejects combinations of trimming options Redis refuses.
+func checkTrimArgs(trim structures.TrimOptions, xadd bool) error {
+	switch {
+	case trim.HasLimit && trim.By == structures.TrimNone:
+		return fmt.Errorf("ERR syntax error, LIMIT cannot be used without specifying a trimming strategy")
+	case !xadd && trim.By == structures.TrimNone:
+		return fmt.Errorf("ERR syntax error, XTRIM must be called with a trimming strategy")
+	case trim.HasLimit && !trim.Approx:
+		return fmt.Errorf("ERR syntax error, LIMIT cannot be used without the special ~ option")
+	}
+	return nil
+}
+
+func (r *CommandRouter) xlen(params []resp.RESP) []byte {
+	if len(params) != 1 {
+		return wrongArgs("xlen")
+	}
+
+	n, err := r.Store.XLen(params[0].Bulk)
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+	return resp.Integer(n).Marshal()
+}
+
+func (r *CommandRouter) xdel(params []resp.RESP) []byte {
+	if len(params) < 2 {
+		return wrongArgs("xdel")
+	}
+
+	deleted, err := r.Store.XDel(params[0].Bulk, bulkParams(params[1:]))
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+	return resp.Integer(deleted).Marshal()
+}
+
+// xtrim implements XTRIM key MAXLEN|MINID [=|~] threshold [LIMIT count].
+func (r *CommandRouter) xtrim(params []resp.RESP) []byte {
 	if len(params) < 3 {
-		return resp.Error("ERR wrong number of arguments for 'xrange' command").Marshal()
+		return wrongArgs("xtrim")
 	}
 
-	start := params[1].Bulk
-	end := params[2].Bulk
+	opts, _, err := parseStreamAddArgs(params[1:], false)
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
 
-	if start == "-" {
-		start = "0-0"
+	trimmed, trim, err := r.Store.XTrim(params[0].Bulk, opts.Trim)
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+	r.rewrite()
+	if trimmed > 0 {
+		r.rewrite(resp.Command("XTRIM", append([]string{params[0].Bulk}, trimArgs(trim)...)...))
 	}
-	if end == "+" {
-		end = strconv.Itoa(math.MaxInt) + "-" + strconv.Itoa(math.MaxInt)
+	return resp.Integer(trimmed).Marshal()
+}
+
+// xrange implements XRANGE key start end [COUNT count].
+func (r *CommandRouter) xrange(params []resp.RESP) []byte {
+	return r.streamRange(params, "xrange")
+}
+
+// xrevrange implements XREVRANGE key end start [COUNT count].
+func (r *CommandRouter) xrevrange(params []resp.RESP) []byte {
+	return r.streamRange(params, "xrevrange")
+}
+
+// streamRange implements XRANGE and XREVRANGE, whose bounds are "-", "+", an
+// ID, or an incomplete ID of just milliseconds, each optionally prefixed
+// with "(" to exclude it. A missing key replies an empty array, and a COUNT
+// of 0 replies nil.
+func (r *CommandRouter) streamRange(params []resp.RESP, command string) []byte {
+	if len(params) < 3 {
+		return wrongArgs(command)
+	}
+
+	count := -1
+	for i := 3; i < len(params); i++ {
+		if !strings.EqualFold(params[i].Bulk, "COUNT") || i+1 >= len(params) {
+			return resp.Error("ERR syntax error").Marshal()
+		}
+		n, err := strconv.Atoi(params[i+1].Bulk)
+		if err != nil {
+			return resp.Error(errNotInteger).Marshal()
+		}
+		count = max(n, 0)
+		i++
 	}
 
-	entries, ok := r.Store.XRange(params[0].Bulk, start, end)
+	var entries []structures.Entry
+	var ok bool
+	var err error
+	if command == "xrevrange" {
+		entries, ok, err = r.Store.XRevRange(params[0].Bulk, params[1].Bulk, params[2].Bulk, max(count, 0))
+	} else {
+		entries, ok, err = r.Store.XRange(params[0].Bulk, params[1].Bulk, params[2].Bulk, max(count, 0))
+	}
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
 	if !ok {
+		return resp.Array().Marshal()
+	}
+	if count == 0 {
 		return resp.Nil().Marshal()
 	}
 
 	return formatEntries(entries).Marshal()
 }
 
+// xread implements XREAD [COUNT count] [BLOCK milliseconds] STREAMS key
+// [key ...] id [id ...]. A "$" ID reads only entries added after the call.
 func (r *CommandRouter) xread(params []resp.RESP) []byte {
 	if len(params) < 1 {
-		return resp.Error("ERR wrong number of arguments for 'xread' command").Marshal()
+		return wrongArgs("xread")
 	}
 
-	if strings.ToUpper(params[0].Bulk) == "STREAMS" {
-		streamKeys, ids, err := r.formatStreamKeys(params[1:])
-		if err != nil {
-			return resp.Error(err.Error()).Marshal()
-		}
-		return r.xReadStreams(streamKeys, ids).Marshal()
+	switch strings.ToUpper(params[0].Bulk) {
+	case "COUNT", "BLOCK", "STREAMS":
+	default:
+		return resp.Nil().Marshal()
+	}
+	if len(params) < 3 {
+		return wrongArgs("xread")
 	}
 
-	if strings.ToUpper(params[0].Bulk) == "BLOCK" {
-		wait, err := strconv.Atoi(params[1].Bulk)
-		if err != nil {
-			return resp.Error("ERR invalid timeout").Marshal()
-		}
+	args, err := parseStreamReadArgs(params, "xread")
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+	streamKeys, ids, err := r.formatStreamKeys(params[len(params)-2*len(args.keys):])
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
 
-		streamKeys, ids, err := r.formatStreamKeys(params[3:])
+	if !args.blocking {
+		data, err := r.Store.XRead(streamKeys, ids, args.count)
 		if err != nil {
 			return resp.Error(err.Error()).Marshal()
 		}
-
-		if wait == 0 {
-			ch := make(chan bool)
-			go r.waitForNewEntry(streamKeys, ch)
-			<-ch
-		} else {
-			<-time.After(time.Duration(wait) * time.Millisecond)
-		}
-
-		result := r.xReadStreams(streamKeys, ids)
-		if result.Type == "array" && len(result.Array) == 0 {
-			return resp.Nil().Marshal()
-		}
-		return result.Marshal()
+		return formatStreams(streamKeys, data).Marshal()
 	}
 
-	return resp.Nil().Marshal()
+	data, err := r.Store.XReadBlock(streamKeys, ids, args.count, args.block)
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+	if data == nil {
+		return resp.Nil().Marshal()
+	}
+	return formatStreams(streamKeys, data).Marshal()
 }
 
-func (r *CommandRouter) xReadStreams(streamKeys, ids []string) resp.RESP {
-	data := r.Store.XRead(streamKeys, ids)
-
+// formatStreams builds the XREAD and XREADGROUP reply: one [key, entries]
+// pair for each stream in data, in the order of streamKeys.
+func formatStreams(streamKeys []string, data map[string][]structures.Entry) resp.RESP {
 	streams := []resp.RESP{}
-	// Iterate in order of streamKeys to preserve input order
 	for _, key := range streamKeys {
 		entries, ok := data[key]
 		if !ok {
 			continue
 		}
-		for _, entry := range entries {
-			pairs := formatPairs(entry)
-			streams = append(streams,
-				resp.Array(
-					resp.Bulk(key),
-					resp.Array(
-						resp.Array(
-							resp.Bulk(entry.Key()),
-							resp.Array(pairs...),
-						),
-					),
-				),
-			)
-		}
+		streams = append(streams, resp.Array(resp.Bulk(key), formatEntries(entries)))
 	}
 
 	return resp.Array(streams...)
 }
 
-func (r *CommandRouter) waitForNewEntry(streamKeys []string, ch chan bool) {
-	originalSize := r.Store.StreamSize(streamKeys)
-	for {
-		newSize := r.Store.StreamSize(streamKeys)
-		if newSize > originalSize {
-			ch <- true
-			return
-		}
-		<-time.After(50 * time.Millisecond)
-	}
-}
-
 func (r *CommandRouter) formatStreamKeys(params []resp.RESP) ([]string, []string, error) {
 	if len(params)%2 != 0 {
 		return nil, nil, fmt.Errorf("ERR wrong number of arguments for 'xread' command")
@@ -162,9 +311,15 @@ func (r *CommandRouter) formatStreamKeys(params []resp.RESP) ([]string, []string
 }
 
 // formatEntries converts a slice of entries into a RESP array response.
+// Entries deleted while pending in a consumer group have nil Pairs and are
+// replied with a nil in place of their fields.
 func formatEntries(entries []structures.Entry) resp.RESP {
 	res := []resp.RESP{}
 	for _, entry := range entries {
+		if entry.Pairs == nil {
+			res = append(res, resp.Array(resp.Bulk(entry.Key()), resp.Nil()))
+			continue
+		}
 		pairs := formatPairs(entry)
 		res = append(res, resp.Array(resp.Bulk(entry.Key()), resp.Array(pairs...)))
 	}
@@ -179,3 +334,384 @@ func formatPairs(entry structures.Entry) []resp.RESP {
 	}
 	return pairs
 }
+
+// xgroupArity is the number of arguments of each XGROUP subcommand, the
+// subcommand itself included.
+var xgroupArity = map[string]int{"CREATE": 4, "DESTROY": 3, "SETID": 4, "CREATECONSUMER": 4, "DELCONSUMER": 4}
+
+// xgroup implements the XGROUP subcommands managing consumer groups.
+func (r *CommandRouter) xgroup(params []resp.RESP) []byte {
+	if len(params) < 1 {
+		return wrongArgs("xgroup")
+	}
+
+	subcommand := strings.ToUpper(params[0].Bulk)
+	want, ok := xgroupArity[subcommand]
+	if !ok {
+		return resp.Error(fmt.Sprintf("ERR unknown subcommand '%s'. Try XGROUP HELP.", params[0].Bulk)).Marshal()
+	}
+	// CREATE alone takes options after its fixed arguments.
+	if len(params) < want || (subcommand != "CREATE" && len(params) != want) {
+		return wrongArgs("xgroup|" + strings.ToLower(subcommand))
+	}
+	key, group := params[1].Bulk, params[2].Bulk
+
+	switch subcommand {
+	case "CREATE":
+		mkStream := false
+		for _, opt := range params[4:] {
+			if !strings.EqualFold(opt.Bulk, "MKSTREAM") {
+				return resp.Error("ERR syntax error").Marshal()
+			}
+			mkStream = true
+		}
+		if err := r.Store.XGroupCreate(key, group, params[3].Bulk, mkStream); err != nil {
+			return resp.Error(err.Error()).Marshal()
+		}
+		return resp.String("OK").Marshal()
+	case "DESTROY":
+		destroyed, err := r.Store.XGroupDestroy(key, group)
+		if err != nil {
+			return resp.Error(err.Error()).Marshal()
+		}
+		return resp.Integer(boolToInt(destroyed)).Marshal()
+	case "SETID":
+		if err := r.Store.XGroupSetID(key, group, params[3].Bulk); err != nil {
+			return resp.Error(err.Error()).Marshal()
+		}
+		return resp.String("OK").Marshal()
+	case "CREATECONSUMER":
+		created, err := r.Store.XGroupCreateConsumer(key, group, params[3].Bulk)
+		if err != nil {
+			return resp.Error(err.Error()).Marshal()
+		}
+		return resp.Integer(boolToInt(created)).Marshal()
+	default:
+		pending, err := r.Store.XGroupDelConsumer(key, group, params[3].Bulk)
+		if err != nil {
+			return resp.Error(err.Error()).Marshal()
+		}
+		return resp.Integer(pending).Marshal()
+	}
+}
+
+// streamReadArgs holds the arguments of a stream read command.
+type streamReadArgs struct {
+	count    int
+	block    time.Duration
+	blocking bool
+	noAck    bool
+	keys     []string
+	ids      []string
+}
+
+// parseStreamReadArgs parses the COUNT, BLOCK and, for XREADGROUP, NOACK
+// options followed by STREAMS and the list of keys and IDs.
+func parseStreamReadArgs(params []resp.RESP, command string) (streamReadArgs, error) {
+	var args streamReadArgs
+	for i := 0; i < len(params); i++ {
+		opt := strings.ToUpper(params[i].Bulk)
+		switch {
+		case opt == "STREAMS":
+			rest := params[i+1:]
+			if len(rest) == 0 || len(rest)%2 != 0 {
+				newID := "'$'"
+				if command == "xreadgroup" {
+					newID = "'>'"
+				}
+				return args, fmt.Errorf("ERR Unbalanced '%s' list of streams: for each stream key an ID or %s must be specified.", command, newID)
+			}
+			args.keys = bulkParams(rest[:len(rest)/2])
+			args.ids = bulkParams(rest[len(rest)/2:])
+			return args, nil
+		case opt == "COUNT" && i+1 < len(params):
+			count, err := strconv.Atoi(params[i+1].Bulk)
+			if err != nil {
+				return args, fmt.Errorf(errNotInteger)
+			}
+			args.count = max(count, 0)
+			i++
+		case opt == "BLOCK" && i+1 < len(params):
+			ms, err := strconv.ParseInt(params[i+1].Bulk, 10, 64)
+			if err != nil {
+				return args, fmt.Errorf("ERR timeout is not an integer or out of range")
+			}
+			if ms < 0 {
+				return args, fmt.Errorf("ERR timeout is negative")
+			}
+			args.block = time.Duration(ms) * time.Millisecond
+			args.blocking = true
+			i++
+		case opt == "NOACK" && command == "xreadgroup":
+			args.noAck = true
+		default:
+			return args, fmt.Errorf("ERR syntax error")
+		}
+	}
+	return args, fmt.Errorf("ERR syntax error")
+}
+
+// xreadgroup implements XREADGROUP GROUP group consumer [COUNT count]
+// [BLOCK milliseconds] [NOACK] STREAMS key [key ...] id [id ...]. It only
+// blocks when every ID is ">", as reading pending entries never waits.
+func (r *CommandRouter) xreadgroup(params []resp.RESP) []byte {
+	if len(params) < 3 || !strings.EqualFold(params[0].Bulk, "GROUP") {
+		return resp.Error("ERR syntax error").Marshal()
+	}
+
+	args, err := parseStreamReadArgs(params[3:], "xreadgroup")
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+	opts := structures.XReadGroupOptions{
+		Group:    params[1].Bulk,
+		Consumer: params[2].Bulk,
+		Count:    args.count,
+		NoAck:    args.noAck,
+	}
+
+	onlyNew := true
+	for _, id := range args.ids {
+		onlyNew = onlyNew && id == ">"
+	}
+
+	var data map[string][]structures.Entry
+	if args.blocking && onlyNew {
+		// The store records what changed in the groups for replicas.
+		data, err = r.Store.XReadGroupBlock(opts, args.keys, args.ids, args.block)
+		r.rewrite()
+	} else {
+		var changes []structures.GroupChange
+		data, changes, err = r.Store.XReadGroup(opts, args.keys, args.ids)
+		r.rewriteGroupChanges(changes...)
+	}
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+	if len(data) == 0 {
+		return resp.Nil().Marshal()
+	}
+	return formatStreams(args.keys, data).Marshal()
+}
+
+// rewriteGroupChanges propagates changes to consumer groups as the
+// commands replicas apply for them; see GroupChange.Commands.
+func (r *CommandRouter) rewriteGroupChanges(changes ...structures.GroupChange) {
+	r.rewrite()
+	for _, ch := range changes {
+		for _, command := range ch.Commands() {
+			r.rewrite(resp.Command(command[0], command[1:]...))
+		}
+	}
+}
+
+func (r *CommandRouter) xack(params []resp.RESP) []byte {
+	if len(params) < 3 {
+		return wrongArgs("xack")
+	}
+
+	acked, err := r.Store.XAck(params[0].Bulk, params[1].Bulk, bulkParams(params[2:]))
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+	return resp.Integer(acked).Marshal()
+}
+
+// xpending implements both forms of XPENDING: the summary of a group's
+// pending entries, and XPENDING key group [IDLE min-idle-time] start end
+// count [consumer] listing them.
+func (r *CommandRouter) xpending(params []resp.RESP) []byte {
+	if len(params) < 2 {
+		return wrongArgs("xpending")
+	}
+	key, group := params[0].Bulk, params[1].Bulk
+
+	if len(params) == 2 {
+		summary, err := r.Store.XPendingSummary(key, group)
+		if err != nil {
+			return resp.Error(err.Error()).Marshal()
+		}
+		if summary.Count == 0 {
+			return resp.Array(resp.Integer(0), resp.Nil(), resp.Nil(), resp.Nil()).Marshal()
+		}
+		consumers := make([]resp.RESP, len(summary.Consumers))
+		for i, c := range summary.Consumers {
+			consumers[i] = resp.Array(resp.Bulk(c.Consumer), resp.Bulk(strconv.Itoa(c.Count)))
+		}
+		return resp.Array(
+			resp.Integer(summary.Count),
+			resp.Bulk(summary.First),
+			resp.Bulk(summary.Last),
+			resp.Array(consumers...),
+		).Marshal()
+	}
+
+	var opts structures.XPendingOptions
+	rest := params[2:]
+	if strings.EqualFold(rest[0].Bulk, "IDLE") && len(rest) > 1 {
+		idle, err := strconv.ParseInt(rest[1].Bulk, 10, 64)
+		if err != nil {
+			return resp.Error(errNotInteger).Marshal()
+		}
+		opts.MinIdle = time.Duration(idle) * time.Millisecond
+		rest = rest[2:]
+	}
+	if len(rest) != 3 && len(rest) != 4 {
+		return resp.Error("ERR syntax error").Marshal()
+	}
+	count, err := strconv.Atoi(rest[2].Bulk)
+	if err != nil {
+		return resp.Error(errNotInteger).Marshal()
+	}
+	opts.Start, opts.End, opts.Count = rest[0].Bulk, rest[1].Bulk, count
+	if len(rest) == 4 {
+		opts.Consumer = rest[3].Bulk
+	}
+
+	pending, err := r.Store.XPending(key, group, opts)
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+	res := make([]resp.RESP, len(pending))
+	for i, p := range pending {
+		res[i] = resp.Array(
+			resp.Bulk(p.ID),
+			resp.Bulk(p.Consumer),
+			resp.Integer(int(p.Idle.Milliseconds())),
+			resp.Integer(p.DeliveryCount),
+		)
+	}
+	return resp.Array(res...).Marshal()
+}
+
+// xclaimOptions are the option names of XCLAIM, which end its list of IDs.
+var xclaimOptions = map[string]bool{"IDLE": true, "TIME": true, "RETRYCOUNT": true, "FORCE": true, "JUSTID": true, "LASTID": true}
+
+// xclaim implements XCLAIM key group consumer min-idle-time id [id ...]
+// [IDLE ms] [TIME unix-time-milliseconds] [RETRYCOUNT count] [FORCE]
+// [JUSTID] [LASTID id].
+func (r *CommandRouter) xclaim(params []resp.RESP) []byte {
+	if len(params) < 5 {
+		return wrongArgs("xclaim")
+	}
+
+	minIdle, err := parseMinIdle(params[3].Bulk, "XCLAIM")
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+
+	i := 4
+	for i < len(params) && !xclaimOptions[strings.ToUpper(params[i].Bulk)] {
+		i++
+	}
+	ids := bulkParams(params[4:i])
+
+	var opts structures.XClaimOptions
+	now := time.Now()
+	for ; i < len(params); i++ {
+		opt := strings.ToUpper(params[i].Bulk)
+		switch {
+		case opt == "FORCE":
+			opts.Force = true
+		case opt == "JUSTID":
+			opts.JustID = true
+		case opt == "LASTID" && i+1 < len(params):
+			opts.LastID = params[i+1].Bulk
+			i++
+		case (opt == "IDLE" || opt == "TIME" || opt == "RETRYCOUNT") && i+1 < len(params):
+			n, err := strconv.ParseInt(params[i+1].Bulk, 10, 64)
+			if err != nil {
+				return resp.Error(fmt.Sprintf("ERR Invalid %s option argument for XCLAIM", opt)).Marshal()
+			}
+			switch opt {
+			case "IDLE":
+				opts.DeliveryTime = now.Add(-time.Duration(n) * time.Millisecond)
+			case "TIME":
+				opts.DeliveryTime = time.UnixMilli(n)
+			default:
+				opts.RetryCount, opts.HasRetryCount = int(n), true
+			}
+			i++
+		default:
+			return resp.Error(fmt.Sprintf("ERR Unrecognized XCLAIM option '%s'", params[i].Bulk)).Marshal()
+		}
+	}
+	// As in Redis, a delivery time in the future means now.
+	if opts.DeliveryTime.After(now) || opts.DeliveryTime.UnixMilli() < 0 {
+		opts.DeliveryTime = now
+	}
+
+	claimed, change, err := r.Store.XClaim(params[0].Bulk, params[1].Bulk, params[2].Bulk, minIdle, ids, opts)
+	r.rewriteGroupChanges(change)
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+	if opts.JustID {
+		return entryIDs(claimed).Marshal()
+	}
+	return formatEntries(claimed).Marshal()
+}
+
+// xautoclaim implements XAUTOCLAIM key group consumer min-idle-time start
+// [COUNT count] [JUSTID].
+func (r *CommandRouter) xautoclaim(params []resp.RESP) []byte {
+	if len(params) < 5 {
+		return wrongArgs("xautoclaim")
+	}
+
+	minIdle, err := parseMinIdle(params[3].Bulk, "XAUTOCLAIM")
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+
+	count, justID := 100, false
+	for i := 5; i < len(params); i++ {
+		opt := strings.ToUpper(params[i].Bulk)
+		switch {
+		case opt == "JUSTID":
+			justID = true
+		case opt == "COUNT" && i+1 < len(params):
+			n, err := strconv.Atoi(params[i+1].Bulk)
+			if err != nil {
+				return resp.Error(errNotInteger).Marshal()
+			}
+			if n < 1 {
+				return resp.Error("ERR COUNT must be > 0").Marshal()
+			}
+			count = n
+			i++
+		default:
+			return resp.Error("ERR syntax error").Marshal()
+		}
+	}
+
+	next, claimed, change, err := r.Store.XAutoClaim(params[0].Bulk, params[1].Bulk, params[2].Bulk, minIdle, params[4].Bulk, count, justID)
+	r.rewriteGroupChanges(change)
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+	reply := formatEntries(claimed)
+	if justID {
+		reply = entryIDs(claimed)
+	}
+	return resp.Array(resp.Bulk(next), reply, bulkArray(change.Dropped)).Marshal()
+}
+
+// parseMinIdle parses the min-idle-time argument of XCLAIM and XAUTOCLAIM
+// in milliseconds; negative values count as 0.
+func parseMinIdle(value, command string) (time.Duration, error) {
+	ms, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("ERR Invalid min-idle-time argument for %s", command)
+	}
+	return time.Duration(max(ms, 0)) * time.Millisecond, nil
+}
+
+// entryIDs returns the IDs of entries as a RESP array.
+func entryIDs(entries []structures.Entry) resp.RESP {
+	ids := make([]string, len(entries))
+	for i, entry := range entries {
+		ids[i] = entry.Key()
+	}
+	return bulkArray(ids)
+}
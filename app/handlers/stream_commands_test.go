@@ -0,0 +1,737 @@
+package handlers
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jgrecu/redis-clone/app/resp"
+	"github.com/jgrecu/redis-clone/app/structures"
+)
+
+// entryReply builds the reply for a stream entry with a single field.
+func entryReply(id, field, value string) resp.RESP {
+	return resp.Array(resp.Bulk(id), resp.Array(resp.Bulk(field), resp.Bulk(value)))
+}
+
+func TestConsumerGroupCommands(t *testing.T) {
+	ok := resp.String("OK").Marshal()
+	stream := func(s *structures.Store) {
+		s.XAdd("s", "1-1", map[string]string{"f": "a"})
+		s.XAdd("s", "2-1", map[string]string{"f": "b"})
+	}
+	group := func(s *structures.Store) {
+		stream(s)
+		s.XGroupCreate("s", "g", "0", false)
+	}
+	delivered := func(s *structures.Store) {
+		group(s)
+		s.XReadGroup(structures.XReadGroupOptions{Group: "g", Consumer: "alice"}, []string{"s"}, []string{">"})
+	}
+
+	tests := []commandTest{
+		{
+			name:     "XGROUP CREATE",
+			setup:    stream,
+			command:  bulks("XGROUP", "CREATE", "s", "g", "$"),
+			expected: ok,
+		},
+		{
+			name:     "XGROUP CREATE MKSTREAM",
+			setup:    func(s *structures.Store) {},
+			command:  bulks("XGROUP", "create", "s", "g", "0", "mkstream"),
+			expected: ok,
+		},
+		{
+			name:     "XGROUP CREATE missing key",
+			setup:    func(s *structures.Store) {},
+			command:  bulks("XGROUP", "CREATE", "s", "g", "$"),
+			expected: resp.Error(structures.ErrXGroupNoKey.Error()).Marshal(),
+		},
+		{
+			name:     "XGROUP CREATE existing group",
+			setup:    group,
+			command:  bulks("XGROUP", "CREATE", "s", "g", "$"),
+			expected: resp.Error("BUSYGROUP Consumer Group name already exists").Marshal(),
+		},
+		{
+			name:     "XGROUP CREATE unknown option",
+			setup:    stream,
+			command:  bulks("XGROUP", "CREATE", "s", "g", "$", "NOW"),
+			expected: resp.Error("ERR syntax error").Marshal(),
+		},
+		{
+			name:     "XGROUP SETID missing group",
+			setup:    stream,
+			command:  bulks("XGROUP", "SETID", "s", "g", "0"),
+			expected: resp.Error("NOGROUP No such consumer group 'g' for key name 's'").Marshal(),
+		},
+		{
+			name:     "XGROUP SETID invalid ID",
+			setup:    group,
+			command:  bulks("XGROUP", "SETID", "s", "g", "x-1"),
+			expected: resp.Error("ERR Invalid stream ID specified as stream command argument").Marshal(),
+		},
+		{
+			name:     "XGROUP CREATECONSUMER",
+			setup:    group,
+			command:  bulks("XGROUP", "CREATECONSUMER", "s", "g", "bob"),
+			expected: resp.Integer(1).Marshal(),
+		},
+		{
+			name:     "XGROUP DELCONSUMER returns pending count",
+			setup:    delivered,
+			command:  bulks("XGROUP", "DELCONSUMER", "s", "g", "alice"),
+			expected: resp.Integer(2).Marshal(),
+		},
+		{
+			name:     "XGROUP DESTROY",
+			setup:    group,
+			command:  bulks("XGROUP", "DESTROY", "s", "g"),
+			expected: resp.Integer(1).Marshal(),
+		},
+		{
+			name:     "XGROUP DESTROY wrong number of arguments",
+			setup:    group,
+			command:  bulks("XGROUP", "DESTROY", "s", "g", "extra"),
+			expected: resp.Error("ERR wrong number of arguments for 'xgroup|destroy' command").Marshal(),
+		},
+		{
+			name:     "XGROUP unknown subcommand",
+			setup:    group,
+			command:  bulks("XGROUP", "RENAME", "s", "g"),
+			expected: resp.Error("ERR unknown subcommand 'RENAME'. Try XGROUP HELP.").Marshal(),
+		},
+		{
+			name:    "XREADGROUP new entries with COUNT",
+			setup:   group,
+			command: bulks("XREADGROUP", "GROUP", "g", "alice", "COUNT", "1", "STREAMS", "s", ">"),
+			expected: resp.Array(
+				resp.Array(resp.Bulk("s"), resp.Array(entryReply("1-1", "f", "a"))),
+			).Marshal(),
+		},
+		{
+			name:     "XREADGROUP nothing new",
+			setup:    delivered,
+			command:  bulks("XREADGROUP", "GROUP", "g", "alice", "STREAMS", "s", ">"),
+			expected: resp.Nil().Marshal(),
+		},
+		{
+			name:    "XREADGROUP pending history",
+			setup:   delivered,
+			command: bulks("XREADGROUP", "GROUP", "g", "alice", "STREAMS", "s", "0"),
+			expected: resp.Array(
+				resp.Array(resp.Bulk("s"), resp.Array(entryReply("1-1", "f", "a"), entryReply("2-1", "f", "b"))),
+			).Marshal(),
+		},
+		{
+			name:    "XREADGROUP history of another consumer is empty",
+			setup:   delivered,
+			command: bulks("XREADGROUP", "GROUP", "g", "bob", "BLOCK", "100", "STREAMS", "s", "0"),
+			expected: resp.Array(
+				resp.Array(resp.Bulk("s"), resp.Array()),
+			).Marshal(),
+		},
+		{
+			name:     "XREADGROUP missing group",
+			setup:    stream,
+			command:  bulks("XREADGROUP", "GROUP", "g", "alice", "STREAMS", "s", ">"),
+			expected: resp.Error("NOGROUP No such key 's' or consumer group 'g' in XREADGROUP with GROUP option").Marshal(),
+		},
+		{
+			name:     "XREADGROUP unbalanced streams",
+			setup:    group,
+			command:  bulks("XREADGROUP", "GROUP", "g", "alice", "STREAMS", "s"),
+			expected: resp.Error("ERR Unbalanced 'xreadgroup' list of streams: for each stream key an ID or '>' must be specified.").Marshal(),
+		},
+		{
+			name:     "XREADGROUP without GROUP",
+			setup:    group,
+			command:  bulks("XREADGROUP", "STREAMS", "s", ">"),
+			expected: resp.Error("ERR syntax error").Marshal(),
+		},
+		{
+			name:     "XREADGROUP negative BLOCK",
+			setup:    group,
+			command:  bulks("XREADGROUP", "GROUP", "g", "alice", "BLOCK", "-1", "STREAMS", "s", ">"),
+			expected: resp.Error("ERR timeout is negative").Marshal(),
+		},
+		{
+			name:     "XREADGROUP on a string",
+			setup:    func(s *structures.Store) { s.Set("s", "v", time.Time{}) },
+			command:  bulks("XREADGROUP", "GROUP", "g", "alice", "STREAMS", "s", ">"),
+			expected: resp.Error(structures.ErrWrongType.Error()).Marshal(),
+		},
+	}
+
+	runCommandTests(t, tests)
+}
+
+func TestXReadGroup_BlockTimeout(t *testing.T) {
+	router := newTestRouter()
+	router.Store.XGroupCreate("s", "g", "$", true)
+
+	result := router.xreadgroup(bulks("GROUP", "g", "alice", "BLOCK", "10", "NOACK", "STREAMS", "s", ">"))
+	if !reflect.DeepEqual(result, resp.Nil().Marshal()) {
+		t.Errorf("XREADGROUP BLOCK timeout = %q, want nil", result)
+	}
+}
+
+func TestPendingEntryCommands(t *testing.T) {
+	delivered := func(s *structures.Store) {
+		s.XAdd("s", "1-1", map[string]string{"f": "a"})
+		s.XAdd("s", "2-1", map[string]string{"f": "b"})
+		s.XGroupCreate("s", "g", "0", false)
+		s.XReadGroup(structures.XReadGroupOptions{Group: "g", Consumer: "alice"}, []string{"s"}, []string{">"})
+	}
+
+	tests := []commandTest{
+		{
+			name:     "XACK",
+			setup:    delivered,
+			command:  bulks("XACK", "s", "g", "1-1", "1-1", "3-1"),
+			expected: resp.Integer(1).Marshal(),
+		},
+		{
+			name:     "XACK invalid ID",
+			setup:    delivered,
+			command:  bulks("XACK", "s", "g", "x"),
+			expected: resp.Error("ERR Invalid stream ID specified as stream command argument").Marshal(),
+		},
+		{
+			name:    "XPENDING summary",
+			setup:   delivered,
+			command: bulks("XPENDING", "s", "g"),
+			expected: resp.Array(
+				resp.Integer(2), resp.Bulk("1-1"), resp.Bulk("2-1"),
+				resp.Array(resp.Array(resp.Bulk("alice"), resp.Bulk("2"))),
+			).Marshal(),
+		},
+		{
+			name: "XPENDING summary of an empty PEL",
+			setup: func(s *structures.Store) {
+				s.XGroupCreate("s", "g", "$", true)
+			},
+			command:  bulks("XPENDING", "s", "g"),
+			expected: resp.Array(resp.Integer(0), resp.Nil(), resp.Nil(), resp.Nil()).Marshal(),
+		},
+		{
+			name:     "XPENDING idle filter",
+			setup:    delivered,
+			command:  bulks("XPENDING", "s", "g", "IDLE", "60000", "-", "+", "10"),
+			expected: resp.Array().Marshal(),
+		},
+		{
+			name:     "XPENDING other consumer",
+			setup:    delivered,
+			command:  bulks("XPENDING", "s", "g", "-", "+", "10", "bob"),
+			expected: resp.Array().Marshal(),
+		},
+		{
+			name:     "XPENDING missing count",
+			setup:    delivered,
+			command:  bulks("XPENDING", "s", "g", "-", "+"),
+			expected: resp.Error("ERR syntax error").Marshal(),
+		},
+		{
+			name:     "XPENDING missing group",
+			setup:    delivered,
+			command:  bulks("XPENDING", "s", "nogroup"),
+			expected: resp.Error("NOGROUP No such key 's' or consumer group 'nogroup'").Marshal(),
+		},
+		{
+			name:     "XCLAIM JUSTID",
+			setup:    delivered,
+			command:  bulks("XCLAIM", "s", "g", "bob", "0", "1-1", "9-9", "JUSTID"),
+			expected: resp.Array(resp.Bulk("1-1")).Marshal(),
+		},
+		{
+			name:     "XCLAIM entries",
+			setup:    delivered,
+			command:  bulks("XCLAIM", "s", "g", "bob", "0", "2-1", "IDLE", "500", "RETRYCOUNT", "3"),
+			expected: resp.Array(entryReply("2-1", "f", "b")).Marshal(),
+		},
+		{
+			name:     "XCLAIM not idle enough",
+			setup:    delivered,
+			command:  bulks("XCLAIM", "s", "g", "bob", "60000", "1-1"),
+			expected: resp.Array().Marshal(),
+		},
+		{
+			name:     "XCLAIM invalid min-idle-time",
+			setup:    delivered,
+			command:  bulks("XCLAIM", "s", "g", "bob", "soon", "1-1"),
+			expected: resp.Error("ERR Invalid min-idle-time argument for XCLAIM").Marshal(),
+		},
+		{
+			name:     "XCLAIM invalid RETRYCOUNT",
+			setup:    delivered,
+			command:  bulks("XCLAIM", "s", "g", "bob", "0", "1-1", "RETRYCOUNT", "x"),
+			expected: resp.Error("ERR Invalid RETRYCOUNT option argument for XCLAIM").Marshal(),
+		},
+		{
+			name:     "XCLAIM unknown option",
+			setup:    delivered,
+			command:  bulks("XCLAIM", "s", "g", "bob", "0", "1-1", "LASTID"),
+			expected: resp.Error("ERR Unrecognized XCLAIM option 'LASTID'").Marshal(),
+		},
+		{
+			name:    "XAUTOCLAIM",
+			setup:   delivered,
+			command: bulks("XAUTOCLAIM", "s", "g", "bob", "0", "-", "COUNT", "1"),
+			expected: resp.Array(
+				resp.Bulk("2-1"), resp.Array(entryReply("1-1", "f", "a")), resp.Array(),
+			).Marshal(),
+		},
+		{
+			name:    "XAUTOCLAIM JUSTID",
+			setup:   delivered,
+			command: bulks("XAUTOCLAIM", "s", "g", "bob", "0", "(1-1", "JUSTID"),
+			expected: resp.Array(
+				resp.Bulk("0-0"), resp.Array(resp.Bulk("2-1")), resp.Array(),
+			).Marshal(),
+		},
+		{
+			name:     "XAUTOCLAIM zero COUNT",
+			setup:    delivered,
+			command:  bulks("XAUTOCLAIM", "s", "g", "bob", "0", "-", "COUNT", "0"),
+			expected: resp.Error("ERR COUNT must be > 0").Marshal(),
+		},
+	}
+
+	runCommandTests(t, tests)
+}
+
+func TestStreamRangeCommands(t *testing.T) {
+	stream := func(s *structures.Store) {
+		s.XAdd("s", "1-1", map[string]string{"f": "a"})
+		s.XAdd("s", "1-2", map[string]string{"f": "b"})
+		s.XAdd("s", "2-1", map[string]string{"f": "c"})
+		s.XAdd("s", "3-0", map[string]string{"f": "d"})
+	}
+	a, b, c, d := entryReply("1-1", "f", "a"), entryReply("1-2", "f", "b"), entryReply("2-1", "f", "c"), entryReply("3-0", "f", "d")
+	invalidID := resp.Error(structures.ErrInvalidStreamID.Error()).Marshal()
+
+	tests := []commandTest{
+		{
+			name:     "XRANGE with COUNT",
+			setup:    stream,
+			command:  bulks("XRANGE", "s", "-", "+", "count", "2"),
+			expected: resp.Array(a, b).Marshal(),
+		},
+		{
+			name:     "XRANGE with negative COUNT",
+			setup:    stream,
+			command:  bulks("XRANGE", "s", "-", "+", "COUNT", "-1"),
+			expected: resp.Nil().Marshal(),
+		},
+		{
+			name:     "XRANGE with incomplete IDs",
+			setup:    stream,
+			command:  bulks("XRANGE", "s", "1", "2"),
+			expected: resp.Array(a, b, c).Marshal(),
+		},
+		{
+			name:     "XRANGE with exclusive IDs",
+			setup:    stream,
+			command:  bulks("XRANGE", "s", "(1-1", "(3-0"),
+			expected: resp.Array(b, c).Marshal(),
+		},
+		{
+			name:     "XRANGE exclusive start continues after the last entry read",
+			setup:    stream,
+			command:  bulks("XRANGE", "s", "(1-2", "+", "COUNT", "1"),
+			expected: resp.Array(c).Marshal(),
+		},
+		{
+			name:     "XRANGE invalid ID",
+			setup:    stream,
+			command:  bulks("XRANGE", "s", "one", "+"),
+			expected: invalidID,
+		},
+		{
+			name:     "XRANGE exclusive start at the greatest ID",
+			setup:    stream,
+			command:  bulks("XRANGE", "s", "(9223372036854775807-9223372036854775807", "+"),
+			expected: resp.Error("ERR invalid start ID for the interval").Marshal(),
+		},
+		{
+			name:     "XRANGE exclusive end at 0-0",
+			setup:    stream,
+			command:  bulks("XRANGE", "s", "-", "(0-0"),
+			expected: resp.Error("ERR invalid end ID for the interval").Marshal(),
+		},
+		{
+			name:     "XRANGE COUNT without a value",
+			setup:    stream,
+			command:  bulks("XRANGE", "s", "-", "+", "COUNT"),
+			expected: resp.Error("ERR syntax error").Marshal(),
+		},
+		{
+			name:     "XRANGE COUNT not an integer",
+			setup:    stream,
+			command:  bulks("XRANGE", "s", "-", "+", "COUNT", "x"),
+			expected: resp.Error(errNotInteger).Marshal(),
+		},
+		{
+			name:     "XREVRANGE",
+			setup:    stream,
+			command:  bulks("XREVRANGE", "s", "+", "-"),
+			expected: resp.Array(d, c, b, a).Marshal(),
+		},
+		{
+			name:     "XREVRANGE with COUNT and incomplete IDs",
+			setup:    stream,
+			command:  bulks("XREVRANGE", "s", "2", "1", "COUNT", "2"),
+			expected: resp.Array(c, b).Marshal(),
+		},
+		{
+			name:     "XREVRANGE with exclusive IDs",
+			setup:    stream,
+			command:  bulks("XREVRANGE", "s", "(3-0", "(1-1"),
+			expected: resp.Array(c, b).Marshal(),
+		},
+		{
+			name:     "XREVRANGE bounds in XRANGE order",
+			setup:    stream,
+			command:  bulks("XREVRANGE", "s", "-", "+"),
+			expected: resp.Array().Marshal(),
+		},
+		{
+			name:     "XREVRANGE missing key",
+			setup:    func(s *structures.Store) {},
+			command:  bulks("XREVRANGE", "s", "+", "-"),
+			expected: resp.Array().Marshal(),
+		},
+		{
+			name:     "XREVRANGE against a list",
+			setup:    func(s *structures.Store) { s.RPush("s", false, "a") },
+			command:  bulks("XREVRANGE", "s", "+", "-"),
+			expected: resp.Error(structures.ErrWrongType.Error()).Marshal(),
+		},
+		{
+			name:     "XREVRANGE too few arguments",
+			setup:    stream,
+			command:  bulks("XREVRANGE", "s", "+"),
+			expected: wrongArgs("xrevrange"),
+		},
+		{
+			name:     "XREAD with COUNT",
+			setup:    stream,
+			command:  bulks("XREAD", "COUNT", "2", "STREAMS", "s", "1-1"),
+			expected: resp.Array(resp.Array(resp.Bulk("s"), resp.Array(b, c))).Marshal(),
+		},
+		{
+			name:     "XREAD with incomplete ID",
+			setup:    stream,
+			command:  bulks("XREAD", "STREAMS", "s", "2"),
+			expected: resp.Array(resp.Array(resp.Bulk("s"), resp.Array(c, d))).Marshal(),
+		},
+		{
+			name:     "XREAD with COUNT and BLOCK",
+			setup:    stream,
+			command:  bulks("XREAD", "BLOCK", "10", "COUNT", "1", "STREAMS", "s", "0"),
+			expected: resp.Array(resp.Array(resp.Bulk("s"), resp.Array(a))).Marshal(),
+		},
+		{
+			name:     "XREAD invalid ID",
+			setup:    stream,
+			command:  bulks("XREAD", "STREAMS", "s", "1-x"),
+			expected: invalidID,
+		},
+		{
+			name:     "XREAD unbalanced streams",
+			setup:    stream,
+			command:  bulks("XREAD", "STREAMS", "s", "t", "0"),
+			expected: resp.Error("ERR Unbalanced 'xread' list of streams: for each stream key an ID or '$' must be specified.").Marshal(),
+		},
+	}
+
+	runCommandTests(t, tests)
+}
+
+func TestStreamTrimCommands(t *testing.T) {
+	stream := func(s *structures.Store) {
+		s.XAdd("s", "1-1", map[string]string{"f": "a"})
+		s.XAdd("s", "2-1", map[string]string{"f": "b"})
+		s.XAdd("s", "3-1", map[string]string{"f": "c"})
+	}
+	syntaxError := func(msg string) []byte { return resp.Error("ERR syntax error" + msg).Marshal() }
+
+	tests := []commandTest{
+		{
+			name:     "XLEN",
+			setup:    stream,
+			command:  bulks("XLEN", "s"),
+			expected: resp.Integer(3).Marshal(),
+		},
+		{
+			name:     "XLEN missing key",
+			setup:    func(s *structures.Store) {},
+			command:  bulks("XLEN", "s"),
+			expected: resp.Integer(0).Marshal(),
+		},
+		{
+			name:     "XLEN on a string",
+			setup:    func(s *structures.Store) { s.Set("s", "v", time.Time{}) },
+			command:  bulks("XLEN", "s"),
+			expected: resp.Error(structures.ErrWrongType.Error()).Marshal(),
+		},
+		{
+			name:     "XDEL",
+			setup:    stream,
+			command:  bulks("XDEL", "s", "1-1", "3-1", "4-1"),
+			expected: resp.Integer(2).Marshal(),
+		},
+		{
+			name:     "XDEL invalid ID",
+			setup:    stream,
+			command:  bulks("XDEL", "s", "1-1", "x"),
+			expected: resp.Error(structures.ErrInvalidStreamID.Error()).Marshal(),
+		},
+		{
+			name:     "XDEL too few arguments",
+			setup:    stream,
+			command:  bulks("XDEL", "s"),
+			expected: wrongArgs("xdel"),
+		},
+		{
+			name:     "XTRIM MAXLEN",
+			setup:    stream,
+			command:  bulks("XTRIM", "s", "maxlen", "=", "1"),
+			expected: resp.Integer(2).Marshal(),
+		},
+		{
+			name:     "XTRIM MAXLEN ~ keeps a partial chunk",
+			setup:    stream,
+			command:  bulks("XTRIM", "s", "MAXLEN", "~", "1"),
+			expected: resp.Integer(0).Marshal(),
+		},
+		{
+			name:     "XTRIM MINID",
+			setup:    stream,
+			command:  bulks("XTRIM", "s", "MINID", "2"),
+			expected: resp.Integer(1).Marshal(),
+		},
+		{
+			name:     "XTRIM MINID ~ with LIMIT",
+			setup:    stream,
+			command:  bulks("XTRIM", "s", "MINID", "~", "9", "LIMIT", "0"),
+			expected: resp.Integer(3).Marshal(),
+		},
+		{
+			name:     "XTRIM without a strategy",
+			setup:    stream,
+			command:  bulks("XTRIM", "s", "LIMIT", "10"),
+			expected: syntaxError(", LIMIT cannot be used without specifying a trimming strategy"),
+		},
+		{
+			name:     "XTRIM LIMIT without ~",
+			setup:    stream,
+			command:  bulks("XTRIM", "s", "MAXLEN", "1", "LIMIT", "10"),
+			expected: syntaxError(", LIMIT cannot be used without the special ~ option"),
+		},
+		{
+			name:     "XTRIM MAXLEN and MINID",
+			setup:    stream,
+			command:  bulks("XTRIM", "s", "MAXLEN", "1", "MINID", "2"),
+			expected: syntaxError(", MAXLEN and MINID options at the same time are not compatible"),
+		},
+		{
+			name:     "XTRIM negative MAXLEN",
+			setup:    stream,
+			command:  bulks("XTRIM", "s", "MAXLEN", "-1"),
+			expected: resp.Error("ERR The MAXLEN argument must be >= 0.").Marshal(),
+		},
+		{
+			name:     "XTRIM MAXLEN not an integer",
+			setup:    stream,
+			command:  bulks("XTRIM", "s", "MAXLEN", "x"),
+			expected: resp.Error(errNotInteger).Marshal(),
+		},
+		{
+			name:     "XTRIM unknown option",
+			setup:    stream,
+			command:  bulks("XTRIM", "s", "MAXLEN", "1", "NOMKSTREAM"),
+			expected: syntaxError(""),
+		},
+		{
+			name:     "XADD NOMKSTREAM missing key",
+			setup:    func(s *structures.Store) {},
+			command:  bulks("XADD", "s", "NOMKSTREAM", "1-1", "f", "v"),
+			expected: resp.Nil().Marshal(),
+		},
+		{
+			name:     "XADD NOMKSTREAM and MAXLEN",
+			setup:    stream,
+			command:  bulks("XADD", "s", "NOMKSTREAM", "MAXLEN", "~", "1", "LIMIT", "5", "4-1", "f", "d"),
+			expected: resp.Bulk("4-1").Marshal(),
+		},
+		{
+			name:     "XADD invalid MINID",
+			setup:    stream,
+			command:  bulks("XADD", "s", "MINID", "x", "4-1", "f", "d"),
+			expected: resp.Error(structures.ErrInvalidStreamID.Error()).Marshal(),
+		},
+		{
+			name:     "XADD options without an ID",
+			setup:    stream,
+			command:  bulks("XADD", "s", "NOMKSTREAM"),
+			expected: wrongArgs("xadd"),
+		},
+		{
+			name:     "XADD without fields",
+			setup:    stream,
+			command:  bulks("XADD", "s", "4-1"),
+			expected: wrongArgs("xadd"),
+		},
+		{
+			name:     "XADD with a field missing its value",
+			setup:    stream,
+			command:  bulks("XADD", "s", "4-1", "f", "d", "g"),
+			expected: wrongArgs("xadd"),
+		},
+	}
+
+	runCommandTests(t, tests)
+}
+
+func TestXAdd_Trims(t *testing.T) {
+	router := newTestRouter()
+	for _, id := range []string{"1-1", "2-1", "3-1"} {
+		router.xadd(bulks("s", "MAXLEN", "2", id, "f", "v"))
+	}
+
+	entries, _, _ := router.Store.XRange("s", "-", "+", 0)
+	if len(entries) != 2 || entries[0].Key() != "2-1" {
+		t.Errorf("XADD MAXLEN 2 left %d entries starting at %v", len(entries), entries)
+	}
+}
+
+func TestXAdd_Propagation(t *testing.T) {
+	router := newTestRouter()
+	args := bulks("XADD", "s", "MAXLEN", "~", "10", "5-*", "f", "v")
+	router.GetHandler("XADD")(args[1:])
+
+	// An approximate trim goes out as the exact trim it amounted to.
+	want := [][]resp.RESP{bulks("XADD", "s", "MAXLEN", "=", "1", "5-0", "f", "v")}
+	if got := router.Propagation(args); !reflect.DeepEqual(got, want) {
+		t.Errorf("Propagation = %v, want %v", got, want)
+	}
+
+	for _, id := range []string{"6-0", "7-0", "8-0", "9-0"} {
+		router.Store.XAdd("s", id, map[string]string{"f": "v"})
+	}
+	want = [][]resp.RESP{bulks("XADD", "s", "MINID", "=", "5-0", "10-0", "f", "v")}
+	if got := propagated(router, "XADD", "s", "NOMKSTREAM", "MINID", "~", "8", "LIMIT", "10", "10-0", "f", "v"); !reflect.DeepEqual(got, want) {
+		t.Errorf("Propagation of MINID ~ = %v, want %v", got, want)
+	}
+	want = [][]resp.RESP{bulks("XTRIM", "s", "MAXLEN", "=", "2")}
+	if got := propagated(router, "XTRIM", "s", "MAXLEN", "2"); !reflect.DeepEqual(got, want) {
+		t.Errorf("Propagation of XTRIM = %v, want %v", got, want)
+	}
+	if got := propagated(router, "XTRIM", "s", "MAXLEN", "~", "5"); len(got) != 0 {
+		t.Errorf("Propagation of an XTRIM trimming nothing = %v, want none", got)
+	}
+
+	args = bulks("XADD", "missing", "NOMKSTREAM", "*", "f", "v")
+	router.GetHandler("XADD")(args[1:])
+	if got := router.Propagation(args); len(got) != 0 {
+		t.Errorf("Propagation of an XADD adding nothing = %v, want none", got)
+	}
+
+	args = bulks("XDEL", "s", "5-0")
+	router.GetHandler("XDEL")(args[1:])
+	if got := router.Propagation(args); !reflect.DeepEqual(got, [][]resp.RESP{args}) {
+		t.Errorf("Propagation of XDEL = %v, want the command itself", got)
+	}
+}
+
+// pendingState lists the pending entries of group g of the stream s,
+// leaving out their idle time, which depends on when it is asked.
+func pendingState(t *testing.T, s *structures.Store) []structures.PendingInfo {
+	t.Helper()
+	pending, err := s.XPending("s", "g", structures.XPendingOptions{Start: "-", End: "+", Count: 100})
+	if err != nil {
+		t.Fatalf("XPending error = %v", err)
+	}
+	for i := range pending {
+		pending[i].Idle = 0
+	}
+	return pending
+}
+
+func TestXReadGroup_Propagation(t *testing.T) {
+	master, replica := newTestRouter(), newTestRouter()
+	for _, id := range []string{"1-1", "2-1", "3-1"} {
+		replicate(master, replica, "XADD", "s", id, "f", "v")
+	}
+	replicate(master, replica, "XGROUP", "CREATE", "s", "g", "0")
+
+	replicate(master, replica, "XREADGROUP", "GROUP", "g", "alice", "COUNT", "2", "STREAMS", "s", ">")
+	time.Sleep(2 * time.Millisecond)
+	replicate(master, replica, "XREADGROUP", "GROUP", "g", "bob", "NOACK", "STREAMS", "s", ">")
+
+	args := bulks("XREADGROUP", "GROUP", "g", "alice", "STREAMS", "s", "0")
+	master.GetHandler("XREADGROUP")(args[1:])
+	if got := master.Propagation(args); len(got) != 0 {
+		t.Errorf("Propagation of a history read = %v, want none", got)
+	}
+
+	if got, want := pendingState(t, replica.Store), pendingState(t, master.Store); !reflect.DeepEqual(got, want) {
+		t.Errorf("replica pending entries = %+v, want %+v", got, want)
+	}
+	if created, _ := replica.Store.XGroupCreateConsumer("s", "g", "bob"); created {
+		t.Error("replica is missing consumer bob")
+	}
+	// Both moved the group past every entry.
+	opts := structures.XReadGroupOptions{Group: "g", Consumer: "carol"}
+	if result, _, _ := replica.Store.XReadGroup(opts, []string{"s"}, []string{">"}); len(result) != 0 {
+		t.Errorf("replica delivered %v again", result)
+	}
+}
+
+func TestXReadGroup_ServedPropagation(t *testing.T) {
+	r := newTestRouter()
+	r.Store.XGroupCreate("s", "g", "$", true)
+	r.Store.XGroupCreateConsumer("s", "g", "alice")
+
+	got := servedReplication(t, r, "s",
+		[]string{"XREADGROUP", "GROUP", "g", "alice", "BLOCK", "0", "STREAMS", "s", ">"},
+		"XADD", "s", "1-1", "f", "v")
+	if len(got) != 2 || !reflect.DeepEqual(got[0], bulks("XADD", "s", "1-1", "f", "v")) {
+		t.Fatalf("replicated %v, want the XADD then the delivery", got)
+	}
+	claim := bulkParams(got[1])
+	if claim[0] != "XCLAIM" || claim[3] != "alice" || claim[5] != "1-1" || claim[len(claim)-1] != "1-1" {
+		t.Errorf("delivery replicated as %v, want an XCLAIM of 1-1 to alice moving LASTID to 1-1", claim)
+	}
+}
+
+func TestXClaim_Propagation(t *testing.T) {
+	master, replica := newTestRouter(), newTestRouter()
+	for _, id := range []string{"1-1", "2-1", "3-1", "4-1"} {
+		replicate(master, replica, "XADD", "s", id, "f", "v")
+	}
+	replicate(master, replica, "XGROUP", "CREATE", "s", "g", "0")
+	replicate(master, replica, "XREADGROUP", "GROUP", "g", "alice", "COUNT", "3", "STREAMS", "s", ">")
+	time.Sleep(5 * time.Millisecond)
+
+	replicate(master, replica, "XCLAIM", "s", "g", "bob", "1", "1-1", "4-1", "FORCE", "LASTID", "4-1")
+	replicate(master, replica, "XDEL", "s", "2-1")
+	replicate(master, replica, "XAUTOCLAIM", "s", "g", "carol", "1", "0", "JUSTID")
+
+	if got, want := pendingState(t, replica.Store), pendingState(t, master.Store); !reflect.DeepEqual(got, want) {
+		t.Errorf("replica pending entries = %+v, want %+v", got, want)
+	}
+	opts := structures.XReadGroupOptions{Group: "g", Consumer: "dave"}
+	if result, _, _ := replica.Store.XReadGroup(opts, []string{"s"}, []string{">"}); len(result) != 0 {
+		t.Errorf("replica delivered %v again, want LASTID applied", result)
+	}
+
+	args := bulks("XCLAIM", "s", "g", "bob", "3600000", "3-1")
+	master.GetHandler("XCLAIM")(args[1:])
+	if got := master.Propagation(args); len(got) != 0 {
+		t.Errorf("Propagation of an XCLAIM claiming nothing = %v, want none", got)
+	}
+}
@@ -0,0 +1,290 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/jgrecu/redis-clone/app/resp"
+	"github.com/jgrecu/redis-clone/app/structures"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func (r *CommandRouter) appendCmd(params []resp.RESP) []byte {
+	if len(params) != 2 {
+		return wrongArgs("append")
+	}
+
+	length, err := r.Store.Append(params[0].Bulk, params[1].Bulk)
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+	return resp.Integer(length).Marshal()
+}
+
+func (r *CommandRouter) strlen(params []resp.RESP) []byte {
+	if len(params) != 1 {
+		return wrongArgs("strlen")
+	}
+
+	length, err := r.Store.StrLen(params[0].Bulk)
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+	return resp.Integer(length).Marshal()
+}
+
+func (r *CommandRouter) getrange(params []resp.RESP) []byte {
+	if len(params) != 3 {
+		return wrongArgs("getrange")
+	}
+
+	start, err1 := strconv.Atoi(params[1].Bulk)
+	end, err2 := strconv.Atoi(params[2].Bulk)
+	if err1 != nil || err2 != nil {
+		return resp.Error(errNotInteger).Marshal()
+	}
+
+	value, err := r.Store.GetRange(params[0].Bulk, start, end)
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+	return resp.Bulk(value).Marshal()
+}
+
+func (r *CommandRouter) setrange(params []resp.RESP) []byte {
+	if len(params) != 3 {
+		return wrongArgs("setrange")
+	}
+
+	offset, err := strconv.Atoi(params[1].Bulk)
+	if err != nil {
+		return resp.Error(errNotInteger).Marshal()
+	}
+	if offset < 0 {
+		return resp.Error("ERR offset is out of range").Marshal()
+	}
+
+	length, err := r.Store.SetRange(params[0].Bulk, offset, params[2].Bulk)
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+	return resp.Integer(length).Marshal()
+}
+
+func (r *CommandRouter) getdel(params []resp.RESP) []byte {
+	if len(params) != 1 {
+		return wrongArgs("getdel")
+	}
+
+	value, ok, err := r.Store.GetDel(params[0].Bulk)
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+	if !ok {
+		return resp.Nil().Marshal()
+	}
+	return resp.Bulk(value).Marshal()
+}
+
+func (r *CommandRouter) getex(params []resp.RESP) []byte {
+	if len(params) < 1 {
+		return wrongArgs("getex")
+	}
+
+	update := false
+	var expiry time.Time
+
+	for i := 1; i < len(params); i++ {
+		opt := strings.ToUpper(params[i].Bulk)
+		switch {
+		case opt == "PERSIST" && !update:
+			update = true
+		case (opt == "EX" || opt == "PX" || opt == "EXAT" || opt == "PXAT") && !update && i+1 < len(params):
+			amount, err := strconv.ParseInt(params[i+1].Bulk, 10, 64)
+			if err != nil {
+				return resp.Error(errNotInteger).Marshal()
+			}
+			unit := time.Second
+			if opt == "PX" || opt == "PXAT" {
+				unit = time.Millisecond
+			}
+			at, ok := expireAt(amount, unit, strings.HasSuffix(opt, "AT"))
+			if amount <= 0 || !ok {
+				return resp.Error("ERR invalid expire time in 'getex' command").Marshal()
+			}
+			expiry = at
+			update = true
+			i++
+		default:
+			return resp.Error("ERR syntax error").Marshal()
+		}
+	}
+
+	key := params[0].Bulk
+	value, ok, err := r.Store.GetEx(key, update, expiry)
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+	r.rewrite()
+	switch {
+	case !ok || !update:
+	case expiry.IsZero():
+		r.rewrite(resp.Command("PERSIST", key))
+	default:
+		r.rewriteExpiry(key, expiry)
+	}
+	if !ok {
+		return resp.Nil().Marshal()
+	}
+	return resp.Bulk(value).Marshal()
+}
+
+func (r *CommandRouter) getset(params []resp.RESP) []byte {
+	if len(params) != 2 {
+		return wrongArgs("getset")
+	}
+
+	old, hadOld, _, err := r.Store.SetWithOptions(params[0].Bulk, params[1].Bulk, structures.SetOptions{Get: true})
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+	if !hadOld {
+		return resp.Nil().Marshal()
+	}
+	return resp.Bulk(old).Marshal()
+}
+
+func (r *CommandRouter) setnx(params []resp.RESP) []byte {
+	if len(params) != 2 {
+		return wrongArgs("setnx")
+	}
+
+	_, _, stored, err := r.Store.SetWithOptions(params[0].Bulk, params[1].Bulk, structures.SetOptions{NX: true})
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+	return resp.Integer(boolToInt(stored)).Marshal()
+}
+
+func (r *CommandRouter) setex(params []resp.RESP) []byte {
+	return r.setexGeneric("setex", params, time.Second)
+}
+
+func (r *CommandRouter) psetex(params []resp.RESP) []byte {
+	return r.setexGeneric("psetex", params, time.Millisecond)
+}
+
+func (r *CommandRouter) setexGeneric(name string, params []resp.RESP, unit time.Duration) []byte {
+	if len(params) != 3 {
+		return wrongArgs(name)
+	}
+
+	amount, err := strconv.ParseInt(params[1].Bulk, 10, 64)
+	if err != nil {
+		return resp.Error(errNotInteger).Marshal()
+	}
+	at, ok := expireAt(amount, unit, false)
+	if amount <= 0 || !ok {
+		return resp.Error(fmt.Sprintf("ERR invalid expire time in '%s' command", name)).Marshal()
+	}
+
+	r.Store.Set(params[0].Bulk, params[2].Bulk, at)
+	r.rewrite(resp.Command("SET", params[0].Bulk, params[2].Bulk, "PXAT", formatUnixMillis(at)))
+	return resp.String("OK").Marshal()
+}
+
+func (r *CommandRouter) mget(params []resp.RESP) []byte {
+	if len(params) < 1 {
+		return wrongArgs("mget")
+	}
+
+	values, found := r.Store.MGet(bulkParams(params)...)
+	result := make([]resp.RESP, len(values))
+	for i, v := range values {
+		if found[i] {
+			result[i] = resp.Bulk(v)
+		} else {
+			result[i] = resp.Nil()
+		}
+	}
+	return resp.Array(result...).Marshal()
+}
+
+func (r *CommandRouter) mset(params []resp.RESP) []byte {
+	if len(params) < 2 || len(params)%2 != 0 {
+		return wrongArgs("mset")
+	}
+
+	r.Store.MSet(fieldPairs(params))
+	return resp.String("OK").Marshal()
+}
+
+func (r *CommandRouter) msetnx(params []resp.RESP) []byte {
+	if len(params) < 2 || len(params)%2 != 0 {
+		return wrongArgs("msetnx")
+	}
+
+	return resp.Integer(boolToInt(r.Store.MSetNX(fieldPairs(params)))).Marshal()
+}
+
+func (r *CommandRouter) incrby(params []resp.RESP) []byte {
+	if len(params) != 2 {
+		return wrongArgs("incrby")
+	}
+
+	delta, err := strconv.ParseInt(params[1].Bulk, 10, 64)
+	if err != nil {
+		return resp.Error(errNotInteger).Marshal()
+	}
+	return r.incrBy(params[0].Bulk, delta)
+}
+
+func (r *CommandRouter) decr(params []resp.RESP) []byte {
+	if len(params) != 1 {
+		return wrongArgs("decr")
+	}
+	return r.incrBy(params[0].Bulk, -1)
+}
+
+func (r *CommandRouter) decrby(params []resp.RESP) []byte {
+	if len(params) != 2 {
+		return wrongArgs("decrby")
+	}
+
+	delta, err := strconv.ParseInt(params[1].Bulk, 10, 64)
+	if err != nil {
+		return resp.Error(errNotInteger).Marshal()
+	}
+	// Negating MinInt64 overflows, and Redis rejects it the same way.
+	if delta == math.MinInt64 {
+		return resp.Error(structures.ErrOverflow.Error()).Marshal()
+	}
+	return r.incrBy(params[0].Bulk, -delta)
+}
+
+// incrBy applies delta to the integer at key and replies with the result.
+func (r *CommandRouter) incrBy(key string, delta int64) []byte {
+	value, err := r.Store.IncrBy(key, delta)
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+	return resp.Integer(int(value)).Marshal()
+}
+
+func (r *CommandRouter) incrbyfloat(params []resp.RESP) []byte {
+	if len(params) != 2 {
+		return wrongArgs("incrbyfloat")
+	}
+
+	delta, err := strconv.ParseFloat(params[1].Bulk, 64)
+	if err != nil || math.IsNaN(delta) || math.IsInf(delta, 0) {
+		return resp.Error(errNotFloat).Marshal()
+	}
+
+	value, err := r.Store.IncrByFloat(params[0].Bulk, delta)
+	if err != nil {
+		return resp.Error(err.Error()).Marshal()
+	}
+	return resp.Bulk(value).Marshal()
+}
@@ -0,0 +1,246 @@
+package handlers
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jgrecu/redis-clone/app/resp"
+	"github.com/jgrecu/redis-clone/app/structures"
+)
+
+func TestStringCommands(t *testing.T) {
+	tests := []commandTest{
+		{
+			name:     "APPEND",
+			setup:    func(s *structures.Store) { s.Set("k", "ab", time.Time{}) },
+			command:  bulks("APPEND", "k", "cd"),
+			expected: resp.Integer(4).Marshal(),
+		},
+		{
+			name:     "APPEND against list",
+			setup:    func(s *structures.Store) { s.RPush("k", false, "a") },
+			command:  bulks("APPEND", "k", "cd"),
+			expected: wrongType,
+		},
+		{
+			name:     "STRLEN",
+			setup:    func(s *structures.Store) { s.Set("k", "hello", time.Time{}) },
+			command:  bulks("STRLEN", "k"),
+			expected: resp.Integer(5).Marshal(),
+		},
+		{
+			name:     "GETRANGE",
+			setup:    func(s *structures.Store) { s.Set("k", "hello", time.Time{}) },
+			command:  bulks("GETRANGE", "k", "1", "-2"),
+			expected: resp.Bulk("ell").Marshal(),
+		},
+		{
+			name:     "GETRANGE missing key",
+			setup:    func(s *structures.Store) {},
+			command:  bulks("GETRANGE", "k", "0", "-1"),
+			expected: resp.Bulk("").Marshal(),
+		},
+		{
+			name:     "SETRANGE negative offset",
+			setup:    func(s *structures.Store) {},
+			command:  bulks("SETRANGE", "k", "-1", "x"),
+			expected: resp.Error("ERR offset is out of range").Marshal(),
+		},
+		{
+			name:     "SETRANGE",
+			setup:    func(s *structures.Store) { s.Set("k", "hello", time.Time{}) },
+			command:  bulks("SETRANGE", "k", "1", "a"),
+			expected: resp.Integer(5).Marshal(),
+		},
+		{
+			name:     "GETDEL missing key",
+			setup:    func(s *structures.Store) {},
+			command:  bulks("GETDEL", "k"),
+			expected: resp.Nil().Marshal(),
+		},
+		{
+			name:     "GETEX with EX",
+			setup:    func(s *structures.Store) { s.Set("k", "v", time.Time{}) },
+			command:  bulks("GETEX", "k", "EX", "100"),
+			expected: resp.Bulk("v").Marshal(),
+		},
+		{
+			name:     "GETEX EX and PERSIST",
+			setup:    func(s *structures.Store) {},
+			command:  bulks("GETEX", "k", "EX", "100", "PERSIST"),
+			expected: resp.Error("ERR syntax error").Marshal(),
+		},
+		{
+			name:     "GETEX zero expiry",
+			setup:    func(s *structures.Store) {},
+			command:  bulks("GETEX", "k", "PX", "0"),
+			expected: resp.Error("ERR invalid expire time in 'getex' command").Marshal(),
+		},
+		{
+			name:     "GETSET",
+			setup:    func(s *structures.Store) { s.Set("k", "old", time.Time{}) },
+			command:  bulks("GETSET", "k", "new"),
+			expected: resp.Bulk("old").Marshal(),
+		},
+		{
+			name:     "SETNX existing key",
+			setup:    func(s *structures.Store) { s.Set("k", "old", time.Time{}) },
+			command:  bulks("SETNX", "k", "new"),
+			expected: resp.Integer(0).Marshal(),
+		},
+		{
+			name:     "SETEX",
+			setup:    func(s *structures.Store) {},
+			command:  bulks("SETEX", "k", "10", "v"),
+			expected: resp.String("OK").Marshal(),
+		},
+		{
+			name:     "PSETEX negative expiry",
+			setup:    func(s *structures.Store) {},
+			command:  bulks("PSETEX", "k", "-5", "v"),
+			expected: resp.Error("ERR invalid expire time in 'psetex' command").Marshal(),
+		},
+		{
+			name: "MGET",
+			setup: func(s *structures.Store) {
+				s.Set("a", "1", time.Time{})
+				s.RPush("l", false, "x")
+			},
+			command:  bulks("MGET", "a", "missing", "l"),
+			expected: resp.Array(resp.Bulk("1"), resp.Nil(), resp.Nil()).Marshal(),
+		},
+		{
+			name:     "MGET no keys",
+			setup:    func(s *structures.Store) {},
+			command:  bulks("MGET"),
+			expected: resp.Error("ERR wrong number of arguments for 'mget' command").Marshal(),
+		},
+		{
+			name:     "MSET",
+			setup:    func(s *structures.Store) { s.RPush("a", false, "x") },
+			command:  bulks("MSET", "a", "1", "b", "2"),
+			expected: resp.String("OK").Marshal(),
+		},
+		{
+			name:     "MSET odd arguments",
+			setup:    func(s *structures.Store) {},
+			command:  bulks("MSET", "a", "1", "b"),
+			expected: resp.Error("ERR wrong number of arguments for 'mset' command").Marshal(),
+		},
+		{
+			name:     "MSETNX",
+			setup:    func(s *structures.Store) {},
+			command:  bulks("MSETNX", "a", "1", "b", "2"),
+			expected: resp.Integer(1).Marshal(),
+		},
+		{
+			name:     "MSETNX odd arguments",
+			setup:    func(s *structures.Store) {},
+			command:  bulks("MSETNX", "a", "1", "b"),
+			expected: resp.Error("ERR wrong number of arguments for 'msetnx' command").Marshal(),
+		},
+		{
+			name:     "INCRBY",
+			setup:    func(s *structures.Store) { s.Set("n", "5", time.Time{}) },
+			command:  bulks("INCRBY", "n", "10"),
+			expected: resp.Integer(15).Marshal(),
+		},
+		{
+			name:     "INCRBY overflow",
+			setup:    func(s *structures.Store) { s.Set("n", "9223372036854775807", time.Time{}) },
+			command:  bulks("INCRBY", "n", "1"),
+			expected: resp.Error("ERR increment or decrement would overflow").Marshal(),
+		},
+		{
+			name:     "INCRBY non-integer increment",
+			setup:    func(s *structures.Store) {},
+			command:  bulks("INCRBY", "n", "1.5"),
+			expected: resp.Error(errNotInteger).Marshal(),
+		},
+		{
+			name:     "INCR against list",
+			setup:    func(s *structures.Store) { s.RPush("n", false, "a") },
+			command:  bulks("INCR", "n"),
+			expected: wrongType,
+		},
+		{
+			name:     "DECR",
+			setup:    func(s *structures.Store) {},
+			command:  bulks("DECR", "n"),
+			expected: resp.Integer(-1).Marshal(),
+		},
+		{
+			name:     "DECRBY",
+			setup:    func(s *structures.Store) { s.Set("n", "10", time.Time{}) },
+			command:  bulks("DECRBY", "n", "3"),
+			expected: resp.Integer(7).Marshal(),
+		},
+		{
+			name:     "DECRBY minimum int64",
+			setup:    func(s *structures.Store) {},
+			command:  bulks("DECRBY", "n", "-9223372036854775808"),
+			expected: resp.Error("ERR increment or decrement would overflow").Marshal(),
+		},
+		{
+			name:     "INCRBYFLOAT",
+			setup:    func(s *structures.Store) { s.Set("f", "10.50", time.Time{}) },
+			command:  bulks("INCRBYFLOAT", "f", "0.1"),
+			expected: resp.Bulk("10.6").Marshal(),
+		},
+		{
+			name:     "INCRBYFLOAT exponent",
+			setup:    func(s *structures.Store) { s.Set("f", "5.0e3", time.Time{}) },
+			command:  bulks("INCRBYFLOAT", "f", "2.0e2"),
+			expected: resp.Bulk("5200").Marshal(),
+		},
+		{
+			name:     "INCRBYFLOAT invalid increment",
+			setup:    func(s *structures.Store) {},
+			command:  bulks("INCRBYFLOAT", "f", "abc"),
+			expected: resp.Error(errNotFloat).Marshal(),
+		},
+	}
+
+	runCommandTests(t, tests)
+}
+
+func TestSetEx_Propagation(t *testing.T) {
+	router := newTestRouter()
+
+	for _, args := range [][]string{
+		{"SETEX", "k", "100", "v"},
+		{"PSETEX", "k", "100000", "v"},
+	} {
+		got := propagated(router, args...)
+		at, _ := router.Store.ExpiryTime("k")
+		want := [][]resp.RESP{bulks("SET", "k", "v", "PXAT", formatUnixMillis(at))}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Propagation of %v = %v, want %v", args, got, want)
+		}
+	}
+}
+
+func TestGetEx_Propagation(t *testing.T) {
+	router := newTestRouter()
+	router.Store.Set("k", "v", time.Time{})
+
+	if got := propagated(router, "GETEX", "k"); len(got) != 0 {
+		t.Errorf("Propagation of GETEX without options = %v, want none", got)
+	}
+	if got := propagated(router, "GETEX", "missing", "EX", "100"); len(got) != 0 {
+		t.Errorf("Propagation of GETEX on a missing key = %v, want none", got)
+	}
+
+	got := propagated(router, "GETEX", "k", "EX", "100")
+	at, _ := router.Store.ExpiryTime("k")
+	if want := [][]resp.RESP{bulks("PEXPIREAT", "k", formatUnixMillis(at))}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Propagation of GETEX EX = %v, want %v", got, want)
+	}
+	if got, want := propagated(router, "GETEX", "k", "PERSIST"), [][]resp.RESP{bulks("PERSIST", "k")}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Propagation of GETEX PERSIST = %v, want %v", got, want)
+	}
+	if got, want := propagated(router, "GETEX", "k", "PXAT", "1"), [][]resp.RESP{bulks("DEL", "k")}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Propagation of GETEX in the past = %v, want %v", got, want)
+	}
+}
@@ -31,7 +31,9 @@ func NewRDB(dir, dbFileName string) (*RDB, error) {
     }, nil
 }
 
-func ReadFromRDB(dir, dbFileName string) (structures.RedisDB, error) {
+// ReadFromRDB loads the keys of every database in the file, keyed by
+// database index.
+func ReadFromRDB(dir, dbFileName string) (map[int]structures.RedisDB, error) {
     rdb, err := NewRDB(dir, dbFileName)
     if err != nil {
         return nil, err
@@ -40,7 +42,7 @@ func ReadFromRDB(dir, dbFileName string) (structures.RedisDB, error) {
     return rdb.readKeys()
 }
 
-func (r *RDB) readKeys() (structures.RedisDB, error) {
+func (r *RDB) readKeys() (map[int]structures.RedisDB, error) {
     // Read the header
     header := make([]byte, 9)
     r.reader.Read(header)
@@ -65,14 +67,19 @@ func (r *RDB) readKeys() (structures.RedisDB, error) {
     return nil, fmt.Errorf("invalid RDB file: unexpected EOF")
 }
 
-func (r *RDB) startDBRead() (structures.RedisDB, error) {
+// startDBRead reads the database sections following the first 0xFE
+// opcode, each of which starts with its database index.
+func (r *RDB) startDBRead() (map[int]structures.RedisDB, error) {
+    databases := map[int]structures.RedisDB{}
+
     // read db index
-    _, err := r.readSizeEncoded()
+    index, err := r.readSizeEncoded()
     if err != nil {
         return nil, err
     }
 
     redisDB := structures.RedisDB{}
+    databases[index] = redisDB
     currentExpiry := time.Time{}
 
     for {
@@ -82,6 +89,14 @@ func (r *RDB) startDBRead() (structures.RedisDB, error) {
         }
 
         switch it {
+        case 0xFE: // start of the next database
+            index, err := r.readSizeEncoded()
+            if err != nil {
+                return nil, err
+            }
+
+            redisDB = structures.RedisDB{}
+            databases[index] = redisDB
         case 0xFB: // db info
             _, err := r.readSizeEncoded()
             if err != nil {
@@ -123,7 +138,7 @@ func (r *RDB) startDBRead() (structures.RedisDB, error) {
 
             currentExpiry = time.Unix(0, int64(timestamp)*int64(time.Second))
         case 0xFF: // end of file?
-            return redisDB, nil
+            return databases, nil
         }
     }
 }
@@ -2,6 +2,7 @@ package respConnection
 
 import (
 	"github.com/jgrecu/redis-clone/app/resp"
+	"strconv"
 	"sync"
 	"time"
 )
@@ -9,6 +10,8 @@ import (
 type ReplicaManager struct {
 	mu       sync.RWMutex
 	Replicas map[string]*RespConn
+	// db is the database the replication stream last selected.
+	db int
 }
 
 var replicaManager *ReplicaManager = &ReplicaManager{
@@ -23,6 +26,9 @@ func (r *ReplicaManager) AddReplica(conn *RespConn) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 	r.Replicas[conn.Id()] = conn
+	// The new replica starts on database 0, so make the stream select
+	// explicitly before the next command.
+	r.db = -1
 }
 
 func (r *ReplicaManager) RemoveReplica(id string) {
@@ -89,11 +95,22 @@ func (r *ReplicaManager) ClearAckChans(ackChan chan int) {
 	}
 }
 
-func (r *ReplicaManager) PropagateCommand(args []resp.RESP) {
-	r.mu.RLock()
-	defer r.mu.RUnlock()
+// PropagateCommand sends a write that ran against database db to every
+// replica, preceded by a SELECT when the stream is on another database.
+func (r *ReplicaManager) PropagateCommand(db int, args []resp.RESP) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if db != r.db {
+		r.db = db
+		r.propagate(resp.Command("SELECT", strconv.Itoa(db)))
+	}
+	r.propagate(resp.Array(args...))
+}
+
+// propagate writes command to every replica. Callers must hold the lock.
+func (r *ReplicaManager) propagate(command resp.RESP) {
 	for _, replica := range r.Replicas {
-		writtenSize, _ := replica.Write(resp.Array(args...).Marshal())
+		writtenSize, _ := replica.Write(command.Marshal())
 		replica.AddOffset(writtenSize)
 	}
 }
@@ -29,11 +29,14 @@ func (c *RespConn) Exec(params []resp.RESP) []byte {
 	if c.TxQueue != nil {
 		buf := []byte(fmt.Sprintf("*%d\r\n", len(c.TxQueue)))
 
-		for _, agrs := range c.TxQueue {
-			handler := c.router.GetHandler(strings.ToUpper(agrs[0].Bulk))
-			handlerResponse := handler(agrs[1:])
-			buf = append(buf, handlerResponse...)
-		}
+		// Blocking commands must not block the transaction.
+		c.router.WithoutBlocking(func() {
+			for _, agrs := range c.TxQueue {
+				handler := c.router.GetHandler(strings.ToUpper(agrs[0].Bulk))
+				handlerResponse := handler(agrs[1:])
+				buf = append(buf, handlerResponse...)
+			}
+		})
 
 		c.TxQueue = nil
 		return buf
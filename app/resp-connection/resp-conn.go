@@ -20,19 +20,23 @@ type RespConn struct {
 	mu       sync.Mutex
 	AckChans []chan int
 	TxQueue  [][]resp.RESP
+	// gone is closed once the client has disconnected.
+	gone chan struct{}
 }
 
 func NewRespConn(conn net.Conn, router *handlers.CommandRouter) *RespConn {
 	log.Println("New connection from: ", conn.RemoteAddr().String())
+	gone := make(chan struct{})
 	return &RespConn{
 		Conn:     conn,
 		Reader:   resp.NewRespReader(bufio.NewReader(conn)),
-		router:   router,
+		router:   router.ForConnection(gone),
 		offset:   0,
 		id:       conn.RemoteAddr().String(),
 		mu:       sync.Mutex{},
 		AckChans: make([]chan int, 0),
 		TxQueue:  nil,
+		gone:     gone,
 	}
 }
 
@@ -45,19 +49,33 @@ func (c *RespConn) Id() string {
 }
 
 func (c *RespConn) Listen() {
+	commands := make(chan []resp.RESP)
+	go c.readCommands(commands)
+	for args := range commands {
+		c.handleClient(args)
+	}
+
+	c.Close()
+}
+
+// readCommands reads the commands of the client into commands until the
+// connection fails or sends something else, then closes commands and
+// c.gone. Reading runs ahead of the command being handled, so that a
+// command blocked waiting for a key notices when its client disconnects.
+func (c *RespConn) readCommands(commands chan<- []resp.RESP) {
+	defer close(c.gone)
+	defer close(commands)
 	for {
 		value, err := c.Reader.Read()
 		if err != nil {
-			break
+			return
 		}
 
 		if value.Type != "array" || len(value.Array) < 1 {
-			break
+			return
 		}
-		c.handleClient(value.Array)
+		commands <- value.Array
 	}
-
-	c.Close()
 }
 
 func (c *RespConn) handleClient(args []resp.RESP) error {
@@ -94,16 +112,109 @@ func (c *RespConn) handleClient(args []resp.RESP) error {
 		return nil
 	}
 
-	// Propagate the command to all replicas
-	if isWriteCommand(command) {
-		GetReplicaManager().PropagateCommand(args)
+	// Propagate the command and its effects to all replicas
+	for _, replicated := range c.router.Replication(args, isWriteCommand(command)) {
+		GetReplicaManager().PropagateCommand(replicated.DB, replicated.Command)
 	}
 
 	return nil
 }
 
+// writeCommands lists the commands that modify the keyspace and must be
+// propagated to replicas.
+var writeCommands = map[string]bool{
+	"SET":              true,
+	"APPEND":           true,
+	"SETRANGE":         true,
+	"GETDEL":           true,
+	"GETEX":            true,
+	"GETSET":           true,
+	"SETNX":            true,
+	"SETEX":            true,
+	"PSETEX":           true,
+	"MSET":             true,
+	"MSETNX":           true,
+	"INCR":             true,
+	"INCRBY":           true,
+	"DECR":             true,
+	"DECRBY":           true,
+	"INCRBYFLOAT":      true,
+	"DEL":              true,
+	"UNLINK":           true,
+	"RENAME":           true,
+	"RENAMENX":         true,
+	"COPY":             true,
+	"MOVE":             true,
+	"SWAPDB":           true,
+	"FLUSHDB":          true,
+	"FLUSHALL":         true,
+	"EXPIRE":           true,
+	"PEXPIRE":          true,
+	"EXPIREAT":         true,
+	"PEXPIREAT":        true,
+	"PERSIST":          true,
+	"LPUSH":            true,
+	"RPUSH":            true,
+	"LPUSHX":           true,
+	"RPUSHX":           true,
+	"LPOP":             true,
+	"RPOP":             true,
+	"LSET":             true,
+	"LINSERT":          true,
+	"LREM":             true,
+	"LTRIM":            true,
+	"LMOVE":            true,
+	"LMPOP":            true,
+	"BLPOP":            true,
+	"BRPOP":            true,
+	"BLMOVE":           true,
+	"BLMPOP":           true,
+	"HSET":             true,
+	"HMSET":            true,
+	"HSETNX":           true,
+	"HDEL":             true,
+	"HINCRBY":          true,
+	"HINCRBYFLOAT":     true,
+	"HEXPIRE":          true,
+	"HPEXPIRE":         true,
+	"HEXPIREAT":        true,
+	"HPEXPIREAT":       true,
+	"HPERSIST":         true,
+	"SADD":             true,
+	"SREM":             true,
+	"SPOP":             true,
+	"SMOVE":            true,
+	"SINTERSTORE":      true,
+	"SUNIONSTORE":      true,
+	"SDIFFSTORE":       true,
+	"ZADD":             true,
+	"ZINCRBY":          true,
+	"ZREM":             true,
+	"ZRANGESTORE":      true,
+	"ZREMRANGEBYRANK":  true,
+	"ZREMRANGEBYSCORE": true,
+	"ZREMRANGEBYLEX":   true,
+	"ZPOPMIN":          true,
+	"ZPOPMAX":          true,
+	"BZPOPMIN":         true,
+	"BZPOPMAX":         true,
+	"ZMPOP":            true,
+	"BZMPOP":           true,
+	"ZUNIONSTORE":      true,
+	"ZINTERSTORE":      true,
+	"ZDIFFSTORE":       true,
+	"XADD":             true,
+	"XDEL":             true,
+	"XTRIM":            true,
+	"XGROUP":           true,
+	"XREADGROUP":       true,
+	"XACK":             true,
+	"XCLAIM":           true,
+	"XAUTOCLAIM":       true,
+}
+
 func isWriteCommand(command string) bool {
-	return command == "SET" || command == "DEL"
+	return writeCommands[command]
 }
 
 func (c *RespConn) AddOffset(offset int) {
@@ -146,8 +146,18 @@ func TestIsWriteCommand(t *testing.T) {
 	}{
 		{"SET command", "SET", true},
 		{"DEL command", "DEL", true},
+		{"LPUSH command", "LPUSH", true},
+		{"LRANGE command", "LRANGE", false},
+		{"SPOP command", "SPOP", true},
+		{"MSET command", "MSET", true},
+		{"MGET command", "MGET", false},
 		{"GET command", "GET", false},
 		{"PING command", "PING", false},
+		{"MOVE command", "MOVE", true},
+		{"FLUSHALL command", "FLUSHALL", true},
+		{"SELECT command", "SELECT", false},
+		{"XADD command", "XADD", true},
+		{"XRANGE command", "XRANGE", false},
 	}
 
 	for _, tt := range tests {
@@ -4,21 +4,36 @@ import (
 	"github.com/jgrecu/redis-clone/app/config"
 	"github.com/jgrecu/redis-clone/app/handlers"
 	"github.com/jgrecu/redis-clone/app/rdb"
+	"github.com/jgrecu/redis-clone/app/resp"
 	respConnection "github.com/jgrecu/redis-clone/app/resp-connection"
 	"github.com/jgrecu/redis-clone/app/structures"
 	"log"
 	"net"
 	"os"
+	"time"
 )
 
 func main() {
 	conf := config.Get()
 
-	store := structures.NewStore()
+	if conf.Databases < 1 {
+		log.Println("The number of databases must be at least 1")
+		os.Exit(1)
+	}
+
+	store := structures.NewStoreWithDatabases(conf.Databases)
 	router := handlers.NewRouter(store)
 
 	initializeMapStore(store)
 
+	// replicas ignore maxmemory and TTLs: they only drop keys the master
+	// evicts or expires
+	if conf.Role == "master" {
+		configureMaxMemory(store, conf)
+		store.OnEffect(propagateEffect)
+		go store.RunActiveExpiry(100*time.Millisecond, nil)
+	}
+
 	// handle the replica if it's a slave
 	if conf.Role == "slave" {
 		masterConn, err := net.Dial("tcp", conf.MasterHost+":"+conf.MasterPort)
@@ -57,11 +72,49 @@ func main() {
 	}
 }
 
+// configureMaxMemory applies the memory limit and eviction policy, and
+// propagates evicted keys to the replicas as deletions.
+func configureMaxMemory(store *structures.Store, conf *config.Config) {
+	limit, err := config.ParseMemory(conf.MaxMemory)
+	if err != nil {
+		log.Println("Invalid maxmemory: ", err.Error())
+		os.Exit(1)
+	}
+	policy, err := structures.ParseEvictionPolicy(conf.MaxMemoryPolicy)
+	if err != nil {
+		log.Println("Invalid maxmemory-policy: ", err.Error())
+		os.Exit(1)
+	}
+
+	store.SetMaxMemory(limit, policy)
+	store.OnEvict(propagateDeletion)
+}
+
+// propagateDeletion tells the replicas about a key the master evicted, as a
+// DEL.
+func propagateDeletion(db int, key string) {
+	respConnection.GetReplicaManager().PropagateCommand(db, resp.Command("DEL", key).Array)
+}
+
+// propagateEffect sends the replicas an effect of no client's command, such
+// as the deletion of a key by the active expiry cycle.
+func propagateEffect(effect structures.Effect) {
+	respConnection.GetReplicaManager().PropagateCommand(effect.DB, resp.Command(effect.Args[0], effect.Args[1:]...).Array)
+}
+
 func initializeMapStore(store *structures.Store) {
-	redisDB, err := rdb.ReadFromRDB(config.Get().Dir, config.Get().DbFileName)
+	databases, err := rdb.ReadFromRDB(config.Get().Dir, config.Get().DbFileName)
 	if err != nil {
 		log.Println("Error loading Database from file: ", err.Error())
-	} else {
-		store.LoadKeys(redisDB)
+		return
+	}
+
+	for index, keys := range databases {
+		db, err := store.Select(index)
+		if err != nil {
+			log.Println("Skipping database from file: ", err.Error())
+			continue
+		}
+		db.LoadKeys(keys)
 	}
 }
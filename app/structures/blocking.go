@@ -0,0 +1,157 @@
+package structures
+
+import "time"
+
+// BlockedClient is a client waiting for one of its keys to receive data.
+// Clients blocked on the same key are served in the order they blocked.
+type BlockedClient struct {
+	keys []string
+	// serve tries to satisfy the client from key. It runs with the store's
+	// write lock held and reports whether the client got its reply.
+	serve  func(key string) (bool, error)
+	done   chan struct{}
+	served bool
+	err    error
+}
+
+// Block registers interest in keys. serve is first tried against each key
+// in order and, if none can satisfy the client right away, the client is
+// queued behind any earlier waiters on those keys until a write signals one
+// of them, unless the view does not wait; see WithBlocking.
+func (s *Store) Block(keys []string, serve func(key string) (bool, error)) *BlockedClient {
+	s.lock()
+	defer s.unlock()
+
+	bc := &BlockedClient{
+		keys:  keys,
+		serve: serve,
+		done:  make(chan struct{}),
+	}
+
+	for _, key := range keys {
+		ok, err := serve(key)
+		if ok || err != nil {
+			bc.served = true
+			bc.err = err
+			close(bc.done)
+			return bc
+		}
+	}
+	if s.noWait {
+		return bc
+	}
+
+	for _, key := range keys {
+		s.blocked[key] = append(s.blocked[key], bc)
+	}
+	return bc
+}
+
+// Wait blocks until bc is served, timeout elapses or the client of the view
+// goes away; a zero timeout waits forever. It reports whether the client was
+// served, along with any error raised while serving it. A view that does not
+// wait only reports whether Block served the client right away.
+func (s *Store) Wait(bc *BlockedClient, timeout time.Duration) (bool, error) {
+	if s.noWait {
+		return bc.served, bc.err
+	}
+
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	select {
+	case <-bc.done:
+	case <-expired:
+	case <-s.gone:
+	}
+
+	s.lock()
+	defer s.unlock()
+
+	// A write may have served the client between the timer firing and the
+	// lock being taken, in which case its reply must not be lost.
+	if !bc.served {
+		s.unqueue(bc)
+		return false, nil
+	}
+	return true, bc.err
+}
+
+// signalKey marks key as having received data. The clients blocked on it
+// are served once the command that wrote it is done, when the write lock is
+// released. Callers must hold the write lock.
+func (s *Store) signalKey(key string) {
+	if len(s.blocked[key]) > 0 {
+		s.ready = append(s.ready, key)
+	}
+}
+
+// serveReady serves the clients blocked on the keys signaled under the write
+// lock, like Redis' handleClientsBlockedOnKeys. Serving a client may signal
+// more keys, as BLMOVE does for its destination; those are served in turn
+// rather than recursively, so a client moving elements back into the key it
+// waits on cannot loop. Callers must hold the write lock.
+func (s *Store) serveReady() {
+	for len(s.ready) > 0 {
+		key := s.ready[0]
+		s.ready = s.ready[1:]
+		s.serveKey(key)
+	}
+}
+
+// serveKey serves clients blocked on key in FIFO order. Every waiter gets a
+// chance, as a single write may satisfy several of them (e.g. a multi-value
+// push). Callers must hold the write lock.
+func (s *Store) serveKey(key string) {
+	for _, bc := range append([]*BlockedClient(nil), s.blocked[key]...) {
+		if bc.served {
+			continue
+		}
+
+		ok, err := bc.serve(key)
+		if err == ErrWrongType {
+			// The key now holds a type this client does not wait for; like
+			// Redis, keep it blocked rather than failing it.
+			continue
+		}
+		if !ok && err == nil {
+			continue
+		}
+
+		bc.served = true
+		bc.err = err
+		s.unqueue(bc)
+		close(bc.done)
+	}
+}
+
+// unqueue removes bc from the wait queue of every key it is blocked on.
+// Callers must hold the write lock.
+func (s *Store) unqueue(bc *BlockedClient) {
+	for _, key := range bc.keys {
+		waiters := s.blocked[key]
+		for i, w := range waiters {
+			if w == bc {
+				waiters = append(waiters[:i], waiters[i+1:]...)
+				break
+			}
+		}
+
+		if len(waiters) == 0 {
+			delete(s.blocked, key)
+		} else {
+			s.blocked[key] = waiters
+		}
+	}
+}
+
+// BlockedCount returns the number of clients waiting on key.
+func (s *Store) BlockedCount(key string) int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.blocked[key])
+}
@@ -0,0 +1,335 @@
+package structures
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// waitBlocked polls until n clients are blocked on key.
+func waitBlocked(t *testing.T, s *Store, key string, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for s.BlockedCount(key) != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("BlockedCount(%s) = %d, want %d", key, s.BlockedCount(key), n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestStore_BLMPop_Immediate(t *testing.T) {
+	s := NewStore()
+	s.RPush("b", false, "x")
+
+	key, values, ok, err := s.BLMPop([]string{"a", "b"}, true, 1, time.Second)
+	if err != nil || !ok || key != "b" || !reflect.DeepEqual(values, []string{"x"}) {
+		t.Errorf("BLMPop = (%q, %v, %v, %v), want (\"b\", [x], true, nil)", key, values, ok, err)
+	}
+	if s.BlockedCount("a") != 0 {
+		t.Error("an immediately served client should not stay queued")
+	}
+}
+
+func TestStore_BLMPop_EmptyKey(t *testing.T) {
+	s := NewStore()
+	s.RPush("", false, "x")
+
+	key, values, ok, err := s.BLMPop([]string{""}, true, 1, time.Second)
+	if err != nil || !ok || key != "" || !reflect.DeepEqual(values, []string{"x"}) {
+		t.Errorf("BLMPop = (%q, %v, %v, %v), want (\"\", [x], true, nil)", key, values, ok, err)
+	}
+}
+
+func TestStore_BLMPop_ClientGone(t *testing.T) {
+	s := NewStore()
+	gone := make(chan struct{})
+	client := s.ForClient(gone)
+
+	done := make(chan bool)
+	go func() {
+		_, _, ok, _ := client.BLMPop([]string{"a"}, true, 1, 0)
+		done <- ok
+	}()
+	waitBlocked(t, s, "a", 1)
+	close(gone)
+
+	select {
+	case ok := <-done:
+		if ok {
+			t.Error("BLMPop of a gone client was served")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("BLMPop kept waiting after its client went away")
+	}
+	if s.BlockedCount("a") != 0 {
+		t.Error("a gone client should be removed from the wait queue")
+	}
+	s.RPush("a", false, "x")
+	if n, _ := s.LLen("a"); n != 1 {
+		t.Errorf("LLen after the push = %d, want the value left for others", n)
+	}
+}
+
+func TestStore_BLMPop_Timeout(t *testing.T) {
+	s := NewStore()
+
+	start := time.Now()
+	_, values, ok, err := s.BLMPop([]string{"a"}, true, 1, 20*time.Millisecond)
+	if err != nil || ok || values != nil {
+		t.Errorf("BLMPop timeout = (%v, %v, %v), want (nil, false, nil)", values, ok, err)
+	}
+	if time.Since(start) < 20*time.Millisecond {
+		t.Error("BLMPop returned before the timeout elapsed")
+	}
+	if s.BlockedCount("a") != 0 {
+		t.Error("timed out client should be removed from the wait queue")
+	}
+}
+
+func TestStore_BLMPop_WrongType(t *testing.T) {
+	s := NewStore()
+	s.Set("str", "v", time.Time{})
+
+	_, _, _, err := s.BLMPop([]string{"str"}, true, 1, 0)
+	if err != ErrWrongType {
+		t.Errorf("BLMPop on string error = %v, want ErrWrongType", err)
+	}
+}
+
+func TestStore_BLMPop_WokenByPush(t *testing.T) {
+	s := NewStore()
+
+	type result struct {
+		key    string
+		values []string
+	}
+	done := make(chan result)
+	go func() {
+		key, values, _, _ := s.BLMPop([]string{"a", "b"}, true, 1, 0)
+		done <- result{key, values}
+	}()
+
+	waitBlocked(t, s, "b", 1)
+	s.RPush("b", false, "v")
+
+	select {
+	case r := <-done:
+		if r.key != "b" || !reflect.DeepEqual(r.values, []string{"v"}) {
+			t.Errorf("woken BLMPop = %+v, want {b [v]}", r)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("BLMPop was not woken by RPush")
+	}
+
+	if s.Type("b") != "none" {
+		t.Error("the pushed value should have been consumed by the waiter")
+	}
+}
+
+func TestStore_BLMPop_FIFOFairness(t *testing.T) {
+	s := NewStore()
+
+	got := make([]chan string, 3)
+	for i := range got {
+		got[i] = make(chan string, 1)
+		go func(ch chan string) {
+			_, values, _, _ := s.BLMPop([]string{"q"}, true, 1, 0)
+			ch <- values[0]
+		}(got[i])
+		waitBlocked(t, s, "q", i+1)
+	}
+
+	// Two values only satisfy the two oldest waiters, in blocking order.
+	s.RPush("q", false, "1", "2")
+	for i, want := range []string{"1", "2"} {
+		select {
+		case v := <-got[i]:
+			if v != want {
+				t.Errorf("client %d got %q, want %q", i, v, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("client %d was not served", i)
+		}
+	}
+	if s.BlockedCount("q") != 1 {
+		t.Errorf("BlockedCount = %d, want 1", s.BlockedCount("q"))
+	}
+
+	s.RPush("q", false, "3")
+	select {
+	case v := <-got[2]:
+		if v != "3" {
+			t.Errorf("client 2 got %q, want '3'", v)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("last waiter was not served")
+	}
+}
+
+func TestStore_BLMove_Chain(t *testing.T) {
+	s := NewStore()
+
+	// One client moves a -> b while another waits on b.
+	moved := make(chan string)
+	go func() {
+		v, _, _ := s.BLMove("a", "b", true, false, 0)
+		moved <- v
+	}()
+	waitBlocked(t, s, "a", 1)
+
+	popped := make(chan []string)
+	go func() {
+		_, values, _, _ := s.BLMPop([]string{"b"}, true, 1, 0)
+		popped <- values
+	}()
+	waitBlocked(t, s, "b", 1)
+
+	s.RPush("a", false, "job")
+
+	if v := <-moved; v != "job" {
+		t.Errorf("BLMove = %q, want 'job'", v)
+	}
+	if values := <-popped; !reflect.DeepEqual(values, []string{"job"}) {
+		t.Errorf("BLMPop on destination = %v, want [job]", values)
+	}
+}
+
+func TestStore_BLMove_SameKey(t *testing.T) {
+	s := NewStore()
+
+	moved := make(chan string)
+	go func() {
+		v, _, _ := s.BLMove("l", "l", true, false, 0)
+		moved <- v
+	}()
+	waitBlocked(t, s, "l", 1)
+
+	// Rotating the element back into l must not serve the client again.
+	s.RPush("l", false, "x")
+
+	select {
+	case v := <-moved:
+		if v != "x" {
+			t.Errorf("BLMove = %q, want 'x'", v)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("BLMove was not woken by RPush")
+	}
+	if got, _ := s.LRange("l", 0, -1); !reflect.DeepEqual(got, []string{"x"}) {
+		t.Errorf("l = %v, want [x]", got)
+	}
+}
+
+func TestStore_BLMove_Cycle(t *testing.T) {
+	s := NewStore()
+
+	// Two clients moving a -> b and b -> a: the element goes round once.
+	moved := make(chan string, 2)
+	go func() {
+		v, _, _ := s.BLMove("a", "b", true, false, 0)
+		moved <- v
+	}()
+	waitBlocked(t, s, "a", 1)
+	go func() {
+		v, _, _ := s.BLMove("b", "a", true, false, 0)
+		moved <- v
+	}()
+	waitBlocked(t, s, "b", 1)
+
+	s.RPush("a", false, "x")
+
+	for i := 0; i < 2; i++ {
+		select {
+		case v := <-moved:
+			if v != "x" {
+				t.Errorf("BLMove = %q, want 'x'", v)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("BLMove was not woken")
+		}
+	}
+	if got, _ := s.LRange("a", 0, -1); !reflect.DeepEqual(got, []string{"x"}) {
+		t.Errorf("a = %v, want [x]", got)
+	}
+	if n, _ := s.LLen("b"); n != 0 {
+		t.Errorf("LLen(b) = %d, want 0", n)
+	}
+}
+
+func TestStore_LMove(t *testing.T) {
+	s := NewStore()
+	s.RPush("src", false, "a", "b")
+
+	v, ok, err := s.LMove("src", "dst", false, true)
+	if err != nil || !ok || v != "b" {
+		t.Fatalf("LMove = (%q, %v, %v), want (\"b\", true, nil)", v, ok, err)
+	}
+
+	s.Set("str", "x", time.Time{})
+	if _, _, err := s.LMove("src", "str", true, true); err != ErrWrongType {
+		t.Errorf("LMove to string error = %v, want ErrWrongType", err)
+	}
+	if n, _ := s.LLen("src"); n != 1 {
+		t.Error("LMove with a wrong-type destination must not pop the source")
+	}
+}
+
+func TestStore_XReadBlock_WokenByXAdd(t *testing.T) {
+	s := NewStore()
+	s.XAdd("s", "1-1", map[string]string{"a": "1"})
+
+	done := make(chan map[string][]Entry)
+	go func() {
+		result, _ := s.XReadBlock([]string{"s"}, []string{"1-1"}, 0, 0)
+		done <- result
+	}()
+	waitBlocked(t, s, "s", 1)
+
+	s.XAdd("s", "2-1", map[string]string{"b": "2"})
+
+	select {
+	case result := <-done:
+		if len(result["s"]) != 1 || result["s"][0].Key() != "2-1" {
+			t.Errorf("XReadBlock = %v, want entry 2-1", result)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("XReadBlock was not woken by XAdd")
+	}
+}
+
+func TestStore_XReadBlock_Timeout(t *testing.T) {
+	s := NewStore()
+
+	if result, _ := s.XReadBlock([]string{"s"}, []string{"0-0"}, 0, 10*time.Millisecond); result != nil {
+		t.Errorf("XReadBlock timeout = %v, want nil", result)
+	}
+}
+
+func TestStore_WithBlocking(t *testing.T) {
+	s := NewStore().WithBlocking(false)
+	s.RPush("a", false, "x")
+
+	// A client that can be served right away still is.
+	if key, values, ok, _ := s.BLMPop([]string{"a"}, true, 1, 0); !ok || key != "a" || !reflect.DeepEqual(values, []string{"x"}) {
+		t.Errorf("BLMPop = (%s, %v, %v), want a's x", key, values, ok)
+	}
+	// Otherwise it gives up at once instead of waiting forever.
+	if _, _, ok, err := s.BLMPop([]string{"a"}, true, 1, 0); ok || err != nil {
+		t.Errorf("BLMPop on an empty list = (%v, %v), want a timeout", ok, err)
+	}
+	if s.BlockedCount("a") != 0 {
+		t.Error("a client that did not wait was left queued")
+	}
+
+	// Views selected from it do not wait either, until blocking is back on.
+	db1, _ := s.Select(1)
+	if _, _, ok, _ := db1.BLMPop([]string{"a"}, true, 1, 0); ok {
+		t.Error("BLMPop on a selected view was served from nothing")
+	}
+	start := time.Now()
+	db1.WithBlocking(true).BLMPop([]string{"a"}, true, 1, 20*time.Millisecond)
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+		t.Errorf("BLMPop with blocking back on returned after %v, want its timeout", elapsed)
+	}
+}
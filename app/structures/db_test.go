@@ -0,0 +1,175 @@
+package structures
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func mustSelect(t *testing.T, s *Store, index int) *Store {
+	t.Helper()
+	db, err := s.Select(index)
+	if err != nil {
+		t.Fatalf("Select(%d) error = %v", index, err)
+	}
+	return db
+}
+
+func TestStore_Select_IsolatesDatabases(t *testing.T) {
+	s := NewStore()
+	db1 := mustSelect(t, s, 1)
+
+	s.Set("k", "zero", time.Time{})
+	db1.Set("k", "one", time.Time{})
+	db1.Set("only-one", "v", time.Time{})
+
+	if v, _, _ := s.Get("k"); v != "zero" {
+		t.Errorf("db0 k = %q, want zero", v)
+	}
+	if v, _, _ := db1.Get("k"); v != "one" {
+		t.Errorf("db1 k = %q, want one", v)
+	}
+	if s.DBSize() != 1 || db1.DBSize() != 2 {
+		t.Errorf("DBSize = (%d, %d), want (1, 2)", s.DBSize(), db1.DBSize())
+	}
+	if s.DB() != 0 || db1.DB() != 1 {
+		t.Errorf("DB() = (%d, %d), want (0, 1)", s.DB(), db1.DB())
+	}
+
+	if _, err := s.Select(DefaultDatabases); err != ErrDBIndexOutOfRange {
+		t.Errorf("Select(%d) error = %v, want ErrDBIndexOutOfRange", DefaultDatabases, err)
+	}
+	if _, err := s.Select(-1); err != ErrDBIndexOutOfRange {
+		t.Errorf("Select(-1) error = %v, want ErrDBIndexOutOfRange", err)
+	}
+	if n := NewStoreWithDatabases(2).Databases(); n != 2 {
+		t.Errorf("Databases() = %d, want 2", n)
+	}
+}
+
+func TestStore_SwapDB(t *testing.T) {
+	s := NewStore()
+	db1 := mustSelect(t, s, 1)
+	s.Set("a", "zero", time.Now().Add(time.Hour))
+	db1.Set("b", "one", time.Time{})
+
+	if err := s.SwapDB(0, 1); err != nil {
+		t.Fatalf("SwapDB() error = %v", err)
+	}
+	if v, ok, _ := s.Get("b"); !ok || v != "one" {
+		t.Errorf("db0 b after swap = (%q, %v), want one", v, ok)
+	}
+	if v, ok, _ := db1.Get("a"); !ok || v != "zero" {
+		t.Errorf("db1 a after swap = (%q, %v), want zero", v, ok)
+	}
+	if _, ok := db1.expires["a"]; !ok {
+		t.Error("the expiry index should move with the data")
+	}
+	if err := s.SwapDB(0, DefaultDatabases); err != ErrDBIndexOutOfRange {
+		t.Errorf("SwapDB out of range error = %v, want ErrDBIndexOutOfRange", err)
+	}
+	if err := s.SwapDB(1, 1); err != nil {
+		t.Errorf("SwapDB(1, 1) error = %v, want nil", err)
+	}
+}
+
+func TestStore_SwapDB_ServesBlockedClients(t *testing.T) {
+	s := NewStore()
+	db1 := mustSelect(t, s, 1)
+	db1.RPush("list", false, "x")
+
+	done := make(chan []string)
+	go func() {
+		_, values, _, _ := s.BLMPop([]string{"list"}, true, 1, time.Second)
+		done <- values
+	}()
+	waitBlocked(t, s, "list", 1)
+
+	s.SwapDB(0, 1)
+	if values := <-done; !reflect.DeepEqual(values, []string{"x"}) {
+		t.Errorf("BLMPop after SWAPDB = %v, want [x]", values)
+	}
+}
+
+func TestStore_Move(t *testing.T) {
+	s := NewStore()
+	db1 := mustSelect(t, s, 1)
+	s.Set("k", "v", time.Now().Add(time.Hour))
+	s.Set("taken", "zero", time.Time{})
+	db1.Set("taken", "one", time.Time{})
+
+	if ok, err := s.Move("k", 1); !ok || err != nil {
+		t.Fatalf("Move() = (%v, %v), want (true, nil)", ok, err)
+	}
+	if s.Exists("k") != 0 || db1.Exists("k") != 1 {
+		t.Error("Move should take the key out of the source database")
+	}
+	if at, _ := db1.ExpiryTime("k"); at.IsZero() {
+		t.Error("Move should keep the expiry")
+	}
+	if ok, _ := s.Move("taken", 1); ok {
+		t.Error("Move should not overwrite an existing key")
+	}
+	if ok, _ := s.Move("missing", 1); ok {
+		t.Error("Move of a missing key should report false")
+	}
+	if _, err := s.Move("taken", 0); err != ErrSameObject {
+		t.Errorf("Move to the same database error = %v, want ErrSameObject", err)
+	}
+	if _, err := s.Move("taken", 99); err != ErrDBIndexOutOfRange {
+		t.Errorf("Move out of range error = %v, want ErrDBIndexOutOfRange", err)
+	}
+}
+
+func TestStore_Copy_AcrossDatabases(t *testing.T) {
+	s := NewStore()
+	db2 := mustSelect(t, s, 2)
+	s.RPush("src", false, "a")
+
+	if ok, err := s.Copy("src", "src", 2, false); !ok || err != nil {
+		t.Fatalf("Copy to db2 = (%v, %v), want (true, nil)", ok, err)
+	}
+	if got, _ := db2.LRange("src", 0, -1); !reflect.DeepEqual(got, []string{"a"}) {
+		t.Errorf("db2 src = %v, want [a]", got)
+	}
+	if _, err := s.Copy("src", "dst", 16, false); err != ErrDBIndexOutOfRange {
+		t.Errorf("Copy out of range error = %v, want ErrDBIndexOutOfRange", err)
+	}
+}
+
+func TestStore_Flush(t *testing.T) {
+	s := NewStore()
+	db1 := mustSelect(t, s, 1)
+	s.Set("a", "v", time.Now().Add(time.Hour))
+	db1.Set("b", "v", time.Time{})
+
+	s.FlushDB()
+	if s.DBSize() != 0 || len(s.expires) != 0 {
+		t.Error("FlushDB should empty the selected database and its indexes")
+	}
+	if db1.DBSize() != 1 {
+		t.Error("FlushDB should leave other databases alone")
+	}
+	if next, keys := s.Scan(0, 10, "", ""); next != 0 || len(keys) != 0 {
+		t.Errorf("Scan after FlushDB = (%d, %v), want (0, [])", next, keys)
+	}
+
+	s.Set("a", "v", time.Time{})
+	s.FlushAll()
+	if s.DBSize() != 0 || db1.DBSize() != 0 {
+		t.Error("FlushAll should empty every database")
+	}
+}
+
+func TestStore_ActiveExpireCycle_CoversEveryDatabase(t *testing.T) {
+	s := NewStore()
+	db3 := mustSelect(t, s, 3)
+	db3.Set("gone", "v", time.Now().Add(-time.Second))
+
+	if n := s.ActiveExpireCycle(time.Second); n != 1 {
+		t.Errorf("ActiveExpireCycle expired %d keys, want 1", n)
+	}
+	if db3.DBSize() != 0 {
+		t.Error("the cycle should reclaim expired keys in every database")
+	}
+}
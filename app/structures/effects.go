@@ -0,0 +1,78 @@
+package structures
+
+// Effect is a command that replicas must apply for something the store did
+// on its own rather than as asked, such as deleting a key whose TTL passed.
+type Effect struct {
+	// DB is the index of the database the command applies to.
+	DB   int
+	Args []string
+}
+
+// effectLog keeps the effects of the operations run through a view until
+// its client takes them; see TakeEffects.
+type effectLog struct {
+	before, after []Effect
+}
+
+// WithEffects returns a view of the store, on the same database, that keeps
+// the effects of the operations run through it for TakeEffects instead of
+// handing them to the OnEffect hook. A view is meant for a single client.
+func (s *Store) WithEffects() *Store {
+	view := s.view(s.database)
+	view.effects = &effectLog{}
+	return view
+}
+
+// TakeEffects returns and forgets the effects of the operations run through
+// a view made by WithEffects: before holds those that happened ahead of the
+// operations' own writes, such as deleting the expired keys they met, and
+// after those their writes caused once done.
+func (s *Store) TakeEffects() (before, after []Effect) {
+	if s.effects == nil {
+		return nil, nil
+	}
+	before, after = s.effects.before, s.effects.after
+	s.effects.before, s.effects.after = nil, nil
+	return before, after
+}
+
+// OnEffect registers fn to be called with the effects of the operations run
+// through views without an effect log, such as the deletions of the active
+// expiry cycle. It runs once the write lock is released.
+func (s *Store) OnEffect(fn func(Effect)) {
+	s.stats.mu.Lock()
+	defer s.stats.mu.Unlock()
+
+	s.stats.onEffect = fn
+}
+
+// record notes that replicas must apply args to the selected database.
+// Callers must hold the write lock.
+func (s *Store) record(args ...string) {
+	s.pending = append(s.pending, Effect{DB: s.id, Args: args})
+}
+
+// publish hands the effects recorded under the write lock, now released,
+// to the effect log of the view or else to the OnEffect hook. caused is the
+// index from which they were caused by the writes rather than met on the
+// way.
+func (s *Store) publish(effects []Effect, caused int) {
+	if len(effects) == 0 {
+		return
+	}
+	if s.effects != nil {
+		s.effects.before = append(s.effects.before, effects[:caused]...)
+		s.effects.after = append(s.effects.after, effects[caused:]...)
+		return
+	}
+
+	s.stats.mu.Lock()
+	onEffect := s.stats.onEffect
+	s.stats.mu.Unlock()
+
+	if onEffect != nil {
+		for _, effect := range effects {
+			onEffect(effect)
+		}
+	}
+}
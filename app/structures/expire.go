@@ -0,0 +1,248 @@
+package structures
+
+import "time"
+
+// expireConditionMet applies the NX/XX/GT/LT options of the EXPIRE family
+// to a current expiry (zero meaning none) and a proposed one. A missing
+// expiry counts as infinite when comparing with GT and LT.
+func expireConditionMet(cond string, current, next time.Time) bool {
+	switch cond {
+	case "NX":
+		return current.IsZero()
+	case "XX":
+		return !current.IsZero()
+	case "GT":
+		return !current.IsZero() && next.After(current)
+	case "LT":
+		return current.IsZero() || next.Before(current)
+	}
+	return true
+}
+
+// Expire sets the expiry of key to at if every condition in conds ("NX",
+// "XX", "GT" or "LT") holds. A deadline in the past deletes the key. It
+// reports whether the key exists and the conditions held.
+func (s *Store) Expire(key string, at time.Time, conds ...string) bool {
+	s.lock()
+	defer s.unlock()
+
+	val, ok := s.lookup(key)
+	if !ok {
+		return false
+	}
+	for _, cond := range conds {
+		if !expireConditionMet(cond, val.Expiry, at) {
+			return false
+		}
+	}
+
+	if !at.After(time.Now()) {
+		s.deleteKey(key)
+		return true
+	}
+	val.Expiry = at
+	s.setKey(key, val)
+	return true
+}
+
+// ExpiryTime returns the expiry of key, which is zero if it has none, and
+// whether the key exists.
+func (s *Store) ExpiryTime(key string) (time.Time, bool) {
+	s.lock()
+	defer s.unlock()
+
+	val, ok := s.lookup(key)
+	return val.Expiry, ok
+}
+
+// Persist removes the expiry of key and reports whether it had one.
+func (s *Store) Persist(key string) bool {
+	s.lock()
+	defer s.unlock()
+
+	val, ok := s.lookup(key)
+	if !ok || val.Expiry.IsZero() {
+		return false
+	}
+	val.Expiry = time.Time{}
+	s.setKey(key, val)
+	return true
+}
+
+// ExpiryStats reports the work done expiring keys, mirroring the expiry
+// fields of the stats section of INFO.
+type ExpiryStats struct {
+	// ExpiredKeys counts keys deleted because their TTL passed, whether
+	// found on access or by the active cycle.
+	ExpiredKeys int64
+	// ExpiredStalePerc estimates the percentage of keys with a TTL that
+	// have expired but not been reclaimed yet.
+	ExpiredStalePerc float64
+	// TimeCapReachedCount counts active cycles cut short by their budget.
+	TimeCapReachedCount int64
+	// CycleTime is the total time spent in active cycles.
+	CycleTime time.Duration
+}
+
+// ExpiryStats returns a snapshot of the expiry metrics.
+func (s *Store) ExpiryStats() ExpiryStats {
+	s.stats.mu.Lock()
+	defer s.stats.mu.Unlock()
+
+	return s.stats.expiry
+}
+
+// deleteExpired removes key because its TTL passed, recording a DEL for
+// replicas, which do not expire keys on their own. Callers must hold the
+// write lock.
+func (s *Store) deleteExpired(key string) {
+	s.deleteKey(key)
+	s.record("DEL", key)
+
+	s.stats.mu.Lock()
+	s.stats.expiry.ExpiredKeys++
+	s.stats.mu.Unlock()
+}
+
+// RunActiveExpiry periodically reclaims expired data that is never read,
+// complementing the lazy checks done on access. Each run may spend up to
+// activeExpireCycleCPUPercent of interval expiring keys. It returns when
+// stop is closed; a nil stop runs forever.
+func (s *Store) RunActiveExpiry(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	budget := interval * activeExpireCycleCPUPercent / 100
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			s.ActiveExpireCycle(budget)
+			s.ReclaimExpiredFields(activeExpiryKeysPerCycle)
+		}
+	}
+}
+
+// Tuning of the active expiry cycle, after Redis' activeExpireCycle.
+const (
+	// activeExpireKeysPerLoop is how many keys with a TTL each sampling
+	// round inspects.
+	activeExpireKeysPerLoop = 20
+	// activeExpireAcceptableStale is the percentage of expired keys in a
+	// sample below which the cycle stops early.
+	activeExpireAcceptableStale = 10
+	// activeExpireCycleCPUPercent is the share of the interval between runs
+	// that a cycle may use.
+	activeExpireCycleCPUPercent = 25
+)
+
+// ActiveExpireCycle deletes expired keys by sampling keys that carry a TTL
+// in each database in turn. Like Redis, it keeps sampling a database while
+// more than activeExpireAcceptableStale percent of a sample turned out to
+// be expired, on the basis that many more are likely waiting, and stops
+// once budget is spent. The lock is released between samples so clients
+// are not starved. It returns the number of keys expired.
+func (s *Store) ActiveExpireCycle(budget time.Duration) int {
+	start := time.Now()
+	totalExpired, totalSampled := 0, 0
+	timeCapReached := false
+
+	for _, db := range s.dbs {
+		view := s.view(db)
+		for {
+			expired, sampled := view.expireSample(activeExpireKeysPerLoop)
+			totalExpired += expired
+			totalSampled += sampled
+
+			if sampled == 0 || expired*100/sampled <= activeExpireAcceptableStale {
+				break
+			}
+			if time.Since(start) > budget {
+				timeCapReached = true
+				break
+			}
+		}
+		if timeCapReached {
+			break
+		}
+	}
+
+	s.stats.mu.Lock()
+	defer s.stats.mu.Unlock()
+
+	currentPerc := 0.0
+	if totalSampled > 0 {
+		currentPerc = float64(totalExpired) * 100 / float64(totalSampled)
+	}
+	stats := &s.stats.expiry
+	stats.ExpiredStalePerc = currentPerc*0.05 + stats.ExpiredStalePerc*0.95
+	if timeCapReached {
+		stats.TimeCapReachedCount++
+	}
+	stats.CycleTime += time.Since(start)
+	return totalExpired
+}
+
+// expireSample inspects up to n keys of the expiry index, starting from a
+// random point, and deletes those that have expired. It returns how many
+// keys expired and how many were sampled.
+func (s *Store) expireSample(n int) (expired, sampled int) {
+	s.lock()
+	defer s.unlock()
+
+	for key := range s.expires {
+		if sampled >= n {
+			break
+		}
+		sampled++
+
+		if s.data[key].IsExpired() {
+			s.deleteExpired(key)
+			expired++
+		}
+	}
+	return expired, sampled
+}
+
+// activeExpiryKeysPerCycle bounds how many keys a single cycle inspects so
+// that the store lock is never held for long.
+const activeExpiryKeysPerCycle = 20
+
+// ReclaimExpiredFields inspects up to maxKeys hashes with volatile fields in
+// each database, starting from a random point of the index, and deletes the
+// fields whose expiry has passed. Hashes left empty are removed. It returns
+// the number of fields reclaimed.
+func (s *Store) ReclaimExpiredFields(maxKeys int) int {
+	reclaimed := 0
+	for _, db := range s.dbs {
+		reclaimed += s.view(db).reclaimExpiredFields(maxKeys)
+	}
+	return reclaimed
+}
+
+// reclaimExpiredFields does the work of ReclaimExpiredFields for the
+// selected database.
+func (s *Store) reclaimExpiredFields(maxKeys int) int {
+	s.lock()
+	defer s.unlock()
+
+	reclaimed, visited := 0, 0
+	for key := range s.volatileHashes {
+		if visited >= maxKeys {
+			break
+		}
+		visited++
+
+		val := s.data[key]
+		if val.Typ == "hash" {
+			reclaimed += val.Hash.purgeExpired()
+			s.recount(key)
+			s.dropIfEmptyHash(key, val.Hash)
+		}
+		if val.Typ != "hash" || !val.Hash.HasVolatileFields() {
+			delete(s.volatileHashes, key)
+		}
+	}
+	return reclaimed
+}
@@ -0,0 +1,167 @@
+package structures
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestStore_ActiveExpireCycle_ReclaimsUnreadKeys(t *testing.T) {
+	s := NewStore()
+	past := time.Now().Add(-time.Second)
+	for i := range 100 {
+		s.Set(fmt.Sprintf("gone:%d", i), "v", past)
+	}
+	s.Set("live", "v", time.Now().Add(time.Hour))
+	s.Set("plain", "v", time.Time{})
+
+	expired := s.ActiveExpireCycle(time.Second)
+	if expired != 100 {
+		t.Errorf("ActiveExpireCycle expired %d keys, want 100", expired)
+	}
+	if s.DBSize() != 2 {
+		t.Errorf("DBSize after cycle = %d, want 2", s.DBSize())
+	}
+	if stats := s.ExpiryStats(); stats.ExpiredKeys != 100 {
+		t.Errorf("ExpiredKeys = %d, want 100", stats.ExpiredKeys)
+	}
+}
+
+func TestStore_ActiveExpireCycle_StopsWhenFewExpired(t *testing.T) {
+	s := NewStore()
+	future := time.Now().Add(time.Hour)
+	for i := range 1000 {
+		s.Set(fmt.Sprintf("live:%d", i), "v", future)
+	}
+	s.Set("gone", "v", time.Now().Add(-time.Second))
+
+	// A single sample finds at most one expired key, under the acceptable
+	// stale threshold, so the cycle should not walk the whole keyspace.
+	s.ActiveExpireCycle(time.Second)
+	if s.DBSize() < 1000 {
+		t.Errorf("DBSize = %d, live keys must never be expired", s.DBSize())
+	}
+	if stats := s.ExpiryStats(); stats.TimeCapReachedCount != 0 {
+		t.Errorf("TimeCapReachedCount = %d, want 0", stats.TimeCapReachedCount)
+	}
+}
+
+func TestStore_ActiveExpireCycle_TimeBudget(t *testing.T) {
+	s := NewStore()
+	past := time.Now().Add(-time.Second)
+	for i := range 1000 {
+		s.Set(fmt.Sprintf("gone:%d", i), "v", past)
+	}
+
+	s.ActiveExpireCycle(0)
+	stats := s.ExpiryStats()
+	if stats.TimeCapReachedCount != 1 {
+		t.Errorf("TimeCapReachedCount = %d, want 1", stats.TimeCapReachedCount)
+	}
+	if s.DBSize() == 0 {
+		t.Error("a zero budget should stop the cycle before every key is reclaimed")
+	}
+	if stats.ExpiredStalePerc <= 0 {
+		t.Errorf("ExpiredStalePerc = %v, want > 0 after sampling only expired keys", stats.ExpiredStalePerc)
+	}
+}
+
+func TestStore_ExpiryIndex_DropsPersistedAndDeletedKeys(t *testing.T) {
+	s := NewStore()
+	s.Set("persisted", "v", time.Now().Add(time.Hour))
+	s.Persist("persisted")
+	s.Set("deleted", "v", time.Now().Add(time.Hour))
+	s.Del("deleted")
+
+	s.ActiveExpireCycle(time.Second)
+	if len(s.expires) != 0 {
+		t.Errorf("expiry index holds %d entries, want 0", len(s.expires))
+	}
+	if s.Type("persisted") != "string" {
+		t.Error("a persisted key must survive the cycle")
+	}
+}
+
+func TestStore_ExpiryIndex_TracksEveryWay(t *testing.T) {
+	s := NewStore()
+	at := time.Now().Add(time.Hour)
+
+	s.Set("set", "v", at)
+	s.SetWithOptions("setopts", "v", SetOptions{Expiry: at})
+	s.Set("getex", "v", time.Time{})
+	s.GetEx("getex", true, at)
+	s.RPush("expire", false, "a")
+	s.Expire("expire", at)
+	s.Set("renamed-src", "v", at)
+	s.Rename("renamed-src", "renamed", false)
+	s.Copy("set", "copied", 0, false)
+
+	for _, key := range []string{"set", "setopts", "getex", "expire", "renamed", "copied"} {
+		if _, ok := s.expires[key]; !ok {
+			t.Errorf("key %q with a TTL is missing from the expiry index", key)
+		}
+	}
+}
+
+func TestStore_LazyExpiry_CountsAndRespectsEveryAccessor(t *testing.T) {
+	s := NewStore()
+	past := time.Now().Add(-time.Second)
+	s.Set("a", "v", past)
+	s.Set("b", "v", past)
+	s.Set("live", "v", time.Time{})
+
+	if keys := s.Keys(); len(keys) != 1 || keys[0] != "live" {
+		t.Errorf("Keys = %q, want [live]", keys)
+	}
+	if s.Type("a") != "none" {
+		t.Error("Type should not report an expired key")
+	}
+	if stats := s.ExpiryStats(); stats.ExpiredKeys != 2 {
+		t.Errorf("ExpiredKeys = %d, want 2", stats.ExpiredKeys)
+	}
+}
+
+func TestStore_LoadKeys_IndexesExpiry(t *testing.T) {
+	s := NewStore()
+	s.LoadKeys(RedisDB{
+		"gone":  {Typ: "string", String: "v", Expiry: time.Now().Add(-time.Second)},
+		"plain": {Typ: "string", String: "v"},
+	})
+
+	if expired := s.ActiveExpireCycle(time.Second); expired != 1 {
+		t.Errorf("ActiveExpireCycle after LoadKeys expired %d keys, want 1", expired)
+	}
+}
+
+func TestStore_ExpiryEffects(t *testing.T) {
+	s := NewStore()
+	db5 := mustSelect(t, s, 5)
+	past := time.Now().Add(-time.Second)
+	s.Set("lazy", "v", past)
+	db5.Set("active", "v", past)
+	s.Set("live", "v", time.Now().Add(time.Hour))
+
+	var published []Effect
+	s.OnEffect(func(e Effect) {
+		db5.DBSize() // the lock is released
+		published = append(published, e)
+	})
+
+	// A client's view keeps the deletions its commands cause.
+	client := s.WithEffects()
+	client.Get("lazy")
+	before, after := client.TakeEffects()
+	if want := []Effect{{DB: 0, Args: []string{"DEL", "lazy"}}}; !reflect.DeepEqual(before, want) || after != nil {
+		t.Errorf("TakeEffects = %v, %v, want %v, none", before, after, want)
+	}
+	if before, after := client.TakeEffects(); before != nil || after != nil {
+		t.Errorf("TakeEffects again = %v, %v, want none", before, after)
+	}
+
+	// Other views hand them to the hook once the lock is released.
+	s.ActiveExpireCycle(time.Second)
+	if want := []Effect{{DB: 5, Args: []string{"DEL", "active"}}}; !reflect.DeepEqual(published, want) {
+		t.Errorf("published effects = %v, want %v", published, want)
+	}
+}
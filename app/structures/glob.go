@@ -0,0 +1,110 @@
+package structures
+
+// MatchGlob reports whether str matches the glob-style pattern used by KEYS,
+// SCAN MATCH and friends: * matches any run of bytes, ? any single byte,
+// [abc], [a-z] and [^x] match byte classes, and \ escapes the next byte.
+// It follows Redis' stringmatchlen byte for byte.
+func MatchGlob(pattern, str string) bool {
+	// Redis short-circuits a lone * so that it matches even the empty key.
+	if pattern == "*" {
+		return true
+	}
+	skipLonger := false
+	return matchGlob(pattern, str, &skipLonger, 0)
+}
+
+// matchGlob does the work of MatchGlob. skipLonger is set once a * has
+// failed to match the rest of the pattern anywhere in the string, at which
+// point no earlier * can succeed by matching more, so the search stops.
+func matchGlob(pattern, str string, skipLonger *bool, nesting int) bool {
+	// Protection against abusive patterns.
+	if nesting > 1000 {
+		return false
+	}
+
+	for len(pattern) > 0 && len(str) > 0 {
+		switch pattern[0] {
+		case '*':
+			for len(pattern) > 1 && pattern[1] == '*' {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 1 {
+				return true
+			}
+			for len(str) > 0 {
+				if matchGlob(pattern[1:], str, skipLonger, nesting+1) {
+					return true
+				}
+				if *skipLonger {
+					return false
+				}
+				str = str[1:]
+			}
+			*skipLonger = true
+			return false
+		case '?':
+			str = str[1:]
+		case '[':
+			pattern = pattern[1:]
+			not := len(pattern) > 0 && pattern[0] == '^'
+			if not {
+				pattern = pattern[1:]
+			}
+
+			match := false
+			for len(pattern) > 0 && pattern[0] != ']' {
+				switch {
+				case pattern[0] == '\\' && len(pattern) >= 2:
+					pattern = pattern[1:]
+					if pattern[0] == str[0] {
+						match = true
+					}
+				case len(pattern) >= 3 && pattern[1] == '-':
+					start, end := pattern[0], pattern[2]
+					if start > end {
+						start, end = end, start
+					}
+					if str[0] >= start && str[0] <= end {
+						match = true
+					}
+					pattern = pattern[2:]
+				case pattern[0] == str[0]:
+					match = true
+				}
+				pattern = pattern[1:]
+			}
+
+			if not {
+				match = !match
+			}
+			if !match {
+				return false
+			}
+			str = str[1:]
+		case '\\':
+			if len(pattern) >= 2 {
+				pattern = pattern[1:]
+			}
+			fallthrough
+		default:
+			if pattern[0] != str[0] {
+				return false
+			}
+			str = str[1:]
+		}
+
+		// Step past the byte just matched, or the ] closing a class. An
+		// unterminated class has already consumed the whole pattern.
+		if len(pattern) > 0 {
+			pattern = pattern[1:]
+		}
+		if len(str) == 0 {
+			for len(pattern) > 0 && pattern[0] == '*' {
+				pattern = pattern[1:]
+			}
+			break
+		}
+	}
+
+	return len(pattern) == 0 && len(str) == 0
+}
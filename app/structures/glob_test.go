@@ -0,0 +1,60 @@
+package structures
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern, str string
+		want         bool
+	}{
+		{"*", "", true},
+		{"*", "anything", true},
+		{"h?llo", "hello", true},
+		{"h?llo", "hllo", false},
+		{"h*llo", "hllo", true},
+		{"h*llo", "heeeello", true},
+		{"h[ae]llo", "hallo", true},
+		{"h[ae]llo", "hillo", false},
+		{"h[^e]llo", "hallo", true},
+		{"h[^e]llo", "hello", false},
+		{"h[a-b]llo", "hbllo", true},
+		{"h[b-a]llo", "hallo", true},
+		{"h[a-b]llo", "hcllo", false},
+		{`h\*llo`, "h*llo", true},
+		{`h\*llo`, "hello", false},
+		{`h[\]]llo`, "h]llo", true},
+		{"[abc", "a", true},
+		{"a*", "a", true},
+		{"a**", "a", true},
+		{"*a", "", false},
+		{"user:*:name", "user:42:name", true},
+		{"user:*:name", "user:42:email", false},
+		{"", "", true},
+		{"", "a", false},
+	}
+	for _, tt := range tests {
+		if got := MatchGlob(tt.pattern, tt.str); got != tt.want {
+			t.Errorf("MatchGlob(%q, %q) = %v, want %v", tt.pattern, tt.str, got, tt.want)
+		}
+	}
+}
+
+func TestMatchGlob_PathologicalPattern(t *testing.T) {
+	pattern := strings.Repeat("a*", 30) + "b"
+	str := strings.Repeat("a", 100)
+
+	done := make(chan bool)
+	go func() { done <- MatchGlob(pattern, str) }()
+	select {
+	case got := <-done:
+		if got {
+			t.Error("pattern should not match")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("MatchGlob backtracked exponentially")
+	}
+}
@@ -0,0 +1,189 @@
+package structures
+
+import "time"
+
+// Hash is a map of fields to string values stored under a single key.
+// Fields may carry their own expiry, which is enforced lazily on access and
+// reclaimed in the background by the active expiry cycle.
+type Hash struct {
+	fields  map[string]string
+	expires map[string]time.Time
+	// bytes is the total length of the fields and values, for memory
+	// accounting.
+	bytes int
+	// index orders the fields for HSCAN. It is built by the first scan and
+	// maintained from then on.
+	index *scanIndex
+}
+
+// NewHash creates a new empty Hash.
+func NewHash() *Hash {
+	return &Hash{
+		fields:  make(map[string]string),
+		expires: make(map[string]time.Time),
+	}
+}
+
+// Len returns the number of fields in the hash. Like Redis' HLEN, it counts
+// expired fields that have not been reclaimed yet.
+func (h *Hash) Len() int {
+	return len(h.fields)
+}
+
+// Clone returns an independent copy of the hash, field expiries included.
+func (h *Hash) Clone() *Hash {
+	clone := NewHash()
+	for field, value := range h.fields {
+		clone.fields[field] = value
+	}
+	clone.bytes = h.bytes
+	for field, at := range h.expires {
+		clone.expires[field] = at
+	}
+	return clone
+}
+
+// Get returns the value of field.
+func (h *Hash) Get(field string) (string, bool) {
+	if h.expireField(field) {
+		return "", false
+	}
+	value, ok := h.fields[field]
+	return value, ok
+}
+
+// Set stores value under field, clearing any expiry it had, and reports
+// whether the field is new.
+func (h *Hash) Set(field, value string) bool {
+	h.expireField(field)
+	isNew := h.store(field, value)
+	delete(h.expires, field)
+	return isNew
+}
+
+// Update replaces the value of an existing field while keeping its expiry,
+// or adds it without one.
+func (h *Hash) Update(field, value string) {
+	h.expireField(field)
+	h.store(field, value)
+}
+
+// store sets the value of field, keeping the byte count and scan index in
+// step, and reports whether the field is new.
+func (h *Hash) store(field, value string) bool {
+	old, exists := h.fields[field]
+	if exists {
+		h.bytes -= len(old)
+	} else {
+		h.bytes += len(field)
+		if h.index != nil {
+			h.index.add(field)
+		}
+	}
+	h.fields[field] = value
+	h.bytes += len(value)
+	return !exists
+}
+
+// Delete removes field and reports whether it existed.
+func (h *Hash) Delete(field string) bool {
+	if h.expireField(field) {
+		return false
+	}
+	if _, ok := h.fields[field]; !ok {
+		return false
+	}
+	h.remove(field)
+	return true
+}
+
+// All returns a copy of every live field and value in the hash, reclaiming
+// the expired fields met on the way.
+func (h *Hash) All() map[string]string {
+	all := make(map[string]string, len(h.fields))
+	for f, v := range h.fields {
+		if !h.expireField(f) {
+			all[f] = v
+		}
+	}
+	return all
+}
+
+// Expiry returns the expiry time of field, which is zero if it has none,
+// and whether the field exists.
+func (h *Hash) Expiry(field string) (time.Time, bool) {
+	if _, ok := h.Get(field); !ok {
+		return time.Time{}, false
+	}
+	return h.expires[field], true
+}
+
+// SetExpiry sets the expiry time of an existing field.
+func (h *Hash) SetExpiry(field string, at time.Time) {
+	h.expires[field] = at
+}
+
+// Persist removes the expiry of field and reports whether it had one.
+func (h *Hash) Persist(field string) bool {
+	if _, ok := h.expires[field]; !ok {
+		return false
+	}
+	delete(h.expires, field)
+	return true
+}
+
+// HasVolatileFields reports whether any field carries an expiry.
+func (h *Hash) HasVolatileFields() bool {
+	return len(h.expires) > 0
+}
+
+// expireField deletes field if its expiry has passed and reports whether it
+// did so.
+func (h *Hash) expireField(field string) bool {
+	at, ok := h.expires[field]
+	if !ok || at.After(time.Now()) {
+		return false
+	}
+	h.remove(field)
+	return true
+}
+
+// remove deletes field along with its expiry.
+func (h *Hash) remove(field string) {
+	h.bytes -= len(field) + len(h.fields[field])
+	delete(h.fields, field)
+	delete(h.expires, field)
+	if h.index != nil {
+		h.index.remove(field)
+	}
+}
+
+// Scan calls visit for the live fields from cursor onwards, about count of
+// them, and returns the cursor to continue from, which is 0 once every
+// field has been visited. Expired fields met on the way are reclaimed.
+func (h *Hash) Scan(cursor uint64, count int, visit func(field, value string)) uint64 {
+	if h.index == nil {
+		h.index = newScanIndex()
+		for field := range h.fields {
+			h.index.add(field)
+		}
+	}
+	return h.index.scan(cursor, count, func(field string) {
+		if !h.expireField(field) {
+			visit(field, h.fields[field])
+		}
+	})
+}
+
+// purgeExpired deletes every field whose expiry has passed and returns how
+// many were removed. It costs a pass over every field with an expiry, so
+// only the active expiry cycle uses it; reads expire fields one at a time.
+func (h *Hash) purgeExpired() int {
+	removed := 0
+	for field := range h.expires {
+		if h.expireField(field) {
+			removed++
+		}
+	}
+	return removed
+}
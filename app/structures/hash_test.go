@@ -0,0 +1,300 @@
+package structures
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestStore_HSet_HGet(t *testing.T) {
+	s := NewStore()
+
+	added, err := s.HSet("user", map[string]string{"name": "ann", "age": "30"})
+	if err != nil || added != 2 {
+		t.Fatalf("HSet = (%d, %v), want (2, nil)", added, err)
+	}
+	added, _ = s.HSet("user", map[string]string{"name": "bob", "city": "x"})
+	if added != 1 {
+		t.Errorf("HSet overwrite = %d, want 1", added)
+	}
+
+	value, ok, err := s.HGet("user", "name")
+	if err != nil || !ok || value != "bob" {
+		t.Errorf("HGet(name) = (%q, %v, %v), want (\"bob\", true, nil)", value, ok, err)
+	}
+	if _, ok, _ := s.HGet("user", "missing"); ok {
+		t.Error("HGet(missing field) should return false")
+	}
+	if s.Type("user") != "hash" {
+		t.Errorf("Type(user) = %q, want 'hash'", s.Type("user"))
+	}
+}
+
+func TestStore_HSetNX(t *testing.T) {
+	s := NewStore()
+
+	if set, _ := s.HSetNX("h", "f", "1"); !set {
+		t.Error("HSetNX on new field should set it")
+	}
+	if set, _ := s.HSetNX("h", "f", "2"); set {
+		t.Error("HSetNX on existing field should not set it")
+	}
+	if v, _, _ := s.HGet("h", "f"); v != "1" {
+		t.Errorf("HGet after HSetNX = %q, want '1'", v)
+	}
+}
+
+func TestStore_HMGet(t *testing.T) {
+	s := NewStore()
+	s.HSet("h", map[string]string{"a": "1"})
+
+	values, found, err := s.HMGet("h", "a", "b")
+	if err != nil || !reflect.DeepEqual(values, []string{"1", ""}) || !reflect.DeepEqual(found, []bool{true, false}) {
+		t.Errorf("HMGet = (%v, %v, %v)", values, found, err)
+	}
+
+	_, found, _ = s.HMGet("missing", "a")
+	if found[0] {
+		t.Error("HMGet on missing key should report fields as absent")
+	}
+}
+
+func TestStore_HDel_DeletesEmptyHash(t *testing.T) {
+	s := NewStore()
+	s.HSet("h", map[string]string{"a": "1", "b": "2"})
+
+	removed, err := s.HDel("h", "a", "b", "c")
+	if err != nil || removed != 2 {
+		t.Errorf("HDel = (%d, %v), want (2, nil)", removed, err)
+	}
+	if s.Type("h") != "none" {
+		t.Error("empty hash should be removed from the store")
+	}
+}
+
+func TestStore_HGetAll(t *testing.T) {
+	s := NewStore()
+	s.HSet("h", map[string]string{"a": "1", "b": "2"})
+
+	all, err := s.HGetAll("h")
+	if err != nil || !reflect.DeepEqual(all, map[string]string{"a": "1", "b": "2"}) {
+		t.Errorf("HGetAll = (%v, %v)", all, err)
+	}
+
+	all, _ = s.HGetAll("missing")
+	if len(all) != 0 {
+		t.Errorf("HGetAll(missing) = %v, want empty", all)
+	}
+}
+
+func TestStore_HIncrBy(t *testing.T) {
+	s := NewStore()
+
+	if v, err := s.HIncrBy("h", "n", 5); err != nil || v != 5 {
+		t.Errorf("HIncrBy(new) = (%d, %v), want (5, nil)", v, err)
+	}
+	if v, err := s.HIncrBy("h", "n", -7); err != nil || v != -2 {
+		t.Errorf("HIncrBy(-7) = (%d, %v), want (-2, nil)", v, err)
+	}
+
+	s.HSet("h", map[string]string{"s": "abc", "big": "9223372036854775807"})
+	if _, err := s.HIncrBy("h", "s", 1); err != ErrHashNotInteger {
+		t.Errorf("HIncrBy(non-integer) error = %v, want ErrHashNotInteger", err)
+	}
+	if _, err := s.HIncrBy("h", "big", 1); err != ErrOverflow {
+		t.Errorf("HIncrBy(overflow) error = %v, want ErrOverflow", err)
+	}
+}
+
+func TestStore_HIncrByFloat(t *testing.T) {
+	s := NewStore()
+	s.HSet("h", map[string]string{"f": "10.50", "s": "abc"})
+
+	if v, err := s.HIncrByFloat("h", "f", 0.1); err != nil || v != "10.6" {
+		t.Errorf("HIncrByFloat = (%q, %v), want (\"10.6\", nil)", v, err)
+	}
+	if v, _ := s.HIncrByFloat("h", "new", 3); v != "3" {
+		t.Errorf("HIncrByFloat(new) = %q, want '3'", v)
+	}
+	if _, err := s.HIncrByFloat("h", "s", 1); err != ErrHashNotFloat {
+		t.Errorf("HIncrByFloat(non-float) error = %v, want ErrHashNotFloat", err)
+	}
+}
+
+func TestStore_Hash_WrongType(t *testing.T) {
+	s := NewStore()
+	s.Set("str", "v", time.Time{})
+	s.RPush("list", false, "a")
+
+	for _, key := range []string{"str", "list"} {
+		if _, err := s.HSet(key, map[string]string{"a": "b"}); err != ErrWrongType {
+			t.Errorf("HSet(%s) error = %v, want ErrWrongType", key, err)
+		}
+		if _, _, err := s.HGet(key, "a"); err != ErrWrongType {
+			t.Errorf("HGet(%s) error = %v, want ErrWrongType", key, err)
+		}
+	}
+}
+
+func TestStore_HExpire(t *testing.T) {
+	s := NewStore()
+	s.HSet("h", map[string]string{"a": "1", "b": "2"})
+
+	codes, err := s.HExpire("h", time.Now().Add(time.Hour), "", []string{"a", "missing"})
+	if err != nil || !reflect.DeepEqual(codes, []int{FieldUpdated, FieldMissing}) {
+		t.Fatalf("HExpire = (%v, %v), want ([1 -2], nil)", codes, err)
+	}
+
+	// NX refuses fields that already have an expiry, XX those that don't.
+	codes, _ = s.HExpire("h", time.Now().Add(2*time.Hour), "NX", []string{"a", "b"})
+	if !reflect.DeepEqual(codes, []int{FieldNotUpdated, FieldUpdated}) {
+		t.Errorf("HExpire NX = %v, want [0 1]", codes)
+	}
+	codes, _ = s.HExpire("h", time.Now().Add(time.Minute), "GT", []string{"a"})
+	if !reflect.DeepEqual(codes, []int{FieldNotUpdated}) {
+		t.Errorf("HExpire GT with smaller time = %v, want [0]", codes)
+	}
+
+	codes, _ = s.HExpire("missing", time.Now().Add(time.Hour), "", []string{"a"})
+	if !reflect.DeepEqual(codes, []int{FieldMissing}) {
+		t.Errorf("HExpire on missing key = %v, want [-2]", codes)
+	}
+}
+
+func TestStore_HExpire_PastDeletes(t *testing.T) {
+	s := NewStore()
+	s.HSet("h", map[string]string{"a": "1"})
+
+	codes, _ := s.HExpire("h", time.Now().Add(-time.Second), "", []string{"a"})
+	if !reflect.DeepEqual(codes, []int{FieldDeletedByTTL}) {
+		t.Errorf("HExpire in the past = %v, want [2]", codes)
+	}
+	if s.Type("h") != "none" {
+		t.Error("hash should be deleted once its last field expires")
+	}
+}
+
+func TestStore_HashField_LazyExpiry(t *testing.T) {
+	s := NewStore()
+	s.HSet("h", map[string]string{"token": "x", "name": "ann"})
+	s.HExpire("h", time.Now().Add(20*time.Millisecond), "", []string{"token"})
+
+	if _, ok, _ := s.HGet("h", "token"); !ok {
+		t.Fatal("field should exist before it expires")
+	}
+	time.Sleep(40 * time.Millisecond)
+
+	if _, ok, _ := s.HGet("h", "token"); ok {
+		t.Error("HGet should not return an expired field")
+	}
+	if n, _ := s.HLen("h"); n != 1 {
+		t.Errorf("HLen after expiry = %d, want 1", n)
+	}
+	if all, _ := s.HGetAll("h"); len(all) != 1 {
+		t.Errorf("HGetAll after expiry = %v, want only name", all)
+	}
+}
+
+func TestStore_HashField_SetClearsExpiry(t *testing.T) {
+	s := NewStore()
+	s.HSet("h", map[string]string{"a": "1", "n": "1"})
+	s.HExpire("h", time.Now().Add(time.Hour), "", []string{"a", "n"})
+
+	s.HSet("h", map[string]string{"a": "2"})
+	s.HIncrBy("h", "n", 1)
+
+	times, found, _ := s.HExpiryTimes("h", []string{"a", "n", "x"})
+	if !times[0].IsZero() {
+		t.Error("HSet should clear the field's expiry")
+	}
+	if times[1].IsZero() {
+		t.Error("HIncrBy should keep the field's expiry")
+	}
+	if !reflect.DeepEqual(found, []bool{true, true, false}) {
+		t.Errorf("HExpiryTimes found = %v, want [true true false]", found)
+	}
+}
+
+func TestStore_HPersist(t *testing.T) {
+	s := NewStore()
+	s.HSet("h", map[string]string{"a": "1", "b": "2"})
+	s.HExpire("h", time.Now().Add(time.Hour), "", []string{"a"})
+
+	codes, err := s.HPersist("h", []string{"a", "b", "c"})
+	if err != nil || !reflect.DeepEqual(codes, []int{FieldUpdated, FieldNoExpiry, FieldMissing}) {
+		t.Errorf("HPersist = (%v, %v), want ([1 -1 -2], nil)", codes, err)
+	}
+}
+
+func TestStore_ReclaimExpiredFields(t *testing.T) {
+	s := NewStore()
+	s.HSet("h1", map[string]string{"a": "1", "b": "2"})
+	s.HSet("h2", map[string]string{"a": "1"})
+	s.HExpire("h1", time.Now().Add(10*time.Millisecond), "", []string{"a"})
+	s.HExpire("h2", time.Now().Add(10*time.Millisecond), "", []string{"a"})
+	time.Sleep(20 * time.Millisecond)
+
+	if n := s.ReclaimExpiredFields(10); n != 2 {
+		t.Errorf("ReclaimExpiredFields = %d, want 2", n)
+	}
+	if s.Type("h2") != "none" {
+		t.Error("a hash emptied by reclamation should be deleted")
+	}
+	if s.Type("h1") != "hash" {
+		t.Error("a hash with live fields should be kept")
+	}
+}
+
+func TestStore_ReclaimExpiredFields_SamplesVolatileHashes(t *testing.T) {
+	s := NewStore()
+	for i := 0; i < 100; i++ {
+		s.Set(fmt.Sprintf("k%d", i), "v", time.Time{})
+	}
+	s.HSet("h", map[string]string{"a": "1", "b": "2"})
+	s.HSet("kept", map[string]string{"a": "1"})
+	s.HExpire("h", time.Now().Add(10*time.Millisecond), "", []string{"a"})
+	s.HExpire("kept", time.Now().Add(time.Hour), "", []string{"a"})
+	s.HPersist("kept", []string{"a"})
+	time.Sleep(20 * time.Millisecond)
+
+	// Only the two hashes are inspected, however many other keys there are.
+	if n := s.ReclaimExpiredFields(2); n != 1 {
+		t.Errorf("ReclaimExpiredFields = %d, want 1", n)
+	}
+	if _, ok := s.volatileHashes["kept"]; ok {
+		t.Error("a hash without volatile fields should leave the index")
+	}
+	if _, ok := s.volatileHashes["h"]; ok {
+		t.Error("a hash whose volatile fields were reclaimed should leave the index")
+	}
+
+	s.Delete("h")
+	s.HSet("h", map[string]string{"a": "1"})
+	s.HExpire("h", time.Now().Add(time.Hour), "", []string{"a"})
+	s.Set("h", "v", time.Time{})
+	if _, ok := s.volatileHashes["h"]; ok {
+		t.Error("overwriting a hash should remove it from the index")
+	}
+}
+
+func TestStore_HashField_ExpiresOnRead(t *testing.T) {
+	s := NewStore()
+	s.HSet("h", map[string]string{"a": "1", "b": "2"})
+	s.HExpire("h", time.Now().Add(10*time.Millisecond), "", []string{"a", "b"})
+	time.Sleep(20 * time.Millisecond)
+
+	// Reading a field only reclaims that field.
+	if _, ok, _ := s.HGet("h", "a"); ok {
+		t.Error("HGet should not return an expired field")
+	}
+	if _, ok := s.data["h"].Hash.fields["b"]; !ok {
+		t.Error("HGet should leave the other expired fields to the active cycle")
+	}
+	if _, ok, _ := s.HGet("h", "b"); ok {
+		t.Error("HGet should not return an expired field")
+	}
+	if s.Type("h") != "none" {
+		t.Error("hash should be deleted once its last field expires")
+	}
+}
@@ -0,0 +1,248 @@
+package structures
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStore_Del_Exists(t *testing.T) {
+	s := NewStore()
+	s.Set("a", "1", time.Time{})
+	s.Set("b", "2", time.Time{})
+	s.Set("expired", "x", time.Now().Add(-time.Second))
+
+	if n := s.Exists("a", "a", "missing", "expired"); n != 2 {
+		t.Errorf("Exists = %d, want 2 (duplicates counted)", n)
+	}
+	if n := s.Del("a", "b", "missing", "expired"); n != 2 {
+		t.Errorf("Del = %d, want 2", n)
+	}
+	if n := s.Exists("a", "b"); n != 0 {
+		t.Errorf("Exists after Del = %d, want 0", n)
+	}
+}
+
+func TestStore_Rename(t *testing.T) {
+	s := NewStore()
+	expiry := time.Now().Add(time.Hour)
+	s.Set("src", "v", expiry)
+	s.RPush("dst", false, "a")
+
+	if _, err := s.Rename("missing", "x", false); err != ErrNoSuchKey {
+		t.Errorf("Rename(missing) error = %v, want ErrNoSuchKey", err)
+	}
+	if ok, _ := s.Rename("src", "dst", true); ok {
+		t.Error("Rename with nx should not overwrite an existing key")
+	}
+	if ok, _ := s.Rename("src", "src", true); ok {
+		t.Error("Rename with nx onto itself should report 0")
+	}
+	if ok, err := s.Rename("src", "src", false); !ok || err != nil {
+		t.Error("Rename onto itself should succeed")
+	}
+
+	if ok, err := s.Rename("src", "dst", false); !ok || err != nil {
+		t.Fatalf("Rename = (%v, %v), want (true, nil)", ok, err)
+	}
+	if s.Type("src") != "none" || s.Type("dst") != "string" {
+		t.Error("Rename should move the value and replace the destination")
+	}
+	if !s.data["dst"].Expiry.Equal(expiry) {
+		t.Error("Rename should keep the expiry")
+	}
+}
+
+func TestStore_Rename_WakesBlockedClient(t *testing.T) {
+	s := NewStore()
+	s.RPush("src", false, "a")
+
+	done := make(chan []string, 1)
+	go func() {
+		_, values, _, _ := s.BLMPop([]string{"dst"}, true, 1, 0)
+		done <- values
+	}()
+	waitBlocked(t, s, "dst", 1)
+
+	s.Rename("src", "dst", false)
+	select {
+	case got := <-done:
+		if len(got) != 1 || got[0] != "a" {
+			t.Errorf("BLMPop = %q, want [a]", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Rename should wake a client blocked on the destination")
+	}
+}
+
+func TestStore_Copy(t *testing.T) {
+	s := NewStore()
+	expiry := time.Now().Add(time.Hour)
+	s.RPush("src", false, "a", "b")
+	val := s.data["src"]
+	val.Expiry = expiry
+	s.data["src"] = val
+	s.Set("other", "x", time.Time{})
+
+	if _, err := s.Copy("src", "src", 0, false); err != ErrSameObject {
+		t.Errorf("Copy onto itself error = %v, want ErrSameObject", err)
+	}
+	if ok, _ := s.Copy("missing", "dst", 0, false); ok {
+		t.Error("Copy of a missing key should report false")
+	}
+	if ok, _ := s.Copy("src", "other", 0, false); ok {
+		t.Error("Copy without replace should not overwrite")
+	}
+	if ok, _ := s.Copy("src", "other", 0, true); !ok {
+		t.Error("Copy with replace should overwrite")
+	}
+
+	s.RPush("other", false, "c")
+	if got, _ := s.LRange("src", 0, -1); len(got) != 2 {
+		t.Errorf("source list = %q, copies must be independent", got)
+	}
+	if !s.data["other"].Expiry.Equal(expiry) {
+		t.Error("Copy should carry the expiry over")
+	}
+}
+
+func TestStore_Copy_AllTypes(t *testing.T) {
+	s := NewStore()
+	s.HSet("hash", map[string]string{"f": "v"})
+	s.SAdd("set", "m")
+	s.ZAdd("zset", ZAddOptions{}, []ScoredMember{{"m", 1}})
+	s.XAdd("stream", "1-1", map[string]string{"f": "v"})
+
+	for _, key := range []string{"hash", "set", "zset", "stream"} {
+		if ok, err := s.Copy(key, key+"-copy", 0, false); !ok || err != nil {
+			t.Errorf("Copy(%s) = (%v, %v)", key, ok, err)
+		}
+	}
+
+	s.HSet("hash-copy", map[string]string{"g": "w"})
+	s.SAdd("set-copy", "n")
+	s.ZAdd("zset-copy", ZAddOptions{}, []ScoredMember{{"n", 2}})
+	s.XAdd("stream-copy", "2-1", map[string]string{"f": "v"})
+
+	if n, _ := s.HLen("hash"); n != 1 {
+		t.Errorf("original hash has %d fields, want 1", n)
+	}
+	if n, _ := s.SCard("set"); n != 1 {
+		t.Errorf("original set has %d members, want 1", n)
+	}
+	if n, _ := s.ZCard("zset"); n != 1 {
+		t.Errorf("original zset has %d members, want 1", n)
+	}
+	if n := s.StreamSize([]string{"stream"}); n != 1 {
+		t.Errorf("original stream has %d entries, want 1", n)
+	}
+}
+
+func TestStore_RandomKey_DBSize(t *testing.T) {
+	s := NewStore()
+	if _, ok := s.RandomKey(); ok {
+		t.Error("RandomKey on an empty store should report false")
+	}
+
+	s.Set("expired", "x", time.Now().Add(-time.Second))
+	s.Set("live", "y", time.Time{})
+	if s.DBSize() != 2 {
+		t.Errorf("DBSize = %d, want 2", s.DBSize())
+	}
+	if key, ok := s.RandomKey(); !ok || key != "live" {
+		t.Errorf("RandomKey = (%q, %v), want (live, true)", key, ok)
+	}
+}
+
+func TestStore_Expire_Conditions(t *testing.T) {
+	s := NewStore()
+	s.Set("k", "v", time.Time{})
+	soon := time.Now().Add(time.Minute)
+	later := time.Now().Add(time.Hour)
+
+	if s.Expire("missing", later) {
+		t.Error("Expire on a missing key should report false")
+	}
+	if s.Expire("k", later, "XX") {
+		t.Error("XX should fail on a key without expiry")
+	}
+	if s.Expire("k", later, "GT") {
+		t.Error("GT should fail on a key without expiry")
+	}
+	if !s.Expire("k", later, "NX") {
+		t.Error("NX should succeed on a key without expiry")
+	}
+	if s.Expire("k", soon, "NX") {
+		t.Error("NX should fail once the key has an expiry")
+	}
+	if s.Expire("k", soon, "XX", "GT") {
+		t.Error("XX GT should fail for an earlier deadline")
+	}
+	if !s.Expire("k", soon, "XX", "LT") {
+		t.Error("XX LT should succeed for an earlier deadline")
+	}
+	if at, ok := s.ExpiryTime("k"); !ok || !at.Equal(soon) {
+		t.Errorf("ExpiryTime = (%v, %v), want (%v, true)", at, ok, soon)
+	}
+}
+
+func TestStore_Expire_PastDeletes(t *testing.T) {
+	s := NewStore()
+	s.Set("k", "v", time.Time{})
+
+	if !s.Expire("k", time.Now().Add(-time.Second)) {
+		t.Error("Expire with a past deadline should report true")
+	}
+	if _, ok := s.ExpiryTime("k"); ok {
+		t.Error("Expire with a past deadline should delete the key")
+	}
+}
+
+func TestStore_Expire_AllTypes(t *testing.T) {
+	s := NewStore()
+	s.RPush("list", false, "a")
+	s.HSet("hash", map[string]string{"f": "v"})
+	s.SAdd("set", "m")
+	s.ZAdd("zset", ZAddOptions{}, []ScoredMember{{"m", 1}})
+	s.XAdd("stream", "1-1", map[string]string{"f": "v"})
+
+	keys := []string{"list", "hash", "set", "zset", "stream"}
+	for _, key := range keys {
+		s.Expire(key, time.Now().Add(20*time.Millisecond))
+	}
+	time.Sleep(40 * time.Millisecond)
+
+	if n := s.Exists(keys...); n != 0 {
+		t.Errorf("Exists after expiry = %d, want 0", n)
+	}
+	if _, ok, _ := s.XRange("stream", "0-0", "9-9", 0); ok {
+		t.Error("XRange should not see an expired stream")
+	}
+	if id, _ := s.XAdd("stream", "1-1", map[string]string{"f": "v"}); id != "1-1" {
+		t.Errorf("XAdd on an expired stream = %q, want a fresh stream", id)
+	}
+}
+
+func TestStore_Persist(t *testing.T) {
+	s := NewStore()
+	s.Set("k", "v", time.Now().Add(time.Hour))
+	s.Set("plain", "v", time.Time{})
+
+	if !s.Persist("k") {
+		t.Error("Persist should report true for a key with an expiry")
+	}
+	if at, _ := s.ExpiryTime("k"); !at.IsZero() {
+		t.Error("Persist should clear the expiry")
+	}
+	if s.Persist("plain") || s.Persist("missing") {
+		t.Error("Persist should report false without an expiry to remove")
+	}
+}
+
+func TestStore_XAdd_WrongType(t *testing.T) {
+	s := NewStore()
+	s.Set("k", "v", time.Time{})
+
+	if _, err := s.XAdd("k", "1-1", map[string]string{"f": "v"}); err != ErrWrongType {
+		t.Errorf("XAdd on a string error = %v, want ErrWrongType", err)
+	}
+}
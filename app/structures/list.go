@@ -0,0 +1,241 @@
+package structures
+
+// List is a double-ended queue backed by a growable ring buffer, so pushes
+// and pops at either end run in amortised O(1).
+type List struct {
+	buf  []string
+	head int
+	size int
+	// bytes is the total length of the values, for memory accounting.
+	bytes int
+}
+
+// NewList creates a new empty List.
+func NewList() *List {
+	return &List{buf: make([]string, 8)}
+}
+
+// Len returns the number of elements in the list.
+func (l *List) Len() int {
+	return l.size
+}
+
+// Clone returns an independent copy of the list.
+func (l *List) Clone() *List {
+	clone := &List{}
+	clone.reset(l.Range(0, -1))
+	return clone
+}
+
+// PushFront inserts a value at the head of the list.
+func (l *List) PushFront(value string) {
+	l.grow()
+	l.head = (l.head - 1 + len(l.buf)) % len(l.buf)
+	l.buf[l.head] = value
+	l.size++
+	l.bytes += len(value)
+}
+
+// PushBack appends a value at the tail of the list.
+func (l *List) PushBack(value string) {
+	l.grow()
+	l.buf[(l.head+l.size)%len(l.buf)] = value
+	l.size++
+	l.bytes += len(value)
+}
+
+// PopFront removes and returns the value at the head of the list.
+func (l *List) PopFront() (string, bool) {
+	if l.size == 0 {
+		return "", false
+	}
+
+	value := l.buf[l.head]
+	l.buf[l.head] = ""
+	l.head = (l.head + 1) % len(l.buf)
+	l.size--
+	l.bytes -= len(value)
+	return value, true
+}
+
+// PopBack removes and returns the value at the tail of the list.
+func (l *List) PopBack() (string, bool) {
+	if l.size == 0 {
+		return "", false
+	}
+
+	i := (l.head + l.size - 1) % len(l.buf)
+	value := l.buf[i]
+	l.buf[i] = ""
+	l.size--
+	l.bytes -= len(value)
+	return value, true
+}
+
+// Index returns the value at index, where negative indexes count from the tail.
+func (l *List) Index(index int) (string, bool) {
+	index, ok := l.normalize(index)
+	if !ok {
+		return "", false
+	}
+	return l.at(index), true
+}
+
+// Set replaces the value at index, where negative indexes count from the tail.
+func (l *List) Set(index int, value string) bool {
+	index, ok := l.normalize(index)
+	if !ok {
+		return false
+	}
+	i := (l.head + index) % len(l.buf)
+	l.bytes += len(value) - len(l.buf[i])
+	l.buf[i] = value
+	return true
+}
+
+// Range returns the values between start and stop inclusive, using the same
+// index semantics as LRANGE.
+func (l *List) Range(start, stop int) []string {
+	start, stop, ok := l.clamp(start, stop)
+	if !ok {
+		return []string{}
+	}
+
+	values := make([]string, 0, stop-start+1)
+	for i := start; i <= stop; i++ {
+		values = append(values, l.at(i))
+	}
+	return values
+}
+
+// Insert places value before or after the first occurrence of pivot. It
+// returns the new length, or -1 if pivot was not found.
+func (l *List) Insert(pivot, value string, before bool) int {
+	for i := 0; i < l.size; i++ {
+		if l.at(i) != pivot {
+			continue
+		}
+
+		if !before {
+			i++
+		}
+		values := l.Range(0, -1)
+		values = append(values[:i], append([]string{value}, values[i:]...)...)
+		l.reset(values)
+		return l.size
+	}
+	return -1
+}
+
+// Remove deletes occurrences of value following LREM semantics: count > 0
+// removes from head to tail, count < 0 from tail to head, and 0 removes all.
+// It returns the number of removed elements.
+func (l *List) Remove(count int, value string) int {
+	values := l.Range(0, -1)
+	keep := make([]bool, len(values))
+	for i := range keep {
+		keep[i] = true
+	}
+
+	removed := 0
+	limit := count
+	if limit < 0 {
+		limit = -limit
+	}
+
+	if count >= 0 {
+		for i := 0; i < len(values) && (limit == 0 || removed < limit); i++ {
+			if values[i] == value {
+				keep[i] = false
+				removed++
+			}
+		}
+	} else {
+		for i := len(values) - 1; i >= 0 && removed < limit; i-- {
+			if values[i] == value {
+				keep[i] = false
+				removed++
+			}
+		}
+	}
+
+	if removed == 0 {
+		return 0
+	}
+
+	kept := make([]string, 0, len(values)-removed)
+	for i, v := range values {
+		if keep[i] {
+			kept = append(kept, v)
+		}
+	}
+	l.reset(kept)
+	return removed
+}
+
+// Trim keeps only the values between start and stop inclusive.
+func (l *List) Trim(start, stop int) {
+	l.reset(l.Range(start, stop))
+}
+
+func (l *List) at(index int) string {
+	return l.buf[(l.head+index)%len(l.buf)]
+}
+
+func (l *List) normalize(index int) (int, bool) {
+	if index < 0 {
+		index += l.size
+	}
+	if index < 0 || index >= l.size {
+		return 0, false
+	}
+	return index, true
+}
+
+func (l *List) clamp(start, stop int) (int, int, bool) {
+	if start < 0 {
+		start += l.size
+	}
+	if stop < 0 {
+		stop += l.size
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= l.size {
+		stop = l.size - 1
+	}
+	if start > stop || start >= l.size {
+		return 0, 0, false
+	}
+	return start, stop, true
+}
+
+func (l *List) grow() {
+	if l.size < len(l.buf) {
+		return
+	}
+
+	buf := make([]string, len(l.buf)*2)
+	for i := 0; i < l.size; i++ {
+		buf[i] = l.at(i)
+	}
+	l.buf = buf
+	l.head = 0
+}
+
+func (l *List) reset(values []string) {
+	capacity := 8
+	for capacity < len(values) {
+		capacity *= 2
+	}
+
+	l.buf = make([]string, capacity)
+	copy(l.buf, values)
+	l.head = 0
+	l.size = len(values)
+	l.bytes = 0
+	for _, v := range values {
+		l.bytes += len(v)
+	}
+}
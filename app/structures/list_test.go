@@ -0,0 +1,248 @@
+package structures
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestList_PushPop(t *testing.T) {
+	l := NewList()
+	l.PushBack("b")
+	l.PushFront("a")
+	l.PushBack("c")
+
+	if l.Len() != 3 {
+		t.Fatalf("Len() = %d, want 3", l.Len())
+	}
+	if v, _ := l.PopFront(); v != "a" {
+		t.Errorf("PopFront() = %q, want 'a'", v)
+	}
+	if v, _ := l.PopBack(); v != "c" {
+		t.Errorf("PopBack() = %q, want 'c'", v)
+	}
+	if v, _ := l.PopBack(); v != "b" {
+		t.Errorf("PopBack() = %q, want 'b'", v)
+	}
+	if _, ok := l.PopFront(); ok {
+		t.Error("PopFront() on empty list should return false")
+	}
+}
+
+func TestList_GrowsAcrossWrap(t *testing.T) {
+	l := NewList()
+	want := []string{}
+	for i := 0; i < 20; i++ {
+		v := string(rune('a' + i))
+		if i%2 == 0 {
+			l.PushFront(v)
+			want = append([]string{v}, want...)
+		} else {
+			l.PushBack(v)
+			want = append(want, v)
+		}
+	}
+
+	if got := l.Range(0, -1); !reflect.DeepEqual(got, want) {
+		t.Errorf("Range(0, -1) = %v, want %v", got, want)
+	}
+}
+
+func TestList_Range(t *testing.T) {
+	l := NewList()
+	for _, v := range []string{"a", "b", "c", "d", "e"} {
+		l.PushBack(v)
+	}
+
+	tests := []struct {
+		start, stop int
+		want        []string
+	}{
+		{0, -1, []string{"a", "b", "c", "d", "e"}},
+		{1, 2, []string{"b", "c"}},
+		{-2, -1, []string{"d", "e"}},
+		{-100, 100, []string{"a", "b", "c", "d", "e"}},
+		{3, 1, []string{}},
+		{5, 10, []string{}},
+	}
+
+	for _, tt := range tests {
+		if got := l.Range(tt.start, tt.stop); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Range(%d, %d) = %v, want %v", tt.start, tt.stop, got, tt.want)
+		}
+	}
+}
+
+func TestList_IndexAndSet(t *testing.T) {
+	l := NewList()
+	l.PushBack("a")
+	l.PushBack("b")
+
+	if v, ok := l.Index(-1); !ok || v != "b" {
+		t.Errorf("Index(-1) = (%q, %v), want ('b', true)", v, ok)
+	}
+	if _, ok := l.Index(2); ok {
+		t.Error("Index(2) should be out of range")
+	}
+	if !l.Set(0, "z") {
+		t.Fatal("Set(0) should succeed")
+	}
+	if v, _ := l.Index(0); v != "z" {
+		t.Errorf("Index(0) after Set = %q, want 'z'", v)
+	}
+	if l.Set(5, "x") {
+		t.Error("Set(5) should fail")
+	}
+}
+
+func TestList_Remove(t *testing.T) {
+	tests := []struct {
+		name  string
+		count int
+		want  []string
+		n     int
+	}{
+		{"from head", 2, []string{"b", "x", "c"}, 2},
+		{"from tail", -2, []string{"x", "b", "c"}, 2},
+		{"all", 0, []string{"b", "c"}, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewList()
+			for _, v := range []string{"x", "b", "x", "x", "c"} {
+				l.PushBack(v)
+			}
+			if n := l.Remove(tt.count, "x"); n != tt.n {
+				t.Errorf("Remove() = %d, want %d", n, tt.n)
+			}
+			if got := l.Range(0, -1); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("after Remove() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestList_Insert(t *testing.T) {
+	l := NewList()
+	l.PushBack("a")
+	l.PushBack("c")
+
+	if n := l.Insert("c", "b", true); n != 3 {
+		t.Errorf("Insert before = %d, want 3", n)
+	}
+	if n := l.Insert("c", "d", false); n != 4 {
+		t.Errorf("Insert after = %d, want 4", n)
+	}
+	if n := l.Insert("missing", "x", true); n != -1 {
+		t.Errorf("Insert missing pivot = %d, want -1", n)
+	}
+	if got := l.Range(0, -1); !reflect.DeepEqual(got, []string{"a", "b", "c", "d"}) {
+		t.Errorf("after Insert = %v", got)
+	}
+}
+
+func TestStore_LPushRPush(t *testing.T) {
+	s := NewStore()
+
+	n, err := s.RPush("list", false, "a", "b")
+	if err != nil || n != 2 {
+		t.Fatalf("RPush = (%d, %v), want (2, nil)", n, err)
+	}
+	n, err = s.LPush("list", false, "y", "z")
+	if err != nil || n != 4 {
+		t.Fatalf("LPush = (%d, %v), want (4, nil)", n, err)
+	}
+
+	values, _ := s.LRange("list", 0, -1)
+	if !reflect.DeepEqual(values, []string{"z", "y", "a", "b"}) {
+		t.Errorf("LRange = %v, want [z y a b]", values)
+	}
+	if s.Type("list") != "list" {
+		t.Errorf("Type(list) = %q, want 'list'", s.Type("list"))
+	}
+}
+
+func TestStore_PushX_MissingKey(t *testing.T) {
+	s := NewStore()
+
+	n, err := s.LPush("list", true, "a")
+	if err != nil || n != 0 {
+		t.Errorf("LPush(onlyIfExists) = (%d, %v), want (0, nil)", n, err)
+	}
+	if s.Type("list") != "none" {
+		t.Error("LPUSHX should not create the key")
+	}
+}
+
+func TestStore_LPop_DeletesEmptyList(t *testing.T) {
+	s := NewStore()
+	s.RPush("list", false, "a", "b")
+
+	values, err := s.LPop("list", 5)
+	if err != nil || !reflect.DeepEqual(values, []string{"a", "b"}) {
+		t.Fatalf("LPop = (%v, %v), want ([a b], nil)", values, err)
+	}
+	if s.Type("list") != "none" {
+		t.Error("empty list should be removed from the store")
+	}
+
+	values, err = s.RPop("list", 1)
+	if err != nil || values != nil {
+		t.Errorf("RPop(missing) = (%v, %v), want (nil, nil)", values, err)
+	}
+}
+
+func TestStore_List_WrongType(t *testing.T) {
+	s := NewStore()
+	s.Set("str", "val", time.Time{})
+	s.XAdd("stream", "1-1", map[string]string{"a": "b"})
+
+	for _, key := range []string{"str", "stream"} {
+		if _, err := s.LPush(key, false, "a"); err != ErrWrongType {
+			t.Errorf("LPush(%s) error = %v, want ErrWrongType", key, err)
+		}
+		if _, err := s.LLen(key); err != ErrWrongType {
+			t.Errorf("LLen(%s) error = %v, want ErrWrongType", key, err)
+		}
+	}
+}
+
+func TestStore_LSet_Errors(t *testing.T) {
+	s := NewStore()
+
+	if err := s.LSet("missing", 0, "x"); err != ErrNoSuchKey {
+		t.Errorf("LSet(missing) error = %v, want ErrNoSuchKey", err)
+	}
+
+	s.RPush("list", false, "a")
+	if err := s.LSet("list", 3, "x"); err != ErrIndexOutOfRange {
+		t.Errorf("LSet(out of range) error = %v, want ErrIndexOutOfRange", err)
+	}
+}
+
+func TestStore_LTrim(t *testing.T) {
+	s := NewStore()
+	s.RPush("list", false, "a", "b", "c", "d")
+
+	s.LTrim("list", 1, -2)
+	values, _ := s.LRange("list", 0, -1)
+	if !reflect.DeepEqual(values, []string{"b", "c"}) {
+		t.Errorf("LRange after LTrim = %v, want [b c]", values)
+	}
+
+	s.LTrim("list", 5, 10)
+	if s.Type("list") != "none" {
+		t.Error("LTrim to an empty range should delete the key")
+	}
+}
+
+func TestStore_List_Expired(t *testing.T) {
+	s := NewStore()
+	s.Set("k", "v", time.Now().Add(-1*time.Second))
+
+	n, err := s.RPush("k", false, "a")
+	if err != nil || n != 1 {
+		t.Errorf("RPush on expired key = (%d, %v), want (1, nil)", n, err)
+	}
+}
@@ -0,0 +1,419 @@
+package structures
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrOOM is returned for commands that may grow the dataset while memory
+// use is over the limit and nothing can be evicted.
+var ErrOOM = errors.New("OOM command not allowed when used memory > 'maxmemory'.")
+
+// EvictionPolicy selects the keys evicted once the memory limit is reached.
+type EvictionPolicy int
+
+const (
+	// NoEviction evicts nothing; writes that may grow the dataset fail.
+	NoEviction EvictionPolicy = iota
+	// AllKeysLRU evicts the least recently used keys.
+	AllKeysLRU
+	// AllKeysLFU evicts the least frequently used keys.
+	AllKeysLFU
+	// AllKeysRandom evicts random keys.
+	AllKeysRandom
+	// VolatileLRU evicts the least recently used keys that carry a TTL.
+	VolatileLRU
+	// VolatileLFU evicts the least frequently used keys that carry a TTL.
+	VolatileLFU
+	// VolatileRandom evicts random keys that carry a TTL.
+	VolatileRandom
+	// VolatileTTL evicts the keys closest to expiring.
+	VolatileTTL
+)
+
+var evictionPolicyNames = []string{
+	"noeviction",
+	"allkeys-lru",
+	"allkeys-lfu",
+	"allkeys-random",
+	"volatile-lru",
+	"volatile-lfu",
+	"volatile-random",
+	"volatile-ttl",
+}
+
+// String returns the policy's name as used by maxmemory-policy.
+func (p EvictionPolicy) String() string {
+	return evictionPolicyNames[p]
+}
+
+// ParseEvictionPolicy returns the policy with the given maxmemory-policy
+// name.
+func ParseEvictionPolicy(name string) (EvictionPolicy, error) {
+	for i, n := range evictionPolicyNames {
+		if strings.EqualFold(n, name) {
+			return EvictionPolicy(i), nil
+		}
+	}
+	return NoEviction, fmt.Errorf("unknown eviction policy '%s'", name)
+}
+
+// volatile reports whether the policy only evicts keys that carry a TTL.
+func (p EvictionPolicy) volatile() bool {
+	return p >= VolatileLRU
+}
+
+// evictionSamples is how many keys of each database are sampled to pick
+// a victim, like Redis' maxmemory-samples.
+const evictionSamples = 5
+
+// memoryState tracks memory use across every database of a Store.
+type memoryState struct {
+	used atomic.Int64
+
+	mu          sync.Mutex
+	limit       int64
+	policy      EvictionPolicy
+	evictedKeys int64
+	nextDB      int
+	onEvict     func(db int, key string)
+}
+
+// MemoryStats reports memory use and eviction, mirroring the memory
+// section of INFO.
+type MemoryStats struct {
+	// Used is the estimated memory held by keys and values.
+	Used int64
+	// MaxMemory is the limit in bytes, 0 meaning none.
+	MaxMemory int64
+	// Policy is the eviction policy applied at the limit.
+	Policy EvictionPolicy
+	// EvictedKeys counts keys evicted to honour the limit.
+	EvictedKeys int64
+}
+
+// SetMaxMemory sets the memory limit in bytes, 0 meaning none, and the
+// policy used to stay under it.
+func (s *Store) SetMaxMemory(limit int64, policy EvictionPolicy) {
+	s.memory.mu.Lock()
+	defer s.memory.mu.Unlock()
+
+	s.memory.limit = limit
+	s.memory.policy = policy
+}
+
+// OnEvict registers fn to be called with every evicted key once it is gone,
+// so that evictions can be propagated like deletions.
+func (s *Store) OnEvict(fn func(db int, key string)) {
+	s.memory.mu.Lock()
+	defer s.memory.mu.Unlock()
+
+	s.memory.onEvict = fn
+}
+
+// MemoryStats returns a snapshot of the memory metrics.
+func (s *Store) MemoryStats() MemoryStats {
+	s.memory.mu.Lock()
+	defer s.memory.mu.Unlock()
+
+	return MemoryStats{
+		Used:        s.memory.used.Load(),
+		MaxMemory:   s.memory.limit,
+		Policy:      s.memory.policy,
+		EvictedKeys: s.memory.evictedKeys,
+	}
+}
+
+// MemoryUsage returns the estimated memory held by key and its value, and
+// whether the key exists.
+func (s *Store) MemoryUsage(key string) (int64, bool) {
+	s.lock()
+	defer s.unlock()
+
+	val, ok := s.lookup(key)
+	if !ok {
+		return 0, false
+	}
+	return memoryUsage(key, val), true
+}
+
+// AccessInfo returns how long ago key was last accessed and its LFU access
+// counter, without counting as an access itself.
+func (s *Store) AccessInfo(key string) (time.Duration, int, bool) {
+	s.lock()
+	defer s.unlock()
+
+	val, ok := s.data[key]
+	if !ok {
+		return 0, 0, false
+	}
+	if val.IsExpired() {
+		s.deleteExpired(key)
+		return 0, 0, false
+	}
+
+	now := time.Now().UnixMilli()
+	return time.Duration(now-val.accessed) * time.Millisecond, int(lfuDecay(val, now)), true
+}
+
+// FreeMemory evicts keys according to the policy until memory use is back
+// under the limit. It returns ErrOOM if that is not possible, in which case
+// commands that may grow the dataset must be refused.
+func (s *Store) FreeMemory() error {
+	s.memory.mu.Lock()
+	limit, policy := s.memory.limit, s.memory.policy
+	s.memory.mu.Unlock()
+
+	for limit > 0 && s.memory.used.Load() > limit {
+		if policy == NoEviction {
+			return ErrOOM
+		}
+		db, key, ok := s.evictionCandidate(policy)
+		if !ok {
+			return ErrOOM
+		}
+		s.evict(db, key)
+	}
+	return nil
+}
+
+// evictionCandidate picks the key to evict next. The random policies take
+// the first key met in each database in turn; the others, like Redis,
+// sample a few keys of every database and pick the best match.
+func (s *Store) evictionCandidate(policy EvictionPolicy) (*database, string, bool) {
+	if policy == AllKeysRandom || policy == VolatileRandom {
+		s.memory.mu.Lock()
+		start := s.memory.nextDB
+		s.memory.mu.Unlock()
+
+		for i := range s.dbs {
+			db := s.dbs[(start+i)%len(s.dbs)]
+			if key, ok := s.view(db).sampleKeys(policy, 1, nil); ok {
+				s.memory.mu.Lock()
+				s.memory.nextDB = db.id + 1
+				s.memory.mu.Unlock()
+				return db, key, true
+			}
+		}
+		return nil, "", false
+	}
+
+	var best *database
+	var bestKey string
+	bestScore := 0.0
+	now := time.Now().UnixMilli()
+	for _, db := range s.dbs {
+		s.view(db).sampleKeys(policy, evictionSamples, func(key string, val MapValue) {
+			score := evictionScore(policy, val, now)
+			if best == nil || score > bestScore {
+				best, bestKey, bestScore = db, key, score
+			}
+		})
+	}
+	return best, bestKey, best != nil
+}
+
+// sampleKeys calls visit with up to n keys of the selected database that
+// the policy may evict, starting from a random point, and returns the last
+// key visited.
+func (s *Store) sampleKeys(policy EvictionPolicy, n int, visit func(key string, val MapValue)) (string, bool) {
+	s.lock()
+	defer s.unlock()
+
+	last, sampled := "", 0
+	sample := func(key string) bool {
+		if sampled >= n {
+			return false
+		}
+		sampled++
+		last = key
+		if visit != nil {
+			visit(key, s.data[key])
+		}
+		return true
+	}
+
+	if policy.volatile() {
+		for key := range s.expires {
+			if !sample(key) {
+				break
+			}
+		}
+	} else {
+		for key := range s.data {
+			if !sample(key) {
+				break
+			}
+		}
+	}
+	return last, sampled > 0
+}
+
+// evictionScore rates val as an eviction victim; the highest score goes
+// first.
+func evictionScore(policy EvictionPolicy, val MapValue, now int64) float64 {
+	switch policy {
+	case AllKeysLFU, VolatileLFU:
+		return float64(255 - int(lfuDecay(val, now)))
+	case VolatileTTL:
+		return -float64(val.Expiry.UnixMilli())
+	default:
+		return float64(now - val.accessed)
+	}
+}
+
+// evict deletes key from db if it still exists.
+func (s *Store) evict(db *database, key string) {
+	view := s.view(db)
+	view.lock()
+	_, ok := view.data[key]
+	if ok {
+		view.deleteKey(key)
+	}
+	view.unlock()
+	if !ok {
+		return
+	}
+
+	s.memory.mu.Lock()
+	s.memory.evictedKeys++
+	onEvict := s.memory.onEvict
+	s.memory.mu.Unlock()
+
+	if onEvict != nil {
+		onEvict(db.id, key)
+	}
+}
+
+// Approximate per-allocation overheads in bytes, used to estimate memory.
+const (
+	keyOverhead         = 64 // map entry, key and value headers
+	listEntryOverhead   = 16
+	hashEntryOverhead   = 48
+	setEntryOverhead    = 48 // map entry plus list slot
+	zsetEntryOverhead   = 64 // map entry plus skiplist node
+	streamEntryOverhead = 64
+)
+
+// memoryUsage estimates the memory held by key and val. Collections keep a
+// running count of their bytes, so this runs in constant time.
+func memoryUsage(key string, val MapValue) int64 {
+	size := keyOverhead + len(key)
+	switch val.Typ {
+	case "string":
+		size += len(val.String)
+	case "list":
+		size += val.List.bytes + val.List.size*listEntryOverhead
+	case "hash":
+		size += val.Hash.bytes + len(val.Hash.fields)*hashEntryOverhead
+	case "set":
+		size += val.Set.bytes + len(val.Set.members)*setEntryOverhead
+	case "zset":
+		size += val.SortedSet.bytes + len(val.SortedSet.scores)*zsetEntryOverhead
+	case "stream":
+		size += val.Stream.bytes + val.Stream.size*streamEntryOverhead
+	}
+	return int64(size)
+}
+
+// lock takes the write lock of the selected database.
+func (s *Store) lock() {
+	s.mu.Lock()
+}
+
+// unlock serves the clients blocked on keys written under the write lock,
+// settles the keys touched and releases it, then publishes the effects
+// recorded meanwhile.
+func (s *Store) unlock() {
+	caused := len(s.pending)
+	s.serveReady()
+	s.settle()
+	effects := s.pending
+	s.pending = nil
+	s.mu.Unlock()
+	s.publish(effects, caused)
+}
+
+// touch records an access to key. Its size and access metadata are brought
+// up to date when the lock is released, once the caller has finished
+// changing the value. Callers must hold the write lock.
+func (s *Store) touch(key string) {
+	s.touched[key] = struct{}{}
+}
+
+// settle recomputes the size of every touched key and records the access
+// for the LRU and LFU policies. Callers must hold the write lock.
+func (s *Store) settle() {
+	if len(s.touched) == 0 {
+		return
+	}
+
+	now := time.Now().UnixMilli()
+	for key := range s.touched {
+		s.recount(key)
+		if val, ok := s.data[key]; ok {
+			val.freq = lfuIncr(lfuDecay(val, now))
+			val.accessed = now
+			s.data[key] = val
+		}
+	}
+	clear(s.touched)
+}
+
+// recount brings the memory accounted to key up to date. Callers must hold
+// the write lock.
+func (s *Store) recount(key string) {
+	val, ok := s.data[key]
+	if !ok {
+		return
+	}
+	size := memoryUsage(key, val)
+	s.account(size - val.size)
+	val.size = size
+	s.data[key] = val
+}
+
+// account adds delta bytes to the memory used by the selected database.
+// Callers must hold the write lock.
+func (s *Store) account(delta int64) {
+	s.usedMemory += delta
+	s.memory.used.Add(delta)
+}
+
+// LFU tuning, after Redis' lfu-log-factor and lfu-decay-time.
+const (
+	lfuInitVal   = 5
+	lfuLogFactor = 10
+	lfuDecayTime = time.Minute
+)
+
+// lfuDecay returns the access counter of val, decremented once for every
+// lfuDecayTime elapsed since the last access.
+func lfuDecay(val MapValue, now int64) uint8 {
+	periods := (now - val.accessed) / lfuDecayTime.Milliseconds()
+	if periods >= int64(val.freq) {
+		return 0
+	}
+	return val.freq - uint8(periods)
+}
+
+// lfuIncr increments counter with a probability that falls as it grows, so
+// that eight bits cover access counts in the millions.
+func lfuIncr(counter uint8) uint8 {
+	if counter == 255 {
+		return counter
+	}
+	base := float64(counter) - lfuInitVal
+	if base < 0 {
+		base = 0
+	}
+	if rand.Float64() < 1/(base*lfuLogFactor+1) {
+		counter++
+	}
+	return counter
+}
@@ -0,0 +1,220 @@
+package structures
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// checkAccounting verifies that the memory in use matches the sum of the
+// current size of every key.
+func checkAccounting(t *testing.T, s *Store) {
+	t.Helper()
+	var want int64
+	for _, db := range s.dbs {
+		for key, val := range db.data {
+			want += memoryUsage(key, val)
+		}
+	}
+	if got := s.MemoryStats().Used; got != want {
+		t.Errorf("used memory = %d, want %d", got, want)
+	}
+}
+
+func TestStore_MemoryAccounting(t *testing.T) {
+	s := NewStore()
+	db1 := mustSelect(t, s, 1)
+
+	s.Set("str", "value", time.Time{})
+	s.Append("str", "more")
+	s.RPush("list", false, "a", "bb", "ccc")
+	s.LPop("list", 1)
+	s.LSet("list", 0, "longer value")
+	s.HSet("hash", map[string]string{"f": "v", "g": "w"})
+	s.HDel("hash", "g")
+	s.SAdd("set", "x", "y")
+	s.ZAdd("zset", ZAddOptions{}, []ScoredMember{{"m", 1}})
+	s.XAdd("stream", "1-1", map[string]string{"k": "v"})
+	db1.Set("other", "v", time.Time{})
+	checkAccounting(t, s)
+
+	usage, ok := s.MemoryUsage("list")
+	if !ok || usage <= keyOverhead {
+		t.Errorf("MemoryUsage(list) = (%d, %v), want more than the key overhead", usage, ok)
+	}
+
+	s.Move("str", 2)
+	s.Copy("hash", "hash", 3, false)
+	s.SwapDB(0, 1)
+	checkAccounting(t, s)
+
+	s.Del("list")
+	db1.FlushDB()
+	checkAccounting(t, s)
+
+	s.FlushAll()
+	if used := s.MemoryStats().Used; used != 0 {
+		t.Errorf("used memory after FLUSHALL = %d, want 0", used)
+	}
+}
+
+func TestStore_FreeMemory_NoEviction(t *testing.T) {
+	s := NewStore()
+	s.Set("k", "v", time.Time{})
+	s.SetMaxMemory(1, NoEviction)
+
+	if err := s.FreeMemory(); err != ErrOOM {
+		t.Errorf("FreeMemory() error = %v, want ErrOOM", err)
+	}
+	if s.DBSize() != 1 {
+		t.Error("noeviction must not delete keys")
+	}
+
+	s.SetMaxMemory(0, NoEviction)
+	if err := s.FreeMemory(); err != nil {
+		t.Errorf("FreeMemory() without a limit error = %v, want nil", err)
+	}
+}
+
+func TestStore_FreeMemory_LRU(t *testing.T) {
+	s := NewStore()
+	for i := range 20 {
+		s.Set(fmt.Sprintf("old:%d", i), "v", time.Time{})
+	}
+	// Age every key, then use the two that should survive.
+	for key, val := range s.data {
+		val.accessed -= time.Hour.Milliseconds()
+		s.data[key] = val
+	}
+	s.Set("new:1", "v", time.Time{})
+	s.Set("new:2", "v", time.Time{})
+	s.Get("new:1")
+
+	s.SetMaxMemory(s.MemoryStats().Used-1, AllKeysLRU)
+	if err := s.FreeMemory(); err != nil {
+		t.Fatalf("FreeMemory() error = %v", err)
+	}
+	if s.Exists("new:1", "new:2") != 2 {
+		t.Error("allkeys-lru evicted a recently used key before idle ones")
+	}
+	if stats := s.MemoryStats(); stats.EvictedKeys != 1 || stats.Used > stats.MaxMemory {
+		t.Errorf("MemoryStats = %+v, want one eviction bringing use under the limit", stats)
+	}
+}
+
+func TestStore_FreeMemory_LFU(t *testing.T) {
+	s := NewStore()
+	for i := range 20 {
+		s.Set(fmt.Sprintf("rare:%d", i), "v", time.Time{})
+	}
+	s.Set("hot", "v", time.Time{})
+	val := s.data["hot"]
+	val.freq = 200
+	s.data["hot"] = val
+
+	s.SetMaxMemory(s.MemoryStats().Used/2, AllKeysLFU)
+	if err := s.FreeMemory(); err != nil {
+		t.Fatalf("FreeMemory() error = %v", err)
+	}
+	if s.Exists("hot") != 1 {
+		t.Error("allkeys-lfu evicted the most frequently used key")
+	}
+}
+
+func TestStore_FreeMemory_Volatile(t *testing.T) {
+	s := NewStore()
+	s.Set("persistent", "v", time.Time{})
+	s.Set("soon", "v", time.Now().Add(time.Minute))
+	s.Set("later", "v", time.Now().Add(time.Hour))
+
+	s.SetMaxMemory(s.MemoryStats().Used-1, VolatileTTL)
+	if err := s.FreeMemory(); err != nil {
+		t.Fatalf("FreeMemory() error = %v", err)
+	}
+	if s.Exists("soon") != 0 || s.Exists("later", "persistent") != 2 {
+		t.Error("volatile-ttl should evict the key closest to expiring")
+	}
+
+	// Once only keys without a TTL are left, volatile policies give up.
+	s.SetMaxMemory(1, VolatileRandom)
+	if err := s.FreeMemory(); err != ErrOOM {
+		t.Errorf("FreeMemory() error = %v, want ErrOOM", err)
+	}
+	if s.Exists("persistent") != 1 {
+		t.Error("volatile policies must never evict keys without a TTL")
+	}
+}
+
+func TestStore_FreeMemory_RandomAcrossDatabases(t *testing.T) {
+	s := NewStore()
+	db5 := mustSelect(t, s, 5)
+	s.Set("a", "v", time.Time{})
+	db5.Set("b", "v", time.Time{})
+
+	var evicted []string
+	s.OnEvict(func(db int, key string) {
+		evicted = append(evicted, fmt.Sprintf("%d:%s", db, key))
+	})
+	s.SetMaxMemory(1, AllKeysRandom)
+
+	if err := s.FreeMemory(); err != nil {
+		t.Errorf("FreeMemory() error = %v, want nil once every key is gone", err)
+	}
+	if len(evicted) != 2 || s.DBSize()+db5.DBSize() != 0 {
+		t.Errorf("evicted %v, want both keys", evicted)
+	}
+}
+
+func TestStore_AccessInfo(t *testing.T) {
+	s := NewStore()
+	s.Set("k", "v", time.Time{})
+	val := s.data["k"]
+	val.accessed -= time.Minute.Milliseconds()
+	s.data["k"] = val
+
+	idle, freq, ok := s.AccessInfo("k")
+	if !ok || idle < time.Minute || freq < lfuInitVal-1 {
+		t.Errorf("AccessInfo = (%v, %d, %v), want about a minute idle", idle, freq, ok)
+	}
+
+	// TOUCH, like any read, counts as an access.
+	s.Exists("k")
+	if idle, _, _ := s.AccessInfo("k"); idle > time.Second {
+		t.Errorf("idle time after access = %v, want about 0", idle)
+	}
+	if _, _, ok := s.AccessInfo("missing"); ok {
+		t.Error("AccessInfo of a missing key should report false")
+	}
+}
+
+func TestLFUCounter(t *testing.T) {
+	now := time.Now().UnixMilli()
+	val := MapValue{freq: 10, accessed: now - 3*lfuDecayTime.Milliseconds()}
+	if got := lfuDecay(val, now); got != 7 {
+		t.Errorf("lfuDecay after three periods = %d, want 7", got)
+	}
+	if got := lfuDecay(MapValue{freq: 2, accessed: 0}, now); got != 0 {
+		t.Errorf("lfuDecay never goes below 0, got %d", got)
+	}
+	if got := lfuIncr(255); got != 255 {
+		t.Errorf("lfuIncr(255) = %d, want 255", got)
+	}
+	if got := lfuIncr(0); got != 1 {
+		t.Errorf("lfuIncr(0) = %d, want 1 as new keys always count", got)
+	}
+}
+
+func TestParseEvictionPolicy(t *testing.T) {
+	for _, name := range []string{"noeviction", "allkeys-lru", "ALLKEYS-LFU", "allkeys-random", "volatile-lru", "volatile-lfu", "volatile-random", "volatile-ttl"} {
+		policy, err := ParseEvictionPolicy(name)
+		if err != nil {
+			t.Errorf("ParseEvictionPolicy(%q) error = %v", name, err)
+		}
+		if policy.String() == "" {
+			t.Errorf("policy %q has no name", name)
+		}
+	}
+	if _, err := ParseEvictionPolicy("lru"); err == nil {
+		t.Error("ParseEvictionPolicy(lru) should fail")
+	}
+}
@@ -4,11 +4,48 @@ import "time"
 
 // MapValue represents a value stored in the Redis database.
 type MapValue struct {
-	Typ    string
-	Stream *Stream
-	String string
-	Expiry time.Time
+	Typ       string
+	Stream    *Stream
+	List      *List
+	Hash      *Hash
+	Set       *Set
+	SortedSet *SortedSet
+	String    string
+	Expiry    time.Time
+
+	// The fields below are maintained by the Store for memory accounting
+	// and eviction.
+
+	// size is the memory accounted to the key.
+	size int64
+	// accessed is the unix time in milliseconds of the last access.
+	accessed int64
+	// freq is the logarithmic access counter used by the LFU policies.
+	freq uint8
 }
 
 // RedisDB is the underlying map type for the store.
 type RedisDB = map[string]MapValue
+
+// IsExpired reports whether the value has an expiry that is in the past.
+func (v MapValue) IsExpired() bool {
+	return !v.Expiry.IsZero() && v.Expiry.Before(time.Now())
+}
+
+// Clone returns a copy of the value whose aggregate data is independent of
+// the original.
+func (v MapValue) Clone() MapValue {
+	switch v.Typ {
+	case "list":
+		v.List = v.List.Clone()
+	case "hash":
+		v.Hash = v.Hash.Clone()
+	case "set":
+		v.Set = v.Set.Clone()
+	case "zset":
+		v.SortedSet = v.SortedSet.Clone()
+	case "stream":
+		v.Stream = v.Stream.Clone()
+	}
+	return v
+}
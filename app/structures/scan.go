@@ -0,0 +1,91 @@
+package structures
+
+import (
+	"hash/maphash"
+	"math"
+)
+
+// The SCAN family walks members in the order of a seeded 32-bit hash kept
+// in a scanIndex, and the cursor it hands out is simply the next hash value
+// to visit. A member's hash never changes, so however the collection grows
+// or shrinks between calls, every member present for the whole iteration
+// lies either behind the cursor, already returned, or ahead of it, still to
+// come. Members sharing a hash are always visited together so that a
+// cursor never splits them.
+
+// scanSeed keys the hash, so that clients cannot craft members that
+// collide and force one call to return an arbitrarily large batch.
+var scanSeed = maphash.MakeSeed()
+
+// scanHash returns the SCAN position of member.
+func scanHash(member string) float64 {
+	return float64(uint32(maphash.String(scanSeed, member)))
+}
+
+// scanIndex orders members by scanHash.
+type scanIndex struct {
+	list *skiplist
+}
+
+func newScanIndex() *scanIndex {
+	return &scanIndex{list: newSkiplist()}
+}
+
+// add indexes member, which must not be indexed yet.
+func (x *scanIndex) add(member string) {
+	x.list.insert(scanHash(member), member)
+}
+
+// remove drops member from the index.
+func (x *scanIndex) remove(member string) {
+	x.list.delete(scanHash(member), member)
+}
+
+// scan calls visit for the members from cursor onwards until about count
+// have been visited, and returns the cursor to continue from, which is 0
+// once the iteration is complete. visit may remove the member it is given.
+func (x *scanIndex) scan(cursor uint64, count int, visit func(member string)) uint64 {
+	if cursor > math.MaxUint32 {
+		return 0
+	}
+
+	node := x.list.firstInScoreRange(ScoreRange{Min: float64(cursor), Max: math.Inf(1)})
+	for visited := 0; node != nil; {
+		hash := node.score
+		for node != nil && node.score == hash {
+			member, next := node.member, node.level[0].forward
+			visit(member)
+			visited++
+			node = next
+		}
+
+		if visited >= count && node != nil {
+			return uint64(hash) + 1
+		}
+	}
+	return 0
+}
+
+// Scan returns keys from the position cursor onwards, visiting about count
+// of them, together with the cursor to continue from, which is 0 once the
+// iteration is complete. Keys are only returned if they match pattern (all
+// do when it is empty) and, when typ is set, hold a value of that type.
+// Expired keys met on the way are reclaimed.
+func (s *Store) Scan(cursor uint64, count int, pattern, typ string) (uint64, []string) {
+	s.lock()
+	defer s.unlock()
+
+	keys := []string{}
+	next := s.keyIndex.scan(cursor, count, func(key string) {
+		val := s.data[key]
+		switch {
+		case val.IsExpired():
+			s.deleteExpired(key)
+		case typ != "" && val.Typ != typ:
+		case pattern != "" && !MatchGlob(pattern, key):
+		default:
+			keys = append(keys, key)
+		}
+	})
+	return next, keys
+}
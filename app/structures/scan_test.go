@@ -0,0 +1,196 @@
+package structures
+
+import (
+	"fmt"
+	"math"
+	"testing"
+	"time"
+)
+
+// scanAll iterates a full SCAN, calling between after every call.
+func scanAll(s *Store, count int, pattern, typ string, between func()) map[string]int {
+	seen := map[string]int{}
+	cursor := uint64(0)
+	for {
+		next, keys := s.Scan(cursor, count, pattern, typ)
+		for _, k := range keys {
+			seen[k]++
+		}
+		if next == 0 {
+			return seen
+		}
+		cursor = next
+		between()
+	}
+}
+
+func TestStore_Scan_ReturnsEveryKeyOnce(t *testing.T) {
+	s := NewStore()
+	for i := range 1000 {
+		s.Set(fmt.Sprintf("key:%d", i), "v", time.Time{})
+	}
+
+	seen := scanAll(s, 10, "", "", func() {})
+	if len(seen) != 1000 {
+		t.Errorf("SCAN returned %d distinct keys, want 1000", len(seen))
+	}
+	for k, n := range seen {
+		if n != 1 {
+			t.Errorf("key %q returned %d times", k, n)
+		}
+	}
+}
+
+func TestStore_Scan_WhileKeyspaceChanges(t *testing.T) {
+	s := NewStore()
+	for i := range 500 {
+		s.Set(fmt.Sprintf("stable:%d", i), "v", time.Time{})
+		s.Set(fmt.Sprintf("doomed:%d", i), "v", time.Time{})
+	}
+
+	added, removed := 0, 0
+	seen := scanAll(s, 20, "", "", func() {
+		// Grow and shrink the keyspace between calls.
+		for range 50 {
+			s.Set(fmt.Sprintf("new:%d", added), "v", time.Time{})
+			added++
+		}
+		for range 25 {
+			if removed < 500 {
+				s.Del(fmt.Sprintf("doomed:%d", removed))
+				removed++
+			}
+		}
+	})
+
+	for i := range 500 {
+		if seen[fmt.Sprintf("stable:%d", i)] != 1 {
+			t.Fatalf("stable:%d returned %d times, want exactly once", i, seen[fmt.Sprintf("stable:%d", i)])
+		}
+	}
+}
+
+func TestStore_Scan_Filters(t *testing.T) {
+	s := NewStore()
+	s.Set("user:1", "v", time.Time{})
+	s.Set("user:2", "v", time.Time{})
+	s.RPush("user:list", false, "a")
+	s.Set("other", "v", time.Time{})
+	s.Set("user:expired", "v", time.Now().Add(-time.Second))
+
+	seen := scanAll(s, 100, "user:*", "string", func() {})
+	if len(seen) != 2 || seen["user:1"] != 1 || seen["user:2"] != 1 {
+		t.Errorf("SCAN MATCH user:* TYPE string = %v, want user:1 and user:2", seen)
+	}
+	if _, ok := s.data["user:expired"]; ok {
+		t.Error("SCAN should reclaim expired keys it visits")
+	}
+}
+
+func TestStore_Scan_Count(t *testing.T) {
+	s := NewStore()
+	for i := range 100 {
+		s.Set(fmt.Sprintf("key:%d", i), "v", time.Time{})
+	}
+
+	next, keys := s.Scan(0, 5, "", "")
+	if next == 0 || len(keys) < 5 || len(keys) > 10 {
+		t.Errorf("Scan COUNT 5 = (%d, %d keys), want a partial batch of about 5", next, len(keys))
+	}
+	if next, keys := s.Scan(0, 1000, "", ""); next != 0 || len(keys) != 100 {
+		t.Errorf("Scan COUNT 1000 = (%d, %d keys), want every key in one call", next, len(keys))
+	}
+	if next, keys := s.Scan(math.MaxUint32+1, 10, "", ""); next != 0 || len(keys) != 0 {
+		t.Errorf("Scan past the hash space = (%d, %v), want (0, [])", next, keys)
+	}
+}
+
+func TestStore_SScan_WhileSetChanges(t *testing.T) {
+	s := NewStore()
+	for i := range 300 {
+		s.SAdd("set", fmt.Sprintf("stable:%d", i), fmt.Sprintf("doomed:%d", i))
+	}
+
+	seen := map[string]int{}
+	cursor, added, removed := uint64(0), 0, 0
+	for {
+		next, members, err := s.SScan("set", cursor, 20, "")
+		if err != nil {
+			t.Fatalf("SScan() error = %v", err)
+		}
+		for _, m := range members {
+			seen[m]++
+		}
+		if next == 0 {
+			break
+		}
+		cursor = next
+		for range 30 {
+			s.SAdd("set", fmt.Sprintf("new:%d", added))
+			added++
+		}
+		for range 15 {
+			if removed < 300 {
+				s.SRem("set", fmt.Sprintf("doomed:%d", removed))
+				removed++
+			}
+		}
+	}
+
+	for i := range 300 {
+		if n := seen[fmt.Sprintf("stable:%d", i)]; n != 1 {
+			t.Fatalf("stable:%d returned %d times, want exactly once", i, n)
+		}
+	}
+}
+
+func TestStore_HScan(t *testing.T) {
+	s := NewStore()
+	s.HSet("h", map[string]string{"name": "ann", "nick": "a", "age": "30", "gone": "x"})
+	s.HExpire("h", time.Now().Add(-time.Second), "", []string{"gone"})
+
+	next, items, err := s.HScan("h", 0, 100, "n*", false)
+	if err != nil || next != 0 || len(items) != 4 {
+		t.Fatalf("HScan MATCH n* = (%d, %v, %v), want both n* pairs", next, items, err)
+	}
+	got := map[string]string{items[0]: items[1], items[2]: items[3]}
+	if got["name"] != "ann" || got["nick"] != "a" {
+		t.Errorf("HScan MATCH n* = %v, want name and nick with their values", got)
+	}
+
+	_, items, _ = s.HScan("h", 0, 100, "", true)
+	if len(items) != 3 {
+		t.Errorf("HScan NOVALUES = %v, want the three live fields", items)
+	}
+
+	if next, items, err := s.HScan("missing", 0, 10, "", false); err != nil || next != 0 || len(items) != 0 {
+		t.Errorf("HScan on missing key = (%d, %v, %v), want (0, [], nil)", next, items, err)
+	}
+	s.Set("str", "v", time.Time{})
+	if _, _, err := s.HScan("str", 0, 10, "", false); err != ErrWrongType {
+		t.Errorf("HScan on string error = %v, want ErrWrongType", err)
+	}
+}
+
+func TestStore_ZScan(t *testing.T) {
+	s := NewStore()
+	s.ZAdd("z", ZAddOptions{}, []ScoredMember{{"a", 1}, {"b", 2.5}, {"c", 3}})
+
+	_, members, err := s.ZScan("z", 0, 100, "[ab]")
+	if err != nil || len(members) != 2 {
+		t.Fatalf("ZScan MATCH [ab] = (%v, %v), want a and b", members, err)
+	}
+	for _, m := range members {
+		if want := map[string]float64{"a": 1, "b": 2.5}[m.Member]; m.Score != want {
+			t.Errorf("ZScan returned %s with score %v, want %v", m.Member, m.Score, want)
+		}
+	}
+
+	// Members added or removed after the index is built are tracked.
+	s.ZAdd("z", ZAddOptions{}, []ScoredMember{{"d", 4}, {"a", 10}})
+	s.ZRem("z", "b")
+	_, members, _ = s.ZScan("z", 0, 100, "")
+	if len(members) != 3 {
+		t.Errorf("ZScan after updates = %v, want a, c and d", members)
+	}
+}
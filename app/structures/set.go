@@ -0,0 +1,142 @@
+package structures
+
+import "math/rand"
+
+// Set is an unordered collection of unique strings.
+type Set struct {
+	// members maps each member to its position in list, which keeps them
+	// densely packed so Random can pick one in constant time.
+	members map[string]int
+	list    []string
+	// bytes is the total length of the members, for memory accounting.
+	bytes int
+	// index orders the members for SSCAN. It is built by the first scan and
+	// maintained from then on.
+	index *scanIndex
+}
+
+// NewSet creates a new empty Set.
+func NewSet() *Set {
+	return &Set{members: make(map[string]int)}
+}
+
+// Len returns the number of members in the set.
+func (s *Set) Len() int {
+	return len(s.members)
+}
+
+// Clone returns an independent copy of the set.
+func (s *Set) Clone() *Set {
+	clone := NewSet()
+	for i, m := range s.list {
+		clone.members[m] = i
+	}
+	clone.list = append([]string(nil), s.list...)
+	clone.bytes = s.bytes
+	return clone
+}
+
+// Add inserts member and reports whether it was new.
+func (s *Set) Add(member string) bool {
+	if _, ok := s.members[member]; ok {
+		return false
+	}
+	s.members[member] = len(s.list)
+	s.list = append(s.list, member)
+	s.bytes += len(member)
+	if s.index != nil {
+		s.index.add(member)
+	}
+	return true
+}
+
+// Remove deletes member and reports whether it was present.
+func (s *Set) Remove(member string) bool {
+	i, ok := s.members[member]
+	if !ok {
+		return false
+	}
+	// Move the last member into the hole to keep list packed.
+	last := len(s.list) - 1
+	s.list[i] = s.list[last]
+	s.members[s.list[i]] = i
+	s.list[last] = ""
+	s.list = s.list[:last]
+	delete(s.members, member)
+	s.bytes -= len(member)
+	if s.index != nil {
+		s.index.remove(member)
+	}
+	return true
+}
+
+// Has reports whether member is in the set.
+func (s *Set) Has(member string) bool {
+	_, ok := s.members[member]
+	return ok
+}
+
+// Scan calls visit for the members from cursor onwards, about count of
+// them, and returns the cursor to continue from, which is 0 once every
+// member has been visited.
+func (s *Set) Scan(cursor uint64, count int, visit func(member string)) uint64 {
+	if s.index == nil {
+		s.index = newScanIndex()
+		for m := range s.members {
+			s.index.add(m)
+		}
+	}
+	return s.index.scan(cursor, count, visit)
+}
+
+// Members returns every member of the set in no particular order.
+func (s *Set) Members() []string {
+	return append([]string(nil), s.list...)
+}
+
+// Random returns random members following SRANDMEMBER semantics: a positive
+// count yields up to count distinct members, a negative one exactly -count
+// members that may repeat. Unless count is close to the size of the set, it
+// costs O(count) rather than O(n).
+func (s *Set) Random(count int) []string {
+	n := len(s.list)
+	if n == 0 {
+		return []string{}
+	}
+
+	if count < 0 {
+		// Grow as members are picked rather than trusting -count up front.
+		result := make([]string, 0, min(-count, n))
+		for range -count {
+			result = append(result, s.list[rand.Intn(n)])
+		}
+		return result
+	}
+
+	if count >= n {
+		return s.Members()
+	}
+	if count*3 > n {
+		// Most of the set is wanted: shuffle just the first count positions
+		// of a copy, as picking distinct members at random would mostly hit
+		// ones already taken.
+		members := s.Members()
+		for i := range count {
+			j := i + rand.Intn(n-i)
+			members[i], members[j] = members[j], members[i]
+		}
+		return members[:count]
+	}
+
+	picked := make(map[int]struct{}, count)
+	result := make([]string, 0, count)
+	for len(result) < count {
+		i := rand.Intn(n)
+		if _, ok := picked[i]; ok {
+			continue
+		}
+		picked[i] = struct{}{}
+		result = append(result, s.list[i])
+	}
+	return result
+}
@@ -0,0 +1,231 @@
+package structures
+
+import (
+	"reflect"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestStore_SAdd_SRem(t *testing.T) {
+	s := NewStore()
+
+	added, err := s.SAdd("s", "a", "b", "a")
+	if err != nil || added != 2 {
+		t.Fatalf("SAdd = (%d, %v), want (2, nil)", added, err)
+	}
+	if added, _ := s.SAdd("s", "b", "c"); added != 1 {
+		t.Errorf("SAdd existing = %d, want 1", added)
+	}
+	if s.Type("s") != "set" {
+		t.Errorf("Type(s) = %q, want 'set'", s.Type("s"))
+	}
+
+	members, _ := s.SMembers("s")
+	sort.Strings(members)
+	if !reflect.DeepEqual(members, []string{"a", "b", "c"}) {
+		t.Errorf("SMembers = %v, want [a b c]", members)
+	}
+
+	if removed, _ := s.SRem("s", "a", "missing"); removed != 1 {
+		t.Errorf("SRem = %d, want 1", removed)
+	}
+	s.SRem("s", "b", "c")
+	if s.Type("s") != "none" {
+		t.Error("removing every member should delete the key")
+	}
+}
+
+func TestStore_SIsMember(t *testing.T) {
+	s := NewStore()
+	s.SAdd("s", "a")
+
+	found, err := s.SIsMember("s", "a", "b")
+	if err != nil || !reflect.DeepEqual(found, []bool{true, false}) {
+		t.Errorf("SIsMember = (%v, %v), want ([true false], nil)", found, err)
+	}
+	if found, _ := s.SIsMember("missing", "a"); found[0] {
+		t.Error("SIsMember on missing key should report false")
+	}
+}
+
+func TestStore_SPop(t *testing.T) {
+	s := NewStore()
+	s.SAdd("s", "a", "b", "c")
+
+	popped, err := s.SPop("s", 2)
+	if err != nil || len(popped) != 2 || popped[0] == popped[1] {
+		t.Fatalf("SPop = (%v, %v), want two distinct members", popped, err)
+	}
+	if n, _ := s.SCard("s"); n != 1 {
+		t.Errorf("SCard after SPop = %d, want 1", n)
+	}
+
+	popped, _ = s.SPop("s", 5)
+	if len(popped) != 1 || s.Type("s") != "none" {
+		t.Errorf("SPop beyond size = %v, key type %q", popped, s.Type("s"))
+	}
+	if popped, _ := s.SPop("s", 1); popped != nil {
+		t.Errorf("SPop on missing key = %v, want nil", popped)
+	}
+}
+
+func TestStore_SRandMember(t *testing.T) {
+	s := NewStore()
+	s.SAdd("s", "a", "b")
+
+	distinct, _ := s.SRandMember("s", 5)
+	if len(distinct) != 2 {
+		t.Errorf("SRandMember(5) = %v, want both members", distinct)
+	}
+
+	repeated, _ := s.SRandMember("s", -5)
+	if len(repeated) != 5 {
+		t.Errorf("SRandMember(-5) returned %d members, want 5", len(repeated))
+	}
+	for _, m := range repeated {
+		if m != "a" && m != "b" {
+			t.Errorf("SRandMember returned non-member %q", m)
+		}
+	}
+	if n, _ := s.SCard("s"); n != 2 {
+		t.Error("SRandMember must not remove members")
+	}
+}
+
+func TestSet_Random(t *testing.T) {
+	set := NewSet()
+	for i := range 100 {
+		set.Add(strconv.Itoa(i))
+	}
+
+	// Counts well below the size pick members one by one, those close to it
+	// shuffle a copy; both must return distinct members.
+	for _, count := range []int{1, 10, 40, 99} {
+		got := set.Random(count)
+		seen := make(map[string]bool)
+		for _, m := range got {
+			if !set.Has(m) || seen[m] {
+				t.Errorf("Random(%d) returned %q twice or a non-member", count, m)
+			}
+			seen[m] = true
+		}
+		if len(got) != count {
+			t.Errorf("Random(%d) returned %d members", count, len(got))
+		}
+	}
+	if set.Len() != 100 {
+		t.Errorf("Len after Random = %d, want 100", set.Len())
+	}
+}
+
+func TestSet_RemoveKeepsMembers(t *testing.T) {
+	set := NewSet()
+	set.Add("a")
+	set.Add("b")
+	set.Add("c")
+	set.Remove("a")
+	set.Remove("missing")
+
+	got := set.Members()
+	sort.Strings(got)
+	if !reflect.DeepEqual(got, []string{"b", "c"}) || !set.Has("c") || set.Has("a") {
+		t.Errorf("Members after Remove = %v, want [b c]", got)
+	}
+	for range 10 {
+		if m := set.Random(-1)[0]; m != "b" && m != "c" {
+			t.Errorf("Random(-1) = %q, want b or c", m)
+		}
+	}
+}
+
+func TestStore_SMove(t *testing.T) {
+	s := NewStore()
+	s.SAdd("src", "a")
+
+	moved, err := s.SMove("src", "dst", "a")
+	if err != nil || !moved {
+		t.Fatalf("SMove = (%v, %v), want (true, nil)", moved, err)
+	}
+	if s.Type("src") != "none" || s.Type("dst") != "set" {
+		t.Error("SMove should empty src and create dst")
+	}
+	if moved, _ := s.SMove("src", "dst", "a"); moved {
+		t.Error("SMove of a missing member should report false")
+	}
+
+	s.Set("str", "v", time.Time{})
+	if _, err := s.SMove("dst", "str", "a"); err != ErrWrongType {
+		t.Errorf("SMove to string error = %v, want ErrWrongType", err)
+	}
+	if found, _ := s.SIsMember("dst", "a"); !found[0] {
+		t.Error("SMove with a wrong-type destination must not remove the member")
+	}
+}
+
+func TestStore_SetAlgebra(t *testing.T) {
+	s := NewStore()
+	s.SAdd("a", "1", "2", "3")
+	s.SAdd("b", "2", "3", "4")
+
+	sorted := func(members []string, err error) []string {
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		sort.Strings(members)
+		return members
+	}
+
+	if got := sorted(s.SInter("a", "b")); !reflect.DeepEqual(got, []string{"2", "3"}) {
+		t.Errorf("SInter = %v, want [2 3]", got)
+	}
+	if got := sorted(s.SUnion("a", "b", "missing")); !reflect.DeepEqual(got, []string{"1", "2", "3", "4"}) {
+		t.Errorf("SUnion = %v, want [1 2 3 4]", got)
+	}
+	if got := sorted(s.SDiff("a", "b")); !reflect.DeepEqual(got, []string{"1"}) {
+		t.Errorf("SDiff = %v, want [1]", got)
+	}
+	if got := sorted(s.SInter("a", "missing")); len(got) != 0 {
+		t.Errorf("SInter with missing key = %v, want []", got)
+	}
+
+	s.Set("str", "v", time.Time{})
+	if _, err := s.SUnion("a", "str"); err != ErrWrongType {
+		t.Errorf("SUnion with string error = %v, want ErrWrongType", err)
+	}
+}
+
+func TestStore_SetAlgebraStore(t *testing.T) {
+	s := NewStore()
+	s.SAdd("a", "1", "2")
+	s.SAdd("b", "2")
+	s.Set("dst", "old", time.Time{})
+
+	n, err := s.SUnionStore("dst", "a", "b")
+	if err != nil || n != 2 || s.Type("dst") != "set" {
+		t.Fatalf("SUnionStore = (%d, %v), type %q", n, err, s.Type("dst"))
+	}
+
+	// The destination may also be a source.
+	if n, _ := s.SDiffStore("a", "a", "b"); n != 1 {
+		t.Errorf("SDiffStore into source = %d, want 1", n)
+	}
+
+	if n, _ := s.SInterStore("dst", "a", "b"); n != 0 || s.Type("dst") != "none" {
+		t.Errorf("empty SInterStore = %d, type %q; want 0 and deleted key", n, s.Type("dst"))
+	}
+}
+
+func TestStore_SInterCard(t *testing.T) {
+	s := NewStore()
+	s.SAdd("a", "1", "2", "3", "4")
+	s.SAdd("b", "1", "2", "3")
+
+	if n, _ := s.SInterCard(0, "a", "b"); n != 3 {
+		t.Errorf("SInterCard = %d, want 3", n)
+	}
+	if n, _ := s.SInterCard(2, "a", "b"); n != 2 {
+		t.Errorf("SInterCard LIMIT 2 = %d, want 2", n)
+	}
+}
@@ -0,0 +1,442 @@
+package structures
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+// SortedSet is a set of unique members ordered by score. A map gives O(1)
+// score lookups while a skiplist keeps the ordering for rank and range
+// queries in O(log n).
+type SortedSet struct {
+	scores map[string]float64
+	list   *skiplist
+	// bytes is the total length of the members, for memory accounting.
+	bytes int
+	// index orders the members for ZSCAN. It is built by the first scan and
+	// maintained from then on.
+	index *scanIndex
+}
+
+// ScoredMember is a sorted set member together with its score.
+type ScoredMember struct {
+	Member string
+	Score  float64
+}
+
+// NewSortedSet creates a new empty SortedSet.
+func NewSortedSet() *SortedSet {
+	return &SortedSet{
+		scores: make(map[string]float64),
+		list:   newSkiplist(),
+	}
+}
+
+// Len returns the number of members in the sorted set.
+func (z *SortedSet) Len() int {
+	return len(z.scores)
+}
+
+// Clone returns an independent copy of the sorted set.
+func (z *SortedSet) Clone() *SortedSet {
+	clone := NewSortedSet()
+	for member, score := range z.scores {
+		clone.Add(member, score)
+	}
+	return clone
+}
+
+// Score returns the score of member and whether it exists.
+func (z *SortedSet) Score(member string) (float64, bool) {
+	score, ok := z.scores[member]
+	return score, ok
+}
+
+// Add sets the score of member, inserting it if needed, and reports whether
+// it is new.
+func (z *SortedSet) Add(member string, score float64) bool {
+	current, exists := z.scores[member]
+	if exists {
+		if current == score {
+			return false
+		}
+		z.list.delete(current, member)
+	} else {
+		z.bytes += len(member)
+		if z.index != nil {
+			z.index.add(member)
+		}
+	}
+	z.list.insert(score, member)
+	z.scores[member] = score
+	return !exists
+}
+
+// Remove deletes member and reports whether it existed.
+func (z *SortedSet) Remove(member string) bool {
+	score, ok := z.scores[member]
+	if !ok {
+		return false
+	}
+	z.list.delete(score, member)
+	delete(z.scores, member)
+	z.bytes -= len(member)
+	if z.index != nil {
+		z.index.remove(member)
+	}
+	return true
+}
+
+// Scan calls visit for the members from cursor onwards, about count of
+// them, and returns the cursor to continue from, which is 0 once every
+// member has been visited.
+func (z *SortedSet) Scan(cursor uint64, count int, visit func(member string, score float64)) uint64 {
+	if z.index == nil {
+		z.index = newScanIndex()
+		for member := range z.scores {
+			z.index.add(member)
+		}
+	}
+	return z.index.scan(cursor, count, func(member string) {
+		visit(member, z.scores[member])
+	})
+}
+
+// Rank returns the 0-based position of member in ascending score order, or
+// descending order if reverse is set, and whether it exists.
+func (z *SortedSet) Rank(member string, reverse bool) (int, bool) {
+	score, ok := z.scores[member]
+	if !ok {
+		return 0, false
+	}
+	rank := z.list.rank(score, member)
+	if reverse {
+		return z.list.length - rank, true
+	}
+	return rank - 1, true
+}
+
+var (
+	// ErrMinMaxNotFloat is returned when a score range bound is not a float.
+	ErrMinMaxNotFloat = errors.New("ERR min or max is not a float")
+	// ErrMinMaxNotLex is returned when a lex range bound is malformed.
+	ErrMinMaxNotLex = errors.New("ERR min or max not valid string range item")
+)
+
+// ScoreRange is an interval of scores whose ends may be exclusive or
+// infinite.
+type ScoreRange struct {
+	Min, Max                   float64
+	MinExclusive, MaxExclusive bool
+}
+
+// ParseScoreRange parses score bounds such as "1.5", "(2" or "-inf".
+func ParseScoreRange(min, max string) (ScoreRange, error) {
+	var r ScoreRange
+	var err error
+	if r.Min, r.MinExclusive, err = parseScoreBound(min); err != nil {
+		return r, err
+	}
+	if r.Max, r.MaxExclusive, err = parseScoreBound(max); err != nil {
+		return r, err
+	}
+	return r, nil
+}
+
+func parseScoreBound(s string) (float64, bool, error) {
+	exclusive := strings.HasPrefix(s, "(")
+	if exclusive {
+		s = s[1:]
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(v) {
+		return 0, false, ErrMinMaxNotFloat
+	}
+	return v, exclusive, nil
+}
+
+func (r ScoreRange) aboveMin(score float64) bool {
+	if r.MinExclusive {
+		return score > r.Min
+	}
+	return score >= r.Min
+}
+
+func (r ScoreRange) belowMax(score float64) bool {
+	if r.MaxExclusive {
+		return score < r.Max
+	}
+	return score <= r.Max
+}
+
+// LexBound is one end of a LexRange. Inf is -1 for "-", 1 for "+" and 0 for
+// a "[value" or "(value" bound.
+type LexBound struct {
+	Value     string
+	Exclusive bool
+	Inf       int
+}
+
+// below reports whether the bound, taken as a minimum, admits member.
+func (b LexBound) below(member string) bool {
+	switch {
+	case b.Inf != 0:
+		return b.Inf < 0
+	case b.Exclusive:
+		return member > b.Value
+	default:
+		return member >= b.Value
+	}
+}
+
+// above reports whether the bound, taken as a maximum, admits member.
+func (b LexBound) above(member string) bool {
+	switch {
+	case b.Inf != 0:
+		return b.Inf > 0
+	case b.Exclusive:
+		return member < b.Value
+	default:
+		return member <= b.Value
+	}
+}
+
+// LexRange is an interval of members compared byte by byte, used when all
+// members share the same score.
+type LexRange struct {
+	Min, Max LexBound
+}
+
+// ParseLexRange parses lex bounds such as "[a", "(b", "-" or "+".
+func ParseLexRange(min, max string) (LexRange, error) {
+	var r LexRange
+	var err error
+	if r.Min, err = parseLexBound(min); err != nil {
+		return r, err
+	}
+	if r.Max, err = parseLexBound(max); err != nil {
+		return r, err
+	}
+	return r, nil
+}
+
+func parseLexBound(s string) (LexBound, error) {
+	switch {
+	case s == "-":
+		return LexBound{Inf: -1}, nil
+	case s == "+":
+		return LexBound{Inf: 1}, nil
+	case strings.HasPrefix(s, "["):
+		return LexBound{Value: s[1:]}, nil
+	case strings.HasPrefix(s, "("):
+		return LexBound{Value: s[1:], Exclusive: true}, nil
+	default:
+		return LexBound{}, ErrMinMaxNotLex
+	}
+}
+
+// RangeBy selects how a RangeSpec interprets its bounds.
+type RangeBy int
+
+const (
+	RangeByRank RangeBy = iota
+	RangeByScore
+	RangeByLex
+)
+
+// RangeSpec describes a ZRANGE-style query. Start and Stop are used for
+// rank ranges, Score and Lex for the other kinds. Rev walks from the highest
+// score down; Offset and Count apply LIMIT to score and lex ranges, with a
+// negative Count meaning no limit.
+type RangeSpec struct {
+	By          RangeBy
+	Start, Stop int
+	Score       ScoreRange
+	Lex         LexRange
+	Rev         bool
+	Offset      int
+	Count       int
+}
+
+// Range returns the members selected by spec in the order it asks for.
+func (z *SortedSet) Range(spec RangeSpec) []ScoredMember {
+	if spec.By == RangeByRank {
+		return z.rangeByRank(spec.Start, spec.Stop, spec.Rev)
+	}
+	if spec.Offset < 0 {
+		return []ScoredMember{}
+	}
+
+	var x *skiplistNode
+	switch {
+	case spec.By == RangeByScore && spec.Rev:
+		x = z.list.lastInScoreRange(spec.Score)
+	case spec.By == RangeByScore:
+		x = z.list.firstInScoreRange(spec.Score)
+	case spec.Rev:
+		x = z.list.lastInLexRange(spec.Lex)
+	default:
+		x = z.list.firstInLexRange(spec.Lex)
+	}
+
+	// Jump over the offset by rank rather than walking it.
+	if x != nil && spec.Offset > 0 {
+		rank := z.list.rank(x.score, x.member)
+		if spec.Rev {
+			rank -= spec.Offset
+		} else {
+			rank += spec.Offset
+		}
+		x = nil
+		if rank >= 1 {
+			x = z.list.byRank(rank)
+		}
+	}
+
+	result := []ScoredMember{}
+	for ; x != nil && spec.Count != 0; spec.Count-- {
+		if !spec.inRange(x) {
+			break
+		}
+		result = append(result, ScoredMember{Member: x.member, Score: x.score})
+		if spec.Rev {
+			x = x.backward
+		} else {
+			x = x.level[0].forward
+		}
+	}
+	return result
+}
+
+// inRange reports whether x is within the score or lex bounds of spec.
+func (spec RangeSpec) inRange(x *skiplistNode) bool {
+	if spec.By == RangeByScore {
+		return spec.Score.aboveMin(x.score) && spec.Score.belowMax(x.score)
+	}
+	return spec.Lex.Min.below(x.member) && spec.Lex.Max.above(x.member)
+}
+
+// rangeByRank returns the members between the 0-based ranks start and stop,
+// which may be negative to count from the end.
+func (z *SortedSet) rangeByRank(start, stop int, rev bool) []ScoredMember {
+	length := z.Len()
+	if start < 0 {
+		start += length
+	}
+	if stop < 0 {
+		stop += length
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= length {
+		stop = length - 1
+	}
+	if start > stop || start >= length {
+		return []ScoredMember{}
+	}
+
+	result := make([]ScoredMember, 0, stop-start+1)
+	if rev {
+		x := z.list.byRank(length - start)
+		for i := start; i <= stop; i++ {
+			result = append(result, ScoredMember{Member: x.member, Score: x.score})
+			x = x.backward
+		}
+		return result
+	}
+
+	x := z.list.byRank(start + 1)
+	for i := start; i <= stop; i++ {
+		result = append(result, ScoredMember{Member: x.member, Score: x.score})
+		x = x.level[0].forward
+	}
+	return result
+}
+
+// Count returns the number of members with a score within r.
+func (z *SortedSet) Count(r ScoreRange) int {
+	first := z.list.firstInScoreRange(r)
+	if first == nil {
+		return 0
+	}
+	last := z.list.lastInScoreRange(r)
+	return z.list.rank(last.score, last.member) - z.list.rank(first.score, first.member) + 1
+}
+
+// LexCount returns the number of members within r.
+func (z *SortedSet) LexCount(r LexRange) int {
+	first := z.list.firstInLexRange(r)
+	if first == nil {
+		return 0
+	}
+	last := z.list.lastInLexRange(r)
+	return z.list.rank(last.score, last.member) - z.list.rank(first.score, first.member) + 1
+}
+
+// Pop removes and returns up to count members with the lowest scores, or
+// the highest if max is set.
+func (z *SortedSet) Pop(count int, max bool) []ScoredMember {
+	result := []ScoredMember{}
+	for ; count > 0 && z.Len() > 0; count-- {
+		x := z.list.header.level[0].forward
+		if max {
+			x = z.list.tail
+		}
+		result = append(result, ScoredMember{Member: x.member, Score: x.score})
+		z.Remove(x.member)
+	}
+	return result
+}
+
+// Random returns random members following ZRANDMEMBER semantics: a positive
+// count yields up to count distinct members, a negative one exactly -count
+// members that may repeat.
+func (z *SortedSet) Random(count int) []ScoredMember {
+	length := z.Len()
+	if length == 0 {
+		return []ScoredMember{}
+	}
+
+	var ranks []int
+	switch {
+	case count < 0:
+		ranks = make([]int, 0, min(-count, length))
+		for range -count {
+			ranks = append(ranks, rand.Intn(length))
+		}
+	case count >= length:
+		return z.rangeByRank(0, -1, false)
+	case count*3 > length:
+		// Most of the set is wanted: shuffle just the first count positions
+		// of the whole range, as picking distinct ranks at random would
+		// mostly hit ones already taken.
+		members := z.rangeByRank(0, -1, false)
+		for i := range count {
+			j := i + rand.Intn(length-i)
+			members[i], members[j] = members[j], members[i]
+		}
+		return members[:count]
+	default:
+		picked := make(map[int]struct{}, count)
+		ranks = make([]int, 0, count)
+		for len(ranks) < count {
+			rank := rand.Intn(length)
+			if _, ok := picked[rank]; ok {
+				continue
+			}
+			picked[rank] = struct{}{}
+			ranks = append(ranks, rank)
+		}
+	}
+
+	result := make([]ScoredMember, len(ranks))
+	for i, rank := range ranks {
+		x := z.list.byRank(rank + 1)
+		result[i] = ScoredMember{Member: x.member, Score: x.score}
+	}
+	return result
+}
@@ -0,0 +1,411 @@
+package structures
+
+import (
+	"math"
+	"math/rand"
+	"reflect"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestSortedSet_RankMatchesSortedOrder(t *testing.T) {
+	z := NewSortedSet()
+	want := make([]ScoredMember, 0, 500)
+	for i := 0; i < 500; i++ {
+		m := ScoredMember{Member: "m" + strconv.Itoa(i), Score: float64(rand.Intn(50))}
+		z.Add(m.Member, m.Score)
+		want = append(want, m)
+	}
+	// Re-score and remove a few to exercise updates and deletes.
+	for i := 0; i < 100; i++ {
+		want[i].Score = float64(rand.Intn(50))
+		z.Add(want[i].Member, want[i].Score)
+	}
+	for _, m := range want[400:] {
+		z.Remove(m.Member)
+	}
+	want = want[:400]
+
+	sort.Slice(want, func(i, j int) bool {
+		if want[i].Score != want[j].Score {
+			return want[i].Score < want[j].Score
+		}
+		return want[i].Member < want[j].Member
+	})
+
+	if z.Len() != len(want) {
+		t.Fatalf("Len = %d, want %d", z.Len(), len(want))
+	}
+	for i, m := range want {
+		if rank, ok := z.Rank(m.Member, false); !ok || rank != i {
+			t.Fatalf("Rank(%s) = (%d, %v), want %d", m.Member, rank, ok, i)
+		}
+		if rank, _ := z.Rank(m.Member, true); rank != len(want)-1-i {
+			t.Fatalf("reverse Rank(%s) = %d, want %d", m.Member, rank, len(want)-1-i)
+		}
+		if node := z.list.byRank(i + 1); node == nil || node.member != m.Member {
+			t.Fatalf("byRank(%d) = %v, want %s", i+1, node, m.Member)
+		}
+	}
+}
+
+func TestStore_ZAdd_Options(t *testing.T) {
+	s := NewStore()
+
+	added, _, err := s.ZAdd("z", ZAddOptions{}, []ScoredMember{{"a", 1}, {"b", 2}})
+	if err != nil || added != 2 {
+		t.Fatalf("ZAdd = (%d, %v), want (2, nil)", added, err)
+	}
+	if s.Type("z") != "zset" {
+		t.Errorf("Type(z) = %q, want 'zset'", s.Type("z"))
+	}
+
+	tests := []struct {
+		name           string
+		opts           ZAddOptions
+		member         string
+		score          float64
+		added, updated int
+		wantScore      float64
+	}{
+		{"NX skips existing", ZAddOptions{NX: true}, "a", 5, 0, 0, 1},
+		{"XX skips new", ZAddOptions{XX: true}, "c", 5, 0, 0, 0},
+		{"XX updates existing", ZAddOptions{XX: true}, "a", 3, 0, 1, 3},
+		{"GT ignores lower", ZAddOptions{GT: true}, "a", 2, 0, 0, 3},
+		{"GT accepts higher", ZAddOptions{GT: true}, "a", 4, 0, 1, 4},
+		{"LT ignores higher", ZAddOptions{LT: true}, "b", 9, 0, 0, 2},
+		{"LT still adds new", ZAddOptions{LT: true}, "d", 9, 1, 0, 9},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			added, updated, err := s.ZAdd("z", tt.opts, []ScoredMember{{tt.member, tt.score}})
+			if err != nil || added != tt.added || updated != tt.updated {
+				t.Errorf("ZAdd = (%d, %d, %v), want (%d, %d, nil)", added, updated, err, tt.added, tt.updated)
+			}
+			if score, _, _ := s.ZScore("z", tt.member); score != tt.wantScore {
+				t.Errorf("ZScore(%s) = %v, want %v", tt.member, score, tt.wantScore)
+			}
+		})
+	}
+
+	if _, _, err := s.ZAdd("missing", ZAddOptions{XX: true}, []ScoredMember{{"a", 1}}); err != nil || s.Type("missing") != "none" {
+		t.Error("ZADD XX on a missing key must not create it")
+	}
+}
+
+func TestStore_ZIncrBy(t *testing.T) {
+	s := NewStore()
+
+	if score, ok, _ := s.ZIncrBy("z", "a", 2.5, ZAddOptions{}); !ok || score != 2.5 {
+		t.Errorf("ZIncrBy new member = (%v, %v), want (2.5, true)", score, ok)
+	}
+	if score, _, _ := s.ZIncrBy("z", "a", 1, ZAddOptions{}); score != 3.5 {
+		t.Errorf("ZIncrBy = %v, want 3.5", score)
+	}
+	if _, ok, _ := s.ZIncrBy("z", "a", -1, ZAddOptions{GT: true}); ok {
+		t.Error("ZIncrBy GT with a negative delta should not update")
+	}
+
+	s.ZAdd("inf", ZAddOptions{}, []ScoredMember{{"a", math.Inf(1)}})
+	if _, _, err := s.ZIncrBy("inf", "a", math.Inf(-1), ZAddOptions{}); err != ErrScoreNaN {
+		t.Errorf("ZIncrBy to NaN error = %v, want ErrScoreNaN", err)
+	}
+}
+
+func TestStore_ZRank_ZRem(t *testing.T) {
+	s := NewStore()
+	s.ZAdd("z", ZAddOptions{}, []ScoredMember{{"a", 1}, {"b", 2}, {"c", 3}})
+
+	if rank, score, ok, _ := s.ZRank("z", "b", false); !ok || rank != 1 || score != 2 {
+		t.Errorf("ZRank(b) = (%d, %v, %v), want (1, 2, true)", rank, score, ok)
+	}
+	if rank, _, _, _ := s.ZRank("z", "a", true); rank != 2 {
+		t.Errorf("ZREVRANK(a) = %d, want 2", rank)
+	}
+
+	if removed, _ := s.ZRem("z", "a", "b", "c", "x"); removed != 3 {
+		t.Errorf("ZRem = %d, want 3", removed)
+	}
+	if s.Type("z") != "none" {
+		t.Error("removing every member should delete the key")
+	}
+
+	s.Set("str", "v", time.Time{})
+	if _, err := s.ZCard("str"); err != ErrWrongType {
+		t.Errorf("ZCard on string error = %v, want ErrWrongType", err)
+	}
+}
+
+func TestSortedSet_Range(t *testing.T) {
+	z := NewSortedSet()
+	for i, m := range []string{"a", "b", "c", "d", "e"} {
+		z.Add(m, float64(i+1))
+	}
+
+	members := func(ms []ScoredMember) []string {
+		names := make([]string, len(ms))
+		for i, m := range ms {
+			names[i] = m.Member
+		}
+		return names
+	}
+	score := func(min, max string) ScoreRange {
+		r, err := ParseScoreRange(min, max)
+		if err != nil {
+			t.Fatalf("ParseScoreRange(%q, %q): %v", min, max, err)
+		}
+		return r
+	}
+
+	tests := []struct {
+		name string
+		spec RangeSpec
+		want []string
+	}{
+		{"rank all", RangeSpec{Start: 0, Stop: -1}, []string{"a", "b", "c", "d", "e"}},
+		{"rank negative", RangeSpec{Start: -2, Stop: -1}, []string{"d", "e"}},
+		{"rank rev", RangeSpec{Start: 0, Stop: 1, Rev: true}, []string{"e", "d"}},
+		{"rank out of range", RangeSpec{Start: 10, Stop: 20}, []string{}},
+		{"score inclusive", RangeSpec{By: RangeByScore, Score: score("2", "4"), Count: -1}, []string{"b", "c", "d"}},
+		{"score exclusive", RangeSpec{By: RangeByScore, Score: score("(2", "(4"), Count: -1}, []string{"c"}},
+		{"score infinite", RangeSpec{By: RangeByScore, Score: score("-inf", "+inf"), Count: 2}, []string{"a", "b"}},
+		{"score rev", RangeSpec{By: RangeByScore, Score: score("2", "4"), Rev: true, Count: -1}, []string{"d", "c", "b"}},
+		{"score limit", RangeSpec{By: RangeByScore, Score: score("-inf", "inf"), Offset: 1, Count: 2}, []string{"b", "c"}},
+		{"score rev limit", RangeSpec{By: RangeByScore, Score: score("-inf", "inf"), Rev: true, Offset: 3, Count: 5}, []string{"b", "a"}},
+		{"score offset past end", RangeSpec{By: RangeByScore, Score: score("-inf", "inf"), Offset: 9, Count: -1}, []string{}},
+		{"score empty", RangeSpec{By: RangeByScore, Score: score("(3", "3"), Count: -1}, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := members(z.Range(tt.spec)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Range = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if n := z.Count(score("(1", "5")); n != 4 {
+		t.Errorf("Count((1, 5]) = %d, want 4", n)
+	}
+}
+
+func TestSortedSet_LexRange(t *testing.T) {
+	z := NewSortedSet()
+	for _, m := range []string{"a", "b", "c", "d"} {
+		z.Add(m, 0)
+	}
+
+	lex := func(min, max string) LexRange {
+		r, err := ParseLexRange(min, max)
+		if err != nil {
+			t.Fatalf("ParseLexRange(%q, %q): %v", min, max, err)
+		}
+		return r
+	}
+
+	got := z.Range(RangeSpec{By: RangeByLex, Lex: lex("[b", "(d"), Count: -1})
+	if len(got) != 2 || got[0].Member != "b" || got[1].Member != "c" {
+		t.Errorf("Range [b (d = %v, want [b c]", got)
+	}
+	got = z.Range(RangeSpec{By: RangeByLex, Lex: lex("-", "+"), Rev: true, Count: 1})
+	if len(got) != 1 || got[0].Member != "d" {
+		t.Errorf("reverse Range - + = %v, want [d]", got)
+	}
+	if n := z.LexCount(lex("(a", "+")); n != 3 {
+		t.Errorf("LexCount((a, +) = %d, want 3", n)
+	}
+	if n := z.LexCount(lex("+", "-")); n != 0 {
+		t.Errorf("LexCount(+, -) = %d, want 0", n)
+	}
+
+	if _, err := ParseLexRange("a", "+"); err != ErrMinMaxNotLex {
+		t.Errorf("ParseLexRange without prefix error = %v, want ErrMinMaxNotLex", err)
+	}
+	if _, err := ParseScoreRange("(x", "1"); err != ErrMinMaxNotFloat {
+		t.Errorf("ParseScoreRange(\"(x\") error = %v, want ErrMinMaxNotFloat", err)
+	}
+}
+
+func TestStore_ZRangeStore_ZRemRange(t *testing.T) {
+	s := NewStore()
+	s.ZAdd("z", ZAddOptions{}, []ScoredMember{{"a", 1}, {"b", 2}, {"c", 3}})
+
+	n, err := s.ZRangeStore("dst", "z", RangeSpec{Start: 0, Stop: 1})
+	if err != nil || n != 2 || s.Type("dst") != "zset" {
+		t.Fatalf("ZRangeStore = (%d, %v), type %q", n, err, s.Type("dst"))
+	}
+	if n, _ := s.ZRangeStore("dst", "missing", RangeSpec{Start: 0, Stop: -1}); n != 0 || s.Type("dst") != "none" {
+		t.Error("ZRangeStore with an empty result should delete the destination")
+	}
+
+	r, _ := ParseScoreRange("2", "+inf")
+	if removed, _ := s.ZRemRange("z", RangeSpec{By: RangeByScore, Score: r, Count: -1}); removed != 2 {
+		t.Errorf("ZRemRange by score = %d, want 2", removed)
+	}
+	if removed, _ := s.ZRemRange("z", RangeSpec{Start: 0, Stop: -1}); removed != 1 || s.Type("z") != "none" {
+		t.Error("ZRemRange by rank should empty and delete the key")
+	}
+}
+
+func TestStore_ZUnionInterStore(t *testing.T) {
+	s := NewStore()
+	s.ZAdd("a", ZAddOptions{}, []ScoredMember{{"x", 1}, {"y", 2}})
+	s.ZAdd("b", ZAddOptions{}, []ScoredMember{{"y", 3}, {"z", 4}})
+	s.SAdd("plain", "y")
+
+	n, err := s.ZUnionStore("u", []string{"a", "b"}, []float64{2, 1}, AggregateSum)
+	if err != nil || n != 3 {
+		t.Fatalf("ZUnionStore = (%d, %v), want (3, nil)", n, err)
+	}
+	if score, _, _ := s.ZScore("u", "y"); score != 7 {
+		t.Errorf("weighted union score of y = %v, want 7", score)
+	}
+
+	if n, _ := s.ZInterStore("i", []string{"a", "b", "plain"}, nil, AggregateMax); n != 1 {
+		t.Errorf("ZInterStore = %d, want 1", n)
+	}
+	if score, _, _ := s.ZScore("i", "y"); score != 3 {
+		t.Errorf("MAX intersection score of y = %v, want 3", score)
+	}
+
+	if n, _ := s.ZDiffStore("d", []string{"a", "b"}); n != 1 {
+		t.Errorf("ZDiffStore = %d, want 1", n)
+	}
+	if n, _ := s.ZInterStore("d", []string{"a", "missing"}, nil, AggregateSum); n != 0 || s.Type("d") != "none" {
+		t.Error("an empty intersection should delete the destination")
+	}
+
+	s.Set("str", "v", time.Time{})
+	if _, err := s.ZUnionStore("u", []string{"a", "str"}, nil, AggregateSum); err != ErrWrongType {
+		t.Errorf("ZUnionStore with string error = %v, want ErrWrongType", err)
+	}
+}
+
+func TestStore_ZUnionStore_InfinityWeights(t *testing.T) {
+	s := NewStore()
+	s.ZAdd("a", ZAddOptions{}, []ScoredMember{{"x", math.Inf(1)}})
+	s.ZAdd("b", ZAddOptions{}, []ScoredMember{{"x", math.Inf(-1)}})
+
+	// inf + -inf and 0 * inf are both NaN, which Redis stores as 0.
+	s.ZUnionStore("sum", []string{"a", "b"}, nil, AggregateSum)
+	if score, _, _ := s.ZScore("sum", "x"); score != 0 {
+		t.Errorf("inf + -inf = %v, want 0", score)
+	}
+	s.ZUnionStore("zero", []string{"a"}, []float64{0}, AggregateSum)
+	if score, _, _ := s.ZScore("zero", "x"); score != 0 {
+		t.Errorf("0 * inf = %v, want 0", score)
+	}
+}
+
+func TestStore_ZPop(t *testing.T) {
+	s := NewStore()
+	s.ZAdd("z", ZAddOptions{}, []ScoredMember{{"a", 1}, {"b", 2}, {"c", 3}})
+
+	if got, _ := s.ZPop("z", true, 2); len(got) != 2 || got[0].Member != "c" || got[1].Member != "b" {
+		t.Errorf("ZPop max 2 = %v, want [c b]", got)
+	}
+	if key, got, ok, _ := s.ZMPop([]string{"missing", "z"}, false, 5); !ok || key != "z" || len(got) != 1 || got[0].Member != "a" {
+		t.Errorf("ZMPop = (%q, %v), want (z, [a])", key, got)
+	}
+	if s.Type("z") != "none" {
+		t.Error("popping every member should delete the key")
+	}
+	if _, got, ok, _ := s.ZMPop([]string{"z"}, false, 1); ok || got != nil {
+		t.Errorf("ZMPop on an empty key = (%v, %v), want nothing popped", got, ok)
+	}
+
+	s.ZAdd("", ZAddOptions{}, []ScoredMember{{"e", 1}})
+	if key, got, ok, _ := s.ZMPop([]string{""}, false, 1); !ok || key != "" || len(got) != 1 {
+		t.Errorf("ZMPop on the empty key name = (%q, %v, %v), want ('', [e], true)", key, got, ok)
+	}
+}
+
+func TestStore_BZMPop_WokenByZAdd(t *testing.T) {
+	s := NewStore()
+
+	done := make(chan []ScoredMember)
+	go func() {
+		_, members, _, _ := s.BZMPop([]string{"q"}, false, 1, 0)
+		done <- members
+	}()
+	waitBlocked(t, s, "q", 1)
+
+	s.ZAdd("q", ZAddOptions{}, []ScoredMember{{"job", 5}, {"urgent", 1}})
+
+	select {
+	case members := <-done:
+		if len(members) != 1 || members[0].Member != "urgent" {
+			t.Errorf("BZMPop = %v, want [urgent]", members)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("BZMPop was not woken by ZAdd")
+	}
+}
+
+func TestStore_BlockedClientIgnoresWrongType(t *testing.T) {
+	s := NewStore()
+
+	done := make(chan error)
+	go func() {
+		_, _, _, err := s.BLMPop([]string{"k"}, true, 1, 0)
+		done <- err
+	}()
+	waitBlocked(t, s, "k", 1)
+
+	// A sorted set appearing under the key must not wake the list waiter.
+	s.ZAdd("k", ZAddOptions{}, []ScoredMember{{"a", 1}})
+	if s.BlockedCount("k") != 1 {
+		t.Fatal("list waiter should stay blocked when the key becomes a sorted set")
+	}
+
+	s.ZRem("k", "a")
+	s.RPush("k", false, "v")
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("BLMPop error = %v, want nil", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("BLMPop was not woken by RPush")
+	}
+}
+
+func TestSortedSet_Random(t *testing.T) {
+	z := NewSortedSet()
+	z.Add("a", 1)
+	z.Add("b", 2)
+
+	if got := z.Random(5); len(got) != 2 {
+		t.Errorf("Random(5) = %v, want both members", got)
+	}
+	if got := z.Random(1); len(got) != 1 {
+		t.Errorf("Random(1) = %v, want one member", got)
+	}
+	if got := z.Random(-4); len(got) != 4 {
+		t.Errorf("Random(-4) returned %d members, want 4", len(got))
+	}
+}
+
+func TestSortedSet_RandomDistinct(t *testing.T) {
+	z := NewSortedSet()
+	for i := range 100 {
+		z.Add(strconv.Itoa(i), float64(i))
+	}
+
+	// Counts well below the size pick ranks one by one, those close to it
+	// shuffle the whole range; both must return distinct members.
+	for _, count := range []int{1, 10, 40, 99} {
+		got := z.Random(count)
+		seen := make(map[string]bool)
+		for _, m := range got {
+			if score, ok := z.Score(m.Member); !ok || score != m.Score || seen[m.Member] {
+				t.Errorf("Random(%d) returned %v twice or a non-member", count, m)
+			}
+			seen[m.Member] = true
+		}
+		if len(got) != count {
+			t.Errorf("Random(%d) returned %d members", count, len(got))
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package structures
+
+import "errors"
+
+// ErrDBIndexOutOfRange is returned when a database index does not name one
+// of the store's databases.
+var ErrDBIndexOutOfRange = errors.New("ERR DB index is out of range")
+
+// view returns a Store sharing s's databases with db selected.
+func (s *Store) view(db *database) *Store {
+	return &Store{database: db, dbs: s.dbs, stats: s.stats, memory: s.memory, gone: s.gone, effects: s.effects, noWait: s.noWait}
+}
+
+// ForClient returns a view of the store, on the same database, for a client
+// whose connection closes gone when it goes away. Commands blocked through
+// the view then stop waiting as if they had timed out, so that nothing is
+// handed to a client that can no longer receive it.
+func (s *Store) ForClient(gone <-chan struct{}) *Store {
+	client := s.view(s.database)
+	client.gone = gone
+	return client
+}
+
+// WithBlocking returns a view of the store, on the same database, whose
+// blocking commands wait for their keys if block is set. Otherwise they
+// give up straight away when they cannot be served, as if their timeout had
+// already passed, which is how Redis runs them inside MULTI/EXEC.
+func (s *Store) WithBlocking(block bool) *Store {
+	view := s.view(s.database)
+	view.noWait = !block
+	return view
+}
+
+// databaseAt returns the database with the given index.
+func (s *Store) databaseAt(index int) (*database, error) {
+	if index < 0 || index >= len(s.dbs) {
+		return nil, ErrDBIndexOutOfRange
+	}
+	return s.dbs[index], nil
+}
+
+// lockDatabases takes the write locks of a and b, which may be the same
+// database, in a fixed order so that concurrent callers cannot deadlock.
+// It returns the function releasing them.
+func (s *Store) lockDatabases(a, b *database) func() {
+	if a == b {
+		view := s.view(a)
+		view.lock()
+		return view.unlock
+	}
+	if a.id > b.id {
+		a, b = b, a
+	}
+	first, second := s.view(a), s.view(b)
+	first.lock()
+	second.lock()
+	return func() {
+		second.unlock()
+		first.unlock()
+	}
+}
+
+// DB returns the index of the selected database.
+func (s *Store) DB() int {
+	return s.id
+}
+
+// Databases returns the number of databases in the store.
+func (s *Store) Databases() int {
+	return len(s.dbs)
+}
+
+// Select returns a view of the store with the database at index selected.
+// s itself is left unchanged.
+func (s *Store) Select(index int) (*Store, error) {
+	db, err := s.databaseAt(index)
+	if err != nil {
+		return nil, err
+	}
+	return s.view(db), nil
+}
+
+// SwapDB exchanges the contents of two databases, so that views selecting
+// one immediately see the data of the other. Clients blocked in either
+// database are served if the keys they wait for arrived with the swap.
+func (s *Store) SwapDB(a, b int) error {
+	x, err := s.databaseAt(a)
+	if err != nil {
+		return err
+	}
+	y, err := s.databaseAt(b)
+	if err != nil {
+		return err
+	}
+
+	unlock := s.lockDatabases(x, y)
+	defer unlock()
+
+	if x == y {
+		return nil
+	}
+	x.data, y.data = y.data, x.data
+	x.expires, y.expires = y.expires, x.expires
+	x.volatileHashes, y.volatileHashes = y.volatileHashes, x.volatileHashes
+	x.keyIndex, y.keyIndex = y.keyIndex, x.keyIndex
+	x.usedMemory, y.usedMemory = y.usedMemory, x.usedMemory
+
+	s.view(x).signalBlocked()
+	s.view(y).signalBlocked()
+	return nil
+}
+
+// signalBlocked gives every client blocked in the selected database a
+// chance to be served. Callers must hold the write lock.
+func (s *Store) signalBlocked() {
+	for key := range s.blocked {
+		s.signalKey(key)
+	}
+}
+
+// Move transfers key, expiry included, from the selected database to the
+// one at index. It does nothing when the key is missing or already exists
+// there, and reports whether the key was moved.
+func (s *Store) Move(key string, index int) (bool, error) {
+	db, err := s.databaseAt(index)
+	if err != nil {
+		return false, err
+	}
+	if db == s.database {
+		return false, ErrSameObject
+	}
+
+	unlock := s.lockDatabases(s.database, db)
+	defer unlock()
+
+	val, ok := s.lookup(key)
+	if !ok {
+		return false, nil
+	}
+	target := s.view(db)
+	if _, exists := target.lookup(key); exists {
+		return false, nil
+	}
+
+	s.deleteKey(key)
+	target.setKey(key, val)
+	target.signalKey(key)
+	return true, nil
+}
+
+// FlushDB removes every key from the selected database.
+func (s *Store) FlushDB() {
+	s.lock()
+	defer s.unlock()
+
+	s.flush()
+}
+
+// FlushAll removes every key from every database.
+func (s *Store) FlushAll() {
+	for _, db := range s.dbs {
+		s.view(db).FlushDB()
+	}
+}
+
+// flush empties the selected database. The old contents are simply
+// dropped for the garbage collector, so flushing never blocks on the size
+// of the keyspace. Callers must hold the write lock.
+func (s *Store) flush() {
+	s.account(-s.usedMemory)
+	clear(s.touched)
+	s.data = make(RedisDB)
+	s.expires = make(map[string]struct{})
+	s.volatileHashes = make(map[string]struct{})
+	s.keyIndex = newScanIndex()
+}
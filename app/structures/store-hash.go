@@ -0,0 +1,369 @@
+package structures
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"time"
+)
+
+var (
+	// ErrHashNotInteger is returned by HINCRBY when the field is not an integer.
+	ErrHashNotInteger = errors.New("ERR hash value is not an integer")
+	// ErrHashNotFloat is returned by HINCRBYFLOAT when the field is not a float.
+	ErrHashNotFloat = errors.New("ERR hash value is not a float")
+	// ErrOverflow is returned when an increment would overflow a 64-bit integer.
+	ErrOverflow = errors.New("ERR increment or decrement would overflow")
+	// ErrNaNOrInfinity is returned when a float increment yields NaN or ±Inf.
+	ErrNaNOrInfinity = errors.New("ERR increment would produce NaN or Infinity")
+)
+
+// hashAt returns the hash stored at key. When the key is missing it returns
+// nil, or a freshly stored empty hash if create is set. Callers must hold
+// the write lock.
+func (s *Store) hashAt(key string, create bool) (*Hash, error) {
+	val, ok := s.lookup(key)
+	if !ok {
+		if !create {
+			return nil, nil
+		}
+		val = MapValue{
+			Typ:  "hash",
+			Hash: NewHash(),
+		}
+		s.setKey(key, val)
+		return val.Hash, nil
+	}
+
+	if val.Typ != "hash" {
+		return nil, ErrWrongType
+	}
+	return val.Hash, nil
+}
+
+// dropIfEmptyHash removes key when its hash has no fields left, as happens
+// once the last one expires. Callers must hold the write lock.
+func (s *Store) dropIfEmptyHash(key string, hash *Hash) {
+	if hash != nil && hash.Len() == 0 {
+		s.deleteKey(key)
+	}
+}
+
+// HSet sets fields in the hash at key, creating it if needed, and returns
+// the number of fields that were added.
+func (s *Store) HSet(key string, pairs map[string]string) (int, error) {
+	s.lock()
+	defer s.unlock()
+
+	hash, err := s.hashAt(key, true)
+	if err != nil {
+		return 0, err
+	}
+
+	added := 0
+	for field, value := range pairs {
+		if hash.Set(field, value) {
+			added++
+		}
+	}
+	return added, nil
+}
+
+// HSetNX sets field only if it does not exist yet and reports whether it
+// was set.
+func (s *Store) HSetNX(key, field, value string) (bool, error) {
+	s.lock()
+	defer s.unlock()
+
+	hash, err := s.hashAt(key, true)
+	if err != nil {
+		return false, err
+	}
+
+	if _, ok := hash.Get(field); ok {
+		return false, nil
+	}
+	hash.Set(field, value)
+	return true, nil
+}
+
+// HGet returns the value of field in the hash at key.
+func (s *Store) HGet(key, field string) (string, bool, error) {
+	s.lock()
+	defer s.unlock()
+
+	hash, err := s.hashAt(key, false)
+	if err != nil || hash == nil {
+		return "", false, err
+	}
+
+	value, ok := hash.Get(field)
+	s.dropIfEmptyHash(key, hash)
+	return value, ok, nil
+}
+
+// HMGet returns the values of fields in the hash at key, along with whether
+// each one exists.
+func (s *Store) HMGet(key string, fields ...string) ([]string, []bool, error) {
+	s.lock()
+	defer s.unlock()
+
+	hash, err := s.hashAt(key, false)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	values := make([]string, len(fields))
+	found := make([]bool, len(fields))
+	if hash == nil {
+		return values, found, nil
+	}
+
+	for i, field := range fields {
+		values[i], found[i] = hash.Get(field)
+	}
+	s.dropIfEmptyHash(key, hash)
+	return values, found, nil
+}
+
+// HDel removes fields from the hash at key and returns how many existed.
+func (s *Store) HDel(key string, fields ...string) (int, error) {
+	s.lock()
+	defer s.unlock()
+
+	hash, err := s.hashAt(key, false)
+	if err != nil || hash == nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, field := range fields {
+		if hash.Delete(field) {
+			removed++
+		}
+	}
+	s.dropIfEmptyHash(key, hash)
+	return removed, nil
+}
+
+// HGetAll returns every field and value in the hash at key.
+func (s *Store) HGetAll(key string) (map[string]string, error) {
+	s.lock()
+	defer s.unlock()
+
+	hash, err := s.hashAt(key, false)
+	if err != nil {
+		return nil, err
+	}
+	if hash == nil {
+		return map[string]string{}, nil
+	}
+	all := hash.All()
+	s.dropIfEmptyHash(key, hash)
+	return all, nil
+}
+
+// HLen returns the number of fields in the hash at key.
+func (s *Store) HLen(key string) (int, error) {
+	s.lock()
+	defer s.unlock()
+
+	hash, err := s.hashAt(key, false)
+	if err != nil || hash == nil {
+		return 0, err
+	}
+	return hash.Len(), nil
+}
+
+// HIncrBy increments the integer value of field by delta, treating a
+// missing field as 0.
+func (s *Store) HIncrBy(key, field string, delta int64) (int64, error) {
+	s.lock()
+	defer s.unlock()
+
+	hash, err := s.hashAt(key, true)
+	if err != nil {
+		return 0, err
+	}
+
+	var current int64
+	if value, ok := hash.Get(field); ok {
+		current, err = strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return 0, ErrHashNotInteger
+		}
+	}
+
+	if (delta > 0 && current > math.MaxInt64-delta) || (delta < 0 && current < math.MinInt64-delta) {
+		return 0, ErrOverflow
+	}
+
+	current += delta
+	hash.Update(field, strconv.FormatInt(current, 10))
+	return current, nil
+}
+
+// HIncrByFloat increments the float value of field by delta, treating a
+// missing field as 0, and returns the new value as Redis formats it.
+func (s *Store) HIncrByFloat(key, field string, delta float64) (string, error) {
+	s.lock()
+	defer s.unlock()
+
+	hash, err := s.hashAt(key, true)
+	if err != nil {
+		return "", err
+	}
+
+	var current float64
+	if value, ok := hash.Get(field); ok {
+		current, err = strconv.ParseFloat(value, 64)
+		if err != nil || math.IsNaN(current) || math.IsInf(current, 0) {
+			return "", ErrHashNotFloat
+		}
+	}
+
+	current += delta
+	if math.IsNaN(current) || math.IsInf(current, 0) {
+		return "", ErrNaNOrInfinity
+	}
+
+	formatted := formatFloat(current)
+	hash.Update(field, formatted)
+	return formatted, nil
+}
+
+// Per-field results of HEXPIRE and HPERSIST, matching Redis' reply codes.
+const (
+	FieldMissing      = -2
+	FieldNoExpiry     = -1
+	FieldNotUpdated   = 0
+	FieldUpdated      = 1
+	FieldDeletedByTTL = 2
+)
+
+// HExpire sets the expiry of fields in the hash at key to at, subject to
+// cond ("", "NX", "XX", "GT" or "LT"). Fields given an expiry in the past
+// are deleted. It returns one of the Field* codes per field.
+func (s *Store) HExpire(key string, at time.Time, cond string, fields []string) ([]int, error) {
+	s.lock()
+	defer s.unlock()
+
+	result := make([]int, len(fields))
+	hash, err := s.hashAt(key, false)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	for i, field := range fields {
+		if hash == nil {
+			result[i] = FieldMissing
+			continue
+		}
+
+		current, ok := hash.Expiry(field)
+		switch {
+		case !ok:
+			result[i] = FieldMissing
+		case !expireConditionMet(cond, current, at):
+			result[i] = FieldNotUpdated
+		case !at.After(now):
+			hash.Delete(field)
+			result[i] = FieldDeletedByTTL
+		default:
+			hash.SetExpiry(field, at)
+			s.volatileHashes[key] = struct{}{}
+			result[i] = FieldUpdated
+		}
+	}
+
+	s.dropIfEmptyHash(key, hash)
+	return result, nil
+}
+
+// HExpiryTimes returns the expiry of each field in the hash at key, which is
+// zero for fields without one, along with whether each field exists.
+func (s *Store) HExpiryTimes(key string, fields []string) ([]time.Time, []bool, error) {
+	s.lock()
+	defer s.unlock()
+
+	hash, err := s.hashAt(key, false)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	times := make([]time.Time, len(fields))
+	found := make([]bool, len(fields))
+	if hash == nil {
+		return times, found, nil
+	}
+
+	for i, field := range fields {
+		times[i], found[i] = hash.Expiry(field)
+	}
+	s.dropIfEmptyHash(key, hash)
+	return times, found, nil
+}
+
+// HPersist removes the expiry of fields in the hash at key. It returns
+// FieldUpdated, FieldNoExpiry or FieldMissing per field.
+func (s *Store) HPersist(key string, fields []string) ([]int, error) {
+	s.lock()
+	defer s.unlock()
+
+	result := make([]int, len(fields))
+	hash, err := s.hashAt(key, false)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, field := range fields {
+		if hash == nil {
+			result[i] = FieldMissing
+			continue
+		}
+
+		if _, ok := hash.Get(field); !ok {
+			result[i] = FieldMissing
+		} else if hash.Persist(field) {
+			result[i] = FieldUpdated
+		} else {
+			result[i] = FieldNoExpiry
+		}
+	}
+	s.dropIfEmptyHash(key, hash)
+	return result, nil
+}
+
+// formatFloat renders a float the way Redis replies with computed floats:
+// the shortest representation, without exponent or trailing zeros.
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// HScan iterates over the hash at key like SCAN does over the keyspace. It
+// returns the next cursor and field, value pairs for the fields matching
+// pattern, or just the fields if noValues is set. A missing key yields an
+// empty, complete iteration.
+func (s *Store) HScan(key string, cursor uint64, count int, pattern string, noValues bool) (uint64, []string, error) {
+	s.lock()
+	defer s.unlock()
+
+	hash, err := s.hashAt(key, false)
+	if err != nil || hash == nil {
+		return 0, []string{}, err
+	}
+
+	items := []string{}
+	next := hash.Scan(cursor, count, func(field, value string) {
+		if pattern != "" && !MatchGlob(pattern, field) {
+			return
+		}
+		items = append(items, field)
+		if !noValues {
+			items = append(items, value)
+		}
+	})
+	s.dropIfEmptyHash(key, hash)
+	return next, items, nil
+}
@@ -0,0 +1,116 @@
+package structures
+
+import "errors"
+
+// ErrSameObject is returned by COPY when source and destination are the
+// same key.
+var ErrSameObject = errors.New("ERR source and destination objects are the same")
+
+// Del removes keys and returns how many of them existed.
+func (s *Store) Del(keys ...string) int {
+	s.lock()
+	defer s.unlock()
+
+	removed := 0
+	for _, key := range keys {
+		if _, ok := s.lookup(key); ok {
+			s.deleteKey(key)
+			removed++
+		}
+	}
+	return removed
+}
+
+// Exists returns how many of keys exist. A key given several times is
+// counted each time.
+func (s *Store) Exists(keys ...string) int {
+	s.lock()
+	defer s.unlock()
+
+	count := 0
+	for _, key := range keys {
+		if _, ok := s.lookup(key); ok {
+			count++
+		}
+	}
+	return count
+}
+
+// Rename moves the value at src to dst, keeping its expiry and overwriting
+// whatever dst held. With nx set it does nothing when dst exists. It
+// reports whether the value was moved.
+func (s *Store) Rename(src, dst string, nx bool) (bool, error) {
+	s.lock()
+	defer s.unlock()
+
+	val, ok := s.lookup(src)
+	if !ok {
+		return false, ErrNoSuchKey
+	}
+	if src == dst {
+		return !nx, nil
+	}
+	if _, exists := s.lookup(dst); exists && nx {
+		return false, nil
+	}
+
+	s.deleteKey(src)
+	s.setKey(dst, val)
+	s.signalKey(dst)
+	return true, nil
+}
+
+// Copy stores a copy of the value at src, expiry included, under dst in
+// the database at index. Unless replace is set it does nothing when dst
+// exists. It reports whether the value was copied.
+func (s *Store) Copy(src, dst string, index int, replace bool) (bool, error) {
+	db, err := s.databaseAt(index)
+	if err != nil {
+		return false, err
+	}
+	if src == dst && db == s.database {
+		return false, ErrSameObject
+	}
+
+	unlock := s.lockDatabases(s.database, db)
+	defer unlock()
+
+	val, ok := s.lookup(src)
+	if !ok {
+		return false, nil
+	}
+	target := s.view(db)
+	if _, exists := target.lookup(dst); exists && !replace {
+		return false, nil
+	}
+
+	target.setKey(dst, val.Clone())
+	target.signalKey(dst)
+	return true, nil
+}
+
+// RandomKey returns a random live key, or false if the store is empty.
+func (s *Store) RandomKey() (string, bool) {
+	s.lock()
+	defer s.unlock()
+
+	// Map iteration starts at a random position, and expired keys met on
+	// the way are reclaimed.
+	for key, val := range s.data {
+		if val.IsExpired() {
+			s.deleteExpired(key)
+			continue
+		}
+		return key, true
+	}
+	return "", false
+}
+
+// DBSize returns the number of keys in the store. Expired keys that have
+// not been reclaimed yet are included, as in Redis.
+func (s *Store) DBSize() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return len(s.data)
+}
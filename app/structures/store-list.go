@@ -0,0 +1,355 @@
+package structures
+
+import (
+	"errors"
+	"strconv"
+	"time"
+)
+
+var (
+	// ErrNoSuchKey is returned when a command requires an existing key.
+	ErrNoSuchKey = errors.New("ERR no such key")
+	// ErrIndexOutOfRange is returned when a list index is out of bounds.
+	ErrIndexOutOfRange = errors.New("ERR index out of range")
+)
+
+// listAt returns the list stored at key. When the key is missing it returns
+// nil, or a freshly stored empty list if create is set. Callers must hold
+// the write lock.
+func (s *Store) listAt(key string, create bool) (*List, error) {
+	val, ok := s.lookup(key)
+	if !ok {
+		if !create {
+			return nil, nil
+		}
+		val = MapValue{
+			Typ:  "list",
+			List: NewList(),
+		}
+		s.setKey(key, val)
+		return val.List, nil
+	}
+
+	if val.Typ != "list" {
+		return nil, ErrWrongType
+	}
+	return val.List, nil
+}
+
+// dropIfEmptyList removes key when its list has no elements left, as Redis
+// never keeps empty aggregates around. Callers must hold the write lock.
+func (s *Store) dropIfEmptyList(key string, list *List) {
+	if list != nil && list.Len() == 0 {
+		s.deleteKey(key)
+	}
+}
+
+// LPush prepends values to the list at key, creating it if needed, and
+// returns the new length. With onlyIfExists set (LPUSHX) a missing key is
+// left untouched and 0 is returned.
+func (s *Store) LPush(key string, onlyIfExists bool, values ...string) (int, error) {
+	return s.push(key, true, onlyIfExists, values)
+}
+
+// RPush appends values to the list at key, creating it if needed, and
+// returns the new length. With onlyIfExists set (RPUSHX) a missing key is
+// left untouched and 0 is returned.
+func (s *Store) RPush(key string, onlyIfExists bool, values ...string) (int, error) {
+	return s.push(key, false, onlyIfExists, values)
+}
+
+func (s *Store) push(key string, front, onlyIfExists bool, values []string) (int, error) {
+	s.lock()
+	defer s.unlock()
+
+	list, err := s.listAt(key, !onlyIfExists)
+	if err != nil || list == nil {
+		return 0, err
+	}
+
+	for _, v := range values {
+		if front {
+			list.PushFront(v)
+		} else {
+			list.PushBack(v)
+		}
+	}
+	length := list.Len()
+
+	s.signalKey(key)
+	return length, nil
+}
+
+// LPop removes and returns up to count values from the head of the list.
+// It returns nil if the key does not exist.
+func (s *Store) LPop(key string, count int) ([]string, error) {
+	return s.pop(key, true, count)
+}
+
+// RPop removes and returns up to count values from the tail of the list.
+// It returns nil if the key does not exist.
+func (s *Store) RPop(key string, count int) ([]string, error) {
+	return s.pop(key, false, count)
+}
+
+func (s *Store) pop(key string, front bool, count int) ([]string, error) {
+	s.lock()
+	defer s.unlock()
+
+	return s.popFrom(key, front, count)
+}
+
+func popN(list *List, front bool, count int) []string {
+	values := []string{}
+	for i := 0; i < count; i++ {
+		var v string
+		var ok bool
+		if front {
+			v, ok = list.PopFront()
+		} else {
+			v, ok = list.PopBack()
+		}
+		if !ok {
+			break
+		}
+		values = append(values, v)
+	}
+	return values
+}
+
+// LLen returns the length of the list at key, or 0 if it does not exist.
+func (s *Store) LLen(key string) (int, error) {
+	s.lock()
+	defer s.unlock()
+
+	list, err := s.listAt(key, false)
+	if err != nil || list == nil {
+		return 0, err
+	}
+	return list.Len(), nil
+}
+
+// LRange returns the values between start and stop inclusive.
+func (s *Store) LRange(key string, start, stop int) ([]string, error) {
+	s.lock()
+	defer s.unlock()
+
+	list, err := s.listAt(key, false)
+	if err != nil {
+		return nil, err
+	}
+	if list == nil {
+		return []string{}, nil
+	}
+	return list.Range(start, stop), nil
+}
+
+// LIndex returns the value at index in the list at key.
+func (s *Store) LIndex(key string, index int) (string, bool, error) {
+	s.lock()
+	defer s.unlock()
+
+	list, err := s.listAt(key, false)
+	if err != nil || list == nil {
+		return "", false, err
+	}
+
+	value, ok := list.Index(index)
+	return value, ok, nil
+}
+
+// LSet replaces the value at index in the list at key.
+func (s *Store) LSet(key string, index int, value string) error {
+	s.lock()
+	defer s.unlock()
+
+	list, err := s.listAt(key, false)
+	if err != nil {
+		return err
+	}
+	if list == nil {
+		return ErrNoSuchKey
+	}
+	if !list.Set(index, value) {
+		return ErrIndexOutOfRange
+	}
+	return nil
+}
+
+// LInsert inserts value before or after pivot. It returns the new length,
+// -1 when pivot is not found and 0 when the key does not exist.
+func (s *Store) LInsert(key string, before bool, pivot, value string) (int, error) {
+	s.lock()
+	defer s.unlock()
+
+	list, err := s.listAt(key, false)
+	if err != nil || list == nil {
+		return 0, err
+	}
+	return list.Insert(pivot, value, before), nil
+}
+
+// LRem removes occurrences of value from the list at key and returns how
+// many were removed.
+func (s *Store) LRem(key string, count int, value string) (int, error) {
+	s.lock()
+	defer s.unlock()
+
+	list, err := s.listAt(key, false)
+	if err != nil || list == nil {
+		return 0, err
+	}
+
+	removed := list.Remove(count, value)
+	s.dropIfEmptyList(key, list)
+	return removed, nil
+}
+
+// LTrim trims the list at key so that it only contains the given range.
+func (s *Store) LTrim(key string, start, stop int) error {
+	s.lock()
+	defer s.unlock()
+
+	list, err := s.listAt(key, false)
+	if err != nil || list == nil {
+		return err
+	}
+
+	list.Trim(start, stop)
+	s.dropIfEmptyList(key, list)
+	return nil
+}
+
+// LMove atomically pops a value from one end of src and pushes it to one end
+// of dst. It returns false if src does not exist.
+func (s *Store) LMove(src, dst string, fromFront, toFront bool) (string, bool, error) {
+	s.lock()
+	defer s.unlock()
+
+	return s.lmove(src, dst, fromFront, toFront)
+}
+
+// lmove implements LMove. Callers must hold the write lock.
+func (s *Store) lmove(src, dst string, fromFront, toFront bool) (string, bool, error) {
+	list, err := s.listAt(src, false)
+	if err != nil || list == nil {
+		return "", false, err
+	}
+
+	// Check the destination type before touching the source.
+	if val, ok := s.lookup(dst); ok && val.Typ != "list" {
+		return "", false, ErrWrongType
+	}
+
+	values := popN(list, fromFront, 1)
+	s.dropIfEmptyList(src, list)
+
+	target, _ := s.listAt(dst, true)
+	if toFront {
+		target.PushFront(values[0])
+	} else {
+		target.PushBack(values[0])
+	}
+
+	s.signalKey(dst)
+	return values[0], true, nil
+}
+
+// LMPop pops up to count values from the first non-empty list among keys.
+// It returns the key that was popped from and reports false if all lists
+// are empty.
+func (s *Store) LMPop(keys []string, front bool, count int) (string, []string, bool, error) {
+	s.lock()
+	defer s.unlock()
+
+	for _, key := range keys {
+		values, err := s.popFrom(key, front, count)
+		if err != nil {
+			return "", nil, false, err
+		}
+		if values != nil {
+			return key, values, true, nil
+		}
+	}
+	return "", nil, false, nil
+}
+
+// popFrom pops up to count values from key, returning nil if it does not
+// exist. Callers must hold the write lock.
+func (s *Store) popFrom(key string, front bool, count int) ([]string, error) {
+	list, err := s.listAt(key, false)
+	if err != nil || list == nil {
+		return nil, err
+	}
+
+	values := popN(list, front, count)
+	s.dropIfEmptyList(key, list)
+	return values, nil
+}
+
+// BLMPop is the blocking form of LMPop: when every list is empty it waits
+// until a push to one of keys or until timeout elapses (0 waits forever).
+// It reports false on timeout. A pop is recorded as an LPOP or RPOP effect,
+// so that replicas see it right after the push that served it.
+func (s *Store) BLMPop(keys []string, front bool, count int, timeout time.Duration) (string, []string, bool, error) {
+	var (
+		poppedKey string
+		values    []string
+	)
+
+	bc := s.Block(keys, func(key string) (bool, error) {
+		popped, err := s.popFrom(key, front, count)
+		if err != nil || popped == nil {
+			return false, err
+		}
+		poppedKey, values = key, popped
+		s.record(popCommand(front), key, strconv.Itoa(len(popped)))
+		return true, nil
+	})
+
+	served, err := s.Wait(bc, timeout)
+	if !served || err != nil {
+		return "", nil, false, err
+	}
+	return poppedKey, values, true, nil
+}
+
+// BLMove is the blocking form of LMove: when src is empty it waits until a
+// push to src or until timeout elapses (0 waits forever). A move is
+// recorded as an LMOVE effect, like the pops of BLMPop.
+func (s *Store) BLMove(src, dst string, fromFront, toFront bool, timeout time.Duration) (string, bool, error) {
+	var value string
+
+	bc := s.Block([]string{src}, func(string) (bool, error) {
+		v, ok, err := s.lmove(src, dst, fromFront, toFront)
+		if ok {
+			s.record("LMOVE", src, dst, listSide(fromFront), listSide(toFront))
+		}
+		value = v
+		return ok, err
+	})
+
+	served, err := s.Wait(bc, timeout)
+	if !served || err != nil {
+		return "", false, err
+	}
+	return value, true, nil
+}
+
+// popCommand returns the command popping from the front of a list, or from
+// its back.
+func popCommand(front bool) string {
+	if front {
+		return "LPOP"
+	}
+	return "RPOP"
+}
+
+// listSide returns the LMOVE argument naming the front of a list, or its
+// back.
+func listSide(front bool) string {
+	if front {
+		return "LEFT"
+	}
+	return "RIGHT"
+}
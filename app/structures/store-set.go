@@ -0,0 +1,377 @@
+package structures
+
+// setAt returns the set stored at key. When the key is missing it returns
+// nil, or a freshly stored empty set if create is set. Callers must hold the
+// write lock.
+func (s *Store) setAt(key string, create bool) (*Set, error) {
+	val, ok := s.lookup(key)
+	if !ok {
+		if !create {
+			return nil, nil
+		}
+		val = MapValue{
+			Typ: "set",
+			Set: NewSet(),
+		}
+		s.setKey(key, val)
+		return val.Set, nil
+	}
+
+	if val.Typ != "set" {
+		return nil, ErrWrongType
+	}
+	return val.Set, nil
+}
+
+// dropIfEmptySet removes key when its set has no members left. Callers must
+// hold the write lock.
+func (s *Store) dropIfEmptySet(key string, set *Set) {
+	if set != nil && set.Len() == 0 {
+		s.deleteKey(key)
+	}
+}
+
+// SAdd adds members to the set at key, creating it if needed, and returns
+// how many were not already present.
+func (s *Store) SAdd(key string, members ...string) (int, error) {
+	s.lock()
+	defer s.unlock()
+
+	set, err := s.setAt(key, true)
+	if err != nil {
+		return 0, err
+	}
+
+	added := 0
+	for _, m := range members {
+		if set.Add(m) {
+			added++
+		}
+	}
+	return added, nil
+}
+
+// SRem removes members from the set at key and returns how many existed.
+func (s *Store) SRem(key string, members ...string) (int, error) {
+	s.lock()
+	defer s.unlock()
+
+	set, err := s.setAt(key, false)
+	if err != nil || set == nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, m := range members {
+		if set.Remove(m) {
+			removed++
+		}
+	}
+	s.dropIfEmptySet(key, set)
+	return removed, nil
+}
+
+// SMembers returns every member of the set at key.
+func (s *Store) SMembers(key string) ([]string, error) {
+	s.lock()
+	defer s.unlock()
+
+	set, err := s.setAt(key, false)
+	if err != nil {
+		return nil, err
+	}
+	if set == nil {
+		return []string{}, nil
+	}
+	return set.Members(), nil
+}
+
+// SIsMember reports, for each of members, whether it is in the set at key.
+func (s *Store) SIsMember(key string, members ...string) ([]bool, error) {
+	s.lock()
+	defer s.unlock()
+
+	set, err := s.setAt(key, false)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]bool, len(members))
+	if set == nil {
+		return result, nil
+	}
+	for i, m := range members {
+		result[i] = set.Has(m)
+	}
+	return result, nil
+}
+
+// SCard returns the number of members in the set at key.
+func (s *Store) SCard(key string) (int, error) {
+	s.lock()
+	defer s.unlock()
+
+	set, err := s.setAt(key, false)
+	if err != nil || set == nil {
+		return 0, err
+	}
+	return set.Len(), nil
+}
+
+// SPop removes and returns up to count random members of the set at key.
+// It returns nil if the key does not exist.
+func (s *Store) SPop(key string, count int) ([]string, error) {
+	s.lock()
+	defer s.unlock()
+
+	set, err := s.setAt(key, false)
+	if err != nil || set == nil {
+		return nil, err
+	}
+
+	members := set.Random(count)
+	for _, m := range members {
+		set.Remove(m)
+	}
+	s.dropIfEmptySet(key, set)
+	return members, nil
+}
+
+// SRandMember returns random members of the set at key without removing
+// them; see Set.Random for the meaning of count. It returns nil if the key
+// does not exist.
+func (s *Store) SRandMember(key string, count int) ([]string, error) {
+	s.lock()
+	defer s.unlock()
+
+	set, err := s.setAt(key, false)
+	if err != nil || set == nil {
+		return nil, err
+	}
+	return set.Random(count), nil
+}
+
+// SMove atomically moves member from the set at src to the set at dst and
+// reports whether it was moved.
+func (s *Store) SMove(src, dst, member string) (bool, error) {
+	s.lock()
+	defer s.unlock()
+
+	from, err := s.setAt(src, false)
+	if err != nil {
+		return false, err
+	}
+	if val, ok := s.lookup(dst); ok && val.Typ != "set" {
+		return false, ErrWrongType
+	}
+
+	if from == nil || !from.Has(member) {
+		return false, nil
+	}
+	if src == dst {
+		return true, nil
+	}
+
+	from.Remove(member)
+	s.dropIfEmptySet(src, from)
+
+	to, _ := s.setAt(dst, true)
+	to.Add(member)
+	return true, nil
+}
+
+// setsAt returns the sets stored at keys, with nil for missing keys. It
+// fails if any key holds another type. Callers must hold the write lock.
+func (s *Store) setsAt(keys []string) ([]*Set, error) {
+	sets := make([]*Set, len(keys))
+	for i, key := range keys {
+		set, err := s.setAt(key, false)
+		if err != nil {
+			return nil, err
+		}
+		sets[i] = set
+	}
+	return sets, nil
+}
+
+// intersectSets returns the members common to every set, stopping once limit
+// members are found if limit is positive. A nil set counts as empty.
+func intersectSets(sets []*Set, limit int) *Set {
+	result := NewSet()
+	if len(sets) == 0 {
+		return result
+	}
+
+	// Iterate the smallest set and probe the others.
+	smallest := 0
+	for i, set := range sets {
+		if set == nil {
+			return result
+		}
+		if set.Len() < sets[smallest].Len() {
+			smallest = i
+		}
+	}
+
+	for member := range sets[smallest].members {
+		inAll := true
+		for i, set := range sets {
+			if i != smallest && !set.Has(member) {
+				inAll = false
+				break
+			}
+		}
+		if inAll {
+			result.Add(member)
+			if limit > 0 && result.Len() >= limit {
+				break
+			}
+		}
+	}
+	return result
+}
+
+// unionSets returns the members of any of the sets.
+func unionSets(sets []*Set) *Set {
+	result := NewSet()
+	for _, set := range sets {
+		if set == nil {
+			continue
+		}
+		for member := range set.members {
+			result.Add(member)
+		}
+	}
+	return result
+}
+
+// diffSets returns the members of the first set that are in none of the
+// others.
+func diffSets(sets []*Set) *Set {
+	result := NewSet()
+	if len(sets) == 0 || sets[0] == nil {
+		return result
+	}
+
+	for member := range sets[0].members {
+		found := false
+		for _, set := range sets[1:] {
+			if set != nil && set.Has(member) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			result.Add(member)
+		}
+	}
+	return result
+}
+
+// combineSets applies combine to the sets at keys and returns the result.
+func (s *Store) combineSets(keys []string, combine func([]*Set) *Set) ([]string, error) {
+	s.lock()
+	defer s.unlock()
+
+	sets, err := s.setsAt(keys)
+	if err != nil {
+		return nil, err
+	}
+	return combine(sets).Members(), nil
+}
+
+// combineSetsStore applies combine to the sets at keys and stores the result
+// at dst, replacing whatever it held. An empty result deletes dst. It returns
+// the size of the result.
+func (s *Store) combineSetsStore(dst string, keys []string, combine func([]*Set) *Set) (int, error) {
+	s.lock()
+	defer s.unlock()
+
+	sets, err := s.setsAt(keys)
+	if err != nil {
+		return 0, err
+	}
+
+	result := combine(sets)
+	if result.Len() == 0 {
+		s.deleteKey(dst)
+		return 0, nil
+	}
+	s.setKey(dst, MapValue{
+		Typ: "set",
+		Set: result,
+	})
+	return result.Len(), nil
+}
+
+func intersectAll(sets []*Set) *Set {
+	return intersectSets(sets, 0)
+}
+
+// SInter returns the members present in every set at keys.
+func (s *Store) SInter(keys ...string) ([]string, error) {
+	return s.combineSets(keys, intersectAll)
+}
+
+// SUnion returns the members present in any set at keys.
+func (s *Store) SUnion(keys ...string) ([]string, error) {
+	return s.combineSets(keys, unionSets)
+}
+
+// SDiff returns the members of the first set at keys that are not in any of
+// the following ones.
+func (s *Store) SDiff(keys ...string) ([]string, error) {
+	return s.combineSets(keys, diffSets)
+}
+
+// SInterStore stores the intersection of the sets at keys in dst and returns
+// its size.
+func (s *Store) SInterStore(dst string, keys ...string) (int, error) {
+	return s.combineSetsStore(dst, keys, intersectAll)
+}
+
+// SUnionStore stores the union of the sets at keys in dst and returns its
+// size.
+func (s *Store) SUnionStore(dst string, keys ...string) (int, error) {
+	return s.combineSetsStore(dst, keys, unionSets)
+}
+
+// SDiffStore stores the difference of the sets at keys in dst and returns
+// its size.
+func (s *Store) SDiffStore(dst string, keys ...string) (int, error) {
+	return s.combineSetsStore(dst, keys, diffSets)
+}
+
+// SInterCard returns the size of the intersection of the sets at keys. A
+// positive limit stops the computation once that many members are found.
+func (s *Store) SInterCard(limit int, keys ...string) (int, error) {
+	s.lock()
+	defer s.unlock()
+
+	sets, err := s.setsAt(keys)
+	if err != nil {
+		return 0, err
+	}
+	return intersectSets(sets, limit).Len(), nil
+}
+
+// SScan iterates over the set at key like SCAN does over the keyspace,
+// returning the next cursor and the members matching pattern. A missing key
+// yields an empty, complete iteration.
+func (s *Store) SScan(key string, cursor uint64, count int, pattern string) (uint64, []string, error) {
+	s.lock()
+	defer s.unlock()
+
+	set, err := s.setAt(key, false)
+	if err != nil || set == nil {
+		return 0, []string{}, err
+	}
+
+	members := []string{}
+	next := set.Scan(cursor, count, func(member string) {
+		if pattern == "" || MatchGlob(pattern, member) {
+			members = append(members, member)
+		}
+	})
+	return next, members, nil
+}
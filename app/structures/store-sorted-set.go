@@ -0,0 +1,598 @@
+package structures
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"time"
+)
+
+// ErrScoreNaN is returned when an increment makes a score NaN.
+var ErrScoreNaN = errors.New("ERR resulting score is not a number (NaN)")
+
+// ZAddOptions holds the update conditions of ZADD. NX only adds new
+// members, XX only updates existing ones, and GT/LT only update a member
+// when its new score is greater/less than the current one.
+type ZAddOptions struct {
+	NX, XX, GT, LT bool
+}
+
+// zsetAt returns the sorted set stored at key. When the key is missing it
+// returns nil, or a freshly stored empty sorted set if create is set.
+// Callers must hold the write lock.
+func (s *Store) zsetAt(key string, create bool) (*SortedSet, error) {
+	val, ok := s.lookup(key)
+	if !ok {
+		if !create {
+			return nil, nil
+		}
+		val = MapValue{
+			Typ:       "zset",
+			SortedSet: NewSortedSet(),
+		}
+		s.setKey(key, val)
+		return val.SortedSet, nil
+	}
+
+	if val.Typ != "zset" {
+		return nil, ErrWrongType
+	}
+	return val.SortedSet, nil
+}
+
+// dropIfEmptyZSet removes key when its sorted set has no members left.
+// Callers must hold the write lock.
+func (s *Store) dropIfEmptyZSet(key string, zset *SortedSet) {
+	if zset != nil && zset.Len() == 0 {
+		s.deleteKey(key)
+	}
+}
+
+// zadd applies a single ZADD update to zset. It returns the resulting score
+// and whether the member was added or had its score changed; ok is false
+// when the options prevented the update.
+func zadd(zset *SortedSet, opts ZAddOptions, member string, score float64, incr bool) (result float64, added, updated, ok bool, err error) {
+	current, exists := zset.Score(member)
+	if !exists {
+		if opts.XX {
+			return 0, false, false, false, nil
+		}
+		zset.Add(member, score)
+		return score, true, false, true, nil
+	}
+
+	if opts.NX {
+		return current, false, false, false, nil
+	}
+	if incr {
+		score += current
+		if math.IsNaN(score) {
+			return 0, false, false, false, ErrScoreNaN
+		}
+	}
+	if (opts.GT && score <= current) || (opts.LT && score >= current) {
+		return current, false, false, false, nil
+	}
+
+	if score != current {
+		zset.Add(member, score)
+		updated = true
+	}
+	return score, false, updated, true, nil
+}
+
+// ZAdd sets the scores of members in the sorted set at key, subject to opts,
+// and returns how many members were added and how many existing ones had
+// their score changed.
+func (s *Store) ZAdd(key string, opts ZAddOptions, members []ScoredMember) (added, updated int, err error) {
+	s.lock()
+	defer s.unlock()
+
+	zset, err := s.zsetAt(key, !opts.XX)
+	if err != nil || zset == nil {
+		return 0, 0, err
+	}
+
+	for _, m := range members {
+		_, a, u, _, _ := zadd(zset, opts, m.Member, m.Score, false)
+		if a {
+			added++
+		}
+		if u {
+			updated++
+		}
+	}
+
+	s.signalKey(key)
+	return added, updated, nil
+}
+
+// ZIncrBy increments the score of member by delta, subject to opts, and
+// returns the new score. It reports false when opts prevented the update.
+func (s *Store) ZIncrBy(key, member string, delta float64, opts ZAddOptions) (float64, bool, error) {
+	s.lock()
+	defer s.unlock()
+
+	zset, err := s.zsetAt(key, !opts.XX)
+	if err != nil || zset == nil {
+		return 0, false, err
+	}
+
+	score, _, _, ok, err := zadd(zset, opts, member, delta, true)
+	s.dropIfEmptyZSet(key, zset)
+	s.signalKey(key)
+	return score, ok, err
+}
+
+// ZScore returns the score of member in the sorted set at key.
+func (s *Store) ZScore(key, member string) (float64, bool, error) {
+	s.lock()
+	defer s.unlock()
+
+	zset, err := s.zsetAt(key, false)
+	if err != nil || zset == nil {
+		return 0, false, err
+	}
+
+	score, ok := zset.Score(member)
+	return score, ok, nil
+}
+
+// ZRank returns the 0-based rank of member in the sorted set at key, in
+// descending order if reverse is set, along with its score.
+func (s *Store) ZRank(key, member string, reverse bool) (int, float64, bool, error) {
+	s.lock()
+	defer s.unlock()
+
+	zset, err := s.zsetAt(key, false)
+	if err != nil || zset == nil {
+		return 0, 0, false, err
+	}
+
+	rank, ok := zset.Rank(member, reverse)
+	score, _ := zset.Score(member)
+	return rank, score, ok, nil
+}
+
+// ZCard returns the number of members in the sorted set at key.
+func (s *Store) ZCard(key string) (int, error) {
+	s.lock()
+	defer s.unlock()
+
+	zset, err := s.zsetAt(key, false)
+	if err != nil || zset == nil {
+		return 0, err
+	}
+	return zset.Len(), nil
+}
+
+// ZRem removes members from the sorted set at key and returns how many
+// existed.
+func (s *Store) ZRem(key string, members ...string) (int, error) {
+	s.lock()
+	defer s.unlock()
+
+	zset, err := s.zsetAt(key, false)
+	if err != nil || zset == nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, m := range members {
+		if zset.Remove(m) {
+			removed++
+		}
+	}
+	s.dropIfEmptyZSet(key, zset)
+	return removed, nil
+}
+
+// ZRange returns the members of the sorted set at key selected by spec.
+func (s *Store) ZRange(key string, spec RangeSpec) ([]ScoredMember, error) {
+	s.lock()
+	defer s.unlock()
+
+	zset, err := s.zsetAt(key, false)
+	if err != nil {
+		return nil, err
+	}
+	if zset == nil {
+		return []ScoredMember{}, nil
+	}
+	return zset.Range(spec), nil
+}
+
+// ZRangeStore stores the members of the sorted set at src selected by spec
+// in dst, replacing whatever it held, and returns how many were stored. An
+// empty result deletes dst.
+func (s *Store) ZRangeStore(dst, src string, spec RangeSpec) (int, error) {
+	s.lock()
+	defer s.unlock()
+
+	zset, err := s.zsetAt(src, false)
+	if err != nil {
+		return 0, err
+	}
+
+	var members []ScoredMember
+	if zset != nil {
+		members = zset.Range(spec)
+	}
+	s.storeZSet(dst, members)
+	return len(members), nil
+}
+
+// storeZSet replaces dst with a sorted set holding members, or deletes it if
+// there are none. Callers must hold the write lock.
+func (s *Store) storeZSet(dst string, members []ScoredMember) {
+	if len(members) == 0 {
+		s.deleteKey(dst)
+		return
+	}
+
+	zset := NewSortedSet()
+	for _, m := range members {
+		zset.Add(m.Member, m.Score)
+	}
+	s.setKey(dst, MapValue{
+		Typ:       "zset",
+		SortedSet: zset,
+	})
+	s.signalKey(dst)
+}
+
+// ZCount returns the number of members of the sorted set at key whose score
+// is within r.
+func (s *Store) ZCount(key string, r ScoreRange) (int, error) {
+	s.lock()
+	defer s.unlock()
+
+	zset, err := s.zsetAt(key, false)
+	if err != nil || zset == nil {
+		return 0, err
+	}
+	return zset.Count(r), nil
+}
+
+// ZLexCount returns the number of members of the sorted set at key within
+// the lex range r.
+func (s *Store) ZLexCount(key string, r LexRange) (int, error) {
+	s.lock()
+	defer s.unlock()
+
+	zset, err := s.zsetAt(key, false)
+	if err != nil || zset == nil {
+		return 0, err
+	}
+	return zset.LexCount(r), nil
+}
+
+// ZRemRange removes the members of the sorted set at key selected by spec
+// and returns how many were removed.
+func (s *Store) ZRemRange(key string, spec RangeSpec) (int, error) {
+	s.lock()
+	defer s.unlock()
+
+	zset, err := s.zsetAt(key, false)
+	if err != nil || zset == nil {
+		return 0, err
+	}
+
+	members := zset.Range(spec)
+	for _, m := range members {
+		zset.Remove(m.Member)
+	}
+	s.dropIfEmptyZSet(key, zset)
+	return len(members), nil
+}
+
+// ZPop removes and returns up to count members with the lowest scores from
+// the sorted set at key, or the highest if max is set. It returns nil if the
+// key does not exist.
+func (s *Store) ZPop(key string, max bool, count int) ([]ScoredMember, error) {
+	s.lock()
+	defer s.unlock()
+
+	return s.zpopFrom(key, max, count)
+}
+
+// zpopFrom pops up to count members from key, returning nil if it does not
+// exist. Callers must hold the write lock.
+func (s *Store) zpopFrom(key string, max bool, count int) ([]ScoredMember, error) {
+	zset, err := s.zsetAt(key, false)
+	if err != nil || zset == nil {
+		return nil, err
+	}
+
+	members := zset.Pop(count, max)
+	s.dropIfEmptyZSet(key, zset)
+	return members, nil
+}
+
+// ZMPop pops up to count members from the first non-empty sorted set among
+// keys and returns its key. It reports false if all are empty.
+func (s *Store) ZMPop(keys []string, max bool, count int) (string, []ScoredMember, bool, error) {
+	s.lock()
+	defer s.unlock()
+
+	for _, key := range keys {
+		members, err := s.zpopFrom(key, max, count)
+		if err != nil {
+			return "", nil, false, err
+		}
+		if members != nil {
+			return key, members, true, nil
+		}
+	}
+	return "", nil, false, nil
+}
+
+// BZMPop is the blocking form of ZMPop: when every sorted set is empty it
+// waits until a write to one of keys or until timeout elapses (0 waits
+// forever). It reports false on timeout. A pop is recorded as a ZPOPMIN
+// or ZPOPMAX effect, so that replicas see it right after the write that
+// served it.
+func (s *Store) BZMPop(keys []string, max bool, count int, timeout time.Duration) (string, []ScoredMember, bool, error) {
+	var (
+		poppedKey string
+		members   []ScoredMember
+	)
+
+	bc := s.Block(keys, func(key string) (bool, error) {
+		popped, err := s.zpopFrom(key, max, count)
+		if err != nil || popped == nil {
+			return false, err
+		}
+		poppedKey, members = key, popped
+		s.record(zpopCommand(max), key, strconv.Itoa(len(popped)))
+		return true, nil
+	})
+
+	served, err := s.Wait(bc, timeout)
+	if !served || err != nil {
+		return "", nil, false, err
+	}
+	return poppedKey, members, true, nil
+}
+
+// zpopCommand returns the command popping the highest scores of a sorted
+// set, or its lowest.
+func zpopCommand(max bool) string {
+	if max {
+		return "ZPOPMAX"
+	}
+	return "ZPOPMIN"
+}
+
+// ZRandMember returns random members of the sorted set at key without
+// removing them; see SortedSet.Random for the meaning of count. It returns
+// nil if the key does not exist.
+func (s *Store) ZRandMember(key string, count int) ([]ScoredMember, error) {
+	s.lock()
+	defer s.unlock()
+
+	zset, err := s.zsetAt(key, false)
+	if err != nil || zset == nil {
+		return nil, err
+	}
+	return zset.Random(count), nil
+}
+
+// Aggregate selects how ZUNIONSTORE and ZINTERSTORE combine the scores of a
+// member present in several inputs.
+type Aggregate int
+
+const (
+	AggregateSum Aggregate = iota
+	AggregateMin
+	AggregateMax
+)
+
+func (a Aggregate) apply(current, score float64) float64 {
+	switch a {
+	case AggregateMin:
+		return math.Min(current, score)
+	case AggregateMax:
+		return math.Max(current, score)
+	default:
+		// inf + -inf is NaN; Redis treats it as 0.
+		if sum := current + score; !math.IsNaN(sum) {
+			return sum
+		}
+		return 0
+	}
+}
+
+// zsetInput is a source of ZUNIONSTORE and friends: a sorted set, or a plain
+// set whose members all score 1. Both are nil for a missing key.
+type zsetInput struct {
+	zset *SortedSet
+	set  *Set
+}
+
+func (in zsetInput) len() int {
+	switch {
+	case in.zset != nil:
+		return in.zset.Len()
+	case in.set != nil:
+		return in.set.Len()
+	}
+	return 0
+}
+
+func (in zsetInput) score(member string) (float64, bool) {
+	switch {
+	case in.zset != nil:
+		return in.zset.Score(member)
+	case in.set != nil:
+		return 1, in.set.Has(member)
+	}
+	return 0, false
+}
+
+func (in zsetInput) each(fn func(member string, score float64)) {
+	switch {
+	case in.zset != nil:
+		for member, score := range in.zset.scores {
+			fn(member, score)
+		}
+	case in.set != nil:
+		for member := range in.set.members {
+			fn(member, 1)
+		}
+	}
+}
+
+// zsetInputs returns the sorted sets or sets stored at keys. Callers must
+// hold the write lock.
+func (s *Store) zsetInputs(keys []string) ([]zsetInput, error) {
+	inputs := make([]zsetInput, len(keys))
+	for i, key := range keys {
+		val, ok := s.lookup(key)
+		if !ok {
+			continue
+		}
+		switch val.Typ {
+		case "zset":
+			inputs[i].zset = val.SortedSet
+		case "set":
+			inputs[i].set = val.Set
+		default:
+			return nil, ErrWrongType
+		}
+	}
+	return inputs, nil
+}
+
+// weighted multiplies score by the weight of input i, treating NaN results
+// (0 * inf) as 0 like Redis.
+func weighted(weights []float64, i int, score float64) float64 {
+	if weights == nil {
+		return score
+	}
+	if w := weights[i] * score; !math.IsNaN(w) {
+		return w
+	}
+	return 0
+}
+
+// ZUnionStore stores in dst the union of the sorted sets at keys, with each
+// input's scores multiplied by its weight (nil means all 1) and combined
+// with agg. It returns the size of the result.
+func (s *Store) ZUnionStore(dst string, keys []string, weights []float64, agg Aggregate) (int, error) {
+	s.lock()
+	defer s.unlock()
+
+	inputs, err := s.zsetInputs(keys)
+	if err != nil {
+		return 0, err
+	}
+
+	scores := make(map[string]float64)
+	for i, in := range inputs {
+		in.each(func(member string, score float64) {
+			score = weighted(weights, i, score)
+			if current, ok := scores[member]; ok {
+				score = agg.apply(current, score)
+			}
+			scores[member] = score
+		})
+	}
+	return s.storeScores(dst, scores), nil
+}
+
+// ZInterStore stores in dst the intersection of the sorted sets at keys,
+// weighting and aggregating scores as ZUnionStore does. It returns the size
+// of the result.
+func (s *Store) ZInterStore(dst string, keys []string, weights []float64, agg Aggregate) (int, error) {
+	s.lock()
+	defer s.unlock()
+
+	inputs, err := s.zsetInputs(keys)
+	if err != nil {
+		return 0, err
+	}
+
+	// Iterate the smallest input and probe the others.
+	smallest := 0
+	for i, in := range inputs {
+		if in.len() < inputs[smallest].len() {
+			smallest = i
+		}
+	}
+
+	scores := make(map[string]float64)
+	inputs[smallest].each(func(member string, _ float64) {
+		var total float64
+		for i, in := range inputs {
+			score, ok := in.score(member)
+			if !ok {
+				return
+			}
+			score = weighted(weights, i, score)
+			if i == 0 {
+				total = score
+			} else {
+				total = agg.apply(total, score)
+			}
+		}
+		scores[member] = total
+	})
+	return s.storeScores(dst, scores), nil
+}
+
+// ZDiffStore stores in dst the members of the first sorted set at keys that
+// are in none of the others, keeping their scores. It returns the size of
+// the result.
+func (s *Store) ZDiffStore(dst string, keys []string) (int, error) {
+	s.lock()
+	defer s.unlock()
+
+	inputs, err := s.zsetInputs(keys)
+	if err != nil {
+		return 0, err
+	}
+
+	scores := make(map[string]float64)
+	inputs[0].each(func(member string, score float64) {
+		for _, in := range inputs[1:] {
+			if _, ok := in.score(member); ok {
+				return
+			}
+		}
+		scores[member] = score
+	})
+	return s.storeScores(dst, scores), nil
+}
+
+// storeScores stores scores as a sorted set at dst and returns its size.
+// Callers must hold the write lock.
+func (s *Store) storeScores(dst string, scores map[string]float64) int {
+	members := make([]ScoredMember, 0, len(scores))
+	for member, score := range scores {
+		members = append(members, ScoredMember{Member: member, Score: score})
+	}
+	s.storeZSet(dst, members)
+	return len(members)
+}
+
+// ZScan iterates over the sorted set at key like SCAN does over the
+// keyspace, returning the next cursor and the members matching pattern with
+// their scores. A missing key yields an empty, complete iteration.
+func (s *Store) ZScan(key string, cursor uint64, count int, pattern string) (uint64, []ScoredMember, error) {
+	s.lock()
+	defer s.unlock()
+
+	zset, err := s.zsetAt(key, false)
+	if err != nil || zset == nil {
+		return 0, []ScoredMember{}, err
+	}
+
+	members := []ScoredMember{}
+	next := zset.Scan(cursor, count, func(member string, score float64) {
+		if pattern == "" || MatchGlob(pattern, member) {
+			members = append(members, ScoredMember{Member: member, Score: score})
+		}
+	})
+	return next, members, nil
+}
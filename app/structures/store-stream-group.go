@@ -0,0 +1,652 @@
+package structures
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// streamAt returns the stream at key, or nil if the key does not exist.
+// With create set, a missing key gets an empty stream. Callers must hold the
+// write lock.
+func (s *Store) streamAt(key string, create bool) (*Stream, error) {
+	val, ok := s.lookup(key)
+	if !ok {
+		if !create {
+			return nil, nil
+		}
+		val = MapValue{
+			Typ:    "stream",
+			Stream: NewStream(),
+		}
+		s.setKey(key, val)
+		return val.Stream, nil
+	}
+
+	if val.Typ != "stream" {
+		return nil, ErrWrongType
+	}
+	return val.Stream, nil
+}
+
+// groupAt returns the named consumer group of the stream at key. Callers
+// must hold the write lock.
+func (s *Store) groupAt(key, group string) (*Stream, *consumerGroup, error) {
+	stream, err := s.streamAt(key, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	if stream == nil {
+		return nil, nil, ErrXGroupNoKey
+	}
+	g, ok := stream.groups[group]
+	if !ok {
+		return nil, nil, noGroupError(key, group)
+	}
+	return stream, g, nil
+}
+
+// groupStartID resolves the ID a group starts reading after: "$" stands for
+// the last entry of the stream.
+func groupStartID(stream *Stream, id string) (streamID, error) {
+	if id == "$" {
+		return stream.lastID(), nil
+	}
+	return parseStreamID(id)
+}
+
+// XGroupCreate creates a consumer group on the stream at key that will
+// deliver the entries after id. With mkStream set a missing key gets an
+// empty stream; otherwise it is an error.
+func (s *Store) XGroupCreate(key, group, id string, mkStream bool) error {
+	s.lock()
+	defer s.unlock()
+
+	stream, err := s.streamAt(key, false)
+	if err != nil {
+		return err
+	}
+	if stream == nil {
+		if !mkStream {
+			return ErrXGroupNoKey
+		}
+		// Validate before creating the key so that a bad ID leaves no trace.
+		if _, err := groupStartID(NewStream(), id); err != nil {
+			return err
+		}
+		stream, _ = s.streamAt(key, true)
+	}
+
+	start, err := groupStartID(stream, id)
+	if err != nil {
+		return err
+	}
+	if _, ok := stream.groups[group]; ok {
+		return ErrBusyGroup
+	}
+	if stream.groups == nil {
+		stream.groups = make(map[string]*consumerGroup)
+	}
+	stream.groups[group] = newConsumerGroup(start)
+	s.touch(key)
+	return nil
+}
+
+// XGroupDestroy removes a consumer group and reports whether it existed.
+// Clients blocked reading for the group are woken up with an error.
+func (s *Store) XGroupDestroy(key, group string) (bool, error) {
+	s.lock()
+	defer s.unlock()
+
+	stream, err := s.streamAt(key, false)
+	if err != nil {
+		return false, err
+	}
+	if stream == nil {
+		return false, ErrXGroupNoKey
+	}
+	if _, ok := stream.groups[group]; !ok {
+		return false, nil
+	}
+
+	delete(stream.groups, group)
+	s.touch(key)
+	s.signalKey(key)
+	return true, nil
+}
+
+// XGroupSetID moves the last delivered ID of a consumer group.
+func (s *Store) XGroupSetID(key, group, id string) error {
+	s.lock()
+	defer s.unlock()
+
+	stream, g, err := s.groupAt(key, group)
+	if err != nil {
+		return err
+	}
+	start, err := groupStartID(stream, id)
+	if err != nil {
+		return err
+	}
+
+	g.lastID = start
+	s.touch(key)
+	return nil
+}
+
+// XGroupCreateConsumer adds a consumer to a group and reports whether it
+// did not exist yet.
+func (s *Store) XGroupCreateConsumer(key, group, name string) (bool, error) {
+	s.lock()
+	defer s.unlock()
+
+	_, g, err := s.groupAt(key, group)
+	if err != nil {
+		return false, err
+	}
+
+	c, created := g.consumer(name)
+	if created {
+		c.seenTime = time.Now().UnixMilli()
+		s.touch(key)
+	}
+	return created, nil
+}
+
+// XGroupDelConsumer removes a consumer from a group and returns the number
+// of entries it still had pending, which are dropped with it.
+func (s *Store) XGroupDelConsumer(key, group, name string) (int, error) {
+	s.lock()
+	defer s.unlock()
+
+	_, g, err := s.groupAt(key, group)
+	if err != nil {
+		return 0, err
+	}
+
+	pending := g.deleteConsumer(name)
+	s.touch(key)
+	return pending, nil
+}
+
+// XReadGroupOptions holds the options of XREADGROUP.
+type XReadGroupOptions struct {
+	Group    string
+	Consumer string
+	// Count limits the entries read from each stream; 0 means no limit.
+	Count int
+	// NoAck delivers new entries without adding them to the pending
+	// entries lists, as if acknowledged straight away.
+	NoAck bool
+}
+
+// GroupChange describes what a read or a claim changed in a consumer group
+// of the stream at Key. Replicas apply it as XGROUP, XCLAIM and XACK rather
+// than running the command, whose outcome depends on the clock and on the
+// entries pending.
+type GroupChange struct {
+	Key, Group, Consumer string
+	// NewConsumer is set when the command created Consumer.
+	NewConsumer bool
+	// Claimed lists the entries delivered or claimed to Consumer, as they
+	// are pending afterwards.
+	Claimed []PendingDelivery
+	// Dropped lists the pending entries found deleted from the stream,
+	// which the command removed from the pending entries lists.
+	Dropped []string
+	// LastID, if set, is the last delivered ID the command moved the group
+	// to.
+	LastID string
+}
+
+// PendingDelivery is the last delivery of a pending entry.
+type PendingDelivery struct {
+	ID string
+	// Time is the unix time in milliseconds of the delivery.
+	Time  int64
+	Count int
+}
+
+// empty reports whether the command left the group as it was.
+func (ch GroupChange) empty() bool {
+	return !ch.NewConsumer && len(ch.Claimed) == 0 && len(ch.Dropped) == 0 && ch.LastID == ""
+}
+
+// Commands returns the commands replicas apply for the change, the way Redis
+// propagates it: XGROUP CREATECONSUMER for a new consumer, an XCLAIM
+// forcing the delivery time and count of each entry delivered, XACK for the
+// pending entries dropped, and XGROUP SETID when only the last delivered ID
+// moved.
+func (ch GroupChange) Commands() [][]string {
+	var commands [][]string
+	if ch.NewConsumer {
+		commands = append(commands, []string{"XGROUP", "CREATECONSUMER", ch.Key, ch.Group, ch.Consumer})
+	}
+	for _, d := range ch.Claimed {
+		command := []string{"XCLAIM", ch.Key, ch.Group, ch.Consumer, "0", d.ID,
+			"TIME", strconv.FormatInt(d.Time, 10), "RETRYCOUNT", strconv.Itoa(d.Count), "FORCE", "JUSTID"}
+		if ch.LastID != "" {
+			command = append(command, "LASTID", ch.LastID)
+		}
+		commands = append(commands, command)
+	}
+	if len(ch.Dropped) > 0 {
+		commands = append(commands, append([]string{"XACK", ch.Key, ch.Group}, ch.Dropped...))
+	}
+	if ch.LastID != "" && len(ch.Claimed) == 0 {
+		commands = append(commands, []string{"XGROUP", "SETID", ch.Key, ch.Group, ch.LastID})
+	}
+	return commands
+}
+
+// claim records the delivery of pe.
+func (ch *GroupChange) claim(pe *pendingEntry) {
+	ch.Claimed = append(ch.Claimed, PendingDelivery{ID: pe.id.String(), Time: pe.deliveryTime, Count: pe.deliveryCount})
+}
+
+// XReadGroup reads from each stream for a consumer of a group. An ID of ">"
+// reads entries never delivered to the group; any other ID re-reads the
+// consumer's pending entries after it. Streams read with ">" only appear in
+// the result when they have new entries. It also returns what changed in
+// the groups.
+func (s *Store) XReadGroup(opts XReadGroupOptions, streamKeys, ids []string) (map[string][]Entry, []GroupChange, error) {
+	s.lock()
+	defer s.unlock()
+
+	return s.xreadgroup(opts, streamKeys, ids)
+}
+
+// XReadGroupBlock is like XReadGroup with every ID set to ">" but, when no
+// stream has new entries, waits until an XADD delivers some or the timeout
+// elapses (0 waits forever). It returns no entries on timeout, though the
+// groups may have changed: the consumer is created straight away. What
+// changed in the groups is recorded as effects, so that replicas see a
+// delivery right after the XADD that served it.
+func (s *Store) XReadGroupBlock(opts XReadGroupOptions, streamKeys, ids []string, timeout time.Duration) (map[string][]Entry, error) {
+	var result map[string][]Entry
+	bc := s.Block(streamKeys, func(string) (bool, error) {
+		var changes []GroupChange
+		var err error
+		result, changes, err = s.xreadgroup(opts, streamKeys, ids)
+		for _, ch := range changes {
+			for _, command := range ch.Commands() {
+				s.record(command...)
+			}
+		}
+		return len(result) > 0, err
+	})
+
+	served, err := s.Wait(bc, timeout)
+	if !served || err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// xreadgroup implements XReadGroup. Every stream and ID is checked before
+// anything is delivered, so an error leaves the groups untouched. Callers
+// must hold the write lock.
+func (s *Store) xreadgroup(opts XReadGroupOptions, streamKeys, ids []string) (map[string][]Entry, []GroupChange, error) {
+	streams := make([]*Stream, len(streamKeys))
+	groups := make([]*consumerGroup, len(streamKeys))
+	for i, key := range streamKeys {
+		stream, err := s.streamAt(key, false)
+		if err != nil {
+			return nil, nil, err
+		}
+		if stream == nil || stream.groups[opts.Group] == nil {
+			return nil, nil, fmt.Errorf("NOGROUP No such key '%s' or consumer group '%s' in XREADGROUP with GROUP option", key, opts.Group)
+		}
+		if ids[i] != ">" {
+			if _, err := parseStreamID(ids[i]); err != nil {
+				return nil, nil, err
+			}
+		}
+		streams[i], groups[i] = stream, stream.groups[opts.Group]
+	}
+
+	now := time.Now().UnixMilli()
+	result := make(map[string][]Entry)
+	var changes []GroupChange
+	for i, key := range streamKeys {
+		g := groups[i]
+		c, created := g.consumer(opts.Consumer)
+		c.seenTime = now
+		s.touch(key)
+		change := GroupChange{Key: key, Group: opts.Group, Consumer: opts.Consumer, NewConsumer: created}
+
+		if ids[i] == ">" {
+			if entries := g.deliverNew(streams[i], c, opts.Count, opts.NoAck, now); len(entries) > 0 {
+				result[key] = entries
+				change.LastID = g.lastID.String()
+				for _, e := range entries {
+					if pe, ok := c.pending[e.id()]; ok {
+						change.claim(pe)
+					}
+				}
+			}
+		} else {
+			after, _ := parseStreamID(ids[i])
+			result[key] = g.pendingAfter(streams[i], c, after, opts.Count)
+		}
+		if !change.empty() {
+			changes = append(changes, change)
+		}
+	}
+	return result, changes, nil
+}
+
+// groupForClaim returns the named group of the stream at key for the
+// commands managing pending entries. Callers must hold the write lock.
+func (s *Store) groupForClaim(key, group string) (*Stream, *consumerGroup, error) {
+	stream, err := s.streamAt(key, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	if stream == nil || stream.groups[group] == nil {
+		return nil, nil, fmt.Errorf("NOGROUP No such key '%s' or consumer group '%s'", key, group)
+	}
+	return stream, stream.groups[group], nil
+}
+
+// parseStreamIDs parses every ID in ids.
+func parseStreamIDs(ids []string) ([]streamID, error) {
+	parsed := make([]streamID, len(ids))
+	for i, id := range ids {
+		var err error
+		if parsed[i], err = parseStreamID(id); err != nil {
+			return nil, err
+		}
+	}
+	return parsed, nil
+}
+
+// XAck acknowledges entries of a consumer group, removing them from the
+// pending entries lists, and returns how many were pending. A missing key or
+// group acknowledges nothing.
+func (s *Store) XAck(key, group string, ids []string) (int, error) {
+	parsed, err := parseStreamIDs(ids)
+	if err != nil {
+		return 0, err
+	}
+
+	s.lock()
+	defer s.unlock()
+
+	stream, err := s.streamAt(key, false)
+	if err != nil || stream == nil || stream.groups[group] == nil {
+		return 0, err
+	}
+
+	acked := 0
+	for _, id := range parsed {
+		if stream.groups[group].ack(id) {
+			acked++
+		}
+	}
+	if acked > 0 {
+		s.touch(key)
+	}
+	return acked, nil
+}
+
+// PendingSummary is the summary form of XPENDING.
+type PendingSummary struct {
+	Count int
+	// First and Last are the smallest and greatest pending IDs.
+	First, Last string
+	// Consumers lists the consumers with pending entries, by name.
+	Consumers []PendingCount
+}
+
+// PendingCount is the number of entries pending for a consumer.
+type PendingCount struct {
+	Consumer string
+	Count    int
+}
+
+// XPendingSummary summarises the pending entries of a consumer group.
+func (s *Store) XPendingSummary(key, group string) (PendingSummary, error) {
+	s.lock()
+	defer s.unlock()
+
+	_, g, err := s.groupForClaim(key, group)
+	if err != nil {
+		return PendingSummary{}, err
+	}
+
+	summary := PendingSummary{Count: len(g.pending)}
+	first, ok := g.order.first()
+	if !ok {
+		return summary, nil
+	}
+	last, _ := g.order.last()
+	summary.First, summary.Last = first.String(), last.String()
+	for name, c := range g.consumers {
+		if len(c.pending) > 0 {
+			summary.Consumers = append(summary.Consumers, PendingCount{Consumer: name, Count: len(c.pending)})
+		}
+	}
+	sort.Slice(summary.Consumers, func(i, j int) bool {
+		return summary.Consumers[i].Consumer < summary.Consumers[j].Consumer
+	})
+	return summary, nil
+}
+
+// PendingInfo describes a pending entry in the extended form of XPENDING.
+type PendingInfo struct {
+	ID       string
+	Consumer string
+	// Idle is the time elapsed since the entry was last delivered.
+	Idle          time.Duration
+	DeliveryCount int
+}
+
+// XPendingOptions selects the entries listed by the extended form of
+// XPENDING.
+type XPendingOptions struct {
+	// MinIdle skips entries delivered more recently.
+	MinIdle time.Duration
+	// Start and End bound the IDs, in the grammar of XRANGE.
+	Start, End string
+	Count      int
+	// Consumer, if set, restricts the list to that consumer's entries.
+	Consumer string
+}
+
+// XPending lists, in ID order, the pending entries of a consumer group
+// selected by opts.
+func (s *Store) XPending(key, group string, opts XPendingOptions) ([]PendingInfo, error) {
+	start, err := parseRangeID(opts.Start, false)
+	if err != nil {
+		return nil, err
+	}
+	end, err := parseRangeID(opts.End, true)
+	if err != nil {
+		return nil, err
+	}
+
+	s.lock()
+	defer s.unlock()
+
+	_, g, err := s.groupForClaim(key, group)
+	if err != nil {
+		return nil, err
+	}
+
+	result := []PendingInfo{}
+	pending, order := g.pending, &g.order
+	if opts.Consumer != "" {
+		c, ok := g.consumers[opts.Consumer]
+		if !ok {
+			return result, nil
+		}
+		pending, order = c.pending, &c.order
+	}
+
+	now := time.Now().UnixMilli()
+	order.ascend(start, func(id streamID) bool {
+		if end.less(id) || len(result) >= opts.Count {
+			return false
+		}
+		pe := pending[id]
+		idle := time.Duration(now-pe.deliveryTime) * time.Millisecond
+		if idle >= opts.MinIdle {
+			result = append(result, PendingInfo{
+				ID:            id.String(),
+				Consumer:      pe.owner.name,
+				Idle:          idle,
+				DeliveryCount: pe.deliveryCount,
+			})
+		}
+		return true
+	})
+	return result, nil
+}
+
+// XClaimOptions holds the options of XCLAIM.
+type XClaimOptions struct {
+	// DeliveryTime is recorded as the time of the last delivery of the
+	// claimed entries; zero means now.
+	DeliveryTime time.Time
+	// RetryCount, when HasRetryCount is set, replaces the delivery count
+	// instead of incrementing it.
+	RetryCount    int
+	HasRetryCount bool
+	// Force claims entries that are not pending, adding them to the
+	// pending entries lists, as long as they are still in the stream.
+	Force bool
+	// JustID leaves the delivery count unchanged.
+	JustID bool
+	// LastID, if set, advances the group's last delivered ID to it.
+	LastID string
+}
+
+// XClaim transfers to consumer the entries among ids that have been pending
+// for at least minIdle, and returns them along with what changed in the
+// group. Pending entries that were deleted from the stream are dropped from
+// the pending entries lists instead.
+func (s *Store) XClaim(key, group, consumer string, minIdle time.Duration, ids []string, opts XClaimOptions) ([]Entry, GroupChange, error) {
+	parsed, err := parseStreamIDs(ids)
+	if err != nil {
+		return nil, GroupChange{}, err
+	}
+	var lastID streamID
+	if opts.LastID != "" {
+		if lastID, err = parseStreamID(opts.LastID); err != nil {
+			return nil, GroupChange{}, err
+		}
+	}
+
+	s.lock()
+	defer s.unlock()
+
+	stream, g, err := s.groupForClaim(key, group)
+	if err != nil {
+		return nil, GroupChange{}, err
+	}
+	s.touch(key)
+
+	now := time.Now().UnixMilli()
+	deliveryTime := now
+	if !opts.DeliveryTime.IsZero() {
+		deliveryTime = opts.DeliveryTime.UnixMilli()
+	}
+	c, created := g.consumer(consumer)
+	c.seenTime = now
+	change := GroupChange{Key: key, Group: group, Consumer: consumer, NewConsumer: created}
+	if g.lastID.less(lastID) {
+		g.lastID = lastID
+		change.LastID = lastID.String()
+	}
+
+	claimed := []Entry{}
+	for _, id := range parsed {
+		e, exists := stream.entry(id)
+		pe, pending := g.pending[id]
+		switch {
+		case pending && !exists:
+			g.ack(id)
+			change.Dropped = append(change.Dropped, id.String())
+			continue
+		case !pending && (!opts.Force || !exists):
+			continue
+		case pending && now-pe.deliveryTime < minIdle.Milliseconds():
+			continue
+		}
+
+		pe = g.claim(id, c)
+		pe.deliveryTime = deliveryTime
+		switch {
+		case opts.HasRetryCount:
+			pe.deliveryCount = opts.RetryCount
+		case !opts.JustID || !pending:
+			pe.deliveryCount++
+		}
+		change.claim(pe)
+		claimed = append(claimed, e)
+	}
+	return claimed, change, nil
+}
+
+// XAutoClaim scans the pending entries of a group from start, transferring
+// to consumer up to count of those pending for at least minIdle. It returns
+// the ID to resume the scan from, "0-0" once it is complete, the claimed
+// entries, and what changed in the group. Its Dropped lists the pending
+// entries found deleted from the stream, which are dropped from the pending
+// entries lists.
+func (s *Store) XAutoClaim(key, group, consumer string, minIdle time.Duration, start string, count int, justID bool) (string, []Entry, GroupChange, error) {
+	from, err := parseRangeID(start, false)
+	if err != nil {
+		return "", nil, GroupChange{}, err
+	}
+
+	s.lock()
+	defer s.unlock()
+
+	stream, g, err := s.groupForClaim(key, group)
+	if err != nil {
+		return "", nil, GroupChange{}, err
+	}
+	s.touch(key)
+
+	now := time.Now().UnixMilli()
+	c, created := g.consumer(consumer)
+	c.seenTime = now
+	change := GroupChange{Key: key, Group: group, Consumer: consumer, NewConsumer: created, Dropped: []string{}}
+
+	// Like Redis, bound the work done on a PEL full of recent entries. The
+	// extra ID is where the next scan resumes.
+	attempts := count * 10
+	ids := g.pendingIDs(from, maxStreamID, attempts+1)
+	claimed := []Entry{}
+	next := 0
+	for ; next < len(ids) && attempts > 0 && len(claimed) < count; next++ {
+		attempts--
+		id := ids[next]
+		if now-g.pending[id].deliveryTime < minIdle.Milliseconds() {
+			continue
+		}
+		e, exists := stream.entry(id)
+		if !exists {
+			g.ack(id)
+			change.Dropped = append(change.Dropped, id.String())
+			continue
+		}
+
+		pe := g.claim(id, c)
+		pe.deliveryTime = now
+		if !justID {
+			pe.deliveryCount++
+		}
+		change.claim(pe)
+		claimed = append(claimed, e)
+	}
+
+	cursor := streamID{}
+	if next < len(ids) {
+		cursor = ids[next]
+	}
+	return cursor.String(), claimed, change, nil
+}
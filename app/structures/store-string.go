@@ -0,0 +1,333 @@
+package structures
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"time"
+)
+
+// SetOptions holds the conditions and expiry of a SET. NX only sets missing
+// keys and XX only existing ones. Expiry is the new deadline (zero for none)
+// unless KeepTTL is set, in which case the key keeps its current one. Get
+// asks for the previous value, which must then be a string.
+type SetOptions struct {
+	NX, XX  bool
+	KeepTTL bool
+	Get     bool
+	Expiry  time.Time
+}
+
+// SetWithOptions stores a string value subject to opts, atomically with
+// respect to the NX/XX check. It returns the previous string value if there
+// was one and whether the value was stored.
+func (s *Store) SetWithOptions(key, value string, opts SetOptions) (old string, hadOld, stored bool, err error) {
+	s.lock()
+	defer s.unlock()
+
+	current, exists := s.lookup(key)
+	if exists && opts.Get {
+		if current.Typ != "string" {
+			return "", false, false, ErrWrongType
+		}
+		old, hadOld = current.String, true
+	}
+
+	if (opts.NX && exists) || (opts.XX && !exists) {
+		return old, hadOld, false, nil
+	}
+
+	expiry := opts.Expiry
+	if opts.KeepTTL && exists {
+		expiry = current.Expiry
+	}
+	s.setKey(key, MapValue{
+		Typ:    "string",
+		String: value,
+		Expiry: expiry,
+	})
+	return old, hadOld, true, nil
+}
+
+// ErrStringTooLong is returned when SETRANGE or APPEND would grow a string
+// past the maximum size Redis allows.
+var ErrStringTooLong = errors.New("ERR string exceeds maximum allowed size (proto-max-bulk-len)")
+
+// maxStringLength matches Redis' default proto-max-bulk-len of 512MB.
+const maxStringLength = 512 * 1024 * 1024
+
+// stringAt returns the string value stored at key and whether it exists. It
+// fails if the key holds another type. Callers must hold the write lock.
+func (s *Store) stringAt(key string) (MapValue, bool, error) {
+	val, ok := s.lookup(key)
+	if !ok {
+		return MapValue{}, false, nil
+	}
+	if val.Typ != "string" {
+		return MapValue{}, false, ErrWrongType
+	}
+	return val, true, nil
+}
+
+// Append appends value to the string at key, creating it if needed, and
+// returns the new length. The key keeps its expiry.
+func (s *Store) Append(key, value string) (int, error) {
+	s.lock()
+	defer s.unlock()
+
+	val, ok, err := s.stringAt(key)
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		val = MapValue{Typ: "string"}
+	}
+	if len(val.String)+len(value) > maxStringLength {
+		return 0, ErrStringTooLong
+	}
+
+	val.String += value
+	s.setKey(key, val)
+	return len(val.String), nil
+}
+
+// StrLen returns the length of the string at key, or 0 if it is missing.
+func (s *Store) StrLen(key string) (int, error) {
+	s.lock()
+	defer s.unlock()
+
+	val, _, err := s.stringAt(key)
+	return len(val.String), err
+}
+
+// GetRange returns the substring of the string at key between the byte
+// offsets start and end, both inclusive. Negative offsets count from the
+// end of the string.
+func (s *Store) GetRange(key string, start, end int) (string, error) {
+	s.lock()
+	defer s.unlock()
+
+	val, _, err := s.stringAt(key)
+	if err != nil {
+		return "", err
+	}
+
+	str := val.String
+	if start < 0 && end < 0 && start > end {
+		return "", nil
+	}
+	if start < 0 {
+		start += len(str)
+	}
+	if end < 0 {
+		end += len(str)
+	}
+	if start < 0 {
+		start = 0
+	}
+	if end < 0 {
+		end = 0
+	}
+	if end >= len(str) {
+		end = len(str) - 1
+	}
+	if start > end || len(str) == 0 {
+		return "", nil
+	}
+	return str[start : end+1], nil
+}
+
+// SetRange overwrites the string at key starting at offset, zero-padding it
+// if it is shorter, and returns the new length. An empty value leaves a
+// missing key absent. The key keeps its expiry.
+func (s *Store) SetRange(key string, offset int, value string) (int, error) {
+	s.lock()
+	defer s.unlock()
+
+	val, ok, err := s.stringAt(key)
+	if err != nil {
+		return 0, err
+	}
+	if value == "" {
+		return len(val.String), nil
+	}
+	if offset > maxStringLength-len(value) {
+		return 0, ErrStringTooLong
+	}
+	if !ok {
+		val = MapValue{Typ: "string"}
+	}
+
+	buf := []byte(val.String)
+	if need := offset + len(value); need > len(buf) {
+		buf = append(buf, make([]byte, need-len(buf))...)
+	}
+	copy(buf[offset:], value)
+
+	val.String = string(buf)
+	s.setKey(key, val)
+	return len(buf), nil
+}
+
+// GetDel returns the string at key and deletes the key.
+func (s *Store) GetDel(key string) (string, bool, error) {
+	s.lock()
+	defer s.unlock()
+
+	val, ok, err := s.stringAt(key)
+	if err != nil || !ok {
+		return "", false, err
+	}
+	s.deleteKey(key)
+	return val.String, true, nil
+}
+
+// GetEx returns the string at key and, if update is set, replaces its
+// expiry with expiry (zero removes it). An expiry in the past deletes the
+// key after reading it.
+func (s *Store) GetEx(key string, update bool, expiry time.Time) (string, bool, error) {
+	s.lock()
+	defer s.unlock()
+
+	val, ok, err := s.stringAt(key)
+	if err != nil || !ok {
+		return "", false, err
+	}
+
+	if update {
+		if !expiry.IsZero() && !expiry.After(time.Now()) {
+			s.deleteKey(key)
+		} else {
+			val.Expiry = expiry
+			s.setKey(key, val)
+		}
+	}
+	return val.String, true, nil
+}
+
+// MGet returns the string values of keys, along with whether each one
+// exists. Keys holding another type are reported as missing, as in Redis.
+func (s *Store) MGet(keys ...string) ([]string, []bool) {
+	s.lock()
+	defer s.unlock()
+
+	values := make([]string, len(keys))
+	found := make([]bool, len(keys))
+	for i, key := range keys {
+		if val, ok := s.lookup(key); ok && val.Typ == "string" {
+			values[i], found[i] = val.String, true
+		}
+	}
+	return values, found
+}
+
+// MSet sets every key to its value in one step, clearing any expiry.
+func (s *Store) MSet(pairs map[string]string) {
+	s.lock()
+	defer s.unlock()
+
+	s.msetLocked(pairs)
+}
+
+// msetLocked stores pairs as plain strings. Callers must hold the write
+// lock.
+func (s *Store) msetLocked(pairs map[string]string) {
+	for key, value := range pairs {
+		s.setKey(key, MapValue{
+			Typ:    "string",
+			String: value,
+		})
+	}
+}
+
+// MSetNX sets every key to its value only if none of the keys exist, and
+// reports whether it did.
+func (s *Store) MSetNX(pairs map[string]string) bool {
+	s.lock()
+	defer s.unlock()
+
+	for key := range pairs {
+		if _, ok := s.lookup(key); ok {
+			return false
+		}
+	}
+
+	s.msetLocked(pairs)
+	return true
+}
+
+var (
+	// ErrNotInteger is returned by INCR and friends when the value is not an
+	// integer or does not fit in 64 bits.
+	ErrNotInteger = errors.New("ERR value is not an integer or out of range")
+	// ErrNotFloat is returned by INCRBYFLOAT when the value is not a float.
+	ErrNotFloat = errors.New("ERR value is not a valid float")
+)
+
+// Incr increments the integer value of the string at key by 1.
+func (s *Store) Incr(key string) (int64, error) {
+	return s.IncrBy(key, 1)
+}
+
+// IncrBy increments the integer value of the string at key by delta,
+// treating a missing key as 0. The key keeps its expiry.
+func (s *Store) IncrBy(key string, delta int64) (int64, error) {
+	s.lock()
+	defer s.unlock()
+
+	val, ok, err := s.stringAt(key)
+	if err != nil {
+		return 0, err
+	}
+
+	var current int64
+	if ok {
+		current, err = strconv.ParseInt(val.String, 10, 64)
+		if err != nil {
+			return 0, ErrNotInteger
+		}
+	} else {
+		val = MapValue{Typ: "string"}
+	}
+
+	if (delta > 0 && current > math.MaxInt64-delta) || (delta < 0 && current < math.MinInt64-delta) {
+		return 0, ErrOverflow
+	}
+
+	current += delta
+	val.String = strconv.FormatInt(current, 10)
+	s.setKey(key, val)
+	return current, nil
+}
+
+// IncrByFloat increments the float value of the string at key by delta,
+// treating a missing key as 0, and returns the new value as Redis formats
+// it. The key keeps its expiry.
+func (s *Store) IncrByFloat(key string, delta float64) (string, error) {
+	s.lock()
+	defer s.unlock()
+
+	val, ok, err := s.stringAt(key)
+	if err != nil {
+		return "", err
+	}
+
+	var current float64
+	if ok {
+		current, err = strconv.ParseFloat(val.String, 64)
+		if err != nil || math.IsNaN(current) || math.IsInf(current, 0) {
+			return "", ErrNotFloat
+		}
+	} else {
+		val = MapValue{Typ: "string"}
+	}
+
+	current += delta
+	if math.IsNaN(current) || math.IsInf(current, 0) {
+		return "", ErrNaNOrInfinity
+	}
+
+	val.String = formatFloat(current)
+	s.setKey(key, val)
+	return val.String, nil
+}
@@ -1,70 +1,201 @@
 package structures
 
 import (
-	"fmt"
-	"strconv"
+	"errors"
 	"sync"
 	"time"
 )
 
-// Store encapsulates the Redis key-value store with thread-safe access.
+// ErrWrongType is returned when a command is run against a key holding a
+// value of a different kind.
+var ErrWrongType = errors.New("WRONGTYPE Operation against a key holding the wrong kind of value")
+
+// DefaultDatabases is the number of logical databases a Store holds unless
+// told otherwise.
+const DefaultDatabases = 16
+
+// Store encapsulates the Redis key-value store with thread-safe access. It
+// holds a number of logical databases, and each Store value is a view onto
+// one of them: the key commands act on the selected database while views
+// obtained through Select share everything else.
 type Store struct {
-	data RedisDB
-	mu   sync.RWMutex
+	*database
+	dbs    []*database
+	stats  *storeStats
+	memory *memoryState
+	// gone, if set, is closed once the client using this view has
+	// disconnected; see ForClient.
+	gone <-chan struct{}
+	// effects, if set, keeps the effects of the operations run through the
+	// view; see WithEffects.
+	effects *effectLog
+	// noWait makes blocking commands give up instead of waiting; see
+	// WithBlocking.
+	noWait bool
 }
 
-// NewStore creates a new empty Store.
-func NewStore() *Store {
-	return &Store{
-		data: make(RedisDB),
-	}
+// database is one logical keyspace, with its own lock.
+type database struct {
+	id      int
+	data    RedisDB
+	mu      sync.RWMutex
+	blocked map[string][]*BlockedClient
+	// ready holds the keys with blocked clients written since the write
+	// lock was taken; see serveReady.
+	ready []string
+	// expires indexes the keys that carry an expiry, so the active expiry
+	// cycle can sample them without scanning the whole keyspace.
+	expires map[string]struct{}
+	// volatileHashes indexes the hashes that have had fields with an
+	// expiry, so the active expiry cycle can reclaim expired fields without
+	// scanning the whole keyspace. Entries are dropped lazily by the cycle.
+	volatileHashes map[string]struct{}
+	// keyIndex orders every key for SCAN.
+	keyIndex *scanIndex
+	// touched holds the keys accessed since the write lock was taken; see
+	// settle.
+	touched map[string]struct{}
+	// usedMemory is the memory accounted to the keys of the database.
+	usedMemory int64
+	// pending holds the effects recorded since the write lock was taken,
+	// for the view releasing it to publish.
+	pending []Effect
 }
 
-// Get retrieves a string value by key, handling lazy expiry.
-func (s *Store) Get(key string) (string, bool) {
-	s.mu.RLock()
-	value, ok := s.data[key]
-	s.mu.RUnlock()
+// storeStats holds the metrics shared by every database of a Store, and the
+// hook told about effects; see OnEffect.
+type storeStats struct {
+	mu       sync.Mutex
+	expiry   ExpiryStats
+	onEffect func(Effect)
+}
 
-	if !ok {
-		return "", false
-	}
+// NewStore creates a new empty Store with DefaultDatabases databases and
+// database 0 selected.
+func NewStore() *Store {
+	return NewStoreWithDatabases(DefaultDatabases)
+}
 
-	if !value.Expiry.IsZero() && value.Expiry.Before(time.Now()) {
-		s.mu.Lock()
-		delete(s.data, key)
-		s.mu.Unlock()
-		return "", false
+// NewStoreWithDatabases creates a new empty Store holding n databases, with
+// database 0 selected.
+func NewStoreWithDatabases(n int) *Store {
+	dbs := make([]*database, n)
+	for i := range dbs {
+		dbs[i] = &database{
+			id:             i,
+			data:           make(RedisDB),
+			blocked:        make(map[string][]*BlockedClient),
+			expires:        make(map[string]struct{}),
+			volatileHashes: make(map[string]struct{}),
+			keyIndex:       newScanIndex(),
+			touched:        make(map[string]struct{}),
+		}
 	}
+	return &Store{database: dbs[0], dbs: dbs, stats: &storeStats{}, memory: &memoryState{}}
+}
+
+// Get retrieves a string value by key, handling lazy expiry. It fails if
+// the key holds another type.
+func (s *Store) Get(key string) (string, bool, error) {
+	s.lock()
+	defer s.unlock()
 
-	return value.String, true
+	value, ok, err := s.stringAt(key)
+	return value.String, ok, err
 }
 
 // Set stores a string value with an optional expiry time.
 func (s *Store) Set(key, value string, expiry time.Time) {
-	s.mu.Lock()
-	s.data[key] = MapValue{
+	s.lock()
+	s.setKey(key, MapValue{
 		Typ:    "string",
 		String: value,
 		Expiry: expiry,
+	})
+	s.unlock()
+}
+
+// lookup returns the live value for key, lazily deleting it if it has
+// expired. Callers must hold the write lock.
+func (s *Store) lookup(key string) (MapValue, bool) {
+	value, ok := s.data[key]
+	if !ok {
+		return MapValue{}, false
+	}
+
+	if value.IsExpired() {
+		s.deleteExpired(key)
+		return MapValue{}, false
 	}
-	s.mu.Unlock()
+
+	s.touch(key)
+	return value, true
+}
+
+// setKey stores val under key, keeping the expiry and scan indexes and the
+// memory accounting in step. Every write to the keyspace goes through it.
+// Callers must hold the write lock.
+func (s *Store) setKey(key string, val MapValue) {
+	if old, exists := s.data[key]; exists {
+		s.account(-old.size)
+	} else {
+		s.keyIndex.add(key)
+	}
+	if val.accessed == 0 {
+		// A new value starts with some credit, so that the LFU policies do
+		// not evict it before it had a chance to be used.
+		val.accessed = time.Now().UnixMilli()
+		val.freq = lfuInitVal
+	}
+	val.size = 0
+	s.data[key] = val
+	s.touch(key)
+
+	if val.Expiry.IsZero() {
+		delete(s.expires, key)
+	} else {
+		s.expires[key] = struct{}{}
+	}
+	if val.Typ == "hash" && val.Hash.HasVolatileFields() {
+		s.volatileHashes[key] = struct{}{}
+	} else {
+		delete(s.volatileHashes, key)
+	}
+}
+
+// deleteKey removes key and its index entries. Callers must hold the write
+// lock.
+func (s *Store) deleteKey(key string) {
+	val, exists := s.data[key]
+	if !exists {
+		return
+	}
+	s.account(-val.size)
+	delete(s.data, key)
+	delete(s.expires, key)
+	delete(s.volatileHashes, key)
+	s.keyIndex.remove(key)
 }
 
 // Delete removes a key from the store.
 func (s *Store) Delete(key string) {
-	s.mu.Lock()
-	delete(s.data, key)
-	s.mu.Unlock()
+	s.lock()
+	s.deleteKey(key)
+	s.unlock()
 }
 
-// Keys returns all key names in the store.
+// Keys returns all live key names in the store, reclaiming expired keys
+// along the way.
 func (s *Store) Keys() []string {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	s.lock()
+	defer s.unlock()
 
 	keys := make([]string, 0, len(s.data))
-	for k := range s.data {
+	for k, v := range s.data {
+		if v.IsExpired() {
+			s.deleteExpired(k)
+			continue
+		}
 		keys = append(keys, k)
 	}
 	return keys
@@ -72,97 +203,206 @@ func (s *Store) Keys() []string {
 
 // Type returns the type name for a key ("string", "stream", or "none").
 func (s *Store) Type(key string) string {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	s.lock()
+	defer s.unlock()
 
-	value, ok := s.data[key]
+	value, ok := s.lookup(key)
 	if !ok {
 		return "none"
 	}
 	return value.Typ
 }
 
-// Incr atomically increments a numeric string value by 1.
-// If the key doesn't exist, it is created with value "1".
-func (s *Store) Incr(key string) (int, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	item, ok := s.data[key]
-	if !ok {
-		s.data[key] = MapValue{
-			Typ:    "string",
-			String: "1",
-		}
-		return 1, nil
-	}
-
-	intValue, err := strconv.Atoi(item.String)
-	if err != nil {
-		return 0, err
-	}
-
-	intValue++
-	item.String = strconv.Itoa(intValue)
-	s.data[key] = item
-
-	return intValue, nil
-}
-
 // LoadKeys replaces the entire store contents (used for RDB loading).
 func (s *Store) LoadKeys(db RedisDB) {
-	s.mu.Lock()
-	s.data = db
-	s.mu.Unlock()
+	s.lock()
+	s.flush()
+	for key, val := range db {
+		s.setKey(key, val)
+	}
+	s.unlock()
 }
 
 // XAdd adds an entry to a stream, creating the stream if needed.
 func (s *Store) XAdd(streamKey, entryKey string, pairs map[string]string) (string, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	key, _, _, err := s.XAddWithOptions(streamKey, entryKey, pairs, XAddOptions{})
+	return key, err
+}
 
-	val, ok := s.data[streamKey]
+// XAddOptions holds the options of XADD. NoMkStream leaves a missing stream
+// alone instead of creating it, and Trim, unless its By is TrimNone, trims
+// the stream once the entry is added.
+type XAddOptions struct {
+	NoMkStream bool
+	Trim       TrimOptions
+}
+
+// XAddWithOptions adds an entry to a stream subject to opts, and returns its
+// ID and whether it was added. It also returns the exact trim with the same
+// outcome as the one opts asked for, for replicas to apply: an approximate
+// trim depends on how the entries are laid out.
+func (s *Store) XAddWithOptions(streamKey, entryKey string, pairs map[string]string, opts XAddOptions) (string, TrimOptions, bool, error) {
+	minID, err := opts.Trim.minID()
+	if err != nil {
+		return "", TrimOptions{}, false, err
+	}
+
+	s.lock()
+	defer s.unlock()
+
+	val, ok := s.lookup(streamKey)
 	if !ok {
+		if opts.NoMkStream {
+			return "", TrimOptions{}, false, nil
+		}
 		val = MapValue{
 			Typ:    "stream",
 			Stream: NewStream(),
 		}
+	} else if val.Typ != "stream" {
+		return "", TrimOptions{}, false, ErrWrongType
 	}
 
 	key, err := val.Stream.Add(entryKey, pairs)
 	if err != nil {
-		return "", err
+		return "", TrimOptions{}, false, err
 	}
+	val.Stream.trim(opts.Trim, minID)
 
-	s.data[streamKey] = val
-	return key, nil
+	s.setKey(streamKey, val)
+	s.signalKey(streamKey)
+	return key, val.Stream.exactTrim(opts.Trim), true, nil
 }
 
-// XRange returns entries from a stream between start and end IDs.
-func (s *Store) XRange(streamKey, start, end string) ([]Entry, bool) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+// XLen returns the number of entries in a stream, 0 for a missing key.
+func (s *Store) XLen(key string) (int, error) {
+	s.lock()
+	defer s.unlock()
 
-	val, ok := s.data[streamKey]
-	if !ok || val.Typ != "stream" {
-		return nil, false
+	stream, err := s.streamAt(key, false)
+	if err != nil || stream == nil {
+		return 0, err
+	}
+	return stream.Len(), nil
+}
+
+// XDel deletes entries from a stream and returns how many existed. Entries
+// pending in a consumer group stay pending.
+func (s *Store) XDel(key string, ids []string) (int, error) {
+	parsed, err := parseStreamIDs(ids)
+	if err != nil {
+		return 0, err
+	}
+
+	s.lock()
+	defer s.unlock()
+
+	stream, err := s.streamAt(key, false)
+	if err != nil || stream == nil {
+		return 0, err
+	}
+	return stream.delete(parsed), nil
+}
+
+// XTrim removes the oldest entries of a stream as opts asks and returns how
+// many it removed, along with the exact trim with the same outcome, like
+// XAddWithOptions.
+func (s *Store) XTrim(key string, opts TrimOptions) (int, TrimOptions, error) {
+	minID, err := opts.minID()
+	if err != nil {
+		return 0, TrimOptions{}, err
+	}
+
+	s.lock()
+	defer s.unlock()
+
+	stream, err := s.streamAt(key, false)
+	if err != nil || stream == nil {
+		return 0, opts, err
 	}
+	trimmed := stream.trim(opts, minID)
+	return trimmed, stream.exactTrim(opts), nil
+}
+
+// XRange returns, in ID order, up to count entries of a stream between the
+// start and end bounds of an ID range; a count of 0 means no limit. It
+// reports false when the key does not exist, and fails if it holds another
+// type.
+func (s *Store) XRange(streamKey, start, end string, count int) ([]Entry, bool, error) {
+	return s.xrange(streamKey, start, end, count, false)
+}
+
+// XRevRange is like XRange but returns the entries in reverse ID order, from
+// end down to start.
+func (s *Store) XRevRange(streamKey, end, start string, count int) ([]Entry, bool, error) {
+	return s.xrange(streamKey, start, end, count, true)
+}
+
+func (s *Store) xrange(streamKey, start, end string, count int, rev bool) ([]Entry, bool, error) {
+	startID, endID, err := parseRange(start, end)
+	if err != nil {
+		return nil, false, err
+	}
+
+	s.lock()
+	defer s.unlock()
+
+	stream, err := s.streamAt(streamKey, false)
+	if err != nil || stream == nil {
+		return nil, false, err
+	}
+
+	if rev {
+		return stream.entriesBetweenRev(endID, startID, count), true, nil
+	}
+	return stream.entriesBetween(startID, endID, count), true, nil
+}
+
+// XRead returns, for each stream, up to count entries after the given ID; a
+// count of 0 means no limit. Streams without such entries are left out.
+func (s *Store) XRead(streamKeys, ids []string, count int) (map[string][]Entry, error) {
+	after, err := parseStreamIDs(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	s.lock()
+	defer s.unlock()
 
-	return val.Stream.Range(start, end), true
+	return s.xread(streamKeys, after, count), nil
 }
 
-// XRead returns entries from multiple streams after the given IDs.
-func (s *Store) XRead(streamKeys, ids []string) map[string][]Entry {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+// XReadBlock is like XRead but, when no stream has new entries, waits until
+// an XADD delivers some or the timeout elapses (0 waits forever). It returns
+// nil on timeout.
+func (s *Store) XReadBlock(streamKeys, ids []string, count int, timeout time.Duration) (map[string][]Entry, error) {
+	after, err := parseStreamIDs(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	var result map[string][]Entry
+	bc := s.Block(streamKeys, func(string) (bool, error) {
+		result = s.xread(streamKeys, after, count)
+		return len(result) > 0, nil
+	})
+
+	if served, _ := s.Wait(bc, timeout); !served {
+		return nil, nil
+	}
+	return result, nil
+}
 
+// xread collects entries after the given IDs. Callers must hold the write
+// lock.
+func (s *Store) xread(streamKeys []string, after []streamID, count int) map[string][]Entry {
 	result := make(map[string][]Entry)
 	for i, key := range streamKeys {
-		val, ok := s.data[key]
+		val, ok := s.lookup(key)
 		if !ok || val.Typ != "stream" {
 			continue
 		}
-		entries := val.Stream.Read(ids[i])
+		entries := val.Stream.entriesAfter(after[i], count)
 		if len(entries) > 0 {
 			result[key] = entries
 		}
@@ -172,12 +412,12 @@ func (s *Store) XRead(streamKeys, ids []string) map[string][]Entry {
 
 // StreamSize returns the total number of entries across the given streams.
 func (s *Store) StreamSize(streamKeys []string) int {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	s.lock()
+	defer s.unlock()
 
 	size := 0
 	for _, key := range streamKeys {
-		val, ok := s.data[key]
+		val, ok := s.lookup(key)
 		if !ok || val.Typ != "stream" {
 			continue
 		}
@@ -188,15 +428,13 @@ func (s *Store) StreamSize(streamKeys []string) int {
 
 // LastStreamID returns the last entry ID for a stream, or "0-0" if not found.
 func (s *Store) LastStreamID(key string) string {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	s.lock()
+	defer s.unlock()
 
-	val, ok := s.data[key]
+	val, ok := s.lookup(key)
 	if !ok || val.Typ != "stream" {
 		return "0-0"
 	}
 
-	lastTs := val.Stream.LastTimestamp()
-	lastSeq := val.Stream.LastSeq(lastTs)
-	return fmt.Sprintf("%d-%d", lastTs, lastSeq)
+	return val.Stream.lastID().String()
 }
@@ -10,7 +10,7 @@ func TestStore_Get(t *testing.T) {
 	s := NewStore()
 	s.Set("key1", "value1", time.Time{})
 
-	val, ok := s.Get("key1")
+	val, ok, _ := s.Get("key1")
 	if !ok || val != "value1" {
 		t.Errorf("Get(key1) = (%q, %v), want (\"value1\", true)", val, ok)
 	}
@@ -19,7 +19,7 @@ func TestStore_Get(t *testing.T) {
 func TestStore_Get_NonExistent(t *testing.T) {
 	s := NewStore()
 
-	_, ok := s.Get("missing")
+	_, ok, _ := s.Get("missing")
 	if ok {
 		t.Error("Get(missing) should return false")
 	}
@@ -29,7 +29,7 @@ func TestStore_Get_EmptyValue(t *testing.T) {
 	s := NewStore()
 	s.Set("empty", "", time.Time{})
 
-	val, ok := s.Get("empty")
+	val, ok, _ := s.Get("empty")
 	if !ok || val != "" {
 		t.Errorf("Get(empty) = (%q, %v), want (\"\", true)", val, ok)
 	}
@@ -39,7 +39,7 @@ func TestStore_Get_EmptyKey(t *testing.T) {
 	s := NewStore()
 	s.Set("", "val", time.Time{})
 
-	val, ok := s.Get("")
+	val, ok, _ := s.Get("")
 	if !ok || val != "val" {
 		t.Errorf("Get(\"\") = (%q, %v), want (\"val\", true)", val, ok)
 	}
@@ -49,7 +49,7 @@ func TestStore_Get_Expired(t *testing.T) {
 	s := NewStore()
 	s.Set("exp", "gone", time.Now().Add(-1*time.Second))
 
-	_, ok := s.Get("exp")
+	_, ok, _ := s.Get("exp")
 	if ok {
 		t.Error("Get(exp) should return false for expired key")
 	}
@@ -59,7 +59,7 @@ func TestStore_Get_NotYetExpired(t *testing.T) {
 	s := NewStore()
 	s.Set("future", "still here", time.Now().Add(24*time.Hour))
 
-	val, ok := s.Get("future")
+	val, ok, _ := s.Get("future")
 	if !ok || val != "still here" {
 		t.Errorf("Get(future) = (%q, %v), want (\"still here\", true)", val, ok)
 	}
@@ -81,7 +81,7 @@ func TestStore_Get_NoExpiryNeverExpires(t *testing.T) {
 	s := NewStore()
 	s.Set("perm", "forever", time.Time{})
 
-	val, ok := s.Get("perm")
+	val, ok, _ := s.Get("perm")
 	if !ok || val != "forever" {
 		t.Errorf("Get(perm) = (%q, %v), want (\"forever\", true)", val, ok)
 	}
@@ -92,7 +92,7 @@ func TestStore_Set_Overwrite(t *testing.T) {
 	s.Set("key", "first", time.Time{})
 	s.Set("key", "second", time.Time{})
 
-	val, ok := s.Get("key")
+	val, ok, _ := s.Get("key")
 	if !ok || val != "second" {
 		t.Errorf("Get after overwrite = (%q, %v), want (\"second\", true)", val, ok)
 	}
@@ -103,7 +103,7 @@ func TestStore_Delete(t *testing.T) {
 	s.Set("key", "val", time.Time{})
 	s.Delete("key")
 
-	_, ok := s.Get("key")
+	_, ok, _ := s.Get("key")
 	if ok {
 		t.Error("Get after Delete should return false")
 	}
@@ -241,11 +241,11 @@ func TestStore_LoadKeys(t *testing.T) {
 	if s.Type("old") != "none" {
 		t.Error("LoadKeys should replace old data")
 	}
-	v1, ok := s.Get("new1")
+	v1, ok, _ := s.Get("new1")
 	if !ok || v1 != "v1" {
 		t.Error("LoadKeys did not load new1")
 	}
-	v2, ok := s.Get("new2")
+	v2, ok, _ := s.Get("new2")
 	if !ok || v2 != "v2" {
 		t.Error("LoadKeys did not load new2")
 	}
@@ -277,7 +277,7 @@ func TestStore_XRange(t *testing.T) {
 	s.XAdd("stream", "1-1", map[string]string{"a": "1"})
 	s.XAdd("stream", "2-1", map[string]string{"b": "2"})
 
-	entries, ok := s.XRange("stream", "0-0", "3-0")
+	entries, ok, _ := s.XRange("stream", "0-0", "3-0", 0)
 	if !ok {
 		t.Fatal("XRange should return true for existing stream")
 	}
@@ -289,7 +289,7 @@ func TestStore_XRange(t *testing.T) {
 func TestStore_XRange_NonExistent(t *testing.T) {
 	s := NewStore()
 
-	_, ok := s.XRange("missing", "0-0", "1-0")
+	_, ok, _ := s.XRange("missing", "0-0", "1-0", 0)
 	if ok {
 		t.Error("XRange on missing stream should return false")
 	}
@@ -300,7 +300,7 @@ func TestStore_XRead(t *testing.T) {
 	s.XAdd("stream", "1-1", map[string]string{"a": "1"})
 	s.XAdd("stream", "1-2", map[string]string{"b": "2"})
 
-	result := s.XRead([]string{"stream"}, []string{"1-1"})
+	result, _ := s.XRead([]string{"stream"}, []string{"1-1"}, 0)
 	entries, ok := result["stream"]
 	if !ok {
 		t.Fatal("XRead should return entries for existing stream")
@@ -343,14 +343,14 @@ func TestStore_Expiry(t *testing.T) {
 	s := NewStore()
 	s.Set("exp", "val", time.Now().Add(50*time.Millisecond))
 
-	val, ok := s.Get("exp")
+	val, ok, _ := s.Get("exp")
 	if !ok || val != "val" {
 		t.Error("Key should exist before expiry")
 	}
 
 	time.Sleep(100 * time.Millisecond)
 
-	_, ok = s.Get("exp")
+	_, ok, _ = s.Get("exp")
 	if ok {
 		t.Error("Key should be expired after waiting")
 	}
@@ -360,7 +360,7 @@ func TestStore_SetThenGet(t *testing.T) {
 	s := NewStore()
 	s.Set("k", "v", time.Time{})
 
-	val, ok := s.Get("k")
+	val, ok, _ := s.Get("k")
 	if !ok || val != "v" {
 		t.Errorf("Set then Get = (%q, %v), want (\"v\", true)", val, ok)
 	}
@@ -378,7 +378,7 @@ func TestStore_SetOverwritesDifferentType(t *testing.T) {
 	if s.Type("key") != "string" {
 		t.Errorf("Type after Set = %q, want 'string'", s.Type("key"))
 	}
-	val, ok := s.Get("key")
+	val, ok, _ := s.Get("key")
 	if !ok || val != "now_string" {
 		t.Errorf("Get after type change = (%q, %v), want (\"now_string\", true)", val, ok)
 	}
@@ -390,7 +390,7 @@ func TestStore_XRange_SingleTimestamp(t *testing.T) {
 	s.XAdd("stream", "1-2", map[string]string{"b": "2"})
 	s.XAdd("stream", "1-3", map[string]string{"c": "3"})
 
-	entries, ok := s.XRange("stream", "1-1", "1-3")
+	entries, ok, _ := s.XRange("stream", "1-1", "1-3", 0)
 	if !ok {
 		t.Fatal("XRange should return true")
 	}
@@ -405,7 +405,7 @@ func TestStore_XRange_NoDuplicates(t *testing.T) {
 	s.XAdd("stream", "2-1", map[string]string{"b": "2"})
 	s.XAdd("stream", "3-1", map[string]string{"c": "3"})
 
-	entries, ok := s.XRange("stream", "1-1", "3-1")
+	entries, ok, _ := s.XRange("stream", "1-1", "3-1", 0)
 	if !ok {
 		t.Fatal("XRange should return true")
 	}
@@ -431,7 +431,7 @@ func TestStore_XRead_MultipleStreams(t *testing.T) {
 	s.XAdd("s1", "1-1", map[string]string{"a": "1"})
 	s.XAdd("s2", "1-1", map[string]string{"b": "2"})
 
-	result := s.XRead([]string{"s1", "s2"}, []string{"0-0", "0-0"})
+	result, _ := s.XRead([]string{"s1", "s2"}, []string{"0-0", "0-0"}, 0)
 	if len(result) != 2 {
 		t.Errorf("XRead returned %d streams, want 2", len(result))
 	}
@@ -448,7 +448,7 @@ func TestStore_XRead_EmptyResult(t *testing.T) {
 	s.XAdd("stream", "1-1", map[string]string{"a": "1"})
 
 	// Read after the only entry — nothing new
-	result := s.XRead([]string{"stream"}, []string{"1-1"})
+	result, _ := s.XRead([]string{"stream"}, []string{"1-1"}, 0)
 	if _, ok := result["stream"]; ok {
 		t.Error("XRead should not return entries when nothing is after the given ID")
 	}
@@ -458,11 +458,19 @@ func TestStore_Type_ExpiredKey(t *testing.T) {
 	s := NewStore()
 	s.Set("exp", "val", time.Now().Add(-1*time.Second))
 
-	// Type does NOT do lazy expiry — this is a known behavior
-	// The key is still in the store until a Get triggers cleanup
+	// Type applies lazy expiry like every other accessor.
 	typ := s.Type("exp")
-	if typ != "string" {
-		t.Errorf("Type(expired key before Get) = %q, want 'string'", typ)
+	if typ != "none" {
+		t.Errorf("Type(expired key before Get) = %q, want 'none'", typ)
+	}
+}
+
+func TestStore_Get_WrongType(t *testing.T) {
+	s := NewStore()
+	s.RPush("l", false, "a")
+
+	if _, _, err := s.Get("l"); err != ErrWrongType {
+		t.Errorf("Get on a list error = %v, want ErrWrongType", err)
 	}
 }
 
@@ -470,9 +478,8 @@ func TestStore_XRange_NonStreamType(t *testing.T) {
 	s := NewStore()
 	s.Set("str", "val", time.Time{})
 
-	_, ok := s.XRange("str", "0-0", "1-0")
-	if ok {
-		t.Error("XRange on string type should return false")
+	if _, _, err := s.XRange("str", "0-0", "1-0", 0); err != ErrWrongType {
+		t.Errorf("XRange on string type error = %v, want ErrWrongType", err)
 	}
 }
 
@@ -521,7 +528,7 @@ func TestStore_XAdd_MultipleEntries(t *testing.T) {
 	}
 
 	// XRead from the beginning
-	result := s.XRead([]string{"stream"}, []string{"0-0"})
+	result, _ := s.XRead([]string{"stream"}, []string{"0-0"}, 0)
 	if len(result["stream"]) != 3 {
 		t.Errorf("XRead all = %d entries, want 3", len(result["stream"]))
 	}
@@ -531,7 +538,7 @@ func TestStore_XRange_BugFix_StartEqualsEnd(t *testing.T) {
 	s := NewStore()
 	s.XAdd("stream", "1-1", map[string]string{"a": "1"})
 
-	entries, ok := s.XRange("stream", "1-1", "1-1")
+	entries, ok, _ := s.XRange("stream", "1-1", "1-1", 0)
 	if !ok {
 		t.Fatal("XRange should return true")
 	}
@@ -548,7 +555,7 @@ func TestStore_XRange_CrossTimestamp(t *testing.T) {
 	s.XAdd("stream", "3-1", map[string]string{"c": "3"})
 
 	// Range spanning multiple timestamps
-	entries, ok := s.XRange("stream", "1-0", "3-2")
+	entries, ok, _ := s.XRange("stream", "1-0", "3-2", 0)
 	if !ok {
 		t.Fatal("XRange should return true")
 	}
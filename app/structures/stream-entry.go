@@ -1,6 +1,9 @@
 package structures
 
-import "fmt"
+import (
+    "fmt"
+    "math"
+)
 
 type Entry struct {
     Pairs     map[string]string
@@ -23,3 +26,41 @@ func (e *Entry) Seq() int {
 func (e *Entry) Key() string {
     return fmt.Sprintf("%d-%d", e.timestamp, e.seq)
 }
+
+func (e *Entry) id() streamID {
+    return streamID{ms: e.timestamp, seq: e.seq}
+}
+
+// streamID is the position of an entry in a stream, ordered by time and then
+// sequence number.
+type streamID struct {
+    ms  int64
+    seq int
+}
+
+// maxStreamID is the greatest possible entry ID.
+var maxStreamID = streamID{ms: math.MaxInt64, seq: math.MaxInt}
+
+func (id streamID) less(other streamID) bool {
+    return id.ms < other.ms || (id.ms == other.ms && id.seq < other.seq)
+}
+
+func (id streamID) String() string {
+    return fmt.Sprintf("%d-%d", id.ms, id.seq)
+}
+
+// next returns the ID following id, which must not be maxStreamID.
+func (id streamID) next() streamID {
+    if id.seq == math.MaxInt {
+        return streamID{ms: id.ms + 1}
+    }
+    return streamID{ms: id.ms, seq: id.seq + 1}
+}
+
+// prev returns the ID preceding id, which must not be 0-0.
+func (id streamID) prev() streamID {
+    if id.seq == 0 {
+        return streamID{ms: id.ms - 1, seq: math.MaxInt}
+    }
+    return streamID{ms: id.ms, seq: id.seq - 1}
+}
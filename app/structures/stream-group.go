@@ -0,0 +1,210 @@
+package structures
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrInvalidStreamID is returned for arguments that are not valid entry
+	// IDs.
+	ErrInvalidStreamID = errors.New("ERR Invalid stream ID specified as stream command argument")
+	// ErrBusyGroup is returned when creating a group that already exists.
+	ErrBusyGroup = errors.New("BUSYGROUP Consumer Group name already exists")
+	// ErrXGroupNoKey is returned by XGROUP subcommands run on a missing key.
+	ErrXGroupNoKey = errors.New("ERR The XGROUP subcommand requires the key to exist. Note that for CREATE you may want to use the MKSTREAM option to create an empty stream automatically.")
+)
+
+// noGroupError reports a consumer group missing from the stream at key.
+func noGroupError(key, group string) error {
+	return fmt.Errorf("NOGROUP No such consumer group '%s' for key name '%s'", group, key)
+}
+
+// consumerGroup tracks how far a group has read a stream and the entries
+// delivered to its consumers but not yet acknowledged.
+type consumerGroup struct {
+	lastID streamID
+	// pending is the group's pending entries list (PEL); each entry is
+	// also in the PEL of the consumer owning it. order keeps its IDs sorted
+	// for range and cursor queries.
+	pending   map[streamID]*pendingEntry
+	order     pelIndex
+	consumers map[string]*consumer
+}
+
+// consumer is a member of a consumer group.
+type consumer struct {
+	name string
+	// seenTime is the unix time in milliseconds of the consumer's last
+	// interaction with the group.
+	seenTime int64
+	pending  map[streamID]*pendingEntry
+	order    pelIndex
+}
+
+// pendingEntry records the delivery of an entry to a consumer.
+type pendingEntry struct {
+	id    streamID
+	owner *consumer
+	// deliveryTime is the unix time in milliseconds of the last delivery.
+	deliveryTime  int64
+	deliveryCount int
+}
+
+func newConsumerGroup(lastID streamID) *consumerGroup {
+	return &consumerGroup{
+		lastID:    lastID,
+		pending:   make(map[streamID]*pendingEntry),
+		consumers: make(map[string]*consumer),
+	}
+}
+
+// clone returns an independent copy of the group, consumers and pending
+// entries included.
+func (g *consumerGroup) clone() *consumerGroup {
+	clone := newConsumerGroup(g.lastID)
+	for name, c := range g.consumers {
+		clone.consumers[name] = &consumer{
+			name:     c.name,
+			seenTime: c.seenTime,
+			pending:  make(map[streamID]*pendingEntry, len(c.pending)),
+		}
+	}
+	// Copying in ID order appends to the indexes rather than inserting.
+	g.order.ascend(streamID{}, func(id streamID) bool {
+		pe := g.pending[id]
+		owner := clone.consumers[pe.owner.name]
+		clone.addPending(&pendingEntry{id: id, owner: owner, deliveryTime: pe.deliveryTime, deliveryCount: pe.deliveryCount})
+		return true
+	})
+	return clone
+}
+
+// consumer returns the named consumer, creating it if needed, and reports
+// whether it was created.
+func (g *consumerGroup) consumer(name string) (*consumer, bool) {
+	if c, ok := g.consumers[name]; ok {
+		return c, false
+	}
+	c := &consumer{name: name, pending: make(map[streamID]*pendingEntry)}
+	g.consumers[name] = c
+	return c, true
+}
+
+// deleteConsumer removes the named consumer, dropping its pending entries,
+// and returns how many it had.
+func (g *consumerGroup) deleteConsumer(name string) int {
+	c, ok := g.consumers[name]
+	if !ok {
+		return 0
+	}
+	for id := range c.pending {
+		delete(g.pending, id)
+		g.order.remove(id)
+	}
+	delete(g.consumers, name)
+	return len(c.pending)
+}
+
+// deliverNew hands c up to count entries never delivered to the group,
+// advancing the group's last delivered ID. Unless noAck is set, each entry
+// is added to the pending entries lists.
+func (g *consumerGroup) deliverNew(s *Stream, c *consumer, count int, noAck bool, now int64) []Entry {
+	entries := s.entriesAfter(g.lastID, count)
+	for _, e := range entries {
+		g.lastID = e.id()
+		if noAck {
+			continue
+		}
+		pe := &pendingEntry{id: e.id(), owner: c, deliveryTime: now, deliveryCount: 1}
+		if old, ok := g.pending[pe.id]; ok {
+			// Possible after SETID moved the group back: the entry passes
+			// to c and keeps its delivery history.
+			g.removePending(old)
+			pe.deliveryCount = old.deliveryCount + 1
+		}
+		g.addPending(pe)
+	}
+	return entries
+}
+
+// pendingAfter returns up to count of c's own pending entries with an ID
+// greater than after. Reading this history is not a new delivery, so their
+// delivery time and count are left alone. Entries deleted from the stream
+// since are returned with nil Pairs.
+func (g *consumerGroup) pendingAfter(s *Stream, c *consumer, after streamID, count int) []Entry {
+	entries := []Entry{}
+	c.order.ascend(after, func(id streamID) bool {
+		if id == after {
+			return true
+		}
+		e, ok := s.entry(id)
+		if !ok {
+			e = NewEntry(id.ms, id.seq, nil)
+		}
+		entries = append(entries, e)
+		return count <= 0 || len(entries) < count
+	})
+	return entries
+}
+
+// pendingIDs returns, in order, up to count of the IDs in the group's
+// pending entries list between start and end inclusive; a count of 0 means
+// no limit.
+func (g *consumerGroup) pendingIDs(start, end streamID, count int) []streamID {
+	ids := []streamID{}
+	g.order.ascend(start, func(id streamID) bool {
+		if end.less(id) {
+			return false
+		}
+		ids = append(ids, id)
+		return count <= 0 || len(ids) < count
+	})
+	return ids
+}
+
+// addPending adds pe to the pending entries lists of the group and of its
+// owner.
+func (g *consumerGroup) addPending(pe *pendingEntry) {
+	g.pending[pe.id] = pe
+	g.order.insert(pe.id)
+	pe.owner.pending[pe.id] = pe
+	pe.owner.order.insert(pe.id)
+}
+
+// removePending removes pe from the pending entries lists of the group and
+// of its owner.
+func (g *consumerGroup) removePending(pe *pendingEntry) {
+	delete(g.pending, pe.id)
+	g.order.remove(pe.id)
+	delete(pe.owner.pending, pe.id)
+	pe.owner.order.remove(pe.id)
+}
+
+// ack removes id from the pending entries lists and reports whether it was
+// pending.
+func (g *consumerGroup) ack(id streamID) bool {
+	pe, ok := g.pending[id]
+	if !ok {
+		return false
+	}
+	g.removePending(pe)
+	return true
+}
+
+// claim transfers the pending entry id to c, adding it to the pending
+// entries lists first if needed, and returns it.
+func (g *consumerGroup) claim(id streamID, c *consumer) *pendingEntry {
+	pe, ok := g.pending[id]
+	if ok {
+		if pe.owner == c {
+			return pe
+		}
+		g.removePending(pe)
+	} else {
+		pe = &pendingEntry{id: id}
+	}
+	pe.owner = c
+	g.addPending(pe)
+	return pe
+}
@@ -0,0 +1,166 @@
+package structures
+
+import "sort"
+
+// streamChunkSize is the most entries a chunk holds, like the entry limit
+// of the listpacks Redis keeps stream entries in.
+const streamChunkSize = 128
+
+// streamIndex keeps the entries of a stream in ID order as a list of
+// chunks, each holding consecutive entries. Finding an ID is a binary
+// search over the chunks followed by one within a chunk, so a range scan
+// costs O(log n + k). Stream IDs only ever grow, so adding an entry appends
+// to the last chunk; removing entries shrinks their chunk in place, and
+// chunks left empty are dropped.
+type streamIndex struct {
+	chunks [][]Entry
+}
+
+// append adds e, whose ID must be greater than any in the index.
+func (x *streamIndex) append(e Entry) {
+	n := len(x.chunks)
+	if n == 0 || len(x.chunks[n-1]) == streamChunkSize {
+		x.chunks = append(x.chunks, make([]Entry, 0, streamChunkSize))
+		n++
+	}
+	x.chunks[n-1] = append(x.chunks[n-1], e)
+}
+
+// seek returns the position of the first entry with an ID of at least id,
+// as a chunk and an offset within it. The chunk is len(x.chunks) when every
+// entry is smaller.
+func (x *streamIndex) seek(id streamID) (int, int) {
+	c := sort.Search(len(x.chunks), func(i int) bool {
+		chunk := x.chunks[i]
+		last := chunk[len(chunk)-1]
+		return !last.id().less(id)
+	})
+	if c == len(x.chunks) {
+		return c, 0
+	}
+	chunk := x.chunks[c]
+	return c, sort.Search(len(chunk), func(i int) bool {
+		return !chunk[i].id().less(id)
+	})
+}
+
+// get returns the entry with the given ID.
+func (x *streamIndex) get(id streamID) (Entry, bool) {
+	c, i := x.seek(id)
+	if c == len(x.chunks) || x.chunks[c][i].id() != id {
+		return Entry{}, false
+	}
+	return x.chunks[c][i], true
+}
+
+// seekFloor returns the position of the last entry with an ID of at most
+// id, and false when every entry is greater.
+func (x *streamIndex) seekFloor(id streamID) (int, int, bool) {
+	c, i := x.seek(id)
+	switch {
+	case c < len(x.chunks) && x.chunks[c][i].id() == id:
+		return c, i, true
+	case i > 0:
+		return c, i - 1, true
+	case c > 0:
+		return c - 1, len(x.chunks[c-1]) - 1, true
+	}
+	return 0, 0, false
+}
+
+// floor returns the entry with the greatest ID not above id.
+func (x *streamIndex) floor(id streamID) (Entry, bool) {
+	c, i, ok := x.seekFloor(id)
+	if !ok {
+		return Entry{}, false
+	}
+	return x.chunks[c][i], true
+}
+
+// last returns the entry with the greatest ID.
+func (x *streamIndex) last() (Entry, bool) {
+	if len(x.chunks) == 0 {
+		return Entry{}, false
+	}
+	chunk := x.chunks[len(x.chunks)-1]
+	return chunk[len(chunk)-1], true
+}
+
+// ascend calls visit with the entries from the first with an ID of at
+// least from, in ID order, until visit returns false.
+func (x *streamIndex) ascend(from streamID, visit func(e Entry) bool) {
+	c, i := x.seek(from)
+	for ; c < len(x.chunks); c, i = c+1, 0 {
+		for _, e := range x.chunks[c][i:] {
+			if !visit(e) {
+				return
+			}
+		}
+	}
+}
+
+// descend calls visit with the entries from the last with an ID of at most
+// from, in reverse ID order, until visit returns false.
+func (x *streamIndex) descend(from streamID, visit func(e Entry) bool) {
+	c, i, ok := x.seekFloor(from)
+	if !ok {
+		return
+	}
+	for ; c >= 0; c-- {
+		if i < 0 {
+			i = len(x.chunks[c]) - 1
+		}
+		for ; i >= 0; i-- {
+			if !visit(x.chunks[c][i]) {
+				return
+			}
+		}
+	}
+}
+
+// remove deletes the entry with the given ID and returns it, reporting
+// whether it existed.
+func (x *streamIndex) remove(id streamID) (Entry, bool) {
+	c, i := x.seek(id)
+	if c == len(x.chunks) || x.chunks[c][i].id() != id {
+		return Entry{}, false
+	}
+
+	chunk := x.chunks[c]
+	e := chunk[i]
+	if len(chunk) == 1 {
+		x.chunks = append(x.chunks[:c], x.chunks[c+1:]...)
+		return e, true
+	}
+	x.chunks[c] = append(chunk[:i], chunk[i+1:]...)
+	return e, true
+}
+
+// front returns the first chunk, or nil when the index is empty.
+func (x *streamIndex) front() []Entry {
+	if len(x.chunks) == 0 {
+		return nil
+	}
+	return x.chunks[0]
+}
+
+// dropFront removes the first n entries of the first chunk, dropping the
+// chunk when that empties it.
+func (x *streamIndex) dropFront(n int) {
+	if n == len(x.chunks[0]) {
+		x.chunks = x.chunks[1:]
+		return
+	}
+	x.chunks[0] = x.chunks[0][n:]
+}
+
+// clone returns a copy of the index that can change independently. Entries
+// are never modified once added, so their fields are shared.
+func (x *streamIndex) clone() streamIndex {
+	chunks := make([][]Entry, len(x.chunks))
+	for i, chunk := range x.chunks {
+		chunks[i] = make([]Entry, len(chunk), streamChunkSize)
+		copy(chunks[i], chunk)
+	}
+	return streamIndex{chunks: chunks}
+}
@@ -0,0 +1,108 @@
+package structures
+
+import "sort"
+
+// pelChunkSize is the most IDs a chunk of a pelIndex holds before it is
+// split.
+const pelChunkSize = 128
+
+// pelIndex keeps the IDs of a pending entries list in order, as a list of
+// sorted chunks like a streamIndex. Unlike stream entries, entries can join
+// a PEL at any ID, through XCLAIM or after XGROUP SETID moved a group back,
+// so adding an ID inserts it into its chunk, splitting the chunk once full.
+// Finding an ID costs O(log n), and walking k IDs from there O(k).
+type pelIndex struct {
+	chunks [][]streamID
+}
+
+// seek returns the position of the first ID of at least id, as a chunk and
+// an offset within it. The chunk is len(x.chunks) when every ID is smaller.
+func (x *pelIndex) seek(id streamID) (int, int) {
+	c := sort.Search(len(x.chunks), func(i int) bool {
+		chunk := x.chunks[i]
+		return !chunk[len(chunk)-1].less(id)
+	})
+	if c == len(x.chunks) {
+		return c, 0
+	}
+	chunk := x.chunks[c]
+	return c, sort.Search(len(chunk), func(i int) bool {
+		return !chunk[i].less(id)
+	})
+}
+
+// insert adds id, which must not be in the index.
+func (x *pelIndex) insert(id streamID) {
+	c, i := x.seek(id)
+	if c == len(x.chunks) {
+		// Past every ID: the usual case, as deliveries come in ID order.
+		if c == 0 || len(x.chunks[c-1]) == pelChunkSize {
+			x.chunks = append(x.chunks, make([]streamID, 0, pelChunkSize))
+			c++
+		}
+		c--
+		x.chunks[c] = append(x.chunks[c], id)
+		return
+	}
+
+	chunk := append(x.chunks[c], streamID{})
+	copy(chunk[i+1:], chunk[i:])
+	chunk[i] = id
+	if len(chunk) <= pelChunkSize {
+		x.chunks[c] = chunk
+		return
+	}
+
+	half := len(chunk) / 2
+	upper := make([]streamID, len(chunk)-half, pelChunkSize)
+	copy(upper, chunk[half:])
+	x.chunks[c] = chunk[:half:half]
+	x.chunks = append(x.chunks, nil)
+	copy(x.chunks[c+2:], x.chunks[c+1:])
+	x.chunks[c+1] = upper
+}
+
+// remove deletes id and reports whether it was in the index.
+func (x *pelIndex) remove(id streamID) bool {
+	c, i := x.seek(id)
+	if c == len(x.chunks) || x.chunks[c][i] != id {
+		return false
+	}
+	chunk := x.chunks[c]
+	if len(chunk) == 1 {
+		x.chunks = append(x.chunks[:c], x.chunks[c+1:]...)
+		return true
+	}
+	x.chunks[c] = append(chunk[:i], chunk[i+1:]...)
+	return true
+}
+
+// ascend calls visit with the IDs from the first of at least from, in
+// order, until visit returns false. visit must not change the index.
+func (x *pelIndex) ascend(from streamID, visit func(id streamID) bool) {
+	c, i := x.seek(from)
+	for ; c < len(x.chunks); c, i = c+1, 0 {
+		for _, id := range x.chunks[c][i:] {
+			if !visit(id) {
+				return
+			}
+		}
+	}
+}
+
+// first returns the smallest ID.
+func (x *pelIndex) first() (streamID, bool) {
+	if len(x.chunks) == 0 {
+		return streamID{}, false
+	}
+	return x.chunks[0][0], true
+}
+
+// last returns the greatest ID.
+func (x *pelIndex) last() (streamID, bool) {
+	if len(x.chunks) == 0 {
+		return streamID{}, false
+	}
+	chunk := x.chunks[len(x.chunks)-1]
+	return chunk[len(chunk)-1], true
+}
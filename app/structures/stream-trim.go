@@ -0,0 +1,132 @@
+package structures
+
+import "sort"
+
+// TrimBy selects what trimming a stream caps: nothing, its length or the
+// IDs of its entries.
+type TrimBy int
+
+const (
+	TrimNone TrimBy = iota
+	TrimByMaxLen
+	TrimByMinID
+)
+
+// defaultTrimLimit is the most entries an approximate trim removes unless
+// given a LIMIT, like Redis' default of 100 nodes' worth.
+const defaultTrimLimit = 100 * streamChunkSize
+
+// TrimOptions describes how XTRIM and XADD trim a stream, always removing
+// its oldest entries.
+type TrimOptions struct {
+	By TrimBy
+	// MaxLen is the length to trim down to, with TrimByMaxLen.
+	MaxLen int
+	// MinID is the smallest ID to keep, with TrimByMinID.
+	MinID string
+	// Approx only removes whole chunks of entries, which is cheaper but
+	// may keep some entries past the threshold, like Redis' "~".
+	Approx bool
+	// Limit, when HasLimit is set, caps the entries an approximate trim
+	// removes; 0 means no cap. Otherwise defaultTrimLimit applies.
+	Limit    int
+	HasLimit bool
+}
+
+// minID parses the MinID of a TrimByMinID trim.
+func (opts TrimOptions) minID() (streamID, error) {
+	if opts.By != TrimByMinID {
+		return streamID{}, nil
+	}
+	return parseStreamID(opts.MinID)
+}
+
+// forget updates the length and size of the stream for a removed entry.
+func (s *Stream) forget(e Entry) {
+	s.size--
+	s.bytes -= entryBytes(e)
+}
+
+// delete removes the entries with the given IDs, raising maxDeletedID, and
+// returns how many were in the stream.
+func (s *Stream) delete(ids []streamID) int {
+	deleted := 0
+	for _, id := range ids {
+		e, ok := s.entries.remove(id)
+		if !ok {
+			continue
+		}
+		s.forget(e)
+		if s.maxDeletedID.less(id) {
+			s.maxDeletedID = id
+		}
+		deleted++
+	}
+	return deleted
+}
+
+// trim removes the oldest entries as opts asks, given its parsed MinID, and
+// returns how many it removed. Whole chunks go at once; an exact trim then
+// removes single entries of the first chunk left, while an approximate one
+// stops there.
+func (s *Stream) trim(opts TrimOptions, minID streamID) int {
+	limit := 0
+	if opts.Approx {
+		limit = defaultTrimLimit
+		if opts.HasLimit {
+			limit = opts.Limit
+		}
+	}
+
+	removed := 0
+	for chunk := s.entries.front(); chunk != nil; chunk = s.entries.front() {
+		n := s.trimmable(chunk, opts, minID)
+		if n == 0 {
+			break
+		}
+		if opts.Approx && (n < len(chunk) || (limit > 0 && removed+n > limit)) {
+			break
+		}
+
+		for _, e := range chunk[:n] {
+			s.forget(e)
+		}
+		s.entries.dropFront(n)
+		removed += n
+	}
+	return removed
+}
+
+// exactTrim returns the exact trim that leaves the stream, as trimmed by
+// opts, the way it is. An approximate trim depends on how the entries are
+// laid out in chunks, so replicas must be sent this one instead.
+func (s *Stream) exactTrim(opts TrimOptions) TrimOptions {
+	if !opts.Approx {
+		return opts
+	}
+	exact := TrimOptions{By: opts.By}
+	switch opts.By {
+	case TrimByMaxLen:
+		exact.MaxLen = s.size
+	case TrimByMinID:
+		exact.MinID = opts.MinID
+		if chunk := s.entries.front(); chunk != nil {
+			exact.MinID = chunk[0].id().String()
+		}
+	}
+	return exact
+}
+
+// trimmable returns how many entries from the start of chunk, the first of
+// the stream, are past the threshold of opts.
+func (s *Stream) trimmable(chunk []Entry, opts TrimOptions, minID streamID) int {
+	switch opts.By {
+	case TrimByMaxLen:
+		return min(max(s.size-opts.MaxLen, 0), len(chunk))
+	case TrimByMinID:
+		return sort.Search(len(chunk), func(i int) bool {
+			return !chunk[i].id().less(minID)
+		})
+	}
+	return 0
+}
@@ -7,15 +7,27 @@ import (
     "time"
 )
 
+// Stream is an append-only log of entries ordered by ID.
 type Stream struct {
-    Entries       map[int64][]Entry
+    entries       streamIndex
     size          int
     lastTimestamp int64
+    // lastSeq completes the ID of the last entry added, which deleting
+    // entries leaves unchanged.
+    lastSeq int
+    // entriesAdded counts every entry ever added and maxDeletedID is the
+    // greatest ID deleted with XDEL, like the Redis 7 stream fields.
+    entriesAdded int64
+    maxDeletedID streamID
+    // bytes is the total length of the entry fields and values, for
+    // memory accounting.
+    bytes int
+    // groups holds the consumer groups by name, nil until one is created.
+    groups map[string]*consumerGroup
 }
 
 func NewStream() *Stream {
     return &Stream{
-        Entries:       map[int64][]Entry{},
         size:          0,
         lastTimestamp: -1,
     }
@@ -35,18 +47,13 @@ func (s *Stream) Add(key string, pairs map[string]string) (string, error) {
     if err != nil {
         return key, err
     }
-    if _, ok := s.Entries[timestamp]; !ok {
-        s.Entries[timestamp] = []Entry{}
-    }
-
     newEntry := NewEntry(timestamp, seq, pairs)
-
-    s.Entries[timestamp] = append(s.Entries[timestamp], newEntry)
+    s.entries.append(newEntry)
 
     s.size++
-    if timestamp > s.lastTimestamp {
-        s.lastTimestamp = timestamp
-    }
+    s.bytes += entryBytes(newEntry)
+    s.lastTimestamp, s.lastSeq = timestamp, seq
+    s.entriesAdded++
 
     return newEntry.Key(), nil
 }
@@ -59,12 +66,8 @@ func (s *Stream) Get(key string) (map[string]string, bool) {
 
     seq, _ := strconv.Atoi(seqStr)
 
-    for _, e := range s.Entries[timestamp] {
-        if e.seq == seq {
-            return e.Pairs, true
-        }
-    }
-    return nil, false
+    e, ok := s.entry(streamID{ms: timestamp, seq: seq})
+    return e.Pairs, ok
 }
 
 func (s *Stream) validateKey(timestamp int64, seq int) error {
@@ -72,11 +75,11 @@ func (s *Stream) validateKey(timestamp int64, seq int) error {
         return fmt.Errorf("ERR The ID specified in XADD must be greater than 0-0")
     }
 
-    if s.size == 0 {
+    if s.lastTimestamp < 0 {
         return nil
     }
 
-    if (timestamp < s.lastTimestamp) || (timestamp == s.lastTimestamp && seq <= s.LastSeq(timestamp)) {
+    if !s.lastID().less(streamID{ms: timestamp, seq: seq}) {
         return fmt.Errorf("ERR The ID specified in XADD is equal or smaller than the target stream top item")
     }
 
@@ -86,16 +89,21 @@ func (s *Stream) validateKey(timestamp int64, seq int) error {
 func (s *Stream) formatKey(timestamp int64, strSeq string) (int64, int, error) {
     if timestamp < 0 {
         unixtimestamp := time.Now().UnixMilli()
+        if unixtimestamp <= s.lastTimestamp {
+            return s.lastTimestamp, s.lastSeq + 1, nil
+        }
         return unixtimestamp, 0, nil
     }
 
     if strSeq == "*" {
-        lastSeq := s.LastSeq(timestamp)
-        if timestamp == 0 && lastSeq == -1 {
-            lastSeq = 0
+        if timestamp == s.lastTimestamp {
+            return timestamp, s.lastSeq + 1, nil
+        }
+        if timestamp == 0 {
+            return timestamp, 1, nil
         }
 
-        return timestamp, lastSeq + 1, nil
+        return timestamp, 0, nil
     }
 
     seq, err := strconv.Atoi(strSeq)
@@ -111,9 +119,10 @@ func parseKey(key string) (int64, string, error) {
         return -1, "*", nil
     }
 
+    // A bare millisecond time stands for its first sequence number.
     ids := strings.Split(key, "-")
     if len(ids) == 1 {
-        return 0, "0", nil
+        ids = append(ids, "0")
     }
 
     timestamp, err := strconv.ParseInt(ids[0], 10, 64)
@@ -125,12 +134,12 @@ func parseKey(key string) (int64, string, error) {
 }
 
 func (s *Stream) LastSeq(timestamp int64) int {
-    entries, ok := s.Entries[timestamp]
-    if !ok {
+    e, ok := s.entries.floor(streamID{ms: timestamp, seq: maxStreamID.seq})
+    if !ok || e.timestamp != timestamp {
         return -1
     }
 
-    return entries[len(entries)-1].Seq()
+    return e.Seq()
 }
 
 func (s *Stream) LastTimestamp() int64 {
@@ -141,65 +150,195 @@ func (s *Stream) Len() int {
     return s.size
 }
 
-func (s *Stream) Range(start, end string) []Entry {
-    startTimestamp, startSeqStr, err := parseKey(start)
-    if err != nil {
-        return []Entry{}
+// EntriesAdded returns how many entries were ever added to the stream,
+// deleted ones included.
+func (s *Stream) EntriesAdded() int64 {
+    return s.entriesAdded
+}
+
+// MaxDeletedID returns the greatest ID deleted from the stream with XDEL, or
+// 0-0 when none was.
+func (s *Stream) MaxDeletedID() string {
+    return s.maxDeletedID.String()
+}
+
+// Clone returns an independent copy of the stream. Entries are never
+// modified once added, so they are shared.
+func (s *Stream) Clone() *Stream {
+    clone := &Stream{
+        entries:       s.entries.clone(),
+        size:          s.size,
+        lastTimestamp: s.lastTimestamp,
+        lastSeq:       s.lastSeq,
+        entriesAdded:  s.entriesAdded,
+        maxDeletedID:  s.maxDeletedID,
+        bytes:         s.bytes,
+    }
+    for name, group := range s.groups {
+        if clone.groups == nil {
+            clone.groups = make(map[string]*consumerGroup, len(s.groups))
+        }
+        clone.groups[name] = group.clone()
     }
+    return clone
+}
 
-    endTimestamp, endSeqStr, err := parseKey(end)
-    if err != nil {
-        return []Entry{}
+// lastID returns the ID of the last entry added, or 0-0 for a stream that
+// never had any.
+func (s *Stream) lastID() streamID {
+    if s.lastTimestamp < 0 {
+        return streamID{}
+    }
+    return streamID{ms: s.lastTimestamp, seq: s.lastSeq}
+}
+
+// entryBytes returns the total length of the fields and values of e, for
+// memory accounting.
+func entryBytes(e Entry) int {
+    n := 0
+    for field, value := range e.Pairs {
+        n += len(field) + len(value)
     }
+    return n
+}
 
-    startSeq, _ := strconv.Atoi(startSeqStr)
-    endSeq, _ := strconv.Atoi(endSeqStr)
+// entry returns the entry with the given ID.
+func (s *Stream) entry(id streamID) (Entry, bool) {
+    return s.entries.get(id)
+}
 
+// entriesAfter returns, in ID order, up to count entries with an ID greater
+// than after; a count of 0 means no limit.
+func (s *Stream) entriesAfter(after streamID, count int) []Entry {
+    if after == maxStreamID {
+        return []Entry{}
+    }
+    return s.entriesBetween(after.next(), maxStreamID, count)
+}
+
+// entriesBetween returns, in ID order, up to count entries with an ID from
+// start to end inclusive; a count of 0 means no limit.
+func (s *Stream) entriesBetween(start, end streamID, count int) []Entry {
     entries := []Entry{}
-    for timestamp, entry := range s.Entries {
-        if timestamp > startTimestamp && timestamp < endTimestamp {
-            entries = append(entries, entry...)
-        } else if timestamp == startTimestamp || timestamp == endTimestamp {
-            for _, e := range entry {
-                if timestamp == startTimestamp && e.Seq() < startSeq {
-                    continue
-                }
-
-                if timestamp == endTimestamp && e.Seq() > endSeq {
-                    break
-                }
-                entries = append(entries, e)
-            }
+    s.entries.ascend(start, func(e Entry) bool {
+        if end.less(e.id()) {
+            return false
         }
-    }
+        entries = append(entries, e)
+        return count == 0 || len(entries) < count
+    })
+    return entries
+}
 
+// entriesBetweenRev returns, in reverse ID order, up to count entries with an
+// ID from end down to start inclusive; a count of 0 means no limit.
+func (s *Stream) entriesBetweenRev(end, start streamID, count int) []Entry {
+    entries := []Entry{}
+    s.entries.descend(end, func(e Entry) bool {
+        if e.id().less(start) {
+            return false
+        }
+        entries = append(entries, e)
+        return count == 0 || len(entries) < count
+    })
     return entries
 }
 
-func (s *Stream) Read(start string) []Entry {
-    startTimestamp, startSeqStr, err := parseKey(start)
+// parseRange parses the start and end bounds of an ID range.
+func parseRange(start, end string) (streamID, streamID, error) {
+    startID, err := parseRangeID(start, false)
     if err != nil {
-        return []Entry{}
+        return streamID{}, streamID{}, err
+    }
+    endID, err := parseRangeID(end, true)
+    if err != nil {
+        return streamID{}, streamID{}, err
     }
+    return startID, endID, nil
+}
 
-    startSeq, _ := strconv.Atoi(startSeqStr)
+// parseRangeID parses a bound of an ID range. "-" and "+" stand for the
+// smallest and greatest IDs, a bare "ms" for ms-0 as a start and for the
+// last possible sequence of ms as an end, and a leading "(" excludes the
+// bound itself.
+func parseRangeID(value string, end bool) (streamID, error) {
+    switch value {
+    case "-":
+        return streamID{}, nil
+    case "+":
+        return maxStreamID, nil
+    }
 
-    entries := []Entry{}
+    exclusive := strings.HasPrefix(value, "(")
+    value = strings.TrimPrefix(value, "(")
+    id, err := parseStreamID(value)
+    if err != nil {
+        return streamID{}, err
+    }
+    if end && !strings.Contains(value, "-") {
+        id.seq = maxStreamID.seq
+    }
+    if !exclusive {
+        return id, nil
+    }
 
-    for timestamp, entry := range s.Entries {
-        if timestamp >= startTimestamp {
-            if timestamp == startTimestamp {
-                for _, e := range entry {
-                    if e.Seq() <= startSeq {
-                        continue
-                    }
-
-                    entries = append(entries, e)
-                }
-            } else {
-                entries = append(entries, entry...)
-            }
+    if end {
+        if id == (streamID{}) {
+            return streamID{}, fmt.Errorf("ERR invalid end ID for the interval")
         }
+        return id.prev(), nil
     }
-    return entries
+    if id == maxStreamID {
+        return streamID{}, fmt.Errorf("ERR invalid start ID for the interval")
+    }
+    return id.next(), nil
+}
+
+// parseStreamID parses a complete entry ID, either "ms-seq" or a bare "ms"
+// standing for ms-0.
+func parseStreamID(value string) (streamID, error) {
+    msStr, seqStr, hasSeq := strings.Cut(value, "-")
+    ms, err := strconv.ParseInt(msStr, 10, 64)
+    if err != nil || ms < 0 {
+        return streamID{}, ErrInvalidStreamID
+    }
+    if !hasSeq {
+        return streamID{ms: ms}, nil
+    }
+    seq, err := strconv.Atoi(seqStr)
+    if err != nil || seq < 0 {
+        return streamID{}, ErrInvalidStreamID
+    }
+    return streamID{ms: ms, seq: seq}, nil
+}
+
+// Range returns, in ID order, up to count entries between the start and end
+// bounds of an ID range, as parsed by parseRangeID; a count of 0 means no
+// limit.
+func (s *Stream) Range(start, end string, count int) ([]Entry, error) {
+    startID, endID, err := parseRange(start, end)
+    if err != nil {
+        return nil, err
+    }
+    return s.entriesBetween(startID, endID, count), nil
+}
+
+// RevRange is like Range but returns the entries in reverse ID order, from
+// end down to start.
+func (s *Stream) RevRange(end, start string, count int) ([]Entry, error) {
+    startID, endID, err := parseRange(start, end)
+    if err != nil {
+        return nil, err
+    }
+    return s.entriesBetweenRev(endID, startID, count), nil
+}
+
+// Read returns, in ID order, up to count entries with an ID greater than
+// after; a count of 0 means no limit.
+func (s *Stream) Read(after string, count int) ([]Entry, error) {
+    id, err := parseStreamID(after)
+    if err != nil {
+        return nil, err
+    }
+    return s.entriesAfter(id, count), nil
 }
@@ -0,0 +1,474 @@
+package structures
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// entryKeys returns the IDs of entries.
+func entryKeys(entries []Entry) []string {
+	keys := make([]string, len(entries))
+	for i, e := range entries {
+		keys[i] = e.Key()
+	}
+	return keys
+}
+
+// newGroupStream returns a store holding a stream with entries 1-1 to 5-1
+// and a group "g" reading it from the start.
+func newGroupStream(t *testing.T) *Store {
+	t.Helper()
+	s := NewStore()
+	for _, id := range []string{"1-1", "2-1", "3-1", "4-1", "5-1"} {
+		if _, err := s.XAdd("s", id, map[string]string{"f": id}); err != nil {
+			t.Fatalf("XAdd(%s) error = %v", id, err)
+		}
+	}
+	if err := s.XGroupCreate("s", "g", "0", false); err != nil {
+		t.Fatalf("XGroupCreate error = %v", err)
+	}
+	return s
+}
+
+func TestStore_XGroupCreate(t *testing.T) {
+	s := NewStore()
+
+	if err := s.XGroupCreate("s", "g", "$", false); err != ErrXGroupNoKey {
+		t.Errorf("XGroupCreate on a missing key error = %v, want ErrXGroupNoKey", err)
+	}
+	if err := s.XGroupCreate("s", "g", "bad", true); err != ErrInvalidStreamID {
+		t.Errorf("XGroupCreate with a bad ID error = %v, want ErrInvalidStreamID", err)
+	}
+	if s.Exists("s") != 0 {
+		t.Error("a failed MKSTREAM must not create the key")
+	}
+	if err := s.XGroupCreate("s", "g", "$", true); err != nil {
+		t.Fatalf("XGroupCreate MKSTREAM error = %v", err)
+	}
+	if s.Type("s") != "stream" {
+		t.Errorf("MKSTREAM created a %q, want a stream", s.Type("s"))
+	}
+	if err := s.XGroupCreate("s", "g", "$", false); err != ErrBusyGroup {
+		t.Errorf("XGroupCreate twice error = %v, want ErrBusyGroup", err)
+	}
+
+	s.Set("str", "v", time.Time{})
+	if err := s.XGroupCreate("str", "g", "$", true); err != ErrWrongType {
+		t.Errorf("XGroupCreate on a string error = %v, want ErrWrongType", err)
+	}
+}
+
+func TestStore_XReadGroup_NewEntries(t *testing.T) {
+	s := newGroupStream(t)
+	opts := XReadGroupOptions{Group: "g", Consumer: "alice", Count: 2}
+
+	result, _, err := s.XReadGroup(opts, []string{"s"}, []string{">"})
+	if err != nil {
+		t.Fatalf("XReadGroup error = %v", err)
+	}
+	if got := entryKeys(result["s"]); !reflect.DeepEqual(got, []string{"1-1", "2-1"}) {
+		t.Errorf("first read = %v, want [1-1 2-1]", got)
+	}
+
+	opts.Consumer, opts.Count = "bob", 0
+	result, _, _ = s.XReadGroup(opts, []string{"s"}, []string{">"})
+	if got := entryKeys(result["s"]); !reflect.DeepEqual(got, []string{"3-1", "4-1", "5-1"}) {
+		t.Errorf("second read = %v, want the rest in order", got)
+	}
+
+	result, _, _ = s.XReadGroup(opts, []string{"s"}, []string{">"})
+	if len(result) != 0 {
+		t.Errorf("read with nothing new = %v, want no streams", result)
+	}
+}
+
+func TestStore_XReadGroup_PendingHistory(t *testing.T) {
+	s := newGroupStream(t)
+	opts := XReadGroupOptions{Group: "g", Consumer: "alice", Count: 3}
+	s.XReadGroup(opts, []string{"s"}, []string{">"})
+	delivered := s.data["s"].Stream.groups["g"].pending[streamID{ms: 2, seq: 1}].deliveryTime
+	time.Sleep(2 * time.Millisecond)
+
+	opts.Count = 0
+	result, _, err := s.XReadGroup(opts, []string{"s"}, []string{"1-1"})
+	if err != nil {
+		t.Fatalf("XReadGroup history error = %v", err)
+	}
+	if got := entryKeys(result["s"]); !reflect.DeepEqual(got, []string{"2-1", "3-1"}) {
+		t.Errorf("history after 1-1 = %v, want [2-1 3-1]", got)
+	}
+
+	// Reading the history leaves the delivery time and count alone.
+	g := s.data["s"].Stream.groups["g"]
+	if pe := g.pending[streamID{ms: 2, seq: 1}]; pe.deliveryCount != 1 || pe.deliveryTime != delivered || pe.owner.name != "alice" {
+		t.Errorf("pending 2-1 = %+v, want delivered once to alice at %d", pe, delivered)
+	}
+
+	opts.Consumer = "bob"
+	result, _, _ = s.XReadGroup(opts, []string{"s"}, []string{"0"})
+	if entries, ok := result["s"]; !ok || len(entries) != 0 {
+		t.Errorf("bob's history = %v, want an empty list for the stream", result)
+	}
+}
+
+func TestStore_XReadGroup_NoAck(t *testing.T) {
+	s := newGroupStream(t)
+	opts := XReadGroupOptions{Group: "g", Consumer: "alice", NoAck: true}
+	s.XReadGroup(opts, []string{"s"}, []string{">"})
+
+	if pending := len(s.data["s"].Stream.groups["g"].pending); pending != 0 {
+		t.Errorf("NOACK left %d pending entries, want 0", pending)
+	}
+}
+
+func TestStore_XReadGroup_Changes(t *testing.T) {
+	s := newGroupStream(t)
+	opts := XReadGroupOptions{Group: "g", Consumer: "alice", Count: 2}
+
+	_, changes, _ := s.XReadGroup(opts, []string{"s"}, []string{">"})
+	g := s.data["s"].Stream.groups["g"]
+	at := g.pending[streamID{ms: 1, seq: 1}].deliveryTime
+	want := []GroupChange{{
+		Key: "s", Group: "g", Consumer: "alice", NewConsumer: true,
+		Claimed: []PendingDelivery{{ID: "1-1", Time: at, Count: 1}, {ID: "2-1", Time: at, Count: 1}},
+		LastID:  "2-1",
+	}}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("changes = %+v, want %+v", changes, want)
+	}
+
+	opts.NoAck = true
+	_, changes, _ = s.XReadGroup(opts, []string{"s"}, []string{">"})
+	want = []GroupChange{{Key: "s", Group: "g", Consumer: "alice", LastID: "4-1"}}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("NOACK changes = %+v, want %+v", changes, want)
+	}
+
+	if _, changes, _ = s.XReadGroup(opts, []string{"s"}, []string{"0"}); len(changes) != 0 {
+		t.Errorf("history changes = %+v, want none", changes)
+	}
+}
+
+func TestStore_XReadGroup_Errors(t *testing.T) {
+	s := newGroupStream(t)
+	opts := XReadGroupOptions{Group: "g", Consumer: "alice"}
+
+	_, _, err := s.XReadGroup(opts, []string{"s", "missing"}, []string{">", ">"})
+	if err == nil || !strings.HasPrefix(err.Error(), "NOGROUP") {
+		t.Errorf("XReadGroup on a missing key error = %v, want NOGROUP", err)
+	}
+	if len(s.data["s"].Stream.groups["g"].pending) != 0 {
+		t.Error("a failed XReadGroup must not deliver from the other streams")
+	}
+	if _, _, err := s.XReadGroup(opts, []string{"s"}, []string{"$"}); err != ErrInvalidStreamID {
+		t.Errorf("XReadGroup with $ error = %v, want ErrInvalidStreamID", err)
+	}
+}
+
+func TestStore_XGroupConsumers(t *testing.T) {
+	s := newGroupStream(t)
+
+	if created, _ := s.XGroupCreateConsumer("s", "g", "alice"); !created {
+		t.Error("XGroupCreateConsumer should create alice")
+	}
+	if created, _ := s.XGroupCreateConsumer("s", "g", "alice"); created {
+		t.Error("XGroupCreateConsumer should report alice as existing")
+	}
+	if _, err := s.XGroupCreateConsumer("s", "nogroup", "alice"); err == nil {
+		t.Error("XGroupCreateConsumer on a missing group should fail")
+	}
+
+	s.XReadGroup(XReadGroupOptions{Group: "g", Consumer: "alice", Count: 2}, []string{"s"}, []string{">"})
+	if pending, _ := s.XGroupDelConsumer("s", "g", "alice"); pending != 2 {
+		t.Errorf("XGroupDelConsumer = %d, want 2 pending entries", pending)
+	}
+	if n := len(s.data["s"].Stream.groups["g"].pending); n != 0 {
+		t.Errorf("group PEL holds %d entries after deleting their owner, want 0", n)
+	}
+}
+
+func TestStore_XGroupSetIDAndDestroy(t *testing.T) {
+	s := newGroupStream(t)
+	opts := XReadGroupOptions{Group: "g", Consumer: "alice"}
+
+	if err := s.XGroupSetID("s", "g", "$"); err != nil {
+		t.Fatalf("XGroupSetID error = %v", err)
+	}
+	if result, _, _ := s.XReadGroup(opts, []string{"s"}, []string{">"}); len(result) != 0 {
+		t.Errorf("read after SETID $ = %v, want nothing", result)
+	}
+	s.XGroupSetID("s", "g", "4")
+	result, _, _ := s.XReadGroup(opts, []string{"s"}, []string{">"})
+	if got := entryKeys(result["s"]); !reflect.DeepEqual(got, []string{"4-1", "5-1"}) {
+		t.Errorf("read after SETID 4 = %v, want [4-1 5-1]", got)
+	}
+
+	if destroyed, _ := s.XGroupDestroy("s", "g"); !destroyed {
+		t.Error("XGroupDestroy should destroy g")
+	}
+	if destroyed, _ := s.XGroupDestroy("s", "g"); destroyed {
+		t.Error("XGroupDestroy of a missing group should report false")
+	}
+	if err := s.XGroupSetID("s", "g", "0"); err == nil || !strings.HasPrefix(err.Error(), "NOGROUP") {
+		t.Errorf("XGroupSetID on a destroyed group error = %v, want NOGROUP", err)
+	}
+}
+
+func TestStore_XReadGroupBlock(t *testing.T) {
+	s := NewStore()
+	s.XGroupCreate("s", "g", "$", true)
+	opts := XReadGroupOptions{Group: "g", Consumer: "alice"}
+
+	done := make(chan map[string][]Entry)
+	go func() {
+		result, _ := s.XReadGroupBlock(opts, []string{"s"}, []string{">"}, 0)
+		done <- result
+	}()
+	waitBlocked(t, s, "s", 1)
+	s.XAdd("s", "1-1", map[string]string{"f": "v"})
+
+	if got := entryKeys((<-done)["s"]); !reflect.DeepEqual(got, []string{"1-1"}) {
+		t.Errorf("blocked read = %v, want [1-1]", got)
+	}
+
+	errs := make(chan error)
+	go func() {
+		_, err := s.XReadGroupBlock(opts, []string{"s"}, []string{">"}, 0)
+		errs <- err
+	}()
+	waitBlocked(t, s, "s", 1)
+	s.XGroupDestroy("s", "g")
+	if err := <-errs; err == nil || !strings.HasPrefix(err.Error(), "NOGROUP") {
+		t.Errorf("blocked read after XGROUP DESTROY error = %v, want NOGROUP", err)
+	}
+
+	if result, err := s.XReadGroupBlock(opts, []string{"s"}, []string{">"}, 10*time.Millisecond); result != nil || err == nil {
+		t.Errorf("XReadGroupBlock without the group = (%v, %v), want an error", result, err)
+	}
+}
+
+func TestStream_CloneGroups(t *testing.T) {
+	s := newGroupStream(t)
+	s.XReadGroup(XReadGroupOptions{Group: "g", Consumer: "alice", Count: 1}, []string{"s"}, []string{">"})
+
+	clone := s.data["s"].Stream.Clone()
+	clone.groups["g"].consumers["alice"].pending[streamID{ms: 1, seq: 1}].deliveryCount = 10
+
+	original := s.data["s"].Stream.groups["g"].pending[streamID{ms: 1, seq: 1}]
+	if original.deliveryCount != 1 {
+		t.Error("changing a cloned pending entry changed the original")
+	}
+	if cloned := clone.groups["g"].pending[streamID{ms: 1, seq: 1}]; cloned.deliveryCount != 10 {
+		t.Error("the cloned group and consumer PELs should share entries")
+	}
+}
+
+// ageDeliveries makes every pending entry of group "g" look delivered d ago.
+func ageDeliveries(s *Store, d time.Duration) {
+	for _, pe := range s.data["s"].Stream.groups["g"].pending {
+		pe.deliveryTime -= d.Milliseconds()
+	}
+}
+
+func TestStore_XAck(t *testing.T) {
+	s := newGroupStream(t)
+	s.XReadGroup(XReadGroupOptions{Group: "g", Consumer: "alice"}, []string{"s"}, []string{">"})
+
+	if acked, err := s.XAck("s", "g", []string{"1-1", "2-1", "9-9"}); acked != 2 || err != nil {
+		t.Errorf("XAck = (%d, %v), want (2, nil)", acked, err)
+	}
+	if acked, _ := s.XAck("s", "g", []string{"1-1"}); acked != 0 {
+		t.Errorf("XAck twice = %d, want 0", acked)
+	}
+	if acked, err := s.XAck("missing", "g", []string{"1-1"}); acked != 0 || err != nil {
+		t.Errorf("XAck on a missing key = (%d, %v), want (0, nil)", acked, err)
+	}
+	if _, err := s.XAck("s", "g", []string{"bad"}); err != ErrInvalidStreamID {
+		t.Errorf("XAck with a bad ID error = %v, want ErrInvalidStreamID", err)
+	}
+
+	summary, _ := s.XPendingSummary("s", "g")
+	if summary.Count != 3 || summary.First != "3-1" || summary.Last != "5-1" {
+		t.Errorf("summary after XAck = %+v, want 3 pending from 3-1 to 5-1", summary)
+	}
+}
+
+func TestStore_XPending(t *testing.T) {
+	s := newGroupStream(t)
+	s.XReadGroup(XReadGroupOptions{Group: "g", Consumer: "bob", Count: 2}, []string{"s"}, []string{">"})
+	ageDeliveries(s, time.Minute)
+	s.XReadGroup(XReadGroupOptions{Group: "g", Consumer: "alice"}, []string{"s"}, []string{">"})
+
+	summary, err := s.XPendingSummary("s", "g")
+	if err != nil {
+		t.Fatalf("XPendingSummary error = %v", err)
+	}
+	want := []PendingCount{{"alice", 3}, {"bob", 2}}
+	if summary.Count != 5 || !reflect.DeepEqual(summary.Consumers, want) {
+		t.Errorf("summary = %+v, want 5 pending split %v", summary, want)
+	}
+
+	pending, _ := s.XPending("s", "g", XPendingOptions{Start: "-", End: "+", Count: 10, MinIdle: time.Second})
+	if len(pending) != 2 || pending[0].ID != "1-1" || pending[0].Consumer != "bob" || pending[0].DeliveryCount != 1 {
+		t.Errorf("idle entries = %+v, want bob's 1-1 and 2-1", pending)
+	}
+
+	pending, _ = s.XPending("s", "g", XPendingOptions{Start: "(2-1", End: "5", Count: 2, Consumer: "alice"})
+	if len(pending) != 2 || pending[0].ID != "3-1" || pending[1].ID != "4-1" {
+		t.Errorf("alice's entries after 2-1 = %+v, want 3-1 and 4-1", pending)
+	}
+
+	if _, err := s.XPendingSummary("s", "nogroup"); err == nil || !strings.HasPrefix(err.Error(), "NOGROUP") {
+		t.Errorf("XPendingSummary on a missing group error = %v, want NOGROUP", err)
+	}
+	if _, err := s.XPending("s", "g", XPendingOptions{Start: "(0-0", End: "(0-0", Count: 1}); err == nil {
+		t.Error("an exclusive end of 0-0 should be rejected")
+	}
+}
+
+func TestStore_XClaim(t *testing.T) {
+	s := newGroupStream(t)
+	s.XReadGroup(XReadGroupOptions{Group: "g", Consumer: "alice", Count: 3}, []string{"s"}, []string{">"})
+	ageDeliveries(s, time.Minute)
+	g := s.data["s"].Stream.groups["g"]
+
+	claimed, _, err := s.XClaim("s", "g", "bob", time.Second, []string{"1-1", "2-1", "5-1"}, XClaimOptions{})
+	if err != nil {
+		t.Fatalf("XClaim error = %v", err)
+	}
+	if got := entryKeys(claimed); !reflect.DeepEqual(got, []string{"1-1", "2-1"}) {
+		t.Errorf("XClaim = %v, want the pending 1-1 and 2-1 only", got)
+	}
+	pe := g.pending[streamID{ms: 1, seq: 1}]
+	if pe.owner.name != "bob" || pe.deliveryCount != 2 || len(g.consumers["alice"].pending) != 1 {
+		t.Errorf("claimed entry = %+v, want owned by bob after a second delivery", pe)
+	}
+
+	// Recently claimed entries are not idle enough to be claimed again.
+	if claimed, _, _ := s.XClaim("s", "g", "carol", time.Second, []string{"1-1"}, XClaimOptions{}); len(claimed) != 0 {
+		t.Errorf("XClaim of a fresh delivery = %v, want nothing", entryKeys(claimed))
+	}
+
+	opts := XClaimOptions{JustID: true, RetryCount: 7, HasRetryCount: true, DeliveryTime: time.Now().Add(-time.Hour)}
+	s.XClaim("s", "g", "carol", 0, []string{"3-1"}, opts)
+	pe = g.pending[streamID{ms: 3, seq: 1}]
+	if pe.owner.name != "carol" || pe.deliveryCount != 7 || time.Now().UnixMilli()-pe.deliveryTime < time.Hour.Milliseconds() {
+		t.Errorf("claimed entry = %+v, want carol with RETRYCOUNT and TIME applied", pe)
+	}
+
+	claimed, _, _ = s.XClaim("s", "g", "carol", 0, []string{"5-1"}, XClaimOptions{Force: true, LastID: "5-1"})
+	if len(claimed) != 1 || g.pending[streamID{ms: 5, seq: 1}].deliveryCount != 1 || g.lastID != (streamID{ms: 5, seq: 1}) {
+		t.Errorf("FORCE claim = %v, lastID %v, want 5-1 added and the group moved to it", entryKeys(claimed), g.lastID)
+	}
+	if claimed, _, _ := s.XClaim("s", "g", "carol", 0, []string{"9-1"}, XClaimOptions{Force: true}); len(claimed) != 0 {
+		t.Error("FORCE must not claim entries missing from the stream")
+	}
+
+	// A pending entry deleted from the stream is dropped instead of claimed.
+	s.XDel("s", []string{"2-1"})
+	if claimed, _, _ := s.XClaim("s", "g", "carol", 0, []string{"2-1"}, XClaimOptions{}); len(claimed) != 0 {
+		t.Error("XClaim should not return deleted entries")
+	}
+	if _, ok := g.pending[streamID{ms: 2, seq: 1}]; ok {
+		t.Error("a deleted entry should leave the PEL when claimed")
+	}
+}
+
+func TestStore_XAutoClaim(t *testing.T) {
+	s := newGroupStream(t)
+	s.XReadGroup(XReadGroupOptions{Group: "g", Consumer: "alice"}, []string{"s"}, []string{">"})
+	ageDeliveries(s, time.Minute)
+
+	next, claimed, change, err := s.XAutoClaim("s", "g", "bob", time.Second, "0", 2, false)
+	if err != nil {
+		t.Fatalf("XAutoClaim error = %v", err)
+	}
+	if next != "3-1" || !reflect.DeepEqual(entryKeys(claimed), []string{"1-1", "2-1"}) || len(change.Dropped) != 0 {
+		t.Errorf("XAutoClaim = (%s, %v, %v), want (3-1, [1-1 2-1], [])", next, entryKeys(claimed), change.Dropped)
+	}
+
+	s.XDel("s", []string{"4-1"})
+	next, claimed, change, _ = s.XAutoClaim("s", "g", "bob", time.Second, next, 10, true)
+	if next != "0-0" || !reflect.DeepEqual(entryKeys(claimed), []string{"3-1", "5-1"}) || !reflect.DeepEqual(change.Dropped, []string{"4-1"}) {
+		t.Errorf("XAutoClaim = (%s, %v, %v), want (0-0, [3-1 5-1], [4-1])", next, entryKeys(claimed), change.Dropped)
+	}
+	g := s.data["s"].Stream.groups["g"]
+	if pe := g.pending[streamID{ms: 3, seq: 1}]; pe.owner.name != "bob" || pe.deliveryCount != 1 {
+		t.Errorf("JUSTID claim = %+v, want bob without a new delivery", pe)
+	}
+
+	if _, claimed, _, _ := s.XAutoClaim("s", "g", "carol", time.Second, "-", 10, false); len(claimed) != 0 {
+		t.Errorf("XAutoClaim of fresh deliveries = %v, want nothing", entryKeys(claimed))
+	}
+}
+
+func TestPelIndex(t *testing.T) {
+	var x pelIndex
+	// Insert in reverse order so that every insert lands ahead of the rest
+	// and full chunks have to split.
+	const n = 3 * pelChunkSize
+	for i := n; i > 0; i-- {
+		x.insert(streamID{ms: int64(i)})
+	}
+	if len(x.chunks) < 3 {
+		t.Errorf("index has %d chunks after %d inserts, want at least 3", len(x.chunks), n)
+	}
+
+	ids := []streamID{}
+	x.ascend(streamID{}, func(id streamID) bool {
+		ids = append(ids, id)
+		return true
+	})
+	if len(ids) != n {
+		t.Fatalf("ascend visited %d IDs, want %d", len(ids), n)
+	}
+	for i, id := range ids {
+		if id.ms != int64(i+1) {
+			t.Fatalf("ascend visited %s at position %d, want %d-0", id, i, i+1)
+		}
+	}
+
+	if !x.remove(streamID{ms: 1}) || x.remove(streamID{ms: 1}) {
+		t.Error("remove(1-0) should succeed exactly once")
+	}
+	if first, _ := x.first(); first.ms != 2 {
+		t.Errorf("first() = %s, want 2-0", first)
+	}
+	if last, _ := x.last(); last.ms != n {
+		t.Errorf("last() = %s, want %d-0", last, n)
+	}
+
+	got := []streamID{}
+	x.ascend(streamID{ms: 200, seq: 1}, func(id streamID) bool {
+		got = append(got, id)
+		return len(got) < 2
+	})
+	if !reflect.DeepEqual(got, []streamID{{ms: 201}, {ms: 202}}) {
+		t.Errorf("ascend from 200-1 = %v, want [201-0 202-0]", got)
+	}
+}
+
+func TestStore_XPending_ClaimedOutOfOrder(t *testing.T) {
+	s := newGroupStream(t)
+	s.XReadGroup(XReadGroupOptions{Group: "g", Consumer: "alice"}, []string{"s"}, []string{">"})
+	// Claiming the entries newest first still lists them in ID order.
+	for _, id := range []string{"5-1", "3-1", "1-1"} {
+		s.XClaim("s", "g", "bob", 0, []string{id}, XClaimOptions{})
+	}
+
+	pending, _ := s.XPending("s", "g", XPendingOptions{Start: "-", End: "+", Count: 10, Consumer: "bob"})
+	got := make([]string, len(pending))
+	for i, p := range pending {
+		got[i] = p.ID
+	}
+	if !reflect.DeepEqual(got, []string{"1-1", "3-1", "5-1"}) {
+		t.Errorf("bob's pending entries = %v, want [1-1 3-1 5-1]", got)
+	}
+
+	history, _, _ := s.XReadGroup(XReadGroupOptions{Group: "g", Consumer: "alice", Count: 1}, []string{"s"}, []string{"2-1"})
+	if keys := entryKeys(history["s"]); !reflect.DeepEqual(keys, []string{"4-1"}) {
+		t.Errorf("alice's history after 2-1 = %v, want [4-1]", keys)
+	}
+}
@@ -1,6 +1,7 @@
 package structures
 
 import (
+	"fmt"
 	"reflect"
 	"strings"
 	"testing"
@@ -47,6 +48,24 @@ func TestStream_Add_AutoSequence(t *testing.T) {
 	}
 }
 
+func TestStream_Add_BareTimestamp(t *testing.T) {
+	s := NewStream()
+
+	key, err := s.Add("5", map[string]string{"f": "v"})
+	if err != nil || key != "5-0" {
+		t.Errorf("Add(5) = %s, %v, want 5-0", key, err)
+	}
+	if _, err := s.Add("5", nil); err == nil {
+		t.Error("Add(5) after 5-0 should fail")
+	}
+	if _, ok := s.Get("5"); !ok {
+		t.Error("Get(5) should find 5-0")
+	}
+	if _, err := s.Add("x", nil); err == nil {
+		t.Error("Add(x) should fail")
+	}
+}
+
 func TestStream_Add_AutoTimestamp(t *testing.T) {
 	s := NewStream()
 
@@ -59,6 +78,17 @@ func TestStream_Add_AutoTimestamp(t *testing.T) {
 	}
 }
 
+func TestStream_Add_AutoTimestampNotAfterLast(t *testing.T) {
+	s := NewStream()
+	s.Add("99999999999999-5", nil)
+
+	// A clock behind the last ID continues its sequence instead.
+	key, err := s.Add("*", nil)
+	if err != nil || key != "99999999999999-6" {
+		t.Errorf("Add(*) = %s, %v, want 99999999999999-6", key, err)
+	}
+}
+
 func TestStream_Add_ZeroZeroRejected(t *testing.T) {
 	s := NewStream()
 
@@ -179,7 +209,7 @@ func TestStream_Read(t *testing.T) {
 	s.Add("1-2", map[string]string{"b": "2"})
 	s.Add("2-1", map[string]string{"c": "3"})
 
-	entries := s.Read("1-1")
+	entries, _ := s.Read("1-1", 0)
 	if len(entries) != 2 {
 		t.Errorf("Read(1-1) returned %d entries, want 2", len(entries))
 	}
@@ -188,7 +218,7 @@ func TestStream_Read(t *testing.T) {
 func TestStream_Read_EmptyStream(t *testing.T) {
 	s := NewStream()
 
-	entries := s.Read("0-0")
+	entries, _ := s.Read("0-0", 0)
 	if len(entries) != 0 {
 		t.Errorf("Read() on empty stream returned %d entries, want 0", len(entries))
 	}
@@ -198,7 +228,7 @@ func TestStream_Read_NothingAfterLast(t *testing.T) {
 	s := NewStream()
 	s.Add("1-1", map[string]string{"a": "1"})
 
-	entries := s.Read("1-1")
+	entries, _ := s.Read("1-1", 0)
 	if len(entries) != 0 {
 		t.Errorf("Read() after last entry returned %d entries, want 0", len(entries))
 	}
@@ -268,7 +298,7 @@ func TestParseKey(t *testing.T) {
 		{"Wildcard", "*", -1, "*", false},
 		{"Normal ID", "123-456", 123, "456", false},
 		{"Zero ID", "0-0", 0, "0", false},
-		{"Missing seq", "123", 0, "0", false},
+		{"Missing seq", "123", 123, "0", false},
 		{"Non-numeric timestamp", "abc-1", 0, "", true},
 		{"Non-numeric seq (valid parse, error later)", "1-abc", 1, "abc", false},
 	}
@@ -316,7 +346,7 @@ func TestStream_Range_NoDuplicates(t *testing.T) {
 	s.Add("2-1", map[string]string{"b": "2"})
 	s.Add("3-1", map[string]string{"c": "3"})
 
-	entries := s.Range("1-1", "3-1")
+	entries, _ := s.Range("1-1", "3-1", 0)
 	if len(entries) != 3 {
 		t.Errorf("Range returned %d entries, want 3 (no duplicates)", len(entries))
 	}
@@ -336,7 +366,7 @@ func TestStream_Range_StartEqualsEnd(t *testing.T) {
 	s := NewStream()
 	s.Add("1-1", map[string]string{"a": "1"})
 
-	entries := s.Range("1-1", "1-1")
+	entries, _ := s.Range("1-1", "1-1", 0)
 	if len(entries) != 1 {
 		t.Errorf("Range(1-1, 1-1) returned %d entries, want 1", len(entries))
 	}
@@ -345,7 +375,7 @@ func TestStream_Range_StartEqualsEnd(t *testing.T) {
 func TestStream_Range_Empty(t *testing.T) {
 	s := NewStream()
 
-	entries := s.Range("0-0", "1-0")
+	entries, _ := s.Range("0-0", "1-0", 0)
 	if len(entries) != 0 {
 		t.Errorf("Range on empty stream returned %d entries, want 0", len(entries))
 	}
@@ -357,8 +387,218 @@ func TestStream_Range_SameTimestamp(t *testing.T) {
 	s.Add("1-2", map[string]string{"b": "2"})
 	s.Add("1-3", map[string]string{"c": "3"})
 
-	entries := s.Range("1-1", "1-3")
+	entries, _ := s.Range("1-1", "1-3", 0)
 	if len(entries) != 3 {
 		t.Errorf("Range same timestamp returned %d entries, want 3", len(entries))
 	}
 }
+
+// addEntries adds n entries with IDs 1-0, 1-1, 2-0, 2-1 and so on.
+func addEntries(t *testing.T, s *Stream, n int) []string {
+	t.Helper()
+	keys := make([]string, n)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("%d-%d", i/2+1, i%2)
+		if _, err := s.Add(keys[i], map[string]string{"i": fmt.Sprint(i)}); err != nil {
+			t.Fatalf("Add(%s) error = %v", keys[i], err)
+		}
+	}
+	return keys
+}
+
+func TestStream_Range_Ordered(t *testing.T) {
+	s := NewStream()
+	keys := addEntries(t, s, 5*streamChunkSize+7)
+
+	if got := rangeKeys(t, s, "0-0", maxStreamID.String()); !reflect.DeepEqual(got, keys) {
+		t.Errorf("Range over the whole stream returned %d entries out of order", len(got))
+	}
+	if got := rangeKeys(t, s, "100-1", "300-0"); !reflect.DeepEqual(got, keys[199:599]) {
+		t.Errorf("Range(100-1, 300-0) = %v...", got[:min(len(got), 3)])
+	}
+	if got := rangeKeys(t, s, "64-1", "65-0"); !reflect.DeepEqual(got, []string{"64-1", "65-0"}) {
+		t.Errorf("Range across a chunk boundary = %v, want [64-1 65-0]", got)
+	}
+}
+
+func TestStream_Read_Ordered(t *testing.T) {
+	s := NewStream()
+	keys := addEntries(t, s, 3*streamChunkSize)
+
+	if got := readKeys(t, s, "0-0"); !reflect.DeepEqual(got, keys) {
+		t.Errorf("Read(0-0) returned %d entries out of order", len(got))
+	}
+	if got := readKeys(t, s, "150-0"); !reflect.DeepEqual(got, keys[299:]) {
+		t.Errorf("Read(150-0) returned %d entries, want %d", len(got), len(keys[299:]))
+	}
+}
+
+func TestStreamIndex(t *testing.T) {
+	s := NewStream()
+	addEntries(t, s, 2*streamChunkSize+1)
+	x := &s.entries
+
+	if len(x.chunks) != 3 {
+		t.Fatalf("index has %d chunks, want 3", len(x.chunks))
+	}
+	if e, ok := x.get(streamID{ms: 70, seq: 1}); !ok || e.Key() != "70-1" {
+		t.Errorf("get(70-1) = %s, %v", e.Key(), ok)
+	}
+	if _, ok := x.get(streamID{ms: 70, seq: 2}); ok {
+		t.Error("get(70-2) found a missing entry")
+	}
+	if e, ok := x.floor(streamID{ms: 70, seq: 5}); !ok || e.Key() != "70-1" {
+		t.Errorf("floor(70-5) = %s, %v, want 70-1", e.Key(), ok)
+	}
+	if _, ok := x.floor(streamID{ms: 0, seq: 5}); ok {
+		t.Error("floor below the first entry should find nothing")
+	}
+
+	// Removing every entry of the last chunk drops it.
+	if e, ok := x.remove(streamID{ms: 129, seq: 0}); !ok || e.Key() != "129-0" {
+		t.Errorf("remove(129-0) = %s, %v", e.Key(), ok)
+	}
+	if _, ok := x.remove(streamID{ms: 129, seq: 0}); ok {
+		t.Error("remove(129-0) should succeed once")
+	}
+	if len(x.chunks) != 2 {
+		t.Errorf("index has %d chunks after emptying one, want 2", len(x.chunks))
+	}
+	if e, _ := x.last(); e.Key() != "128-1" {
+		t.Errorf("last() = %s, want 128-1", e.Key())
+	}
+
+	x.remove(streamID{ms: 64, seq: 1})
+	if got := rangeKeys(t, s, "64-0", "65-0"); !reflect.DeepEqual(got, []string{"64-0", "65-0"}) {
+		t.Errorf("Range after remove = %v, want [64-0 65-0]", got)
+	}
+
+	// A clone is unaffected by later changes to the original.
+	clone := x.clone()
+	x.remove(streamID{ms: 1, seq: 0})
+	s.Add("200-0", nil)
+	if _, ok := clone.get(streamID{ms: 1, seq: 0}); !ok {
+		t.Error("clone lost an entry removed from the original")
+	}
+	if _, ok := clone.get(streamID{ms: 200, seq: 0}); ok {
+		t.Error("clone gained an entry added to the original")
+	}
+}
+
+// rangeKeys returns the keys of the entries Range returns.
+func rangeKeys(t *testing.T, s *Stream, start, end string) []string {
+	t.Helper()
+	entries, err := s.Range(start, end, 0)
+	if err != nil {
+		t.Fatalf("Range(%s, %s) error = %v", start, end, err)
+	}
+	return entryKeys(entries)
+}
+
+// readKeys returns the keys of the entries Read returns.
+func readKeys(t *testing.T, s *Stream, after string) []string {
+	t.Helper()
+	entries, err := s.Read(after, 0)
+	if err != nil {
+		t.Fatalf("Read(%s) error = %v", after, err)
+	}
+	return entryKeys(entries)
+}
+
+func TestParseRangeID(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		end     bool
+		want    streamID
+		wantErr bool
+	}{
+		{"Minus", "-", false, streamID{}, false},
+		{"Plus", "+", true, maxStreamID, false},
+		{"Complete start", "5-3", false, streamID{ms: 5, seq: 3}, false},
+		{"Incomplete start", "5", false, streamID{ms: 5}, false},
+		{"Incomplete end", "5", true, streamID{ms: 5, seq: maxStreamID.seq}, false},
+		{"Exclusive start", "(5-3", false, streamID{ms: 5, seq: 4}, false},
+		{"Exclusive end", "(5-3", true, streamID{ms: 5, seq: 2}, false},
+		{"Exclusive incomplete start", "(5", false, streamID{ms: 5, seq: 1}, false},
+		{"Exclusive incomplete end", "(5", true, streamID{ms: 5, seq: maxStreamID.seq - 1}, false},
+		{"Exclusive end wraps to the previous ms", "(5-0", true, streamID{ms: 4, seq: maxStreamID.seq}, false},
+		{"Exclusive start past the greatest ID", "(" + maxStreamID.String(), false, streamID{}, true},
+		{"Exclusive end before 0-0", "(0-0", true, streamID{}, true},
+		{"Exclusive minus", "(-", false, streamID{}, true},
+		{"Negative", "-5", false, streamID{}, true},
+		{"Non-numeric seq", "5-x", false, streamID{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseRangeID(tt.value, tt.end)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseRangeID(%q, %v) error = %v, wantErr %v", tt.value, tt.end, err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("parseRangeID(%q, %v) = %s, want %s", tt.value, tt.end, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStream_Range_Count(t *testing.T) {
+	s := NewStream()
+	keys := addEntries(t, s, 2*streamChunkSize)
+
+	entries, err := s.Range("(64-1", "+", 3)
+	if err != nil {
+		t.Fatalf("Range error = %v", err)
+	}
+	if got := entryKeys(entries); !reflect.DeepEqual(got, keys[128:131]) {
+		t.Errorf("Range((64-1, +, 3) = %v, want %v", got, keys[128:131])
+	}
+	if got := rangeKeys(t, s, "10", "11"); !reflect.DeepEqual(got, []string{"10-0", "10-1", "11-0", "11-1"}) {
+		t.Errorf("Range(10, 11) = %v, want the entries of both milliseconds", got)
+	}
+	if _, err := s.Range("1-x", "+", 0); err == nil {
+		t.Error("Range with an invalid start should fail")
+	}
+}
+
+func TestStream_RevRange(t *testing.T) {
+	s := NewStream()
+	keys := addEntries(t, s, 2*streamChunkSize+3)
+
+	entries, _ := s.RevRange("+", "-", 0)
+	got := entryKeys(entries)
+	if len(got) != len(keys) || got[0] != keys[len(keys)-1] || got[len(got)-1] != keys[0] {
+		t.Errorf("RevRange(+, -) returned %d entries, want all %d in reverse", len(got), len(keys))
+	}
+
+	// Crossing a chunk boundary backwards.
+	entries, _ = s.RevRange("(65-0", "64", 0)
+	if got := entryKeys(entries); !reflect.DeepEqual(got, []string{"64-1", "64-0"}) {
+		t.Errorf("RevRange((65-0, 64) = %v, want [64-1 64-0]", got)
+	}
+	entries, _ = s.RevRange("200", "-", 2)
+	if got := entryKeys(entries); !reflect.DeepEqual(got, []string{"130-0", "129-1"}) {
+		t.Errorf("RevRange(200, -, 2) = %v, want [130-0 129-1]", got)
+	}
+	entries, _ = s.RevRange("-", "+", 0)
+	if len(entries) != 0 {
+		t.Errorf("RevRange with an end below the start returned %d entries, want 0", len(entries))
+	}
+}
+
+func TestStream_Read_Count(t *testing.T) {
+	s := NewStream()
+	addEntries(t, s, 10)
+
+	entries, err := s.Read("2", 3)
+	if err != nil {
+		t.Fatalf("Read error = %v", err)
+	}
+	if got := entryKeys(entries); !reflect.DeepEqual(got, []string{"2-1", "3-0", "3-1"}) {
+		t.Errorf("Read(2, 3) = %v, want [2-1 3-0 3-1]", got)
+	}
+	if _, err := s.Read("abc", 0); err != ErrInvalidStreamID {
+		t.Errorf("Read(abc) error = %v, want %v", err, ErrInvalidStreamID)
+	}
+}
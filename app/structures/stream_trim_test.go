@@ -0,0 +1,208 @@
+package structures
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// newLongStream returns a store holding a stream with entries 1-1 to n-1.
+func newLongStream(t *testing.T, n int) *Store {
+	t.Helper()
+	s := NewStore()
+	for i := 1; i <= n; i++ {
+		if _, err := s.XAdd("s", fmt.Sprintf("%d-1", i), map[string]string{"f": "v"}); err != nil {
+			t.Fatalf("XAdd error = %v", err)
+		}
+	}
+	return s
+}
+
+// firstKey returns the ID of the first entry of the stream "s".
+func firstKey(s *Store) string {
+	entries, _, _ := s.XRange("s", "-", "+", 1)
+	if len(entries) == 0 {
+		return ""
+	}
+	return entries[0].Key()
+}
+
+func TestStore_XLen(t *testing.T) {
+	s := newLongStream(t, 3)
+
+	if n, err := s.XLen("s"); err != nil || n != 3 {
+		t.Errorf("XLen = %d, %v, want 3", n, err)
+	}
+	if n, err := s.XLen("missing"); err != nil || n != 0 {
+		t.Errorf("XLen on a missing key = %d, %v, want 0", n, err)
+	}
+	s.Set("str", "v", time.Time{})
+	if _, err := s.XLen("str"); err != ErrWrongType {
+		t.Errorf("XLen on a string error = %v, want ErrWrongType", err)
+	}
+}
+
+func TestStore_XDel(t *testing.T) {
+	s := newLongStream(t, 5)
+
+	if n, err := s.XDel("s", []string{"2-1", "4-1", "9-1", "4-1"}); err != nil || n != 2 {
+		t.Errorf("XDel = %d, %v, want 2", n, err)
+	}
+	if _, err := s.XDel("s", []string{"3-1", "bad"}); err != ErrInvalidStreamID {
+		t.Errorf("XDel with an invalid ID error = %v, want ErrInvalidStreamID", err)
+	}
+	entries, _, _ := s.XRange("s", "-", "+", 0)
+	if got := entryKeys(entries); !reflect.DeepEqual(got, []string{"1-1", "3-1", "5-1"}) {
+		t.Errorf("entries after XDel = %v, want [1-1 3-1 5-1]", got)
+	}
+
+	stream := s.data["s"].Stream
+	if stream.Len() != 3 || stream.bytes != 3*len("fv") {
+		t.Errorf("Len, bytes = %d, %d, want 3, %d", stream.Len(), stream.bytes, 3*len("fv"))
+	}
+	if got := stream.MaxDeletedID(); got != "4-1" {
+		t.Errorf("MaxDeletedID = %s, want 4-1", got)
+	}
+	checkAccounting(t, s)
+
+	// Deleting the last entry keeps its ID as the top of the stream.
+	s.XDel("s", []string{"5-1"})
+	if _, err := s.XAdd("s", "5-1", nil); err == nil {
+		t.Error("XAdd reusing a deleted last ID should fail")
+	}
+	if id, _ := s.XAdd("s", "5-*", nil); id != "5-2" {
+		t.Errorf("XAdd 5-* after deleting 5-1 = %s, want 5-2", id)
+	}
+	if got := stream.MaxDeletedID(); got != "5-1" {
+		t.Errorf("MaxDeletedID = %s, want 5-1", got)
+	}
+	if got := stream.EntriesAdded(); got != 6 {
+		t.Errorf("EntriesAdded = %d, want 6", got)
+	}
+}
+
+func TestStore_XTrim_MaxLen(t *testing.T) {
+	n := 3*streamChunkSize + 10
+	s := newLongStream(t, n)
+
+	// An approximate trim only drops whole chunks.
+	trimmed, exact, err := s.XTrim("s", TrimOptions{By: TrimByMaxLen, MaxLen: 2 * streamChunkSize, Approx: true})
+	if err != nil || trimmed != streamChunkSize {
+		t.Errorf("XTrim MAXLEN ~ = %d, %v, want %d", trimmed, err, streamChunkSize)
+	}
+	// Replicas get the length it actually left.
+	if want := (TrimOptions{By: TrimByMaxLen, MaxLen: 2*streamChunkSize + 10}); exact != want {
+		t.Errorf("exact trim = %+v, want %+v", exact, want)
+	}
+	if got := firstKey(s); got != fmt.Sprintf("%d-1", streamChunkSize+1) {
+		t.Errorf("first entry = %s, want %d-1", got, streamChunkSize+1)
+	}
+
+	trimmed, _, _ = s.XTrim("s", TrimOptions{By: TrimByMaxLen, MaxLen: 5})
+	if want := 2*streamChunkSize + 5; trimmed != want {
+		t.Errorf("XTrim MAXLEN = %d, want %d", trimmed, want)
+	}
+	if n, _ := s.XLen("s"); n != 5 {
+		t.Errorf("XLen after XTrim = %d, want 5", n)
+	}
+	if got := firstKey(s); got != fmt.Sprintf("%d-1", 3*streamChunkSize+6) {
+		t.Errorf("first entry = %s, want %d-1", got, 3*streamChunkSize+6)
+	}
+	checkAccounting(t, s)
+
+	if trimmed, _, _ := s.XTrim("s", TrimOptions{By: TrimByMaxLen, MaxLen: 10}); trimmed != 0 {
+		t.Errorf("XTrim above the length = %d, want 0", trimmed)
+	}
+	if trimmed, _, err := s.XTrim("missing", TrimOptions{By: TrimByMaxLen}); err != nil || trimmed != 0 {
+		t.Errorf("XTrim on a missing key = %d, %v, want 0", trimmed, err)
+	}
+}
+
+func TestStore_XTrim_MinID(t *testing.T) {
+	s := newLongStream(t, 3*streamChunkSize)
+
+	trimmed, exact, _ := s.XTrim("s", TrimOptions{By: TrimByMinID, MinID: "200", Approx: true})
+	if trimmed != streamChunkSize {
+		t.Errorf("XTrim MINID ~ = %d, want %d", trimmed, streamChunkSize)
+	}
+	// Replicas get the first ID it actually kept.
+	if want := (TrimOptions{By: TrimByMinID, MinID: firstKey(s)}); exact != want {
+		t.Errorf("exact trim = %+v, want %+v", exact, want)
+	}
+	trimmed, _, _ = s.XTrim("s", TrimOptions{By: TrimByMinID, MinID: "200-1"})
+	if want := 199 - streamChunkSize; trimmed != want {
+		t.Errorf("XTrim MINID = %d, want %d", trimmed, want)
+	}
+	if got := firstKey(s); got != "200-1" {
+		t.Errorf("first entry = %s, want 200-1", got)
+	}
+	if _, _, err := s.XTrim("s", TrimOptions{By: TrimByMinID, MinID: "x"}); err != ErrInvalidStreamID {
+		t.Errorf("XTrim with an invalid MINID error = %v, want ErrInvalidStreamID", err)
+	}
+	checkAccounting(t, s)
+}
+
+func TestStore_XTrim_Limit(t *testing.T) {
+	s := newLongStream(t, 5*streamChunkSize)
+
+	opts := TrimOptions{By: TrimByMaxLen, Approx: true, Limit: 2*streamChunkSize + 1, HasLimit: true}
+	if trimmed, _, _ := s.XTrim("s", opts); trimmed != 2*streamChunkSize {
+		t.Errorf("XTrim with LIMIT = %d, want %d", trimmed, 2*streamChunkSize)
+	}
+	opts.Limit = 0
+	if trimmed, _, _ := s.XTrim("s", opts); trimmed != 3*streamChunkSize {
+		t.Errorf("XTrim with LIMIT 0 = %d, want %d", trimmed, 3*streamChunkSize)
+	}
+}
+
+func TestStore_XAddWithOptions(t *testing.T) {
+	s := NewStore()
+
+	if _, _, added, err := s.XAddWithOptions("s", "1-1", nil, XAddOptions{NoMkStream: true}); added || err != nil {
+		t.Errorf("XAdd NOMKSTREAM on a missing key = %v, %v, want not added", added, err)
+	}
+	if s.Exists("s") != 0 {
+		t.Error("XAdd NOMKSTREAM created the stream")
+	}
+
+	trim := TrimOptions{By: TrimByMaxLen, MaxLen: 2}
+	for i := 1; i <= 4; i++ {
+		if _, _, _, err := s.XAddWithOptions("s", fmt.Sprintf("%d-1", i), map[string]string{"f": "v"}, XAddOptions{Trim: trim}); err != nil {
+			t.Fatalf("XAdd MAXLEN error = %v", err)
+		}
+	}
+	entries, _, _ := s.XRange("s", "-", "+", 0)
+	if got := entryKeys(entries); !reflect.DeepEqual(got, []string{"3-1", "4-1"}) {
+		t.Errorf("entries after XAdd MAXLEN 2 = %v, want [3-1 4-1]", got)
+	}
+
+	// The entry is checked before trimming, which then keeps the stream.
+	_, _, _, err := s.XAddWithOptions("s", "1-1", nil, XAddOptions{Trim: TrimOptions{By: TrimByMaxLen}})
+	if err == nil {
+		t.Error("XAdd with a smaller ID should fail")
+	}
+	_, _, _, err = s.XAddWithOptions("s", "5-1", nil, XAddOptions{NoMkStream: true, Trim: TrimOptions{By: TrimByMinID, MinID: "bad"}})
+	if err != ErrInvalidStreamID {
+		t.Errorf("XAdd with an invalid MINID error = %v, want ErrInvalidStreamID", err)
+	}
+	if n, _ := s.XLen("s"); n != 2 {
+		t.Errorf("XLen = %d, want 2", n)
+	}
+	if got := s.data["s"].Stream.EntriesAdded(); got != 4 {
+		t.Errorf("EntriesAdded = %d, want 4", got)
+	}
+	checkAccounting(t, s)
+}
+
+func TestStream_CloneKeepsCounters(t *testing.T) {
+	s := NewStream()
+	s.Add("1-1", nil)
+	s.Add("2-1", nil)
+	s.delete([]streamID{{ms: 2, seq: 1}})
+
+	clone := s.Clone()
+	if clone.EntriesAdded() != 2 || clone.MaxDeletedID() != "2-1" || clone.lastID() != (streamID{ms: 2, seq: 1}) {
+		t.Errorf("clone = (%d, %s, %s), want (2, 2-1, 2-1)", clone.EntriesAdded(), clone.MaxDeletedID(), clone.lastID())
+	}
+}
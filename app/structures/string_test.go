@@ -0,0 +1,294 @@
+package structures
+
+import (
+	"math"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestStore_SetWithOptions_Conditions(t *testing.T) {
+	s := NewStore()
+
+	if _, _, stored, _ := s.SetWithOptions("lock", "a", SetOptions{XX: true}); stored {
+		t.Error("SET XX on a missing key should not store")
+	}
+	if _, _, stored, _ := s.SetWithOptions("lock", "a", SetOptions{NX: true}); !stored {
+		t.Error("SET NX on a missing key should store")
+	}
+	if _, _, stored, _ := s.SetWithOptions("lock", "b", SetOptions{NX: true}); stored {
+		t.Error("SET NX on an existing key should not store")
+	}
+	if v, _, _ := s.Get("lock"); v != "a" {
+		t.Errorf("Get(lock) = %q, want 'a'", v)
+	}
+	if _, _, stored, _ := s.SetWithOptions("lock", "c", SetOptions{XX: true}); !stored {
+		t.Error("SET XX on an existing key should store")
+	}
+}
+
+func TestStore_SetWithOptions_Get(t *testing.T) {
+	s := NewStore()
+	s.Set("k", "old", time.Time{})
+
+	old, hadOld, stored, err := s.SetWithOptions("k", "new", SetOptions{Get: true, NX: true})
+	if err != nil || !hadOld || old != "old" || stored {
+		t.Errorf("SET NX GET = (%q, %v, %v, %v), want (\"old\", true, false, nil)", old, hadOld, stored, err)
+	}
+
+	s.RPush("list", false, "a")
+	if _, _, _, err := s.SetWithOptions("list", "v", SetOptions{Get: true}); err != ErrWrongType {
+		t.Errorf("SET GET on a list error = %v, want ErrWrongType", err)
+	}
+	if s.Type("list") != "list" {
+		t.Error("a failed SET GET must not overwrite the key")
+	}
+
+	// Without GET, SET replaces a value of any type.
+	if _, _, stored, _ := s.SetWithOptions("list", "v", SetOptions{}); !stored || s.Type("list") != "string" {
+		t.Error("plain SET should overwrite a list")
+	}
+}
+
+func TestStore_SetWithOptions_KeepTTL(t *testing.T) {
+	s := NewStore()
+	expiry := time.Now().Add(time.Hour)
+	s.Set("k", "v", expiry)
+
+	s.SetWithOptions("k", "v2", SetOptions{KeepTTL: true})
+	if got := s.data["k"].Expiry; !got.Equal(expiry) {
+		t.Errorf("expiry after KEEPTTL = %v, want %v", got, expiry)
+	}
+
+	s.SetWithOptions("k", "v3", SetOptions{})
+	if got := s.data["k"].Expiry; !got.IsZero() {
+		t.Errorf("expiry after plain SET = %v, want none", got)
+	}
+}
+
+func TestStore_Append_StrLen(t *testing.T) {
+	s := NewStore()
+	expiry := time.Now().Add(time.Hour)
+	s.Set("k", "foo", expiry)
+
+	if n, err := s.Append("k", "bar"); err != nil || n != 6 {
+		t.Errorf("Append = (%d, %v), want (6, nil)", n, err)
+	}
+	if v, _, _ := s.Get("k"); v != "foobar" {
+		t.Errorf("Get after Append = %q, want 'foobar'", v)
+	}
+	if !s.data["k"].Expiry.Equal(expiry) {
+		t.Error("Append should keep the key's expiry")
+	}
+	if n, _ := s.Append("new", "x"); n != 1 {
+		t.Errorf("Append to missing key = %d, want 1", n)
+	}
+	if n, _ := s.StrLen("missing"); n != 0 {
+		t.Errorf("StrLen(missing) = %d, want 0", n)
+	}
+
+	s.RPush("list", false, "a")
+	if _, err := s.StrLen("list"); err != ErrWrongType {
+		t.Errorf("StrLen on list error = %v, want ErrWrongType", err)
+	}
+}
+
+func TestStore_GetRange(t *testing.T) {
+	s := NewStore()
+	s.Set("k", "This is a string", time.Time{})
+
+	tests := []struct {
+		start, end int
+		want       string
+	}{
+		{0, 3, "This"},
+		{-3, -1, "ing"},
+		{0, -1, "This is a string"},
+		{10, 100, "string"},
+		{5, 3, ""},
+		{-1, -5, ""},
+		{-100, 3, "This"},
+	}
+	for _, tt := range tests {
+		if got, _ := s.GetRange("k", tt.start, tt.end); got != tt.want {
+			t.Errorf("GetRange(%d, %d) = %q, want %q", tt.start, tt.end, got, tt.want)
+		}
+	}
+}
+
+func TestStore_SetRange(t *testing.T) {
+	s := NewStore()
+	s.Set("k", "Hello World", time.Time{})
+
+	if n, _ := s.SetRange("k", 6, "Redis"); n != 11 {
+		t.Errorf("SetRange = %d, want 11", n)
+	}
+	if v, _, _ := s.Get("k"); v != "Hello Redis" {
+		t.Errorf("Get after SetRange = %q, want 'Hello Redis'", v)
+	}
+
+	if n, _ := s.SetRange("pad", 3, "x"); n != 4 {
+		t.Errorf("SetRange with padding = %d, want 4", n)
+	}
+	if v, _, _ := s.Get("pad"); v != "\x00\x00\x00x" {
+		t.Errorf("padded value = %q, want zero bytes then 'x'", v)
+	}
+
+	if n, _ := s.SetRange("missing", 5, ""); n != 0 || s.Type("missing") != "none" {
+		t.Error("SetRange with an empty value must not create the key")
+	}
+	if _, err := s.SetRange("k", maxStringLength, "x"); err != ErrStringTooLong {
+		t.Errorf("SetRange past the size limit error = %v, want ErrStringTooLong", err)
+	}
+	if _, err := s.SetRange("k", math.MaxInt, "x"); err != ErrStringTooLong {
+		t.Errorf("SetRange at a huge offset error = %v, want ErrStringTooLong", err)
+	}
+}
+
+func TestStore_GetDel_GetEx(t *testing.T) {
+	s := NewStore()
+	s.Set("k", "v", time.Time{})
+
+	if v, ok, _ := s.GetDel("k"); !ok || v != "v" || s.Type("k") != "none" {
+		t.Error("GetDel should return the value and delete the key")
+	}
+
+	s.Set("k", "v", time.Now().Add(time.Hour))
+	if _, ok, _ := s.GetEx("k", true, time.Time{}); !ok || !s.data["k"].Expiry.IsZero() {
+		t.Error("GetEx PERSIST should clear the expiry")
+	}
+	at := time.Now().Add(time.Minute)
+	s.GetEx("k", true, at)
+	if !s.data["k"].Expiry.Equal(at) {
+		t.Error("GetEx should set the new expiry")
+	}
+	if v, ok, _ := s.GetEx("k", true, time.Now().Add(-time.Second)); !ok || v != "v" || s.Type("k") != "none" {
+		t.Error("GetEx with a past expiry should return the value and delete the key")
+	}
+}
+
+func TestStore_MSetNX(t *testing.T) {
+	s := NewStore()
+
+	if !s.MSetNX(map[string]string{"a": "1", "b": "2"}) {
+		t.Fatal("MSetNX on missing keys should succeed")
+	}
+	if s.MSetNX(map[string]string{"b": "x", "c": "3"}) {
+		t.Error("MSetNX should fail when any key exists")
+	}
+	if s.Type("c") != "none" {
+		t.Error("a failed MSetNX must not set any key")
+	}
+}
+
+func TestStore_IncrBy(t *testing.T) {
+	s := NewStore()
+	expiry := time.Now().Add(time.Hour)
+	s.Set("n", "10", expiry)
+
+	if v, err := s.IncrBy("n", -15); err != nil || v != -5 {
+		t.Errorf("IncrBy(-15) = (%d, %v), want (-5, nil)", v, err)
+	}
+	if !s.data["n"].Expiry.Equal(expiry) {
+		t.Error("IncrBy should keep the key's expiry")
+	}
+
+	s.Set("max", strconv.FormatInt(math.MaxInt64, 10), time.Time{})
+	if _, err := s.IncrBy("max", 1); err != ErrOverflow {
+		t.Errorf("IncrBy past MaxInt64 error = %v, want ErrOverflow", err)
+	}
+	s.Set("min", strconv.FormatInt(math.MinInt64, 10), time.Time{})
+	if _, err := s.IncrBy("min", -1); err != ErrOverflow {
+		t.Errorf("IncrBy past MinInt64 error = %v, want ErrOverflow", err)
+	}
+	s.Set("big", "9223372036854775808", time.Time{})
+	if _, err := s.IncrBy("big", 1); err != ErrNotInteger {
+		t.Errorf("IncrBy on out-of-range value error = %v, want ErrNotInteger", err)
+	}
+
+	s.RPush("list", false, "a")
+	if _, err := s.Incr("list"); err != ErrWrongType {
+		t.Errorf("Incr on list error = %v, want ErrWrongType", err)
+	}
+}
+
+func TestStore_IncrByFloat(t *testing.T) {
+	s := NewStore()
+	expiry := time.Now().Add(time.Hour)
+	s.Set("f", "10.50", expiry)
+
+	tests := []struct {
+		delta float64
+		want  string
+	}{
+		{0.1, "10.6"},
+		{-5, "5.6"},
+		{4.4, "10"},
+		{2.0e3, "2010"},
+	}
+	for _, tt := range tests {
+		if got, err := s.IncrByFloat("f", tt.delta); err != nil || got != tt.want {
+			t.Errorf("IncrByFloat(%v) = (%q, %v), want (%q, nil)", tt.delta, got, err, tt.want)
+		}
+	}
+	if !s.data["f"].Expiry.Equal(expiry) {
+		t.Error("IncrByFloat should keep the key's expiry")
+	}
+
+	if got, _ := s.IncrByFloat("new", 1.5); got != "1.5" {
+		t.Errorf("IncrByFloat on missing key = %q, want '1.5'", got)
+	}
+	s.Set("str", "abc", time.Time{})
+	if _, err := s.IncrByFloat("str", 1); err != ErrNotFloat {
+		t.Errorf("IncrByFloat on non-float error = %v, want ErrNotFloat", err)
+	}
+	s.Set("huge", "1.7e308", time.Time{})
+	if _, err := s.IncrByFloat("huge", 1.7e308); err != ErrNaNOrInfinity {
+		t.Errorf("IncrByFloat to infinity error = %v, want ErrNaNOrInfinity", err)
+	}
+}
+
+func TestStore_MGet_MSet(t *testing.T) {
+	s := NewStore()
+	s.Set("a", "old", time.Now().Add(time.Hour))
+	s.RPush("list", false, "x")
+
+	s.MSet(map[string]string{"a": "1", "b": "2"})
+	if !s.data["a"].Expiry.IsZero() {
+		t.Error("MSet should clear the key's expiry")
+	}
+
+	values, found := s.MGet("a", "missing", "list", "b")
+	wantValues := []string{"1", "", "", "2"}
+	wantFound := []bool{true, false, false, true}
+	if !reflect.DeepEqual(values, wantValues) || !reflect.DeepEqual(found, wantFound) {
+		t.Errorf("MGet = (%q, %v), want (%q, %v)", values, found, wantValues, wantFound)
+	}
+}
+
+func TestStore_MSet_Atomic(t *testing.T) {
+	s := NewStore()
+	s.MSet(map[string]string{"x": "0", "y": "0"})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := range 1000 {
+			v := strconv.Itoa(i)
+			s.MSet(map[string]string{"x": v, "y": v})
+		}
+	}()
+
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+		values, _ := s.MGet("x", "y")
+		if values[0] != values[1] {
+			t.Fatalf("MGet observed a partial MSet: %q", values)
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"fmt"
 	"net"
+	"strconv"
 	"strings"
 	"sync"
 	"testing"
@@ -255,7 +256,8 @@ func TestE2E_SetGet_Expiry(t *testing.T) {
 	})
 
 	t.Run("invalid PX value", func(t *testing.T) {
-		assertErrorContains(t, c.Do(t, "SET", "k", "v", "PX", "notanumber"), "invalid expire")
+		assertErrorContains(t, c.Do(t, "SET", "k", "v", "PX", "notanumber"), "not an integer")
+		assertErrorContains(t, c.Do(t, "SET", "k", "v", "PX", "0"), "invalid expire time")
 	})
 
 	t.Run("no expiry persists", func(t *testing.T) {
@@ -265,6 +267,132 @@ func TestE2E_SetGet_Expiry(t *testing.T) {
 	})
 }
 
+func TestE2E_SetOptions(t *testing.T) {
+	addr, cleanup := startServer(t)
+	defer cleanup()
+	c := dial(t, addr)
+	defer c.Close()
+
+	t.Run("NX lock", func(t *testing.T) {
+		assertString(t, c.Do(t, "SET", "lock", "owner1", "NX", "PX", "5000"), "OK")
+		assertNil(t, c.Do(t, "SET", "lock", "owner2", "NX", "PX", "5000"))
+		assertBulk(t, c.Do(t, "GET", "lock"), "owner1")
+	})
+
+	t.Run("XX and GET", func(t *testing.T) {
+		assertNil(t, c.Do(t, "SET", "missing", "v", "XX"))
+		assertNil(t, c.Do(t, "GET", "missing"))
+		assertBulk(t, c.Do(t, "SET", "lock", "owner3", "GET", "KEEPTTL"), "owner1")
+	})
+
+	t.Run("absolute expiry", func(t *testing.T) {
+		past := strconv.FormatInt(time.Now().Add(-time.Second).UnixMilli(), 10)
+		assertString(t, c.Do(t, "SET", "old", "v", "PXAT", past), "OK")
+		assertNil(t, c.Do(t, "GET", "old"))
+	})
+
+	t.Run("conflicting options", func(t *testing.T) {
+		assertErrorContains(t, c.Do(t, "SET", "k", "v", "NX", "XX"), "syntax error")
+		assertErrorContains(t, c.Do(t, "SET", "k", "v", "EX", "10", "KEEPTTL"), "syntax error")
+	})
+}
+
+func TestE2E_StringCommands(t *testing.T) {
+	addr, cleanup := startServer(t)
+	defer cleanup()
+	c := dial(t, addr)
+	defer c.Close()
+
+	t.Run("append and ranges", func(t *testing.T) {
+		assertInteger(t, c.Do(t, "APPEND", "greeting", "Hello"), 5)
+		assertInteger(t, c.Do(t, "APPEND", "greeting", " World"), 11)
+		assertInteger(t, c.Do(t, "STRLEN", "greeting"), 11)
+		assertBulk(t, c.Do(t, "GETRANGE", "greeting", "-5", "-1"), "World")
+		assertInteger(t, c.Do(t, "SETRANGE", "greeting", "6", "Redis"), 11)
+		assertBulk(t, c.Do(t, "GET", "greeting"), "Hello Redis")
+	})
+
+	t.Run("get and modify", func(t *testing.T) {
+		assertBulk(t, c.Do(t, "GETSET", "greeting", "Hi"), "Hello Redis")
+		assertBulk(t, c.Do(t, "GETEX", "greeting", "PX", "50"), "Hi")
+		time.Sleep(100 * time.Millisecond)
+		assertNil(t, c.Do(t, "GET", "greeting"))
+
+		c.Do(t, "SET", "once", "v")
+		assertBulk(t, c.Do(t, "GETDEL", "once"), "v")
+		assertNil(t, c.Do(t, "GET", "once"))
+	})
+
+	t.Run("counters", func(t *testing.T) {
+		assertInteger(t, c.Do(t, "INCRBY", "counter", "10"), 10)
+		assertInteger(t, c.Do(t, "DECR", "counter"), 9)
+		assertInteger(t, c.Do(t, "DECRBY", "counter", "4"), 5)
+		assertBulk(t, c.Do(t, "INCRBYFLOAT", "counter", "0.25"), "5.25")
+
+		c.Do(t, "SET", "max", "9223372036854775807")
+		assertErrorContains(t, c.Do(t, "INCR", "max"), "overflow")
+		c.Do(t, "RPUSH", "counter-list", "a")
+		assertErrorContains(t, c.Do(t, "INCR", "counter-list"), "WRONGTYPE")
+	})
+
+	t.Run("conditional and expiring sets", func(t *testing.T) {
+		assertInteger(t, c.Do(t, "SETNX", "nx", "1"), 1)
+		assertInteger(t, c.Do(t, "SETNX", "nx", "2"), 0)
+		assertString(t, c.Do(t, "SETEX", "ex", "100", "v"), "OK")
+		assertString(t, c.Do(t, "PSETEX", "pex", "100000", "v"), "OK")
+		assertInteger(t, c.Do(t, "MSETNX", "m1", "a", "m2", "b"), 1)
+		assertInteger(t, c.Do(t, "MSETNX", "m2", "c", "m3", "d"), 0)
+		assertNil(t, c.Do(t, "GET", "m3"))
+	})
+}
+
+func TestE2E_MGetMSet(t *testing.T) {
+	addr, cleanup := startServer(t)
+	defer cleanup()
+	c := dial(t, addr)
+	defer c.Close()
+
+	assertString(t, c.Do(t, "MSET", "k1", "v1", "k2", "v2", "k1", "v3"), "OK")
+	c.Do(t, "RPUSH", "klist", "a")
+
+	r := c.Do(t, "MGET", "k1", "k2", "missing", "klist")
+	assertArray(t, r, 4)
+	if len(r.Array) == 4 {
+		assertBulk(t, r.Array[0], "v3")
+		assertBulk(t, r.Array[1], "v2")
+		assertNil(t, r.Array[2])
+		assertNil(t, r.Array[3])
+	}
+
+	assertErrorContains(t, c.Do(t, "MSET", "k1"), "wrong number of arguments")
+
+	t.Run("atomic against concurrent readers", func(t *testing.T) {
+		writer := dial(t, addr)
+		defer writer.Close()
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for i := range 200 {
+				v := strconv.Itoa(i)
+				writer.Do(t, "MSET", "pair-a", v, "pair-b", v)
+			}
+		}()
+
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			r := c.Do(t, "MGET", "pair-a", "pair-b")
+			if len(r.Array) == 2 && r.Array[0].Bulk != r.Array[1].Bulk {
+				t.Fatalf("MGET observed a partial MSET: %q and %q", r.Array[0].Bulk, r.Array[1].Bulk)
+			}
+		}
+	})
+}
+
 func TestE2E_SetGet_WrongArgs(t *testing.T) {
 	addr, cleanup := startServer(t)
 	defer cleanup()
@@ -318,6 +446,106 @@ func TestE2E_Keys(t *testing.T) {
 	})
 }
 
+func TestE2E_KeysPattern(t *testing.T) {
+	addr, cleanup := startServer(t)
+	defer cleanup()
+	c := dial(t, addr)
+	defer c.Close()
+
+	c.Do(t, "MSET", "hello", "1", "hallo", "2", "hxllo", "3", "h*llo", "4")
+
+	assertArray(t, c.Do(t, "KEYS", "h?llo"), 4)
+	assertArray(t, c.Do(t, "KEYS", "h[ae]llo"), 2)
+	assertArray(t, c.Do(t, "KEYS", "h[^e]llo"), 3)
+	r := c.Do(t, "KEYS", `h\*llo`)
+	assertArray(t, r, 1)
+	if len(r.Array) == 1 {
+		assertBulk(t, r.Array[0], "h*llo")
+	}
+}
+
+func TestE2E_Scan(t *testing.T) {
+	addr, cleanup := startServer(t)
+	defer cleanup()
+	c := dial(t, addr)
+	defer c.Close()
+
+	for i := range 100 {
+		c.Do(t, "SET", fmt.Sprintf("scan:%d", i), "v")
+	}
+	c.Do(t, "RPUSH", "scan:list", "a")
+
+	seen := map[string]bool{}
+	cursor := "0"
+	for {
+		r := c.Do(t, "SCAN", cursor, "MATCH", "scan:*", "COUNT", "7", "TYPE", "string")
+		assertArray(t, r, 2)
+		if len(r.Array) != 2 {
+			return
+		}
+		for _, k := range r.Array[1].Array {
+			seen[k.Bulk] = true
+		}
+		cursor = r.Array[0].Bulk
+		if cursor == "0" {
+			break
+		}
+	}
+
+	if len(seen) != 100 || seen["scan:list"] {
+		t.Errorf("SCAN returned %d keys, want the 100 string keys", len(seen))
+	}
+	assertErrorContains(t, c.Do(t, "SCAN", "abc"), "invalid cursor")
+}
+
+func TestE2E_CollectionScan(t *testing.T) {
+	addr, cleanup := startServer(t)
+	defer cleanup()
+	c := dial(t, addr)
+	defer c.Close()
+
+	for i := range 50 {
+		c.Do(t, "HSET", "h", fmt.Sprintf("f%d", i), fmt.Sprintf("v%d", i))
+		c.Do(t, "SADD", "s", fmt.Sprintf("m%d", i))
+		c.Do(t, "ZADD", "z", fmt.Sprint(i), fmt.Sprintf("m%d", i))
+	}
+
+	// scanAll walks a full iteration and returns the flattened items.
+	scanAll := func(args ...string) []string {
+		var items []string
+		cursor := "0"
+		for {
+			r := c.Do(t, args[0], append([]string{args[1], cursor}, args[2:]...)...)
+			assertArray(t, r, 2)
+			if len(r.Array) != 2 {
+				return items
+			}
+			for _, item := range r.Array[1].Array {
+				items = append(items, item.Bulk)
+			}
+			cursor = r.Array[0].Bulk
+			if cursor == "0" {
+				return items
+			}
+		}
+	}
+
+	if items := scanAll("HSCAN", "h", "COUNT", "5"); len(items) != 100 {
+		t.Errorf("HSCAN returned %d items, want 50 field/value pairs", len(items))
+	}
+	if items := scanAll("HSCAN", "h", "NOVALUES", "MATCH", "f1*"); len(items) != 11 {
+		t.Errorf("HSCAN NOVALUES MATCH f1* returned %v, want 11 fields", items)
+	}
+	if items := scanAll("SSCAN", "s", "COUNT", "5"); len(items) != 50 {
+		t.Errorf("SSCAN returned %d members, want 50", len(items))
+	}
+	items := scanAll("ZSCAN", "z", "MATCH", "m7")
+	if len(items) != 2 || items[0] != "m7" || items[1] != "7" {
+		t.Errorf("ZSCAN MATCH m7 = %v, want [m7 7]", items)
+	}
+	assertErrorContains(t, c.Do(t, "SSCAN", "h", "0"), "WRONGTYPE")
+}
+
 // ---------------------------------------------------------------------------
 // TYPE
 // ---------------------------------------------------------------------------
@@ -347,6 +575,204 @@ func TestE2E_Type(t *testing.T) {
 	})
 }
 
+// ---------------------------------------------------------------------------
+// Keyspace: DEL / EXISTS / RENAME / COPY / RANDOMKEY / DBSIZE
+// ---------------------------------------------------------------------------
+
+func TestE2E_KeyspaceCommands(t *testing.T) {
+	addr, cleanup := startServer(t)
+	defer cleanup()
+	c := dial(t, addr)
+	defer c.Close()
+
+	assertInteger(t, c.Do(t, "DBSIZE"), 0)
+	assertNil(t, c.Do(t, "RANDOMKEY"))
+
+	c.Do(t, "MSET", "a", "1", "b", "2", "c", "3")
+	c.Do(t, "RPUSH", "list", "x", "y")
+	assertInteger(t, c.Do(t, "DBSIZE"), 4)
+	assertInteger(t, c.Do(t, "EXISTS", "a", "a", "missing"), 2)
+	assertInteger(t, c.Do(t, "TOUCH", "a", "b", "missing"), 2)
+
+	t.Run("delete", func(t *testing.T) {
+		assertInteger(t, c.Do(t, "DEL", "a", "missing"), 1)
+		assertInteger(t, c.Do(t, "UNLINK", "b"), 1)
+		assertInteger(t, c.Do(t, "EXISTS", "a", "b"), 0)
+	})
+
+	t.Run("rename", func(t *testing.T) {
+		c.Do(t, "SET", "ttl-key", "v", "EX", "100")
+		assertString(t, c.Do(t, "RENAME", "ttl-key", "renamed"), "OK")
+		assertNil(t, c.Do(t, "GET", "ttl-key"))
+		assertBulk(t, c.Do(t, "GET", "renamed"), "v")
+		assertErrorContains(t, c.Do(t, "RENAME", "ttl-key", "x"), "no such key")
+		assertInteger(t, c.Do(t, "RENAMENX", "renamed", "c"), 0)
+		assertInteger(t, c.Do(t, "RENAMENX", "renamed", "fresh"), 1)
+	})
+
+	t.Run("copy", func(t *testing.T) {
+		assertInteger(t, c.Do(t, "COPY", "list", "list-copy"), 1)
+		assertInteger(t, c.Do(t, "COPY", "list", "list-copy"), 0)
+		c.Do(t, "RPUSH", "list-copy", "z")
+		assertInteger(t, c.Do(t, "LLEN", "list"), 2)
+		assertInteger(t, c.Do(t, "LLEN", "list-copy"), 3)
+
+		assertInteger(t, c.Do(t, "COPY", "c", "list-copy", "REPLACE", "DB", "0"), 1)
+		assertBulk(t, c.Do(t, "GET", "list-copy"), "3")
+		assertErrorContains(t, c.Do(t, "COPY", "c", "d", "DB", "16"), "out of range")
+	})
+
+	r := c.Do(t, "RANDOMKEY")
+	if r.Type != "bulk" || r.Bulk == "" {
+		t.Errorf("RANDOMKEY = %v, want a key", r)
+	}
+}
+
+func TestE2E_KeyExpiry(t *testing.T) {
+	addr, cleanup := startServer(t)
+	defer cleanup()
+	c := dial(t, addr)
+	defer c.Close()
+
+	assertInteger(t, c.Do(t, "TTL", "missing"), -2)
+	assertInteger(t, c.Do(t, "PTTL", "missing"), -2)
+
+	c.Do(t, "SET", "k", "v")
+	assertInteger(t, c.Do(t, "TTL", "k"), -1)
+	assertInteger(t, c.Do(t, "EXPIRETIME", "k"), -1)
+
+	t.Run("conditions", func(t *testing.T) {
+		assertInteger(t, c.Do(t, "EXPIRE", "k", "100", "XX"), 0)
+		assertInteger(t, c.Do(t, "EXPIRE", "k", "100", "NX"), 1)
+		assertInteger(t, c.Do(t, "TTL", "k"), 100)
+		assertInteger(t, c.Do(t, "EXPIRE", "k", "50", "GT"), 0)
+		assertInteger(t, c.Do(t, "EXPIRE", "k", "50", "LT"), 1)
+		assertInteger(t, c.Do(t, "TTL", "k"), 50)
+		assertErrorContains(t, c.Do(t, "EXPIRE", "k", "50", "NX", "XX"), "not compatible")
+	})
+
+	t.Run("absolute", func(t *testing.T) {
+		at := time.Now().Add(time.Hour).Unix()
+		assertInteger(t, c.Do(t, "EXPIREAT", "k", strconv.FormatInt(at, 10)), 1)
+		assertInteger(t, c.Do(t, "EXPIRETIME", "k"), int(at))
+		assertInteger(t, c.Do(t, "PEXPIRETIME", "k"), int(at*1000))
+	})
+
+	t.Run("persist", func(t *testing.T) {
+		assertInteger(t, c.Do(t, "PERSIST", "k"), 1)
+		assertInteger(t, c.Do(t, "PTTL", "k"), -1)
+		assertInteger(t, c.Do(t, "PERSIST", "k"), 0)
+	})
+
+	t.Run("every type", func(t *testing.T) {
+		c.Do(t, "RPUSH", "elist", "a")
+		c.Do(t, "XADD", "estream", "1-1", "f", "v")
+		assertInteger(t, c.Do(t, "PEXPIRE", "elist", "50"), 1)
+		assertInteger(t, c.Do(t, "PEXPIRE", "estream", "50"), 1)
+		time.Sleep(100 * time.Millisecond)
+		assertInteger(t, c.Do(t, "EXISTS", "elist", "estream"), 0)
+		assertInteger(t, c.Do(t, "TTL", "estream"), -2)
+	})
+
+	t.Run("past deadline deletes", func(t *testing.T) {
+		c.Do(t, "SET", "gone", "v")
+		assertInteger(t, c.Do(t, "EXPIRE", "gone", "-1"), 1)
+		assertNil(t, c.Do(t, "GET", "gone"))
+	})
+}
+
+// ---------------------------------------------------------------------------
+// Databases: SELECT / SWAPDB / MOVE / FLUSHDB / FLUSHALL
+// ---------------------------------------------------------------------------
+
+func TestE2E_Databases(t *testing.T) {
+	addr, cleanup := startServer(t)
+	defer cleanup()
+	c := dial(t, addr)
+	defer c.Close()
+	other := dial(t, addr)
+	defer other.Close()
+
+	t.Run("SELECT is per connection", func(t *testing.T) {
+		assertString(t, c.Do(t, "SELECT", "2"), "OK")
+		c.Do(t, "SET", "tenant", "two")
+		assertNil(t, other.Do(t, "GET", "tenant"))
+		assertString(t, other.Do(t, "SELECT", "2"), "OK")
+		assertBulk(t, other.Do(t, "GET", "tenant"), "two")
+		assertErrorContains(t, c.Do(t, "SELECT", "16"), "out of range")
+	})
+
+	t.Run("SELECT inside MULTI", func(t *testing.T) {
+		assertString(t, c.Do(t, "MULTI"), "OK")
+		c.Do(t, "SELECT", "3")
+		c.Do(t, "SET", "tx", "three")
+		assertArray(t, c.Do(t, "EXEC"), 2)
+		assertBulk(t, c.Do(t, "GET", "tx"), "three")
+	})
+
+	t.Run("MOVE and COPY DB", func(t *testing.T) {
+		assertInteger(t, c.Do(t, "MOVE", "tx", "4"), 1)
+		assertNil(t, c.Do(t, "GET", "tx"))
+		assertInteger(t, c.Do(t, "COPY", "tenant", "tenant", "DB", "4"), 0)
+		c.Do(t, "SELECT", "2")
+		assertInteger(t, c.Do(t, "COPY", "tenant", "tenant", "DB", "4"), 1)
+		c.Do(t, "SELECT", "4")
+		assertBulk(t, c.Do(t, "GET", "tx"), "three")
+		assertBulk(t, c.Do(t, "GET", "tenant"), "two")
+	})
+
+	t.Run("SWAPDB is seen by other connections", func(t *testing.T) {
+		assertString(t, c.Do(t, "SWAPDB", "2", "5"), "OK")
+		assertNil(t, other.Do(t, "GET", "tenant"))
+		other.Do(t, "SELECT", "5")
+		assertBulk(t, other.Do(t, "GET", "tenant"), "two")
+	})
+
+	t.Run("FLUSHDB and FLUSHALL", func(t *testing.T) {
+		assertString(t, c.Do(t, "FLUSHDB", "ASYNC"), "OK")
+		assertInteger(t, c.Do(t, "DBSIZE"), 0)
+		assertInteger(t, other.Do(t, "DBSIZE"), 1)
+		assertString(t, c.Do(t, "FLUSHALL"), "OK")
+		assertInteger(t, other.Do(t, "DBSIZE"), 0)
+	})
+}
+
+// ---------------------------------------------------------------------------
+// Memory
+// ---------------------------------------------------------------------------
+
+func TestE2E_Memory(t *testing.T) {
+	addr, cleanup := startServer(t)
+	defer cleanup()
+	c := dial(t, addr)
+	defer c.Close()
+
+	t.Run("MEMORY USAGE follows the value", func(t *testing.T) {
+		c.Do(t, "RPUSH", "list", "a")
+		small := c.Do(t, "MEMORY", "USAGE", "list")
+		c.Do(t, "RPUSH", "list", strings.Repeat("x", 1000))
+		large := c.Do(t, "MEMORY", "USAGE", "list", "SAMPLES", "5")
+		if large.Integer-small.Integer < 1000 {
+			t.Errorf("MEMORY USAGE grew from %d to %d, want at least 1000 bytes more", small.Integer, large.Integer)
+		}
+		assertNil(t, c.Do(t, "MEMORY", "USAGE", "missing"))
+	})
+
+	t.Run("OBJECT IDLETIME", func(t *testing.T) {
+		assertInteger(t, c.Do(t, "OBJECT", "IDLETIME", "list"), 0)
+		assertErrorContains(t, c.Do(t, "OBJECT", "FREQ", "list"), "LFU")
+	})
+
+	t.Run("INFO memory", func(t *testing.T) {
+		info := c.Do(t, "INFO", "memory").Bulk
+		for _, field := range []string{"used_memory:", "maxmemory:0", "maxmemory_policy:noeviction"} {
+			if !strings.Contains(info, field) {
+				t.Errorf("INFO memory = %q, missing %q", info, field)
+			}
+		}
+	})
+}
+
 // ---------------------------------------------------------------------------
 // INCR
 // ---------------------------------------------------------------------------
@@ -439,7 +865,8 @@ func TestE2E_Xadd(t *testing.T) {
 	})
 
 	t.Run("no field-value pairs", func(t *testing.T) {
-		assertBulk(t, c.Do(t, "XADD", "s7", "1-1"), "1-1")
+		assertErrorContains(t, c.Do(t, "XADD", "s7", "1-1"), "wrong number of arguments")
+		assertErrorContains(t, c.Do(t, "XADD", "s7", "1-1", "a", "1", "b"), "wrong number of arguments")
 	})
 
 	t.Run("too few args", func(t *testing.T) {
@@ -474,12 +901,13 @@ func TestE2E_Xrange(t *testing.T) {
 	})
 
 	t.Run("non-existent stream", func(t *testing.T) {
-		assertNil(t, c.Do(t, "XRANGE", "nosuch", "-", "+"))
+		assertArray(t, c.Do(t, "XRANGE", "nosuch", "-", "+"), 0)
+		assertArray(t, c.Do(t, "XREVRANGE", "nosuch", "+", "-"), 0)
 	})
 
 	t.Run("non-stream type", func(t *testing.T) {
 		c.Do(t, "SET", "str", "val")
-		assertNil(t, c.Do(t, "XRANGE", "str", "-", "+"))
+		assertErrorContains(t, c.Do(t, "XRANGE", "str", "-", "+"), "WRONGTYPE")
 	})
 
 	t.Run("empty range", func(t *testing.T) {
@@ -505,6 +933,32 @@ func TestE2E_Xrange(t *testing.T) {
 		}
 	})
 
+	t.Run("COUNT pages with exclusive start", func(t *testing.T) {
+		r := c.Do(t, "XRANGE", "stream", "-", "+", "COUNT", "2")
+		assertArray(t, r, 2)
+		last := r.Array[1].Array[0].Bulk
+		r = c.Do(t, "XRANGE", "stream", "("+last, "+", "COUNT", "2")
+		assertArray(t, r, 1)
+		assertBulk(t, r.Array[0].Array[0], "3-1")
+	})
+
+	t.Run("incomplete IDs", func(t *testing.T) {
+		r := c.Do(t, "XRANGE", "stream", "2", "3")
+		assertArray(t, r, 2)
+		assertBulk(t, r.Array[0].Array[0], "2-1")
+	})
+
+	t.Run("invalid ID", func(t *testing.T) {
+		assertErrorContains(t, c.Do(t, "XRANGE", "stream", "x", "+"), "Invalid stream ID")
+	})
+
+	t.Run("XREVRANGE", func(t *testing.T) {
+		r := c.Do(t, "XREVRANGE", "stream", "+", "-", "COUNT", "2")
+		assertArray(t, r, 2)
+		assertBulk(t, r.Array[0].Array[0], "3-1")
+		assertBulk(t, r.Array[1].Array[0], "2-1")
+	})
+
 	t.Run("wrong args", func(t *testing.T) {
 		assertErrorContains(t, c.Do(t, "XRANGE", "stream", "-"), "wrong number of arguments")
 	})
@@ -541,6 +995,14 @@ func TestE2E_Xread(t *testing.T) {
 		assertArray(t, r, 0)
 	})
 
+	t.Run("COUNT", func(t *testing.T) {
+		r := c.Do(t, "XREAD", "COUNT", "1", "STREAMS", "s", "0")
+		assertArray(t, r, 1)
+		entries := r.Array[0].Array[1]
+		assertArray(t, entries, 1)
+		assertBulk(t, entries.Array[0].Array[0], "1-1")
+	})
+
 	t.Run("unknown subcommand", func(t *testing.T) {
 		assertNil(t, c.Do(t, "XREAD", "INVALID"))
 	})
@@ -550,6 +1012,155 @@ func TestE2E_Xread(t *testing.T) {
 	})
 }
 
+func TestE2E_StreamTrimming(t *testing.T) {
+	addr, cleanup := startServer(t)
+	defer cleanup()
+	c := dial(t, addr)
+	defer c.Close()
+
+	for _, id := range []string{"1-1", "2-1", "3-1", "4-1"} {
+		c.Do(t, "XADD", "s", id, "f", "v")
+	}
+
+	t.Run("XLEN", func(t *testing.T) {
+		assertInteger(t, c.Do(t, "XLEN", "s"), 4)
+		assertInteger(t, c.Do(t, "XLEN", "nosuch"), 0)
+	})
+
+	t.Run("XDEL", func(t *testing.T) {
+		assertInteger(t, c.Do(t, "XDEL", "s", "2-1", "9-1"), 1)
+		assertInteger(t, c.Do(t, "XLEN", "s"), 3)
+	})
+
+	t.Run("XTRIM MAXLEN", func(t *testing.T) {
+		assertInteger(t, c.Do(t, "XTRIM", "s", "MAXLEN", "2"), 1)
+		r := c.Do(t, "XRANGE", "s", "-", "+")
+		assertArray(t, r, 2)
+		assertBulk(t, r.Array[0].Array[0], "3-1")
+	})
+
+	t.Run("XADD MINID", func(t *testing.T) {
+		assertBulk(t, c.Do(t, "XADD", "s", "MINID", "4", "5-1", "f", "v"), "5-1")
+		assertInteger(t, c.Do(t, "XLEN", "s"), 2)
+	})
+
+	t.Run("XADD NOMKSTREAM", func(t *testing.T) {
+		assertNil(t, c.Do(t, "XADD", "nosuch", "NOMKSTREAM", "*", "f", "v"))
+		assertInteger(t, c.Do(t, "EXISTS", "nosuch"), 0)
+	})
+
+	t.Run("LIMIT needs ~", func(t *testing.T) {
+		assertErrorContains(t, c.Do(t, "XTRIM", "s", "MAXLEN", "0", "LIMIT", "10"), "special ~ option")
+	})
+}
+
+// ---------------------------------------------------------------------------
+// Streams: consumer groups
+// ---------------------------------------------------------------------------
+
+func TestE2E_ConsumerGroups(t *testing.T) {
+	addr, cleanup := startServer(t)
+	defer cleanup()
+	c := dial(t, addr)
+	defer c.Close()
+	worker := dial(t, addr)
+	defer worker.Close()
+
+	t.Run("XGROUP CREATE", func(t *testing.T) {
+		assertErrorContains(t, c.Do(t, "XGROUP", "CREATE", "jobs", "workers", "$"), "MKSTREAM")
+		assertString(t, c.Do(t, "XGROUP", "CREATE", "jobs", "workers", "$", "MKSTREAM"), "OK")
+		assertErrorContains(t, c.Do(t, "XGROUP", "CREATE", "jobs", "workers", "$"), "BUSYGROUP")
+	})
+
+	t.Run("XREADGROUP delivers each entry once", func(t *testing.T) {
+		for _, id := range []string{"1-1", "2-1", "3-1"} {
+			c.Do(t, "XADD", "jobs", id, "job", id)
+		}
+		r := c.Do(t, "XREADGROUP", "GROUP", "workers", "w1", "COUNT", "2", "STREAMS", "jobs", ">")
+		assertArray(t, r, 1)
+		assertBulk(t, r.Array[0].Array[0], "jobs")
+		assertArray(t, r.Array[0].Array[1], 2)
+		assertBulk(t, r.Array[0].Array[1].Array[0].Array[0], "1-1")
+
+		r = worker.Do(t, "XREADGROUP", "GROUP", "workers", "w2", "STREAMS", "jobs", ">")
+		assertArray(t, r.Array[0].Array[1], 1)
+		assertBulk(t, r.Array[0].Array[1].Array[0].Array[0], "3-1")
+		assertNil(t, worker.Do(t, "XREADGROUP", "GROUP", "workers", "w2", "STREAMS", "jobs", ">"))
+	})
+
+	t.Run("XREADGROUP rereads pending entries", func(t *testing.T) {
+		r := c.Do(t, "XREADGROUP", "GROUP", "workers", "w1", "STREAMS", "jobs", "0")
+		assertArray(t, r.Array[0].Array[1], 2)
+	})
+
+	t.Run("XREADGROUP BLOCK is served by XADD", func(t *testing.T) {
+		done := make(chan resp.RESP)
+		go func() {
+			done <- worker.Do(t, "XREADGROUP", "GROUP", "workers", "w2", "BLOCK", "0", "STREAMS", "jobs", ">")
+		}()
+		time.Sleep(50 * time.Millisecond)
+		c.Do(t, "XADD", "jobs", "4-1", "job", "4")
+
+		r := <-done
+		assertBulk(t, r.Array[0].Array[1].Array[0].Array[0], "4-1")
+	})
+
+	t.Run("XGROUP consumers and DESTROY", func(t *testing.T) {
+		assertInteger(t, c.Do(t, "XGROUP", "CREATECONSUMER", "jobs", "workers", "w3"), 1)
+		assertInteger(t, c.Do(t, "XGROUP", "DELCONSUMER", "jobs", "workers", "w1"), 2)
+		assertString(t, c.Do(t, "XGROUP", "SETID", "jobs", "workers", "0"), "OK")
+		assertInteger(t, c.Do(t, "XGROUP", "DESTROY", "jobs", "workers"), 1)
+		assertErrorContains(t, c.Do(t, "XREADGROUP", "GROUP", "workers", "w1", "STREAMS", "jobs", ">"), "NOGROUP")
+	})
+}
+
+func TestE2E_PendingEntries(t *testing.T) {
+	addr, cleanup := startServer(t)
+	defer cleanup()
+	c := dial(t, addr)
+	defer c.Close()
+
+	c.Do(t, "XGROUP", "CREATE", "jobs", "workers", "$", "MKSTREAM")
+	for _, id := range []string{"1-1", "2-1", "3-1"} {
+		c.Do(t, "XADD", "jobs", id, "job", id)
+	}
+	c.Do(t, "XREADGROUP", "GROUP", "workers", "crashed", "STREAMS", "jobs", ">")
+
+	t.Run("XPENDING", func(t *testing.T) {
+		r := c.Do(t, "XPENDING", "jobs", "workers")
+		assertInteger(t, r.Array[0], 3)
+		assertBulk(t, r.Array[1], "1-1")
+		assertBulk(t, r.Array[3].Array[0].Array[0], "crashed")
+
+		r = c.Do(t, "XPENDING", "jobs", "workers", "-", "+", "1")
+		assertArray(t, r, 1)
+		assertBulk(t, r.Array[0].Array[1], "crashed")
+		assertInteger(t, r.Array[0].Array[3], 1)
+	})
+
+	t.Run("XACK", func(t *testing.T) {
+		assertInteger(t, c.Do(t, "XACK", "jobs", "workers", "1-1"), 1)
+		assertInteger(t, c.Do(t, "XACK", "jobs", "workers", "1-1"), 0)
+	})
+
+	t.Run("XCLAIM transfers ownership", func(t *testing.T) {
+		r := c.Do(t, "XCLAIM", "jobs", "workers", "rescuer", "0", "2-1")
+		assertArray(t, r, 1)
+		assertBulk(t, r.Array[0].Array[0], "2-1")
+		r = c.Do(t, "XPENDING", "jobs", "workers", "2-1", "2-1", "1")
+		assertBulk(t, r.Array[0].Array[1], "rescuer")
+		assertInteger(t, r.Array[0].Array[3], 2)
+	})
+
+	t.Run("XAUTOCLAIM", func(t *testing.T) {
+		r := c.Do(t, "XAUTOCLAIM", "jobs", "workers", "rescuer", "0", "0", "JUSTID")
+		assertBulk(t, r.Array[0], "0-0")
+		assertArray(t, r.Array[1], 2)
+		assertArray(t, r.Array[2], 0)
+		assertErrorContains(t, c.Do(t, "XAUTOCLAIM", "jobs", "nogroup", "rescuer", "0", "0"), "NOGROUP")
+	})
+}
+
 // ---------------------------------------------------------------------------
 // Transactions: MULTI / EXEC / DISCARD
 // ---------------------------------------------------------------------------
@@ -616,6 +1227,30 @@ func TestE2E_MultiExec(t *testing.T) {
 		assertArray(t, r, 1)
 		assertError(t, r.Array[0])
 	})
+
+	t.Run("blocking commands do not block", func(t *testing.T) {
+		assertString(t, c.Do(t, "MULTI"), "OK")
+		assertString(t, c.Do(t, "RPUSH", "txl", "a"), "QUEUED")
+		assertString(t, c.Do(t, "BLPOP", "txl", "0"), "QUEUED")
+		assertString(t, c.Do(t, "BLPOP", "txl", "0"), "QUEUED")
+		assertString(t, c.Do(t, "BZPOPMIN", "txz", "0"), "QUEUED")
+
+		// Like Redis, they run as if their timeout had already passed.
+		r := c.Do(t, "EXEC")
+		assertArray(t, r, 4)
+		assertInteger(t, r.Array[0], 1)
+		assertArray(t, r.Array[1], 2)
+		assertBulk(t, r.Array[1].Array[1], "a")
+		assertNil(t, r.Array[2])
+		assertNil(t, r.Array[3])
+
+		// Outside the transaction they block again.
+		start := time.Now()
+		assertNil(t, c.Do(t, "BLPOP", "txl", "0.05"))
+		if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+			t.Errorf("BLPOP after EXEC returned after %v, want it to wait its timeout", elapsed)
+		}
+	})
 }
 
 func TestE2E_Discard(t *testing.T) {
@@ -865,14 +1500,14 @@ func TestE2E_MixedTypes(t *testing.T) {
 	c.Do(t, "XADD", "mixed_stream", "1-1", "f", "v")
 	assertBulk(t, c.Do(t, "TYPE", "mixed_stream"), "stream")
 
-	// GET on stream returns nil (it's not a string)
-	// The GET handler fetches .String which is empty for stream types
-	r := c.Do(t, "GET", "mixed_stream")
-	// Stream MapValue has empty String field, so GET returns bulk ""
-	if r.Type == "nil" || (r.Type == "bulk" && r.Bulk == "") {
-		// Either behavior is acceptable
-	} else {
-		t.Errorf("GET on stream type = (%s %q), want nil or empty bulk", r.Type, r.Bulk)
+	// GET only reads strings
+	assertErrorContains(t, c.Do(t, "GET", "mixed_stream"), "WRONGTYPE")
+	c.Do(t, "RPUSH", "mixed_list", "a")
+	assertErrorContains(t, c.Do(t, "GET", "mixed_list"), "WRONGTYPE")
+	r := c.Do(t, "MGET", "mixed", "mixed_list")
+	assertArray(t, r, 2)
+	if len(r.Array) == 2 {
+		assertNil(t, r.Array[1])
 	}
 }
 
@@ -899,3 +1534,365 @@ func TestE2E_KeysAfterExpiry(t *testing.T) {
 	assertArray(t, r, 1)
 	assertBulk(t, r.Array[0], "persist")
 }
+
+func TestE2E_ExpiryWithoutRead(t *testing.T) {
+	addr, cleanup := startServer(t)
+	defer cleanup()
+	c := dial(t, addr)
+	defer c.Close()
+
+	c.Do(t, "SET", "gone", "v", "PX", "50")
+	c.Do(t, "RPUSH", "gone-list", "a")
+	c.Do(t, "PEXPIRE", "gone-list", "50")
+	time.Sleep(100 * time.Millisecond)
+
+	// KEYS and TYPE reclaim expired keys without a GET first.
+	assertArray(t, c.Do(t, "KEYS", "*"), 0)
+	assertString(t, c.Do(t, "TYPE", "gone-list"), "none")
+
+	r := c.Do(t, "INFO", "stats")
+	if r.Type != "bulk" || !strings.Contains(r.Bulk, "expired_keys:2") {
+		t.Errorf("INFO stats = %q, want expired_keys:2", r.Bulk)
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Lists
+// ---------------------------------------------------------------------------
+
+func TestE2E_Lists(t *testing.T) {
+	addr, cleanup := startServer(t)
+	defer cleanup()
+	c := dial(t, addr)
+	defer c.Close()
+
+	t.Run("push and range", func(t *testing.T) {
+		assertInteger(t, c.Do(t, "RPUSH", "jobs", "a", "b", "c"), 3)
+		assertInteger(t, c.Do(t, "LPUSH", "jobs", "z"), 4)
+		r := c.Do(t, "LRANGE", "jobs", "0", "-1")
+		assertArray(t, r, 4)
+		if len(r.Array) == 4 {
+			assertBulk(t, r.Array[0], "z")
+			assertBulk(t, r.Array[3], "c")
+		}
+		assertBulk(t, c.Do(t, "TYPE", "jobs"), "list")
+	})
+
+	t.Run("pop from both ends", func(t *testing.T) {
+		assertBulk(t, c.Do(t, "LPOP", "jobs"), "z")
+		assertBulk(t, c.Do(t, "RPOP", "jobs"), "c")
+		assertInteger(t, c.Do(t, "LLEN", "jobs"), 2)
+	})
+
+	t.Run("index and set", func(t *testing.T) {
+		assertString(t, c.Do(t, "LSET", "jobs", "-1", "B"), "OK")
+		assertBulk(t, c.Do(t, "LINDEX", "jobs", "1"), "B")
+		assertErrorContains(t, c.Do(t, "LSET", "jobs", "9", "x"), "index out of range")
+	})
+
+	t.Run("rem and trim", func(t *testing.T) {
+		c.Do(t, "RPUSH", "dups", "x", "y", "x", "z", "x")
+		assertInteger(t, c.Do(t, "LREM", "dups", "-2", "x"), 2)
+		assertString(t, c.Do(t, "LTRIM", "dups", "0", "1"), "OK")
+		assertArray(t, c.Do(t, "LRANGE", "dups", "0", "-1"), 2)
+	})
+
+	t.Run("empty list is removed", func(t *testing.T) {
+		c.Do(t, "RPUSH", "once", "v")
+		c.Do(t, "LPOP", "once")
+		assertString(t, c.Do(t, "TYPE", "once"), "none")
+	})
+
+	t.Run("wrong type", func(t *testing.T) {
+		c.Do(t, "SET", "str", "v")
+		assertErrorContains(t, c.Do(t, "LPUSH", "str", "a"), "WRONGTYPE")
+		assertErrorContains(t, c.Do(t, "LRANGE", "str", "0", "-1"), "WRONGTYPE")
+	})
+}
+
+func TestE2E_BlockingListPop(t *testing.T) {
+	addr, cleanup := startServer(t)
+	defer cleanup()
+	waiter := dial(t, addr)
+	defer waiter.Close()
+	pusher := dial(t, addr)
+	defer pusher.Close()
+
+	t.Run("times out", func(t *testing.T) {
+		assertNil(t, waiter.Do(t, "BLPOP", "empty", "0.05"))
+	})
+
+	t.Run("woken by push from another client", func(t *testing.T) {
+		done := make(chan resp.RESP)
+		go func() { done <- waiter.Do(t, "BLPOP", "queue", "1") }()
+
+		time.Sleep(50 * time.Millisecond)
+		assertInteger(t, pusher.Do(t, "RPUSH", "queue", "job"), 1)
+
+		r := <-done
+		assertArray(t, r, 2)
+		if len(r.Array) == 2 {
+			assertBulk(t, r.Array[0], "queue")
+			assertBulk(t, r.Array[1], "job")
+		}
+		assertInteger(t, pusher.Do(t, "LLEN", "queue"), 0)
+	})
+
+	t.Run("client gone before the push", func(t *testing.T) {
+		gone := dial(t, addr)
+		gone.conn.Write(resp.Command("BLPOP", "jobs", "0").Marshal())
+		time.Sleep(50 * time.Millisecond)
+		gone.Close()
+		time.Sleep(50 * time.Millisecond)
+
+		assertInteger(t, pusher.Do(t, "RPUSH", "jobs", "job"), 1)
+		assertInteger(t, pusher.Do(t, "LLEN", "jobs"), 1)
+	})
+
+	t.Run("XREAD BLOCK woken by XADD", func(t *testing.T) {
+		done := make(chan resp.RESP)
+		go func() { done <- waiter.Do(t, "XREAD", "BLOCK", "1000", "STREAMS", "events", "$") }()
+
+		time.Sleep(50 * time.Millisecond)
+		pusher.Do(t, "XADD", "events", "1-1", "a", "1")
+
+		assertArray(t, <-done, 1)
+	})
+}
+
+// ---------------------------------------------------------------------------
+// Hashes
+// ---------------------------------------------------------------------------
+
+func TestE2E_Hashes(t *testing.T) {
+	addr, cleanup := startServer(t)
+	defer cleanup()
+	c := dial(t, addr)
+	defer c.Close()
+
+	t.Run("set and get fields", func(t *testing.T) {
+		assertInteger(t, c.Do(t, "HSET", "user:1", "name", "ann", "visits", "1"), 2)
+		assertBulk(t, c.Do(t, "HGET", "user:1", "name"), "ann")
+		assertNil(t, c.Do(t, "HGET", "user:1", "missing"))
+		assertBulk(t, c.Do(t, "TYPE", "user:1"), "hash")
+	})
+
+	t.Run("counters", func(t *testing.T) {
+		assertInteger(t, c.Do(t, "HINCRBY", "user:1", "visits", "4"), 5)
+		assertBulk(t, c.Do(t, "HINCRBYFLOAT", "user:1", "score", "1.5"), "1.5")
+	})
+
+	t.Run("introspection", func(t *testing.T) {
+		assertInteger(t, c.Do(t, "HLEN", "user:1"), 3)
+		assertInteger(t, c.Do(t, "HEXISTS", "user:1", "score"), 1)
+		assertInteger(t, c.Do(t, "HSTRLEN", "user:1", "name"), 3)
+		assertArray(t, c.Do(t, "HGETALL", "user:1"), 6)
+		assertArray(t, c.Do(t, "HKEYS", "user:1"), 3)
+	})
+
+	t.Run("delete fields", func(t *testing.T) {
+		assertInteger(t, c.Do(t, "HDEL", "user:1", "name", "visits", "score"), 3)
+		assertString(t, c.Do(t, "TYPE", "user:1"), "none")
+	})
+
+	t.Run("wrong type", func(t *testing.T) {
+		c.Do(t, "SET", "plain", "v")
+		assertErrorContains(t, c.Do(t, "HGET", "plain", "f"), "WRONGTYPE")
+	})
+}
+
+func TestE2E_HashFieldExpiry(t *testing.T) {
+	addr, cleanup := startServer(t)
+	defer cleanup()
+	c := dial(t, addr)
+	defer c.Close()
+
+	c.Do(t, "HSET", "devices", "phone", "tok1", "laptop", "tok2")
+
+	r := c.Do(t, "HPEXPIRE", "devices", "50", "FIELDS", "1", "phone")
+	assertArray(t, r, 1)
+	if len(r.Array) == 1 {
+		assertInteger(t, r.Array[0], 1)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	assertNil(t, c.Do(t, "HGET", "devices", "phone"))
+	assertBulk(t, c.Do(t, "HGET", "devices", "laptop"), "tok2")
+	assertInteger(t, c.Do(t, "HLEN", "devices"), 1)
+}
+
+// ---------------------------------------------------------------------------
+// Sets
+// ---------------------------------------------------------------------------
+
+func TestE2E_Sets(t *testing.T) {
+	addr, cleanup := startServer(t)
+	defer cleanup()
+	c := dial(t, addr)
+	defer c.Close()
+
+	t.Run("add and query members", func(t *testing.T) {
+		assertInteger(t, c.Do(t, "SADD", "tags", "go", "redis", "go"), 2)
+		assertInteger(t, c.Do(t, "SCARD", "tags"), 2)
+		assertInteger(t, c.Do(t, "SISMEMBER", "tags", "go"), 1)
+		assertArray(t, c.Do(t, "SMEMBERS", "tags"), 2)
+		assertBulk(t, c.Do(t, "TYPE", "tags"), "set")
+	})
+
+	t.Run("random members", func(t *testing.T) {
+		assertArray(t, c.Do(t, "SRANDMEMBER", "tags", "5"), 2)
+		assertArray(t, c.Do(t, "SRANDMEMBER", "tags", "-5"), 5)
+	})
+
+	t.Run("move and pop", func(t *testing.T) {
+		assertInteger(t, c.Do(t, "SMOVE", "tags", "other", "go"), 1)
+		assertInteger(t, c.Do(t, "SISMEMBER", "other", "go"), 1)
+		assertBulk(t, c.Do(t, "SPOP", "tags"), "redis")
+		assertString(t, c.Do(t, "TYPE", "tags"), "none")
+	})
+
+	t.Run("algebra", func(t *testing.T) {
+		c.Do(t, "SADD", "s1", "a", "b", "c")
+		c.Do(t, "SADD", "s2", "b", "c", "d")
+		assertArray(t, c.Do(t, "SINTER", "s1", "s2"), 2)
+		assertArray(t, c.Do(t, "SUNION", "s1", "s2"), 4)
+		assertArray(t, c.Do(t, "SDIFF", "s1", "s2"), 1)
+		assertInteger(t, c.Do(t, "SINTERSTORE", "both", "s1", "s2"), 2)
+		assertInteger(t, c.Do(t, "SCARD", "both"), 2)
+		assertInteger(t, c.Do(t, "SINTERCARD", "2", "s1", "s2", "LIMIT", "1"), 1)
+	})
+
+	t.Run("wrong type", func(t *testing.T) {
+		c.Do(t, "SET", "plain", "v")
+		assertErrorContains(t, c.Do(t, "SADD", "plain", "x"), "WRONGTYPE")
+		assertErrorContains(t, c.Do(t, "SINTER", "s1", "plain"), "WRONGTYPE")
+	})
+}
+
+// ---------------------------------------------------------------------------
+// Sorted sets
+// ---------------------------------------------------------------------------
+
+func TestE2E_SortedSets(t *testing.T) {
+	addr, cleanup := startServer(t)
+	defer cleanup()
+	c := dial(t, addr)
+	defer c.Close()
+
+	t.Run("add and rank", func(t *testing.T) {
+		assertInteger(t, c.Do(t, "ZADD", "board", "10", "ann", "20", "bob", "15", "cat"), 3)
+		assertBulk(t, c.Do(t, "TYPE", "board"), "zset")
+		assertInteger(t, c.Do(t, "ZCARD", "board"), 3)
+		assertInteger(t, c.Do(t, "ZRANK", "board", "cat"), 1)
+		assertInteger(t, c.Do(t, "ZREVRANK", "board", "bob"), 0)
+		assertNil(t, c.Do(t, "ZRANK", "board", "nobody"))
+	})
+
+	t.Run("options", func(t *testing.T) {
+		assertInteger(t, c.Do(t, "ZADD", "board", "GT", "CH", "5", "ann", "25", "cat"), 1)
+		assertBulk(t, c.Do(t, "ZSCORE", "board", "cat"), "25")
+		assertBulk(t, c.Do(t, "ZADD", "board", "INCR", "0.5", "ann"), "10.5")
+		assertBulk(t, c.Do(t, "ZINCRBY", "board", "-1.5", "ann"), "9")
+	})
+
+	t.Run("remove", func(t *testing.T) {
+		assertInteger(t, c.Do(t, "ZREM", "board", "ann", "bob", "cat"), 3)
+		assertString(t, c.Do(t, "TYPE", "board"), "none")
+	})
+
+	t.Run("wrong type", func(t *testing.T) {
+		c.Do(t, "SET", "plain", "v")
+		assertErrorContains(t, c.Do(t, "ZADD", "plain", "1", "a"), "WRONGTYPE")
+	})
+}
+
+func TestE2E_SortedSetRanges(t *testing.T) {
+	addr, cleanup := startServer(t)
+	defer cleanup()
+	c := dial(t, addr)
+	defer c.Close()
+
+	c.Do(t, "ZADD", "board", "1", "a", "2.5", "b", "3", "c", "4", "d")
+
+	t.Run("by rank", func(t *testing.T) {
+		r := c.Do(t, "ZRANGE", "board", "0", "1", "WITHSCORES")
+		assertArray(t, r, 4)
+		if len(r.Array) == 4 {
+			assertBulk(t, r.Array[3], "2.5")
+		}
+		r = c.Do(t, "ZRANGE", "board", "0", "0", "REV")
+		assertArray(t, r, 1)
+		if len(r.Array) == 1 {
+			assertBulk(t, r.Array[0], "d")
+		}
+	})
+
+	t.Run("by score", func(t *testing.T) {
+		assertArray(t, c.Do(t, "ZRANGE", "board", "(1", "+inf", "BYSCORE"), 3)
+		assertArray(t, c.Do(t, "ZRANGE", "board", "+inf", "-inf", "BYSCORE", "REV", "LIMIT", "1", "2"), 2)
+		assertInteger(t, c.Do(t, "ZCOUNT", "board", "-inf", "(3"), 2)
+	})
+
+	t.Run("by lex", func(t *testing.T) {
+		c.Do(t, "ZADD", "names", "0", "alpha", "0", "beta", "0", "gamma")
+		assertArray(t, c.Do(t, "ZRANGE", "names", "[b", "+", "BYLEX"), 2)
+		assertInteger(t, c.Do(t, "ZLEXCOUNT", "names", "-", "(gamma"), 2)
+	})
+
+	t.Run("store and remove", func(t *testing.T) {
+		assertInteger(t, c.Do(t, "ZRANGESTORE", "top", "board", "0", "1", "REV"), 2)
+		assertInteger(t, c.Do(t, "ZREMRANGEBYSCORE", "board", "3", "+inf"), 2)
+		assertInteger(t, c.Do(t, "ZREMRANGEBYRANK", "board", "0", "-1"), 2)
+		assertString(t, c.Do(t, "TYPE", "board"), "none")
+	})
+}
+
+func TestE2E_SortedSetPopsAndAggregation(t *testing.T) {
+	addr, cleanup := startServer(t)
+	defer cleanup()
+	c := dial(t, addr)
+	defer c.Close()
+
+	t.Run("aggregation", func(t *testing.T) {
+		c.Do(t, "ZADD", "week1", "10", "ann", "5", "bob")
+		c.Do(t, "ZADD", "week2", "3", "ann", "8", "cat")
+		assertInteger(t, c.Do(t, "ZUNIONSTORE", "total", "2", "week1", "week2", "WEIGHTS", "1", "2"), 3)
+		assertBulk(t, c.Do(t, "ZSCORE", "total", "ann"), "16")
+		assertInteger(t, c.Do(t, "ZINTERSTORE", "both", "2", "week1", "week2", "AGGREGATE", "MIN"), 1)
+		assertBulk(t, c.Do(t, "ZSCORE", "both", "ann"), "3")
+		assertInteger(t, c.Do(t, "ZDIFFSTORE", "only1", "2", "week1", "week2"), 1)
+	})
+
+	t.Run("pops", func(t *testing.T) {
+		r := c.Do(t, "ZPOPMIN", "total")
+		assertArray(t, r, 2)
+		if len(r.Array) == 2 {
+			assertBulk(t, r.Array[0], "bob")
+		}
+		r = c.Do(t, "ZMPOP", "1", "total", "MAX")
+		assertArray(t, r, 2)
+		if len(r.Array) == 2 {
+			assertBulk(t, r.Array[0], "total")
+		}
+		assertArray(t, c.Do(t, "ZRANDMEMBER", "total", "-3"), 3)
+	})
+
+	t.Run("blocking pop", func(t *testing.T) {
+		waiter := dial(t, addr)
+		defer waiter.Close()
+
+		done := make(chan resp.RESP)
+		go func() { done <- waiter.Do(t, "BZPOPMIN", "jobs", "1") }()
+
+		time.Sleep(50 * time.Millisecond)
+		assertInteger(t, c.Do(t, "ZADD", "jobs", "1", "task"), 1)
+
+		r := <-done
+		assertArray(t, r, 3)
+		if len(r.Array) == 3 {
+			assertBulk(t, r.Array[1], "task")
+			assertBulk(t, r.Array[2], "1")
+		}
+	})
+}